@@ -4,17 +4,20 @@ import (
 	"context"
 	"io"
 	"log/slog"
+	"net/url"
 	"strings"
 	"time"
 
 	"github.com/gin-gonic/gin"
+
+	"github.com/tariel-x/gocall/internal/config"
 )
 
-func slogGinLogger(logger *slog.Logger) gin.HandlerFunc {
+func slogGinLogger(logger *slog.Logger, cfg *config.Config) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		start := time.Now()
 		path := c.Request.URL.Path
-		rawQuery := c.Request.URL.RawQuery
+		query := redactQuery(c.Request.URL.RawQuery)
 
 		c.Next()
 
@@ -29,8 +32,8 @@ func slogGinLogger(logger *slog.Logger) gin.HandlerFunc {
 			"status", status,
 			"method", c.Request.Method,
 			"path", path,
-			"query", rawQuery,
-			"ip", c.ClientIP(),
+			"query", query,
+			"ip", cfg.ClientIPForLog(c.ClientIP()),
 			"user_agent", c.Request.UserAgent(),
 			"latency_ms", latency.Milliseconds(),
 		}
@@ -46,6 +49,27 @@ func slogGinLogger(logger *slog.Logger) gin.HandlerFunc {
 	}
 }
 
+// redactedQueryParams identify a peer well enough to take over its seat.
+var redactedQueryParams = []string{"reconnect_token", "peer_id"}
+
+// redactQuery returns rawQuery with the values of redactedQueryParams
+// replaced. A query that doesn't parse isn't logged at all.
+func redactQuery(rawQuery string) string {
+	if rawQuery == "" {
+		return ""
+	}
+	values, err := url.ParseQuery(rawQuery)
+	if err != nil {
+		return ""
+	}
+	for _, key := range redactedQueryParams {
+		if _, ok := values[key]; ok {
+			values.Set(key, "REDACTED")
+		}
+	}
+	return values.Encode()
+}
+
 // newTLSErrorWriter wires net/http server errors (including TLS handshake errors)
 // into slog JSON. Some noisy unauthorized-host handshake errors are suppressed.
 func newTLSErrorWriter(logger *slog.Logger) io.Writer {
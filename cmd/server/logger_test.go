@@ -0,0 +1,18 @@
+package main
+
+import "testing"
+
+func TestRedactQuery(t *testing.T) {
+	cases := map[string]string{
+		"":                                   "",
+		"call_id=abc":                        "call_id=abc",
+		"call_id=abc&reconnect_token=secret": "call_id=abc&reconnect_token=REDACTED",
+		"peer_id=p1&role=guest":              "peer_id=REDACTED&role=guest",
+		"peer_id=%zz":                        "",
+	}
+	for raw, want := range cases {
+		if got := redactQuery(raw); got != want {
+			t.Errorf("redactQuery(%q) = %q, want %q", raw, got, want)
+		}
+	}
+}
@@ -19,19 +19,27 @@ import (
 	"net"
 	"net/http"
 	"os"
+	"os/signal"
 	"path/filepath"
+	"slices"
 	"strings"
+	"sync"
+	"syscall"
 	"time"
 
 	"github.com/gorilla/websocket"
+	"github.com/redis/go-redis/v9"
 
+	"github.com/tariel-x/gocall/internal/analytics"
 	"github.com/tariel-x/gocall/internal/config"
 	"github.com/tariel-x/gocall/internal/handlers"
 	"github.com/tariel-x/gocall/internal/static"
 	"github.com/tariel-x/gocall/internal/turn"
 
 	"github.com/gin-gonic/gin"
+	"github.com/quic-go/quic-go/http3"
 	"golang.org/x/crypto/acme/autocert"
+	"golang.org/x/net/netutil"
 )
 
 const AppVersion = "1.0.0"
@@ -43,10 +51,19 @@ func main() {
 	// Parse command-line flags
 	httpOnly := flag.Bool("http-only", false, "Run in backend-only mode (disable SSL/LE, use HTTP)")
 	selfSigned := flag.Bool("self-signed", false, "Enable HTTPS using a generated self-signed certificate (explicitly, no localhost auto-detect)")
+	selfSignedDays := flag.Int("self-signed-days", defaultSelfSignedDays, "Validity of the generated self-signed certificate in days")
 	flag.Parse()
 
-	cfg := config.Load(httpOnly)
+	startedAt := time.Now()
 	logger := slog.New(slog.NewJSONHandler(os.Stdout, nil))
+	cfg, err := config.Load(httpOnly)
+	if err != nil {
+		logger.Error("invalid configuration", "error", err)
+		return
+	}
+	if cfg.InstanceID != "" {
+		logger = logger.With("instance", cfg.InstanceID)
+	}
 
 	// Log version and build info
 	logger.Info(fmt.Sprintf("Gocall Server v%s (build: %d)", AppVersion, buildTimestamp))
@@ -58,37 +75,199 @@ func main() {
 			return
 		}
 	}
+	var selfSignedCert *selfSignedCertificate
+	if *selfSigned {
+		if *selfSignedDays < 1 || *selfSignedDays > maxSelfSignedDays {
+			logger.Error(fmt.Sprintf("Error: --self-signed-days must be between 1 and %d", maxSelfSignedDays))
+			return
+		}
+		hosts := []string{"localhost"}
+		if cfg.Domain != "" {
+			hosts = []string{cfg.Domain}
+		}
+		selfSignedCert = newSelfSignedCertificate(hosts, time.Duration(*selfSignedDays)*24*time.Hour)
+	}
 
-	// Initialize TURN server
-	turnServer, err := turn.Initialize(cfg.TURNPort, cfg.TURNRealm, logger)
-	if err != nil {
-		logger.Error("failed to initialize TURN server", "error", err)
-		return
+	// The TURNS listener starts before the HTTPS server has its certificate,
+	// so it reads it through certs once startServer fills it in.
+	certs := &certificateSource{}
+
+	// Initialize TURN server, unless external ICE servers replace it
+	var turnServer *turn.TURNServer
+	if cfg.BuiltinTURNEnabled() {
+		if cfg.DisableBuiltinTURN {
+			logger.Warn("DISABLE_BUILTIN_TURN ignored: no EXTERNAL_ICE_SERVERS configured")
+		}
+		if cfg.TURNTLSPort > 0 {
+			if err := configureTURNCertificate(cfg, certs); err != nil {
+				logger.Error("failed to configure TURNS certificate", "error", err)
+				return
+			}
+		}
+
+		turnServer, err = turn.Initialize(turn.Config{
+			Port:               cfg.TURNPort,
+			Realm:              cfg.TURNRealm,
+			ListenAddress:      cfg.TURNListenAddress,
+			TCPEnabled:         cfg.TURNTCPEnabled,
+			TLSPort:            cfg.TURNTLSPort,
+			GetCertificate:     certs.GetCertificate,
+			PublicIP:           net.ParseIP(cfg.TURNPublicIP),
+			PublicIPTimeout:    cfg.TURNPublicIPTimeout,
+			IPv6:               cfg.TURNIPv6,
+			PublicIPv6:         net.ParseIP(cfg.TURNPublicIPv6),
+			PublicIPCacheTTL:   cfg.TURNPublicIPCacheTTL,
+			TrustPublicIPCache: cfg.TURNPublicIPCacheTrust,
+			AuthCacheSize:      cfg.TURNAuthCacheSize,
+			AuthCacheTTL:       cfg.TURNAuthCacheTTL,
+			ClockSkew:          cfg.ClockSkewTolerance,
+		}, logger)
+		if err != nil {
+			logger.Error("failed to initialize TURN server", "error", err)
+			return
+		}
+		defer turnServer.Close()
+
+		logger.Info(fmt.Sprintf("TURN server started at port %d", cfg.TURNPort))
+	} else {
+		logger.Info(fmt.Sprintf("Built-in TURN server disabled, using %d external ICE servers", len(cfg.ExternalICEServers)))
+	}
+
+	// With REDIS_URL set, call state and WS routing are shared between
+	// instances; otherwise everything stays in this process, optionally
+	// backed by a SQLite file.
+	var calls handlers.Store
+	storeOpts := handlers.CallStoreOptions{
+		TTL:             cfg.CallTTL,
+		CleanupInterval: cfg.CallCleanupInterval,
+		TombstoneTTL:    cfg.CallEndedRetention,
+		MaxCalls:        cfg.MaxConcurrentCalls,
+	}
+	wsHub := handlers.NewWSHubV2()
+	if cfg.RedisURL != "" {
+		client, err := connectRedis(cfg.RedisURL)
+		if err != nil {
+			logger.Error("failed to connect to redis", "error", err)
+			return
+		}
+		defer client.Close()
+
+		bus := handlers.NewRedisBus(client, cfg.RedisKeyPrefix, logger)
+		defer bus.Close()
+		if err := wsHub.SetBus(bus); err != nil {
+			logger.Error("failed to enable cross-instance signaling", "error", err)
+			return
+		}
+		calls = handlers.NewRedisCallStore(client, cfg.RedisKeyPrefix, storeOpts)
+	} else if cfg.CallStoreBackend == config.CallStoreSQLite {
+		store, err := handlers.NewSQLiteCallStore(cfg.CallStoreSQLitePath, storeOpts)
+		if err != nil {
+			logger.Error("failed to open call database", "path", cfg.CallStoreSQLitePath, "error", err)
+			return
+		}
+		defer store.Close()
+		calls = store
+	} else {
+		calls = handlers.NewCallStoreWithOptions(storeOpts)
 	}
-	defer turnServer.Close()
 
-	logger.Info(fmt.Sprintf("TURN server started at port %d", cfg.TURNPort))
+	var statsBaseline handlers.CallStoreStats
+	if cfg.AnalyticsFile != "" {
+		// Redis and SQLite keep their counters across restarts; the
+		// in-memory store picks its lifetime figures up from the log.
+		if cfg.RedisURL == "" && cfg.CallStoreBackend == config.CallStoreMemory {
+			totals, err := analytics.ReadTotals(cfg.AnalyticsFile, cfg.AnalyticsMaxFiles)
+			if err != nil {
+				logger.Warn("failed to read analytics totals, lifetime counters start at zero", "error", err)
+			}
+			statsBaseline = handlers.CallStoreStats{Created: totals.Created, Ended: totals.Ended}
+		}
+
+		events, err := analytics.NewWriter(cfg.AnalyticsFile, cfg.AnalyticsMaxBytes, cfg.AnalyticsMaxFiles, logger)
+		if err != nil {
+			logger.Error("failed to open analytics file", "error", err)
+			return
+		}
+		defer events.Close()
+		calls.SetEventSink(events)
+	}
 
 	// Api routes
 	h := handlers.New(
 		cfg,
 		turnServer,
-		handlers.NewCallStore(),
-		handlers.NewWSHubV2(),
+		calls,
+		wsHub,
 		websocket.Upgrader{
-			ReadBufferSize:  1024,
-			WriteBufferSize: 1024,
-			CheckOrigin: func(r *http.Request) bool {
-				return true
-			},
+			ReadBufferSize:    1024,
+			WriteBufferSize:   1024,
+			CheckOrigin:       handlers.CheckWSOrigin(cfg.AllowedWSOrigins),
+			EnableCompression: cfg.WS.Compression,
 		},
+		logger,
 	)
+	h.SetStatsBaseline(statsBaseline)
+
+	if cfg.CallStatsExportAddr != "" {
+		exporter, err := analytics.NewUDPExporter(cfg.CallStatsExportAddr, cfg.CallStatsExportInterval, logger)
+		if err != nil {
+			logger.Error("failed to set up call stats export", "error", err)
+			return
+		}
+		defer exporter.Close()
+		h.SetCallStatsExporter(exporter)
+	}
 
 	// Setup router
 	router := setupRouter(h, cfg, logger)
 
-	// Setup server (HTTPS and/or HTTP)
-	startServer(router, cfg, *selfSigned, logger)
+	// Setup server (HTTPS and/or HTTP) and serve until SIGINT/SIGTERM
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	clean := false
+	defer func() {
+		logSessionSummary(logger, startedAt, calls, wsHub, clean)
+	}()
+	clean = startServer(ctx, router, cfg, selfSignedCert, certs, logger) == nil
+
+	// HTTP is down; tell WS clients before the deferred closes (TURN, Redis,
+	// analytics) run.
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+	if err := wsHub.Shutdown(shutdownCtx); err != nil {
+		logger.Warn("WebSocket clients did not disconnect in time", "error", err)
+	}
+	logger.Info("Server stopped")
+}
+
+func connectRedis(url string) (*redis.Client, error) {
+	opts, err := redis.ParseURL(url)
+	if err != nil {
+		return nil, fmt.Errorf("invalid REDIS_URL: %w", err)
+	}
+	client := redis.NewClient(opts)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := client.Ping(ctx).Err(); err != nil {
+		client.Close()
+		return nil, err
+	}
+	return client, nil
+}
+
+// logSessionSummary emits a single post-mortem entry describing this server run.
+func logSessionSummary(logger *slog.Logger, startedAt time.Time, calls handlers.Store, wsHub *handlers.WSHubV2, clean bool) {
+	stats := calls.Stats()
+	logger.Info("session summary",
+		"uptime", time.Since(startedAt).Round(time.Second).String(),
+		"calls_created", stats.Created,
+		"calls_ended", stats.Ended,
+		"peak_concurrent_calls", stats.PeakConcurrent,
+		"peak_connections", wsHub.PeakConnections(),
+		"clean_shutdown", clean,
+	)
 }
 
 func setupRouter(h *handlers.Handlers, cfg *config.Config, logger *slog.Logger) *gin.Engine {
@@ -97,9 +276,22 @@ func setupRouter(h *handlers.Handlers, cfg *config.Config, logger *slog.Logger)
 	}
 
 	router := gin.New()
+	if len(cfg.TrustedProxies) > 0 {
+		// Only these proxies' X-Forwarded-For headers set c.ClientIP();
+		// config.Load has already validated the list.
+		_ = router.SetTrustedProxies(cfg.TrustedProxies)
+	}
 	router.Use(gin.Recovery())
 	if logger != nil {
-		router.Use(slogGinLogger(logger))
+		router.Use(slogGinLogger(logger, cfg))
+	}
+
+	if cfg.InstanceID != "" {
+		// Call state is per instance; this shows which one served the request.
+		router.Use(func(c *gin.Context) {
+			c.Header("X-Gocall-Instance", cfg.InstanceID)
+			c.Next()
+		})
 	}
 
 	// CORS middleware (for web app)
@@ -113,6 +305,7 @@ func setupRouter(h *handlers.Handlers, cfg *config.Config, logger *slog.Logger)
 		c.Writer.Header().Set("Access-Control-Allow-Credentials", "true")
 		c.Writer.Header().Set("Access-Control-Allow-Headers", "Content-Type, Content-Length, Accept-Encoding, X-CSRF-Token, Authorization, accept, origin, Cache-Control, X-Requested-With")
 		c.Writer.Header().Set("Access-Control-Allow-Methods", "POST, OPTIONS, GET, PUT, DELETE")
+		c.Writer.Header().Set("Access-Control-Expose-Headers", "X-Gocall-Instance")
 
 		if c.Request.Method == "OPTIONS" {
 			c.AbortWithStatus(204)
@@ -122,41 +315,74 @@ func setupRouter(h *handlers.Handlers, cfg *config.Config, logger *slog.Logger)
 		c.Next()
 	})
 
+	// Probes for load balancers and orchestrators
+	router.GET("/healthz", h.Healthz)
+	router.GET("/readyz", h.Readyz)
+	router.GET("/metrics", h.RequireAdmin, h.GetMetrics)
+
 	// Public routes
 	api := router.Group("/api")
 	{
 		api.GET("/turn-config", h.GetTURNConfig)
+		api.GET("/status", h.GetStatus)
+		api.GET("/capabilities", h.GetCapabilities)
 		api.POST("/calls", h.CreateCall)
 		api.GET("/calls/:call_id", h.GetCall)
 		api.POST("/calls/:call_id/join", h.JoinCall)
 		api.POST("/calls/:call_id/leave", h.LeaveCall)
+		api.POST("/calls/:call_id/admit", h.AdmitPeer)
+		api.POST("/calls/:call_id/reject", h.RejectPeer)
 		api.GET("/ws", h.HandleWebSocket)
+		api.POST("/client-log", h.ReportClientLog)
 	}
 
-	// New React UI routes under /newui
-	static.RegisterNewUIRoutes(router, cfg)
+	// Operator routes
+	admin := router.Group("/api", h.RequireAdmin)
+	{
+		admin.GET("/turn-stats", h.GetTURNStats)
+		admin.GET("/ws-stats", h.GetWSStats)
+		admin.GET("/maintenance", h.GetMaintenance)
+		admin.PUT("/maintenance", h.PutMaintenance)
+		admin.GET("/admin/calls", h.ListCalls)
+		admin.DELETE("/admin/calls/:call_id", h.TerminateCall)
+	}
+
+	if cfg.DisableEmbeddedUI {
+		// API-only deployment: the frontend is hosted elsewhere.
+		router.NoRoute(func(c *gin.Context) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "not found"})
+		})
+	} else {
+		static.RegisterNewUIRoutes(router, cfg)
+	}
 
 	return router
 }
 
-func startServer(router *gin.Engine, cfg *config.Config, selfSigned bool, logger *slog.Logger) {
+// startServer serves the router until ctx is cancelled, then shuts the HTTP
+// servers down gracefully.
+func startServer(ctx context.Context, router *gin.Engine, cfg *config.Config, selfSigned *selfSignedCertificate, certs *certificateSource, logger *slog.Logger) error {
 	// http-only mode: simple HTTP server
 	if cfg.HTTPOnly {
-		startHTTP(router, cfg, logger)
-		return
+		return startHTTP(ctx, router, cfg, logger)
 	}
 
-	if selfSigned {
-		startSelfSignedHTTPS(router, cfg, logger)
-		return
+	if selfSigned != nil {
+		return startSelfSignedHTTPS(ctx, router, cfg, selfSigned, certs, logger)
 	}
 
 	// Normal mode: HTTPS with Let's Encrypt
+	schedule, err := newCertRenewalSchedule(cfg)
+	if err != nil {
+		logger.Error("Invalid certificate renewal settings", "error", err)
+		return err
+	}
+
 	// Get certs directory
 	certsDir := getCertsDirectory()
 	if err := os.MkdirAll(certsDir, 0700); err != nil {
 		logger.Error("Failed to create certs directory", "error", err)
-		return
+		return err
 	}
 
 	// Normalize domain (remove www. prefix if present, convert to lowercase)
@@ -176,6 +402,7 @@ func startServer(router *gin.Engine, cfg *config.Config, selfSigned bool, logger
 		},
 		Cache: autocert.DirCache(certsDir),
 	}
+	certs.setDefault(m.GetCertificate)
 
 	// Create HTTP handler that redirects to HTTPS, but allows ACME challenges
 	// Use autocert's HTTP handler for ACME challenges, then redirect everything else
@@ -219,6 +446,7 @@ func startServer(router *gin.Engine, cfg *config.Config, selfSigned bool, logger
 		IdleTimeout:  60 * time.Second,
 		ErrorLog:     errorLog,
 	}
+	configureHTTPProtocols(httpsServer, cfg, logger)
 
 	// Start HTTP server in goroutine (for Let's Encrypt challenge and redirects)
 	go func() {
@@ -230,7 +458,7 @@ func startServer(router *gin.Engine, cfg *config.Config, selfSigned bool, logger
 	}()
 
 	// Start certificate renewal goroutine
-	go startCertificateRenewal(m, normalizedDomain, logger)
+	go startCertificateRenewal(m, normalizedDomain, schedule, logger)
 
 	// Start HTTPS server
 	logger.Info(fmt.Sprintf("HTTPS server starting on port %s for domain: %s", cfg.HTTPSPort, normalizedDomain))
@@ -240,13 +468,14 @@ func startServer(router *gin.Engine, cfg *config.Config, selfSigned bool, logger
 		logger.Warn("Let's Encrypt will not work for localhost. Use --self-signed for local development.")
 	}
 
-	if err := httpsServer.ListenAndServeTLS("", ""); err != nil && !errors.Is(err, http.ErrServerClosed) {
+	if err := serveUntilDone(ctx, func() error { return serveLimited(httpsServer, cfg, true) }, logger, httpsServer, httpServer); err != nil {
 		logger.Error("Failed to start HTTPS server", "error", err)
-		return
+		return err
 	}
+	return nil
 }
 
-func startHTTP(router *gin.Engine, cfg *config.Config, logger *slog.Logger) {
+func startHTTP(ctx context.Context, router *gin.Engine, cfg *config.Config, logger *slog.Logger) error {
 	httpServer := &http.Server{
 		Addr:         ":" + cfg.HTTPPort,
 		Handler:      router,
@@ -260,34 +489,26 @@ func startHTTP(router *gin.Engine, cfg *config.Config, logger *slog.Logger) {
 	logger.Info(fmt.Sprintf("Frontend URI: %s", cfg.FrontendURI))
 	logger.Info(fmt.Sprintf("API calls will use: %s/api", cfg.FrontendURI))
 
-	if err := httpServer.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+	if err := serveUntilDone(ctx, func() error { return serveLimited(httpServer, cfg, false) }, logger, httpServer); err != nil {
 		logger.Error("Failed to start HTTP server", "error", err)
+		return err
 	}
+	return nil
 }
 
-func startSelfSignedHTTPS(router *gin.Engine, cfg *config.Config, logger *slog.Logger) {
-	logger.Info("Self-signed TLS enabled - generating self-signed certificate")
+func startSelfSignedHTTPS(ctx context.Context, router *gin.Engine, cfg *config.Config, selfSigned *selfSignedCertificate, certs *certificateSource, logger *slog.Logger) error {
+	logger.Info("Self-signed TLS enabled - generating self-signed certificate", "validity", selfSigned.validity.String())
 
-	hosts := []string{"localhost"}
-	if cfg.Domain != "" {
-		hosts = []string{cfg.Domain}
-	}
-	certPEM, keyPEM, err := generateSelfSignedCert(hosts)
-	if err != nil {
+	if _, err := selfSigned.get(time.Now()); err != nil {
 		logger.Error("Failed to generate self-signed certificate", "error", err)
-		return
-	}
-
-	cert, err := tls.X509KeyPair(certPEM, keyPEM)
-	if err != nil {
-		logger.Error("Failed to load self-signed certificate", "error", err)
-		return
+		return err
 	}
 
 	tlsConfig := &tls.Config{
-		Certificates: []tls.Certificate{cert},
-		MinVersion:   tls.VersionTLS12,
+		GetCertificate: selfSigned.GetCertificate,
+		MinVersion:     tls.VersionTLS12,
 	}
+	certs.setDefault(selfSigned.GetCertificate)
 
 	httpsServer := &http.Server{
 		Addr:         ":" + cfg.HTTPSPort,
@@ -298,27 +519,28 @@ func startSelfSignedHTTPS(router *gin.Engine, cfg *config.Config, logger *slog.L
 		IdleTimeout:  60 * time.Second,
 		ErrorLog:     log.New(newTLSErrorWriter(logger), "", 0),
 	}
+	configureHTTPProtocols(httpsServer, cfg, logger)
 
 	// Start HTTP redirect server
-	go func() {
-		redirectHandler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-			host := r.Host
-			if idx := strings.Index(host, ":"); idx != -1 {
-				host = host[:idx]
-			}
-			target := "https://" + host + ":" + cfg.HTTPSPort + r.URL.Path
-			if r.URL.RawQuery != "" {
-				target += "?" + r.URL.RawQuery
-			}
-			http.Redirect(w, r, target, http.StatusMovedPermanently)
-		})
-		httpServer := &http.Server{
-			Addr:     ":" + cfg.HTTPPort,
-			Handler:  redirectHandler,
-			ErrorLog: log.New(newTLSErrorWriter(logger), "", 0),
+	redirectHandler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		host := r.Host
+		if idx := strings.Index(host, ":"); idx != -1 {
+			host = host[:idx]
+		}
+		target := "https://" + host + ":" + cfg.HTTPSPort + r.URL.Path
+		if r.URL.RawQuery != "" {
+			target += "?" + r.URL.RawQuery
 		}
+		http.Redirect(w, r, target, http.StatusMovedPermanently)
+	})
+	httpServer := &http.Server{
+		Addr:     ":" + cfg.HTTPPort,
+		Handler:  redirectHandler,
+		ErrorLog: log.New(newTLSErrorWriter(logger), "", 0),
+	}
+	go func() {
 		logger.Info(fmt.Sprintf("HTTP redirect server starting on port %s", cfg.HTTPPort))
-		if err := httpServer.ListenAndServe(); err != nil {
+		if err := httpServer.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
 			logger.Error("HTTP redirect server error", "error", err)
 		}
 	}()
@@ -330,30 +552,160 @@ func startSelfSignedHTTPS(router *gin.Engine, cfg *config.Config, logger *slog.L
 	logger.Info(fmt.Sprintf("HTTPS server (self-signed) starting on port %s", cfg.HTTPSPort))
 	logger.Info(fmt.Sprintf("Access at: https://%s:%s", hostForLog, cfg.HTTPSPort))
 
-	if err := httpsServer.ListenAndServeTLS("", ""); err != nil && !errors.Is(err, http.ErrServerClosed) {
+	if err := serveUntilDone(ctx, func() error { return serveLimited(httpsServer, cfg, true) }, logger, httpsServer, httpServer); err != nil {
 		logger.Error("Failed to start HTTPS server", "error", err)
+		return err
+	}
+	return nil
+}
+
+// shutdownTimeout bounds how long in-flight requests may take to finish on
+// shutdown.
+const shutdownTimeout = 10 * time.Second
+
+// serveUntilDone runs serve until it fails or ctx is cancelled. On
+// cancellation every server in servers is shut down gracefully: listeners
+// close at once and in-flight requests get shutdownTimeout to finish.
+// Hijacked WebSocket connections are not covered; the hub closes those.
+func serveUntilDone(ctx context.Context, serve func() error, logger *slog.Logger, servers ...*http.Server) error {
+	errCh := make(chan error, 1)
+	go func() {
+		errCh <- serve()
+	}()
+
+	select {
+	case err := <-errCh:
+		if errors.Is(err, http.ErrServerClosed) {
+			return nil
+		}
+		return err
+	case <-ctx.Done():
+	}
+
+	logger.Info("Shutting down HTTP servers")
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+	for _, srv := range servers {
+		if err := srv.Shutdown(shutdownCtx); err != nil {
+			logger.Warn("HTTP server did not shut down cleanly", "addr", srv.Addr, "error", err)
+		}
 	}
+	if err := <-errCh; err != nil && !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	return nil
 }
 
-// startCertificateRenewal runs a background goroutine that checks and renews certificates monthly
-func startCertificateRenewal(m *autocert.Manager, domain string, logger *slog.Logger) {
+// serveLimited serves srv on a TCP listener capped at cfg.MaxConnections
+// concurrent connections. Upgraded WebSocket connections keep their slot for
+// their whole lifetime, so the limit must leave room for two per active call.
+// Slow clients are bounded by the server's ReadTimeout, which also covers
+// reading request headers.
+func serveLimited(srv *http.Server, cfg *config.Config, useTLS bool) error {
+	ln, err := net.Listen("tcp", srv.Addr)
+	if err != nil {
+		return err
+	}
+	if cfg.MaxConnections > 0 {
+		ln = netutil.LimitListener(ln, cfg.MaxConnections)
+	}
+	if useTLS {
+		return srv.ServeTLS(ln, "", "")
+	}
+	return srv.Serve(ln)
+}
+
+// configureHTTPProtocols applies the HTTP/2 and HTTP/3 toggles to an HTTPS server.
+// HTTP/3 runs on the same port over UDP and is advertised through Alt-Svc.
+func configureHTTPProtocols(srv *http.Server, cfg *config.Config, logger *slog.Logger) {
+	if cfg.DisableHTTP2 {
+		// A non-nil empty map disables the automatic HTTP/2 upgrade. Also stop
+		// offering h2 via ALPN (autocert advertises it by default).
+		srv.TLSNextProto = map[string]func(*http.Server, *tls.Conn, http.Handler){}
+		if srv.TLSConfig != nil {
+			srv.TLSConfig = srv.TLSConfig.Clone()
+			srv.TLSConfig.NextProtos = slices.DeleteFunc(slices.Clone(srv.TLSConfig.NextProtos), func(p string) bool {
+				return p == "h2"
+			})
+		}
+		logger.Info("HTTP/2 disabled")
+	}
+
+	if !cfg.EnableHTTP3 {
+		return
+	}
+
+	h3Server := &http3.Server{
+		Addr:      srv.Addr,
+		Handler:   srv.Handler,
+		TLSConfig: http3.ConfigureTLSConfig(srv.TLSConfig),
+		Logger:    logger,
+	}
+
+	next := srv.Handler
+	srv.Handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_ = h3Server.SetQUICHeaders(w.Header())
+		next.ServeHTTP(w, r)
+	})
+
+	srv.RegisterOnShutdown(func() {
+		_ = h3Server.Close()
+	})
+
+	go func() {
+		logger.Info(fmt.Sprintf("HTTP/3 server starting on UDP port %s", cfg.HTTPSPort))
+		if err := h3Server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			logger.Error("HTTP/3 server error", "error", err)
+		}
+	}()
+}
+
+// letsEncryptCertValidity is the lifetime of certificates issued by Let's Encrypt.
+const letsEncryptCertValidity = 90 * 24 * time.Hour
+
+// certRenewalSchedule controls how often the proactive certificate check runs.
+type certRenewalSchedule struct {
+	InitialDelay time.Duration
+	Interval     time.Duration
+	RenewBefore  time.Duration
+}
+
+func newCertRenewalSchedule(cfg *config.Config) (certRenewalSchedule, error) {
+	schedule := certRenewalSchedule{
+		InitialDelay: cfg.CertCheckDelay,
+		Interval:     cfg.CertCheckInterval,
+		RenewBefore:  cfg.CertRenewBefore,
+	}
+	if schedule.InitialDelay < 0 {
+		return schedule, fmt.Errorf("initial delay must not be negative, got %s", schedule.InitialDelay)
+	}
+	if schedule.Interval < time.Minute {
+		return schedule, fmt.Errorf("check interval must be at least 1m, got %s", schedule.Interval)
+	}
+	if schedule.RenewBefore <= 0 || schedule.RenewBefore >= letsEncryptCertValidity {
+		return schedule, fmt.Errorf("renewal threshold must be between 0 and %s, got %s", letsEncryptCertValidity, schedule.RenewBefore)
+	}
+	return schedule, nil
+}
+
+// startCertificateRenewal runs a background goroutine that periodically checks and renews certificates
+func startCertificateRenewal(m *autocert.Manager, domain string, schedule certRenewalSchedule, logger *slog.Logger) {
 	// Wait a bit for initial certificate to be obtained
-	time.Sleep(30 * time.Second)
+	time.Sleep(schedule.InitialDelay)
 
-	// Run renewal check every month (30 days)
-	ticker := time.NewTicker(30 * 24 * time.Hour)
+	ticker := time.NewTicker(schedule.Interval)
 	defer ticker.Stop()
 
-	// Run immediately on startup, then every month
-	checkAndRenewCertificate(m, domain, logger)
+	// Run immediately on startup, then on every tick
+	checkAndRenewCertificate(m, domain, schedule.RenewBefore, logger)
 
 	for range ticker.C {
-		checkAndRenewCertificate(m, domain, logger)
+		checkAndRenewCertificate(m, domain, schedule.RenewBefore, logger)
 	}
 }
 
 // checkAndRenewCertificate checks if certificate needs renewal and triggers renewal if needed
-func checkAndRenewCertificate(m *autocert.Manager, domain string, logger *slog.Logger) {
+func checkAndRenewCertificate(m *autocert.Manager, domain string, renewBefore time.Duration, logger *slog.Logger) {
 	logger.Info(fmt.Sprintf("[CERT] Checking certificate expiration for domain: %s", domain))
 
 	// Get certificate from cache
@@ -391,14 +743,14 @@ func checkAndRenewCertificate(m *autocert.Manager, domain string, logger *slog.L
 		return
 	}
 
-	// Check if certificate expires within 30 days
+	// Check if certificate expires within the renewal threshold
 	now := time.Now()
 	expiresIn := x509Cert.NotAfter.Sub(now)
 	daysUntilExpiry := int(expiresIn.Hours() / 24)
 
 	logger.Info(fmt.Sprintf("[CERT] Certificate expires in %d days (expires: %s)", daysUntilExpiry, x509Cert.NotAfter.Format("2006-01-02")))
 
-	if daysUntilExpiry < 30 {
+	if expiresIn < renewBefore {
 		logger.Info(fmt.Sprintf("[CERT] Certificate expires soon (%d days), triggering renewal...", daysUntilExpiry))
 		// Create a dummy request to trigger certificate renewal
 		// The autocert manager will handle the renewal automatically
@@ -437,8 +789,101 @@ func normalizeDomain(domain string) string {
 	return domain
 }
 
-// generateSelfSignedCert creates a self-signed certificate for localhost
-func generateSelfSignedCert(hosts []string) (certPEM, keyPEM []byte, err error) {
+// certificateSource serves the TURNS certificate: an explicit cert/key pair,
+// or whatever the HTTPS server ends up using.
+type certificateSource struct {
+	mu    sync.RWMutex
+	fixed bool
+	get   func(*tls.ClientHelloInfo) (*tls.Certificate, error)
+}
+
+func configureTURNCertificate(cfg *config.Config, certs *certificateSource) error {
+	if cfg.TURNTLSCertFile == "" && cfg.TURNTLSKeyFile == "" {
+		if cfg.HTTPOnly {
+			return errors.New("TURN_TLS_CERT_FILE and TURN_TLS_KEY_FILE are required with --http-only")
+		}
+		return nil
+	}
+
+	cert, err := tls.LoadX509KeyPair(cfg.TURNTLSCertFile, cfg.TURNTLSKeyFile)
+	if err != nil {
+		return err
+	}
+	certs.mu.Lock()
+	defer certs.mu.Unlock()
+	certs.fixed = true
+	certs.get = func(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+		return &cert, nil
+	}
+	return nil
+}
+
+// setDefault shares the HTTPS certificate unless a fixed one is configured.
+func (s *certificateSource) setDefault(get func(*tls.ClientHelloInfo) (*tls.Certificate, error)) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !s.fixed {
+		s.get = get
+	}
+}
+
+func (s *certificateSource) GetCertificate(hello *tls.ClientHelloInfo) (*tls.Certificate, error) {
+	s.mu.RLock()
+	get := s.get
+	s.mu.RUnlock()
+	if get == nil {
+		return nil, errors.New("certificate not available yet")
+	}
+	return get(hello)
+}
+
+const (
+	defaultSelfSignedDays = 365
+	maxSelfSignedDays     = 3650
+)
+
+// selfSignedCertificate serves a generated certificate and replaces it once
+// less than a tenth of its validity is left, so a long-running server with a
+// short --self-signed-days never serves an expired one.
+type selfSignedCertificate struct {
+	hosts    []string
+	validity time.Duration
+
+	mu   sync.Mutex
+	cert *tls.Certificate
+}
+
+func newSelfSignedCertificate(hosts []string, validity time.Duration) *selfSignedCertificate {
+	return &selfSignedCertificate{hosts: hosts, validity: validity}
+}
+
+func (s *selfSignedCertificate) get(now time.Time) (*tls.Certificate, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.cert != nil && now.Before(s.cert.Leaf.NotAfter.Add(-s.validity/10)) {
+		return s.cert, nil
+	}
+
+	certPEM, keyPEM, err := generateSelfSignedCert(s.hosts, now, s.validity)
+	if err != nil {
+		return nil, err
+	}
+	cert, err := tls.X509KeyPair(certPEM, keyPEM)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load certificate: %w", err)
+	}
+	s.cert = &cert
+	return s.cert, nil
+}
+
+func (s *selfSignedCertificate) GetCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	return s.get(time.Now())
+}
+
+// generateSelfSignedCert creates a self-signed certificate for hosts, valid
+// from now for validity.
+func generateSelfSignedCert(hosts []string, now time.Time, validity time.Duration) (certPEM, keyPEM []byte, err error) {
 	// Generate private key
 	priv, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
 	if err != nil {
@@ -453,8 +898,8 @@ func generateSelfSignedCert(hosts []string) (certPEM, keyPEM []byte, err error)
 	}
 
 	// Create certificate template
-	notBefore := time.Now()
-	notAfter := notBefore.Add(365 * 24 * time.Hour) // Valid for 1 year
+	notBefore := now
+	notAfter := notBefore.Add(validity)
 
 	dnsNames := make([]string, 0, len(hosts))
 	ipAddrs := make([]net.IP, 0, len(hosts))
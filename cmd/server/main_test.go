@@ -0,0 +1,297 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/tariel-x/gocall/internal/config"
+)
+
+func parseTestCert(t *testing.T, certPEM []byte) *x509.Certificate {
+	t.Helper()
+	block, _ := pem.Decode(certPEM)
+	if block == nil || block.Type != "CERTIFICATE" {
+		t.Fatalf("expected PEM certificate, got %q", certPEM)
+	}
+	cert, err := x509.ParseCertificate(block.Bytes)
+	if err != nil {
+		t.Fatalf("parse certificate: %v", err)
+	}
+	return cert
+}
+
+func TestGenerateSelfSignedCertSANs(t *testing.T) {
+	tests := []struct {
+		name     string
+		hosts    []string
+		wantDNS  []string
+		wantIPs  []string
+		wantName string
+	}{
+		{
+			name:     "hostnames",
+			hosts:    []string{"example.test", "www.example.test"},
+			wantDNS:  []string{"example.test", "www.example.test"},
+			wantName: "example.test",
+		},
+		{
+			name:     "raw IP",
+			hosts:    []string{"192.168.1.10"},
+			wantIPs:  []string{"192.168.1.10"},
+			wantName: "192.168.1.10",
+		},
+		{
+			name:     "host with port",
+			hosts:    []string{"example.test:8443", "10.0.0.1:8443"},
+			wantDNS:  []string{"example.test"},
+			wantIPs:  []string{"10.0.0.1"},
+			wantName: "example.test",
+		},
+		{
+			name:     "empty list",
+			hosts:    nil,
+			wantDNS:  []string{"localhost"},
+			wantName: "localhost",
+		},
+		{
+			name:     "blank entries",
+			hosts:    []string{" ", ""},
+			wantDNS:  []string{"localhost"},
+			wantName: "localhost",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			certPEM, keyPEM, err := generateSelfSignedCert(tt.hosts, time.Now(), defaultSelfSignedDays*24*time.Hour)
+			if err != nil {
+				t.Fatalf("generate: %v", err)
+			}
+			if len(keyPEM) == 0 {
+				t.Fatalf("expected private key PEM")
+			}
+
+			cert := parseTestCert(t, certPEM)
+			if !slices.Equal(cert.DNSNames, tt.wantDNS) {
+				t.Fatalf("DNSNames = %v, want %v", cert.DNSNames, tt.wantDNS)
+			}
+			gotIPs := make([]string, 0, len(cert.IPAddresses))
+			for _, ip := range cert.IPAddresses {
+				gotIPs = append(gotIPs, ip.String())
+			}
+			if len(tt.wantIPs) == 0 {
+				tt.wantIPs = []string{}
+			}
+			if !slices.Equal(gotIPs, tt.wantIPs) {
+				t.Fatalf("IPAddresses = %v, want %v", gotIPs, tt.wantIPs)
+			}
+			if cert.Subject.CommonName != tt.wantName {
+				t.Fatalf("CommonName = %q, want %q", cert.Subject.CommonName, tt.wantName)
+			}
+			for _, ip := range tt.wantIPs {
+				if err := cert.VerifyHostname(ip); err != nil {
+					t.Fatalf("cert not valid for %s: %v", ip, err)
+				}
+			}
+			if net.ParseIP(tt.wantName) == nil {
+				if err := cert.VerifyHostname(tt.wantName); err != nil {
+					t.Fatalf("cert not valid for %s: %v", tt.wantName, err)
+				}
+			}
+		})
+	}
+}
+
+func TestGenerateSelfSignedCertValidity(t *testing.T) {
+	now := time.Now().Truncate(time.Second)
+	for _, days := range []int{1, 30, defaultSelfSignedDays} {
+		validity := time.Duration(days) * 24 * time.Hour
+		certPEM, _, err := generateSelfSignedCert([]string{"localhost"}, now, validity)
+		if err != nil {
+			t.Fatalf("generate: %v", err)
+		}
+		cert := parseTestCert(t, certPEM)
+
+		if !cert.NotBefore.Equal(now) {
+			t.Fatalf("NotBefore = %s, want %s", cert.NotBefore, now)
+		}
+		if !cert.NotAfter.Equal(now.Add(validity)) {
+			t.Fatalf("%d days: NotAfter = %s, want %s", days, cert.NotAfter, now.Add(validity))
+		}
+	}
+}
+
+func TestSelfSignedCertificateRenewsNearExpiry(t *testing.T) {
+	s := newSelfSignedCertificate([]string{"localhost"}, 10*24*time.Hour)
+	now := time.Now()
+
+	first, err := s.get(now)
+	if err != nil {
+		t.Fatalf("get: %v", err)
+	}
+	if again, _ := s.get(now.Add(8 * 24 * time.Hour)); again != first {
+		t.Fatalf("certificate regenerated while still fresh")
+	}
+	renewed, err := s.get(now.Add(9*24*time.Hour + time.Minute))
+	if err != nil {
+		t.Fatalf("get near expiry: %v", err)
+	}
+	if renewed == first || !renewed.Leaf.NotAfter.After(first.Leaf.NotAfter) {
+		t.Fatalf("expected a new certificate near expiry")
+	}
+}
+
+func TestServeUntilDoneShutsDownOnCancel(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	srv := &http.Server{Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})}
+	other := &http.Server{}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() {
+		done <- serveUntilDone(ctx, func() error { return srv.Serve(ln) }, slog.New(slog.NewTextHandler(io.Discard, nil)), srv, other)
+	}()
+
+	resp, err := http.Get("http://" + ln.Addr().String())
+	if err != nil {
+		t.Fatalf("server not serving: %v", err)
+	}
+	resp.Body.Close()
+
+	cancel()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatalf("serveUntilDone = %v, want nil after cancel", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("serveUntilDone did not return after cancel")
+	}
+	if _, err := http.Get("http://" + ln.Addr().String()); err == nil {
+		t.Fatalf("server still accepting after shutdown")
+	}
+}
+
+func TestServeUntilDoneReturnsServeError(t *testing.T) {
+	want := errors.New("bind failed")
+	err := serveUntilDone(context.Background(), func() error { return want }, slog.New(slog.NewTextHandler(io.Discard, nil)))
+	if !errors.Is(err, want) {
+		t.Fatalf("serveUntilDone = %v, want %v", err, want)
+	}
+}
+
+func TestConfigureHTTPProtocolsHTTP3(t *testing.T) {
+	srv := &http.Server{
+		Addr:      "127.0.0.1:0",
+		Handler:   http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}),
+		TLSConfig: &tls.Config{GetCertificate: newSelfSignedCertificate([]string{"localhost"}, time.Hour).GetCertificate},
+	}
+	configureHTTPProtocols(srv, &config.Config{EnableHTTP3: true}, slog.New(slog.NewTextHandler(io.Discard, nil)))
+
+	altSvc := func() string {
+		rec := httptest.NewRecorder()
+		srv.Handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+		return rec.Header().Get("Alt-Svc")
+	}
+	waitFor := func(what string, cond func() bool) {
+		t.Helper()
+		deadline := time.Now().Add(5 * time.Second)
+		for !cond() {
+			if time.Now().After(deadline) {
+				t.Fatalf("timed out waiting for %s", what)
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+	}
+
+	waitFor("Alt-Svc to advertise h3", func() bool { return strings.HasPrefix(altSvc(), `h3=":`) })
+
+	// Shutdown runs the registered hook, which closes the HTTP/3 listener
+	// and withdraws the advertisement.
+	if err := srv.Shutdown(context.Background()); err != nil {
+		t.Fatalf("shutdown: %v", err)
+	}
+	waitFor("Alt-Svc to be withdrawn", func() bool { return altSvc() == "" })
+}
+
+func TestConfigureHTTPProtocolsDisableHTTP2(t *testing.T) {
+	srv := &http.Server{TLSConfig: &tls.Config{NextProtos: []string{"h2", "http/1.1"}}}
+	original := srv.TLSConfig
+	configureHTTPProtocols(srv, &config.Config{DisableHTTP2: true}, slog.New(slog.NewTextHandler(io.Discard, nil)))
+
+	if srv.TLSNextProto == nil || len(srv.TLSNextProto) != 0 {
+		t.Fatalf("TLSNextProto = %v, want a non-nil empty map", srv.TLSNextProto)
+	}
+	if !slices.Equal(srv.TLSConfig.NextProtos, []string{"http/1.1"}) {
+		t.Fatalf("NextProtos = %v, want [http/1.1]", srv.TLSConfig.NextProtos)
+	}
+	if !slices.Equal(original.NextProtos, []string{"h2", "http/1.1"}) {
+		t.Fatalf("shared TLS config was modified: %v", original.NextProtos)
+	}
+}
+
+func TestServeLimitedCapsConnections(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	addr := ln.Addr().String()
+	ln.Close()
+
+	srv := &http.Server{Addr: addr, Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})}
+	t.Cleanup(func() { srv.Close() })
+	go serveLimited(srv, &config.Config{MaxConnections: 1}, false)
+
+	// A keep-alive connection holds the only slot after its first response.
+	var held net.Conn
+	deadline := time.Now().Add(5 * time.Second)
+	for held == nil {
+		if held, err = net.Dial("tcp", addr); err != nil {
+			if time.Now().After(deadline) {
+				t.Fatalf("dial: %v", err)
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+	}
+	if _, err := io.WriteString(held, "GET / HTTP/1.1\r\nHost: test\r\n\r\n"); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	resp, err := http.ReadResponse(bufio.NewReader(held), nil)
+	if err != nil {
+		t.Fatalf("read response: %v", err)
+	}
+	resp.Body.Close()
+
+	get := func(timeout time.Duration) error {
+		client := &http.Client{Timeout: timeout, Transport: &http.Transport{DisableKeepAlives: true}}
+		resp, err := client.Get("http://" + addr)
+		if err == nil {
+			resp.Body.Close()
+		}
+		return err
+	}
+	if err := get(300 * time.Millisecond); err == nil {
+		t.Fatalf("second connection served while the limit was reached")
+	}
+
+	held.Close()
+	if err := get(5 * time.Second); err != nil {
+		t.Fatalf("connection not served after the slot was freed: %v", err)
+	}
+}
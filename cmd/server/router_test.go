@@ -0,0 +1,85 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"testing"
+
+	"github.com/gorilla/websocket"
+
+	"github.com/tariel-x/gocall/internal/config"
+	"github.com/tariel-x/gocall/internal/handlers"
+)
+
+func newTestRouter(cfg *config.Config) http.Handler {
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	h := handlers.New(cfg, nil, handlers.NewCallStore(), handlers.NewWSHubV2(), websocket.Upgrader{}, logger)
+	return setupRouter(h, cfg, nil)
+}
+
+func TestDisableEmbeddedUIReturnsJSON404(t *testing.T) {
+	router := newTestRouter(&config.Config{DisableEmbeddedUI: true})
+
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/call/abc123", nil))
+	if rec.Code != http.StatusNotFound {
+		t.Fatalf("status = %d, want 404", rec.Code)
+	}
+	var body map[string]string
+	if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil {
+		t.Fatalf("expected JSON body, got %q: %v", rec.Body.String(), err)
+	}
+	if body["error"] == "" {
+		t.Fatalf("expected error message, got %v", body)
+	}
+
+	rec = httptest.NewRecorder()
+	router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/status", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("/api/status = %d, want 200", rec.Code)
+	}
+}
+
+func TestInstanceHeader(t *testing.T) {
+	router := newTestRouter(&config.Config{InstanceID: "node-1"})
+
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/status", nil))
+	if got := rec.Header().Get("X-Gocall-Instance"); got != "node-1" {
+		t.Fatalf("X-Gocall-Instance = %q, want node-1", got)
+	}
+}
+
+func TestIPPolicyUsesTrustedProxies(t *testing.T) {
+	router := newTestRouter(&config.Config{
+		DisableEmbeddedUI: true,
+		IPAllowList:       []netip.Prefix{netip.MustParsePrefix("198.51.100.0/24")},
+		TrustedProxies:    []string{"192.0.2.10"},
+	})
+
+	create := func(remoteAddr, forwardedFor string) int {
+		req := httptest.NewRequest(http.MethodPost, "/api/calls", nil)
+		req.RemoteAddr = remoteAddr
+		req.Header.Set("X-Forwarded-For", forwardedFor)
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, req)
+		return rec.Code
+	}
+
+	// The trusted proxy forwards an allowed client.
+	if code := create("192.0.2.10:1234", "198.51.100.7"); code != http.StatusOK {
+		t.Fatalf("via trusted proxy: status = %d, want 200", code)
+	}
+	// The trusted proxy forwards a client outside the allow list.
+	if code := create("192.0.2.10:1234", "203.0.113.9"); code != http.StatusForbidden {
+		t.Fatalf("disallowed client via trusted proxy: status = %d, want 403", code)
+	}
+	// An untrusted peer can't spoof an allowed address.
+	if code := create("203.0.113.9:1234", "198.51.100.7"); code != http.StatusForbidden {
+		t.Fatalf("spoofed header: status = %d, want 403", code)
+	}
+}
@@ -174,7 +174,9 @@ export function useCallSession(callId: string | undefined): UseCallSessionResult
     remoteStream,
     mediaRoute,
     destroyPeerConnection,
+    applyJoinIceConfig,
   } = useWebRTCManager({
+    callId,
     localStream,
     isHost: sessionInfo.role === 'host',
     isWsConnected: wsState === 'ready',
@@ -414,6 +416,7 @@ export function useCallSession(callId: string | undefined): UseCallSessionResult
           if (!isActive) {
             return;
           }
+          applyJoinIceConfig(data);
           setWsState('ready');
           if (data?.peer_id) {
             const resolvedRole = (data.role as PeerRole) ?? sessionInfoRef.current.role ?? 'host';
@@ -501,6 +504,10 @@ export function useCallSession(callId: string | undefined): UseCallSessionResult
           if (envelope.type === 'peer-reconnected') {
             handlePeerReconnected();
           }
+          // Server is restarting; the socket closes next and the usual reconnect takes over
+          if (envelope.type === 'server-shutdown') {
+            setTransientMessage('Сервер перезапускается, переподключаемся...');
+          }
           // Handle renegotiation request from peer (they recreated their connection)
           if (envelope.type === 'renegotiate-request') {
             console.log('[CALL] Received renegotiate-request from peer');
@@ -9,7 +9,7 @@
  * making it easier to test and refactor signaling and reconnection strategies.
  * 
  * Currently handles:
- * - TURN server configuration fetch
+ * - ICE server configuration (from the join ack, refreshed on recreate)
  * - RTCPeerConnection creation and cleanup
  * - Basic state tracking (connection state, ICE connection state)
  * 
@@ -21,9 +21,9 @@
 
 import { useCallback, useEffect, useRef, useState } from 'react';
 import { fetchTurnConfig } from '../services/api';
-import { ReconnectionState } from '../services/types';
+import { IcePolicy, ReconnectionState } from '../services/types';
 import { MediaRouteMode } from './uiConsts';
-import { parseMediaRouteStats } from '../utils/webrtcStats';
+import { parseMediaRouteStats, parseQualityStats } from '../utils/webrtcStats';
 import { useLatest } from '../utils/useLatest';
 import { createConfiguredPeerConnection } from '../utils/webrtcFactory';
 
@@ -35,6 +35,8 @@ const TIMEOUTS = {
 const MEDIA_ROUTE_INTERVAL = 5000;
 
 export interface WebRTCManagerProps {
+  /** Current call ID, used to fetch the call-scoped ICE config */
+  callId?: string;
   /** Local media stream (camera/microphone). Will be added to PC when created. */
   localStream: MediaStream | null;
   /** Role of the current peer (host initiates offer, guest waits) */
@@ -84,14 +86,16 @@ export interface WebRTCManagerResult {
   handleIceConnected: () => void;
   /** Function to explicitly destroy the peer connection and cleanup */
   destroyPeerConnection: () => void;
+  /** Use the ICE servers and transport policy sent with the join ack */
+  applyJoinIceConfig: (join: { ice_servers?: RTCIceServer[]; ice_transport_policy?: IcePolicy }) => void;
 }
 
 /**
  * Manages WebRTC peer connection lifecycle.
  * 
  * Initialization:
- * - Fetches TURN server config from the backend
- * - Creates RTCPeerConnection with ICE servers
+ * - Creates RTCPeerConnection with the ICE servers known so far
+ * - Switches to the join ack's ICE servers and policy when it arrives
  * - Adds local media tracks if available
  * - Sets up basic state listeners (without complex reconnection logic yet)
  * 
@@ -103,6 +107,7 @@ export interface WebRTCManagerResult {
  * @returns Object containing pcRef, state, and cleanup functions
  */
 export function useWebRTCManager({
+  callId,
   localStream,
   isHost,
   isWsConnected,
@@ -248,10 +253,14 @@ export function useWebRTCManager({
       const stats = await pc.getStats();
       const routeInfo = parseMediaRouteStats(stats);
       setMediaRoute(routeInfo);
+      const quality = parseQualityStats(stats, routeInfo.mode);
+      if (quality) {
+        sendSignalRef.current('call-stats', quality);
+      }
     } catch (err) {
       console.warn('[WebRTCManager] Failed to inspect media route', err);
     }
-  }, []);
+  }, [sendSignalRef]);
 
   const stopMediaRouteTimer = useCallback(() => {
     if (mediaRouteTimerRef.current) {
@@ -398,10 +407,14 @@ export function useWebRTCManager({
       try {
         let rtcConfig: RTCConfiguration = {};
         if (options?.fetchNewTurnConfig) {
+          // The join ack's TURN credentials may have expired by now.
           try {
-            const turnConfig = await fetchTurnConfig();
+            const turnConfig = await fetchTurnConfig(callId);
             if (turnConfig?.iceServers?.length) {
-              rtcConfig = { iceServers: turnConfig.iceServers };
+              rtcConfig = {
+                iceServers: turnConfig.iceServers,
+                iceTransportPolicy: turnConfig.iceTransportPolicy ?? 'all',
+              };
               rtcConfigRef.current = rtcConfig;
             }
           } catch (err) {
@@ -436,6 +449,7 @@ export function useWebRTCManager({
     },
     [
       attachPeerConnectionHandlers,
+      callId,
       clearIceTimers,
       errorRef,
       isHostRef,
@@ -501,18 +515,9 @@ export function useWebRTCManager({
       return;
     }
 
-    // Step 1: Fetch TURN server configuration
-    try {
-      const turnConfig = await fetchTurnConfig();
-      if (turnConfig?.iceServers?.length) {
-        rtcConfigRef.current = { iceServers: turnConfig.iceServers };
-      }
-    } catch (err) {
-      console.warn('[WebRTCManager] Failed to fetch TURN config', err);
-      // Proceed without TURN servers if fetch fails
-    }
-
-    // Step 2: Create RTCPeerConnection with ICE servers
+    // ICE servers come with the join ack, usually after this point;
+    // applyJoinIceConfig then reconfigures the connection before the first
+    // offer or answer starts gathering candidates.
     const pc = createConfiguredPeerConnection(rtcConfigRef.current, localStream);
     pcRef.current = pc;
 
@@ -521,6 +526,21 @@ export function useWebRTCManager({
     return pc;
   }, [attachPeerConnectionHandlers, localStream]);
 
+  const applyJoinIceConfig = useCallback<WebRTCManagerResult['applyJoinIceConfig']>((join) => {
+    if (!join.ice_servers?.length) {
+      return;
+    }
+    rtcConfigRef.current = {
+      iceServers: join.ice_servers,
+      iceTransportPolicy: join.ice_transport_policy ?? 'all',
+    };
+    try {
+      pcRef.current?.setConfiguration(rtcConfigRef.current);
+    } catch (err) {
+      console.warn('[WebRTCManager] Failed to apply ICE config from join', err);
+    }
+  }, []);
+
   // ============================================================
   // CLEANUP
   // Destroy peer connection and reset state
@@ -582,5 +602,6 @@ export function useWebRTCManager({
     handleConnectionLoss,
     handleIceConnected,
     destroyPeerConnection,
+    applyJoinIceConfig,
   };
 }
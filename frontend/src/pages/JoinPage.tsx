@@ -16,6 +16,9 @@ const JoinPage = () => {
   const [error, setError] = useState<string | null>(null);
   const [isJoining, setIsJoining] = useState(false);
   const [isCallLoaded, setIsCallLoaded] = useState(false);
+  const [requiresPin, setRequiresPin] = useState(false);
+  const [pin, setPin] = useState('');
+  const [pinError, setPinError] = useState<string | null>(null);
 
   const { mediaState, mediaError, requestMedia } = useMediaPermissions();
   const { wsState } = useSignaling({
@@ -46,14 +49,19 @@ const JoinPage = () => {
         }
         setCallStatus(response.status);
         setParticipants(response.participants?.count ?? 0);
+        setRequiresPin(Boolean(response.requires_pin));
       })
       .catch((err) => {
         if (cancelled) {
           return;
         }
         const statusCode = (err as { response?: { status?: number } })?.response?.status;
+        if (statusCode === 410) {
+          setError('Звонок уже завершён.');
+          return;
+        }
         if (statusCode === 404) {
-          setError('Звонок не найден или уже завершён.');
+          setError('Звонок не найден.');
           return;
         }
         if (err instanceof Error) {
@@ -79,14 +87,24 @@ const JoinPage = () => {
     }
     setIsJoining(true);
     setError(null);
+    setPinError(null);
     try {
       await requestMedia();
-      const response = await joinCall(callId);
+      const response = await joinCall(callId, requiresPin ? pin : undefined);
       setCallContext(callId);
       setPeerContext(response.peer_id, 'guest');
       setSessionState({ callId, peerId: response.peer_id, role: 'guest' });
       navigate(`/call/${callId}`);
     } catch (err) {
+      const statusCode = (err as { response?: { status?: number } })?.response?.status;
+      if (statusCode === 403 && requiresPin) {
+        setPinError('Неверный PIN-код.');
+        return;
+      }
+      if (statusCode === 429 && requiresPin) {
+        setPinError('Слишком много попыток. Подождите немного.');
+        return;
+      }
       if (err instanceof Error) {
         setError(err.message);
       } else {
@@ -163,7 +181,23 @@ const JoinPage = () => {
         {mediaError && <p className="page-error">{mediaError}</p>}
       </section>
 
-      <button className="primary-button" onClick={handleJoin} disabled={isJoining || !isCallLoaded}>
+      {requiresPin && (
+        <label className="pin-field">
+          Звонок защищён PIN-кодом
+          <input
+            className="pin-input"
+            type="password"
+            inputMode="numeric"
+            autoComplete="off"
+            maxLength={64}
+            value={pin}
+            onChange={(event) => setPin(event.target.value)}
+          />
+          {pinError && <span className="page-error">{pinError}</span>}
+        </label>
+      )}
+
+      <button className="primary-button" onClick={handleJoin} disabled={isJoining || !isCallLoaded || (requiresPin && !pin)}>
         {isJoining ? 'Подключаемся…' : 'Подключиться'}
       </button>
     </main>
@@ -1,15 +1,26 @@
 import { useEffect, useState } from 'react';
 import { useNavigate } from 'react-router-dom';
-import { createCall } from '../services/api';
-import { resetSession, setCallContext } from '../services/session';
+import { createCall, fetchStatus } from '../services/api';
+import { resetSession, setCallContext, setPeerContext } from '../services/session';
 
 const StartPage = () => {
   const navigate = useNavigate();
   const [isLoading, setIsLoading] = useState(false);
   const [error, setError] = useState<string | null>(null);
+  const [pin, setPin] = useState('');
+  const [maintenance, setMaintenance] = useState<string | null>(null);
 
   useEffect(() => {
     resetSession();
+    fetchStatus()
+      .then((status) => {
+        if (status.maintenance?.enabled) {
+          setMaintenance(status.maintenance.message || 'Сервер на обслуживании.');
+        }
+      })
+      .catch(() => {
+        // The banner is best effort; creating a call reports real errors.
+      });
   }, []);
 
   const handleStartCall = async () => {
@@ -20,8 +31,12 @@ const StartPage = () => {
     setError(null);
     try {
       resetSession();
-      const call = await createCall();
+      const call = await createCall({ pin: pin.trim() || undefined });
       setCallContext(call.call_id);
+      if (call.peer_id) {
+        // PIN-protected calls hand the host its peer_id up front
+        setPeerContext(call.peer_id, 'host');
+      }
       navigate(`/wait/${call.call_id}`);
     } catch (err) {
       if (err instanceof Error) {
@@ -38,7 +53,21 @@ const StartPage = () => {
     <main className="page">
       <h1>Gocall</h1>
       <p>Создайте звонок и поделитесь ссылкой с собеседником.</p>
-      <button className="primary-button" onClick={handleStartCall} disabled={isLoading}>
+      {maintenance && <p className="page-error">{maintenance}</p>}
+      <label className="pin-field">
+        PIN-код (необязательно)
+        <input
+          className="pin-input"
+          type="password"
+          inputMode="numeric"
+          autoComplete="off"
+          minLength={4}
+          maxLength={64}
+          value={pin}
+          onChange={(event) => setPin(event.target.value)}
+        />
+      </label>
+      <button className="primary-button" onClick={handleStartCall} disabled={isLoading || maintenance !== null}>
         {isLoading ? 'Создаём…' : 'Начать звонок'}
       </button>
       {error && <p className="page-error">{error}</p>}
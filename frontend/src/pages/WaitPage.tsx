@@ -1,7 +1,7 @@
 import { useEffect, useMemo, useState } from 'react';
 import { useNavigate, useParams } from 'react-router-dom';
 import { getCall } from '../services/api';
-import { setCallContext } from '../services/session';
+import { getSessionState, setCallContext } from '../services/session';
 import type { CallStatus } from '../services/types';
 import { useMediaPermissions } from '../hooks/useMedia';
 import { useSignaling } from '../hooks/useSignaling';
@@ -18,6 +18,7 @@ const WaitPage = () => {
   const { mediaState, mediaError, requestMedia } = useMediaPermissions();
   const { wsState } = useSignaling({
     callId,
+    peerId: getSessionState().peerId,
     onState: (status, count) => {
       setCallStatus(status);
       setParticipants(count);
@@ -48,8 +49,12 @@ const WaitPage = () => {
           return;
         }
         const status = (err as { response?: { status?: number } })?.response?.status;
+        if (status === 410) {
+          setCallError('Звонок уже завершён.');
+          return;
+        }
         if (status === 404) {
-          setCallError('Звонок не найден или уже завершён.');
+          setCallError('Звонок не найден.');
           return;
         }
         if (err instanceof Error) {
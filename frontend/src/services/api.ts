@@ -1,5 +1,5 @@
 import axios from 'axios';
-import { CallDetailsResponse, CallResponse, JoinResponse, TurnConfig } from './types';
+import { CallDetailsResponse, CallResponse, IcePolicy, JoinResponse, ServerStatus, TurnConfig } from './types';
 
 const resolveBaseURL = (): string => {
   const value = window.API_ADDRESS;
@@ -14,13 +14,34 @@ export const apiClient = axios.create({
   withCredentials: true
 });
 
-export const fetchTurnConfig = async (): Promise<TurnConfig> => {
-  const { data } = await apiClient.get<TurnConfig>('/api/turn-config');
+export const fetchTurnConfig = async (callId?: string): Promise<TurnConfig> => {
+  const { data } = await apiClient.get<TurnConfig>('/api/turn-config', {
+    params: callId ? { call_id: callId } : undefined,
+  });
   return data;
 };
 
-export const createCall = async (): Promise<CallResponse> => {
-  const { data } = await apiClient.post<CallResponse>('/api/calls');
+export const fetchStatus = async (): Promise<ServerStatus> => {
+  const { data } = await apiClient.get<ServerStatus>('/api/status');
+  return data;
+};
+
+export const createCall = async (options?: {
+  icePolicy?: IcePolicy;
+  pin?: string;
+  waitingRoom?: boolean;
+}): Promise<CallResponse> => {
+  const body: { ice_policy?: IcePolicy; pin?: string; waiting_room?: boolean } = {};
+  if (options?.icePolicy) {
+    body.ice_policy = options.icePolicy;
+  }
+  if (options?.pin) {
+    body.pin = options.pin;
+  }
+  if (options?.waitingRoom) {
+    body.waiting_room = true;
+  }
+  const { data } = await apiClient.post<CallResponse>('/api/calls', Object.keys(body).length ? body : undefined);
   return data;
 };
 
@@ -29,7 +50,15 @@ export const getCall = async (callId: string): Promise<CallDetailsResponse> => {
   return data;
 };
 
-export const joinCall = async (callId: string): Promise<JoinResponse> => {
-  const { data } = await apiClient.post<JoinResponse>(`/api/calls/${callId}/join`);
+export const joinCall = async (callId: string, pin?: string): Promise<JoinResponse> => {
+  const { data } = await apiClient.post<JoinResponse>(`/api/calls/${callId}/join`, pin ? { pin } : undefined);
   return data;
 };
+
+export const admitPeer = async (callId: string, hostPeerId: string, peerId: string): Promise<void> => {
+  await apiClient.post(`/api/calls/${callId}/admit`, { host_peer_id: hostPeerId, peer_id: peerId });
+};
+
+export const rejectPeer = async (callId: string, hostPeerId: string, peerId: string): Promise<void> => {
+  await apiClient.post(`/api/calls/${callId}/reject`, { host_peer_id: hostPeerId, peer_id: peerId });
+};
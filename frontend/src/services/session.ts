@@ -6,6 +6,9 @@ export interface SessionState {
   callId?: string;
   peerId?: string;
   role?: PeerRole;
+  // Issued by the server on the first connection; reconnects use it
+  // instead of the peer ID.
+  reconnectToken?: string;
 }
 
 let sessionState: SessionState = readFromStorage();
@@ -39,6 +42,9 @@ function persist(): void {
 }
 
 export function setCallContext(callId: string): void {
+  if (sessionState.callId !== callId) {
+    sessionState.reconnectToken = undefined;
+  }
   sessionState.callId = callId;
   persist();
 }
@@ -49,6 +55,11 @@ export function setPeerContext(peerId: string, role: PeerRole): void {
   persist();
 }
 
+export function setReconnectToken(token: string): void {
+  sessionState.reconnectToken = token;
+  persist();
+}
+
 export function getSessionState(): SessionState {
   return { ...sessionState };
 }
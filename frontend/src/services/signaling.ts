@@ -1,22 +1,46 @@
-import { CallStatus, PeerRole } from './types';
+import { CallStatus, IcePolicy, PeerRole } from './types';
+import { getSessionState, setReconnectToken } from './session';
+
+export interface MediaState {
+  audio: boolean;
+  video: boolean;
+}
 
 interface StateEnvelope {
   call_id: string;
   status: CallStatus;
+  seq?: number;
+  end_reason?: 'left' | 'expired' | 'host_ended' | 'terminated';
   participants?: {
     count: number;
+    list?: {
+      peer_id: string;
+      name?: string;
+      role: PeerRole;
+      is_present: boolean;
+      pending?: boolean;
+      media?: MediaState;
+    }[];
   };
 }
 
 interface JoinEnvelope {
   peer_id: string;
   role?: PeerRole;
+  pending?: boolean;
+  reconnect_token?: string;
+  peer_media?: Record<string, MediaState>;
+  ice_servers?: RTCIceServer[];
+  ice_transport_policy?: IcePolicy;
+  protected?: boolean;
 }
 
 export interface SignalingEnvelope {
   type: string;
   data?: unknown;
   from?: string;
+  from_role?: PeerRole;
+  from_name?: string;
   to?: string;
   call_type?: string;
 }
@@ -46,6 +70,7 @@ interface SharedConnection {
   key: string;
   callId: string;
   peerId?: string;
+  reconnectToken?: string;
   socket: WebSocket;
   listeners: Set<SignalingCallbacks>;
   pendingQueue: SignalingEnvelope[];
@@ -91,7 +116,9 @@ const clearReconnectTimer = (connection: SharedConnection) => {
 };
 
 const createSharedConnection = (callId: string, peerId?: string): SharedConnection => {
-  const wsURL = buildWSUrl(callId, peerId);
+  const session = getSessionState();
+  const reconnectToken = session.callId === callId ? session.reconnectToken : undefined;
+  const wsURL = buildWSUrl(callId, peerId, undefined, reconnectToken);
   const listeners = new Set<SignalingCallbacks>();
   const pendingQueue: SignalingEnvelope[] = [];
 
@@ -99,6 +126,7 @@ const createSharedConnection = (callId: string, peerId?: string): SharedConnecti
     key: connectionKey(callId),
     callId,
     peerId,
+    reconnectToken,
     socket: new WebSocket(wsURL),
     listeners,
     pendingQueue,
@@ -145,7 +173,7 @@ const createSharedConnection = (callId: string, peerId?: string): SharedConnecti
     const delay = 2000;
     clearReconnectTimer(connection);
     connection.reconnectTimer = setTimeout(() => {
-      const newSocket = new WebSocket(buildWSUrl(connection.callId, connection.peerId));
+      const newSocket = new WebSocket(buildWSUrl(connection.callId, connection.peerId, connection.lastJoin, connection.reconnectToken));
       attachSocketHandlers(newSocket);
     }, delay);
   };
@@ -179,12 +207,22 @@ const createSharedConnection = (callId: string, peerId?: string): SharedConnecti
               if (!connection.peerId && joinData?.peer_id) {
                 connection.peerId = joinData.peer_id;
               }
+              if (joinData?.reconnect_token) {
+                connection.reconnectToken = joinData.reconnect_token;
+                setReconnectToken(joinData.reconnect_token);
+              }
               dispatch((listener) => listener.onJoin?.(joinData));
             }
             break;
           case 'state':
-            if (envelope.data) {
+            // Only the server sends state; a relayed one carries "from".
+            if (envelope.data && !envelope.from) {
               const stateData = envelope.data as StateEnvelope;
+              // Pushes for concurrent changes can arrive out of order.
+              const last = connection.lastState;
+              if (last?.call_id === stateData.call_id && (stateData.seq ?? 0) < (last.seq ?? 0)) {
+                break;
+              }
               connection.lastState = stateData;
               dispatch((listener) => listener.onState?.(stateData));
             }
@@ -311,15 +349,30 @@ export const subscribeToSignaling = (
   };
 };
 
-const buildWSUrl = (callId: string, peerId?: string): string => {
+const buildWSUrl = (callId: string, peerId?: string, lastJoin?: JoinEnvelope, reconnectToken?: string): string => {
   const apiAddress = (window.API_ADDRESS && window.API_ADDRESS.trim() !== '')
     ? window.API_ADDRESS
     : window.location.origin;
   const url = new URL('/api/ws', apiAddress);
   url.searchParams.set('call_id', callId);
+  if (reconnectToken) {
+    url.searchParams.set('reconnect_token', reconnectToken);
+  }
+  // With a token the peer ID is only used to resume a call the server lost.
   if (peerId) {
     url.searchParams.set('peer_id', peerId);
   }
+  // Lets the server rebuild the call after a restart, if it allows that.
+  // The policy and protection flag keep it from rebuilding a weaker call.
+  if (lastJoin?.role) {
+    url.searchParams.set('role', lastJoin.role);
+  }
+  if (lastJoin?.ice_transport_policy) {
+    url.searchParams.set('ice_policy', lastJoin.ice_transport_policy);
+  }
+  if (lastJoin?.protected) {
+    url.searchParams.set('protected', '1');
+  }
   url.protocol = url.protocol === 'https:' ? 'wss:' : 'ws:';
   return url.toString();
 };
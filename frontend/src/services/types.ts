@@ -1,5 +1,8 @@
+export type IcePolicy = 'all' | 'relay';
+
 export interface TurnConfig {
   iceServers?: RTCIceServer[];
+  iceTransportPolicy?: IcePolicy;
 }
 
 export type CallStatus = 'waiting' | 'active' | 'ended';
@@ -8,6 +11,11 @@ export type ReconnectionState = 'connected' | 'reconnecting' | 'peer-disconnecte
 export interface CallResponse {
   call_id: string;
   status: CallStatus;
+  ice_policy?: IcePolicy;
+  requires_pin?: boolean;
+  waiting_room?: boolean;
+  /** Host peer_id, returned only for PIN-protected calls */
+  peer_id?: string;
 }
 
 export interface CallDetailsResponse extends CallResponse {
@@ -18,9 +26,24 @@ export interface CallDetailsResponse extends CallResponse {
 
 export type PeerRole = 'host' | 'guest';
 
+export interface ServerStatus {
+  active_calls: number;
+  waiting_calls: number;
+  max_calls: number;
+  max_participants: number;
+  accepting_calls: boolean;
+  maintenance?: {
+    enabled: boolean;
+    message?: string;
+  };
+}
+
 export interface JoinResponse {
   call_id: string;
   peer_id: string;
+  requires_pin?: boolean;
+  /** The guest waits in the lobby until the host admits it */
+  pending?: boolean;
 }
 
 declare global {
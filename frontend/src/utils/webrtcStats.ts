@@ -81,3 +81,43 @@ export function parseMediaRouteStats(stats: RTCStatsReport): MediaRouteInfo {
     detail: detailParts.join(' | ') || undefined,
   };
 }
+
+export interface CallQualityStats {
+  rtt_ms: number;
+  jitter_ms: number;
+  packet_loss: number;
+  bitrate_kbps: number;
+  route: MediaRouteMode;
+}
+
+// Summarises a stats report into the "call-stats" sample the server exports
+// for quality monitoring. Loss is cumulative over the call.
+export function parseQualityStats(stats: RTCStatsReport, route: MediaRouteMode): CallQualityStats | null {
+  let pair: any;
+  let jitter = 0;
+  let lost = 0;
+  let received = 0;
+
+  stats.forEach((report: any) => {
+    if (report.type === 'candidate-pair' && report.state === 'succeeded' && (report.nominated || report.selected)) {
+      pair = pair ?? report;
+    }
+    if (report.type === 'inbound-rtp') {
+      jitter = Math.max(jitter, report.jitter ?? 0);
+      lost += Math.max(report.packetsLost ?? 0, 0);
+      received += report.packetsReceived ?? 0;
+    }
+  });
+
+  if (!pair) {
+    return null;
+  }
+
+  return {
+    rtt_ms: (pair.currentRoundTripTime ?? 0) * 1000,
+    jitter_ms: jitter * 1000,
+    packet_loss: lost + received > 0 ? lost / (lost + received) : 0,
+    bitrate_kbps: (pair.availableOutgoingBitrate ?? 0) / 1000,
+    route,
+  };
+}
@@ -0,0 +1,205 @@
+package analytics
+
+import (
+	"fmt"
+	"log/slog"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/tariel-x/gocall/internal/models"
+)
+
+const (
+	// qualityMeasurement is the line protocol measurement name.
+	qualityMeasurement = "gocall_call_quality"
+	// maxDatagramBytes keeps datagrams under a typical path MTU.
+	maxDatagramBytes = 1400
+	// maxLinesPerFlush caps how many per-call lines one flush sends; the
+	// remaining aggregates are dropped so a busy server can't flood the sink.
+	maxLinesPerFlush = 1000
+)
+
+// UDPExporter aggregates call quality samples per call and periodically sends
+// them to a StatsD/InfluxDB-compatible UDP listener in line protocol.
+// ExportCallStats never blocks: samples are dropped when the queue is full.
+type UDPExporter struct {
+	conn     net.Conn
+	interval time.Duration
+	logger   *slog.Logger
+
+	samples   chan models.CallStatsSample
+	stop      chan struct{}
+	done      chan struct{}
+	closeOnce sync.Once
+
+	pending map[string]*qualityAggregate
+}
+
+// qualityAggregate accumulates one call's samples between flushes.
+type qualityAggregate struct {
+	callID     string
+	samples    int
+	relayed    int
+	rtt        float64
+	jitter     float64
+	loss       float64
+	maxLoss    float64
+	bitrate    float64
+	lastSample time.Time
+}
+
+// NewUDPExporter sends aggregates to addr (host:port) every interval.
+func NewUDPExporter(addr string, interval time.Duration, logger *slog.Logger) (*UDPExporter, error) {
+	if interval <= 0 {
+		return nil, fmt.Errorf("export interval must be positive, got %v", interval)
+	}
+	conn, err := net.Dial("udp", addr)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open call stats sink: %w", err)
+	}
+
+	e := &UDPExporter{
+		conn:     conn,
+		interval: interval,
+		logger:   logger,
+		samples:  make(chan models.CallStatsSample, queueSize),
+		stop:     make(chan struct{}),
+		done:     make(chan struct{}),
+		pending:  make(map[string]*qualityAggregate),
+	}
+	go e.run()
+	return e, nil
+}
+
+// ExportCallStats queues a sample for aggregation.
+func (e *UDPExporter) ExportCallStats(sample models.CallStatsSample) {
+	select {
+	case <-e.stop:
+	case e.samples <- sample:
+	default:
+		e.logger.Warn("call stats queue full, dropping sample", "call_id", sample.CallID)
+	}
+}
+
+// Close sends what has been aggregated so far and closes the socket.
+func (e *UDPExporter) Close() error {
+	e.closeOnce.Do(func() {
+		close(e.stop)
+	})
+	<-e.done
+	return e.conn.Close()
+}
+
+func (e *UDPExporter) run() {
+	defer close(e.done)
+	ticker := time.NewTicker(e.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case sample := <-e.samples:
+			e.add(sample)
+		case <-ticker.C:
+			e.flush()
+		case <-e.stop:
+			for {
+				select {
+				case sample := <-e.samples:
+					e.add(sample)
+				default:
+					e.flush()
+					return
+				}
+			}
+		}
+	}
+}
+
+func (e *UDPExporter) add(sample models.CallStatsSample) {
+	agg, ok := e.pending[sample.CallID]
+	if !ok {
+		agg = &qualityAggregate{callID: sample.CallID}
+		e.pending[sample.CallID] = agg
+	}
+	agg.samples++
+	if sample.Relayed {
+		agg.relayed++
+	}
+	agg.rtt += sample.RTTMs
+	agg.jitter += sample.JitterMs
+	agg.loss += sample.PacketLoss
+	agg.maxLoss = max(agg.maxLoss, sample.PacketLoss)
+	agg.bitrate += sample.BitrateKbps
+	if sample.At.After(agg.lastSample) {
+		agg.lastSample = sample.At
+	}
+}
+
+// flush sends one line per call, packed into as few datagrams as fit.
+func (e *UDPExporter) flush() {
+	if len(e.pending) == 0 {
+		return
+	}
+	aggregates := make([]*qualityAggregate, 0, len(e.pending))
+	for _, agg := range e.pending {
+		aggregates = append(aggregates, agg)
+	}
+	clear(e.pending)
+
+	sort.Slice(aggregates, func(i, j int) bool { return aggregates[i].callID < aggregates[j].callID })
+	if dropped := len(aggregates) - maxLinesPerFlush; dropped > 0 {
+		e.logger.Warn("too many calls for one call stats export, dropping the rest", "dropped", dropped)
+		aggregates = aggregates[:maxLinesPerFlush]
+	}
+
+	var batch []byte
+	for _, agg := range aggregates {
+		line := agg.line()
+		if len(batch) > 0 && len(batch)+len(line) > maxDatagramBytes {
+			e.send(batch)
+			batch = batch[:0]
+		}
+		batch = append(batch, line...)
+	}
+	e.send(batch)
+}
+
+func (e *UDPExporter) send(batch []byte) {
+	if len(batch) == 0 {
+		return
+	}
+	if _, err := e.conn.Write(batch); err != nil {
+		e.logger.Warn("failed to export call stats", "error", err)
+	}
+}
+
+// line renders the aggregate in InfluxDB line protocol with a trailing newline.
+func (a *qualityAggregate) line() []byte {
+	n := float64(a.samples)
+	fields := []string{
+		"samples=" + strconv.Itoa(a.samples) + "i",
+		"relayed_samples=" + strconv.Itoa(a.relayed) + "i",
+		"rtt_ms=" + formatFloat(a.rtt/n),
+		"jitter_ms=" + formatFloat(a.jitter/n),
+		"packet_loss=" + formatFloat(a.loss/n),
+		"packet_loss_max=" + formatFloat(a.maxLoss),
+		"bitrate_kbps=" + formatFloat(a.bitrate/n),
+	}
+	return fmt.Appendf(nil, "%s,call_id=%s %s %d\n",
+		qualityMeasurement, escapeTag(a.callID), strings.Join(fields, ","), a.lastSample.UnixNano())
+}
+
+func formatFloat(v float64) string {
+	return strconv.FormatFloat(v, 'f', -1, 64)
+}
+
+var tagEscaper = strings.NewReplacer(",", `\,`, "=", `\=`, " ", `\ `)
+
+// escapeTag escapes the characters line protocol treats specially in tags.
+func escapeTag(value string) string {
+	return tagEscaper.Replace(value)
+}
@@ -0,0 +1,91 @@
+package analytics
+
+import (
+	"io"
+	"log/slog"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/tariel-x/gocall/internal/models"
+)
+
+func TestUDPExporterSendsAggregatedLines(t *testing.T) {
+	sink, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	defer sink.Close()
+
+	exporter, err := NewUDPExporter(sink.LocalAddr().String(), time.Hour, slog.New(slog.NewTextHandler(io.Discard, nil)))
+	if err != nil {
+		t.Fatalf("NewUDPExporter: %v", err)
+	}
+
+	at := time.Unix(1_700_000_000, 0)
+	exporter.ExportCallStats(models.CallStatsSample{CallID: "abc", At: at, RTTMs: 40, JitterMs: 2, PacketLoss: 0.01, BitrateKbps: 800})
+	exporter.ExportCallStats(models.CallStatsSample{CallID: "abc", At: at.Add(time.Second), RTTMs: 60, JitterMs: 4, PacketLoss: 0.03, BitrateKbps: 1200, Relayed: true})
+	exporter.ExportCallStats(models.CallStatsSample{CallID: "x,y z", At: at, RTTMs: 10})
+
+	// Close flushes the pending aggregates; the hour-long interval never fires.
+	if err := exporter.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+
+	_ = sink.SetReadDeadline(time.Now().Add(2 * time.Second))
+	buf := make([]byte, 2048)
+	n, _, err := sink.ReadFrom(buf)
+	if err != nil {
+		t.Fatalf("no datagram received: %v", err)
+	}
+
+	lines := strings.Split(strings.TrimSuffix(string(buf[:n]), "\n"), "\n")
+	want := []string{
+		"gocall_call_quality,call_id=abc samples=2i,relayed_samples=1i,rtt_ms=50,jitter_ms=3,packet_loss=0.02,packet_loss_max=0.03,bitrate_kbps=1000 1700000001000000000",
+		`gocall_call_quality,call_id=x\,y\ z samples=1i,relayed_samples=0i,rtt_ms=10,jitter_ms=0,packet_loss=0,packet_loss_max=0,bitrate_kbps=0 1700000000000000000`,
+	}
+	if len(lines) != len(want) {
+		t.Fatalf("got %d lines, want %d:\n%s", len(lines), len(want), buf[:n])
+	}
+	for i := range want {
+		if lines[i] != want[i] {
+			t.Fatalf("line %d:\n got %s\nwant %s", i, lines[i], want[i])
+		}
+	}
+}
+
+func TestUDPExporterSplitsDatagrams(t *testing.T) {
+	sink, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	defer sink.Close()
+
+	exporter, err := NewUDPExporter(sink.LocalAddr().String(), time.Hour, slog.New(slog.NewTextHandler(io.Discard, nil)))
+	if err != nil {
+		t.Fatalf("NewUDPExporter: %v", err)
+	}
+	for i := range 40 {
+		exporter.ExportCallStats(models.CallStatsSample{CallID: strings.Repeat("c", 10) + string(rune('A'+i)), RTTMs: 1})
+	}
+	exporter.Close()
+
+	_ = sink.SetReadDeadline(time.Now().Add(2 * time.Second))
+	buf := make([]byte, 4096)
+	lines, datagrams := 0, 0
+	for lines < 40 {
+		n, _, err := sink.ReadFrom(buf)
+		if err != nil {
+			t.Fatalf("after %d lines: %v", lines, err)
+		}
+		if n > maxDatagramBytes {
+			t.Fatalf("datagram of %d bytes exceeds %d", n, maxDatagramBytes)
+		}
+		datagrams++
+		lines += strings.Count(string(buf[:n]), "\n")
+	}
+	if datagrams < 2 {
+		t.Fatalf("expected the batch to be split, got %d datagram", datagrams)
+	}
+}
@@ -0,0 +1,216 @@
+// Package analytics persists call lifecycle events to a rotating JSONL file
+// and exports call quality metrics to external time-series sinks.
+package analytics
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/tariel-x/gocall/internal/models"
+)
+
+const queueSize = 256
+
+// Writer appends call events to a JSONL file from a background goroutine.
+// Record never blocks: events are dropped when the queue is full.
+type Writer struct {
+	path     string
+	maxBytes int64
+	maxFiles int
+	logger   *slog.Logger
+
+	events    chan models.CallEvent
+	stop      chan struct{}
+	done      chan struct{}
+	closeOnce sync.Once
+
+	file *os.File
+	size int64
+}
+
+// NewWriter opens path for appending. Once the file would exceed maxBytes it
+// is rotated to path.1 … path.<maxFiles>, dropping the oldest.
+func NewWriter(path string, maxBytes int64, maxFiles int, logger *slog.Logger) (*Writer, error) {
+	if maxBytes <= 0 {
+		return nil, fmt.Errorf("max bytes must be positive, got %d", maxBytes)
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return nil, fmt.Errorf("failed to create analytics directory: %w", err)
+	}
+
+	w := &Writer{
+		path:     path,
+		maxBytes: maxBytes,
+		maxFiles: maxFiles,
+		logger:   logger,
+		events:   make(chan models.CallEvent, queueSize),
+		stop:     make(chan struct{}),
+		done:     make(chan struct{}),
+	}
+	if err := w.open(); err != nil {
+		return nil, err
+	}
+
+	go w.run()
+	return w, nil
+}
+
+// Record queues an event for writing.
+func (w *Writer) Record(event models.CallEvent) {
+	select {
+	case <-w.stop:
+	case w.events <- event:
+	default:
+		w.logger.Warn("analytics queue full, dropping event", "type", event.Type, "call_id", event.CallID)
+	}
+}
+
+// Close flushes queued events and closes the file.
+func (w *Writer) Close() error {
+	w.closeOnce.Do(func() {
+		close(w.stop)
+	})
+	<-w.done
+	return w.file.Close()
+}
+
+func (w *Writer) run() {
+	defer close(w.done)
+	for {
+		select {
+		case event := <-w.events:
+			w.write(event)
+		case <-w.stop:
+			for {
+				select {
+				case event := <-w.events:
+					w.write(event)
+				default:
+					return
+				}
+			}
+		}
+	}
+}
+
+func (w *Writer) write(event models.CallEvent) {
+	line, err := json.Marshal(event)
+	if err != nil {
+		return
+	}
+	line = append(line, '\n')
+
+	if w.size > 0 && w.size+int64(len(line)) > w.maxBytes {
+		if err := w.rotate(); err != nil {
+			w.logger.Error("failed to rotate analytics file", "error", err)
+		}
+	}
+
+	n, err := w.file.Write(line)
+	w.size += int64(n)
+	if err != nil {
+		w.logger.Error("failed to write analytics event", "error", err)
+	}
+}
+
+func (w *Writer) open() error {
+	f, err := os.OpenFile(w.path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0600)
+	if err != nil {
+		return fmt.Errorf("failed to open analytics file: %w", err)
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return err
+	}
+	w.file = f
+	w.size = info.Size()
+	return nil
+}
+
+func (w *Writer) rotate() error {
+	if err := w.file.Close(); err != nil {
+		return err
+	}
+	if w.maxFiles > 0 {
+		_ = os.Remove(rotatedName(w.path, w.maxFiles))
+		for i := w.maxFiles - 1; i >= 1; i-- {
+			_ = os.Rename(rotatedName(w.path, i), rotatedName(w.path, i+1))
+		}
+		if err := os.Rename(w.path, rotatedName(w.path, 1)); err != nil {
+			return err
+		}
+	} else if err := os.Remove(w.path); err != nil {
+		return err
+	}
+	return w.open()
+}
+
+func rotatedName(path string, n int) string {
+	return fmt.Sprintf("%s.%d", path, n)
+}
+
+// Totals counts call events by type.
+type Totals struct {
+	Created int
+	Joined  int
+	Ended   int
+}
+
+// ReadTotals counts the events kept in path and its rotated files, so
+// lifetime figures survive a restart for as long as the log holds them.
+// Missing files count as empty.
+func ReadTotals(path string, maxFiles int) (Totals, error) {
+	var totals Totals
+	names := []string{path}
+	for i := 1; i <= maxFiles; i++ {
+		names = append(names, rotatedName(path, i))
+	}
+	for _, name := range names {
+		events, err := readEvents(name)
+		if errors.Is(err, fs.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return Totals{}, fmt.Errorf("%s: %w", name, err)
+		}
+		for _, event := range events {
+			switch event.Type {
+			case models.CallEventCreated:
+				totals.Created++
+			case models.CallEventJoined:
+				totals.Joined++
+			case models.CallEventEnded:
+				totals.Ended++
+			}
+		}
+	}
+	return totals, nil
+}
+
+// readEvents loads all events from a single JSONL file.
+func readEvents(path string) ([]models.CallEvent, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var events []models.CallEvent
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var event models.CallEvent
+		if err := json.Unmarshal(scanner.Bytes(), &event); err != nil {
+			return nil, fmt.Errorf("invalid analytics line: %w", err)
+		}
+		events = append(events, event)
+	}
+	return events, scanner.Err()
+}
@@ -0,0 +1,109 @@
+package analytics
+
+import (
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/tariel-x/gocall/internal/handlers"
+	"github.com/tariel-x/gocall/internal/models"
+)
+
+func TestWriterRoundTripsStoreEvents(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "events.jsonl")
+	w, err := NewWriter(path, 1<<20, 3, slog.New(slog.NewTextHandler(io.Discard, nil)))
+	if err != nil {
+		t.Fatalf("NewWriter: %v", err)
+	}
+
+	store := handlers.NewCallStore()
+	store.SetEventSink(w)
+
+	now := time.Now()
+	call, err := store.CreateCall(now, handlers.CreateCallOptions{})
+	if err != nil {
+		t.Fatalf("CreateCall: %v", err)
+	}
+	if _, _, err := store.Join(call.ID, now.Add(time.Second)); err != nil {
+		t.Fatalf("Join: %v", err)
+	}
+	if _, err := store.EndCall(call.ID, models.CallEndReasonLeft, now.Add(time.Minute)); err != nil {
+		t.Fatalf("EndCall: %v", err)
+	}
+
+	if err := w.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+
+	events, err := readEvents(path)
+	if err != nil {
+		t.Fatalf("readEvents: %v", err)
+	}
+	want := []models.CallEventType{models.CallEventCreated, models.CallEventJoined, models.CallEventEnded}
+	if len(events) != len(want) {
+		t.Fatalf("got %d events, want %d", len(events), len(want))
+	}
+	for i, event := range events {
+		if event.Type != want[i] || event.CallID != call.ID {
+			t.Fatalf("event %d = %+v, want type %s for %s", i, event, want[i], call.ID)
+		}
+	}
+	if events[2].Duration != time.Minute {
+		t.Fatalf("ended duration = %v, want 1m", events[2].Duration)
+	}
+}
+
+func TestWriterRotates(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "events.jsonl")
+	w, err := NewWriter(path, 100, 2, slog.New(slog.NewTextHandler(io.Discard, nil)))
+	if err != nil {
+		t.Fatalf("NewWriter: %v", err)
+	}
+	for i := 0; i < 10; i++ {
+		w.Record(models.CallEvent{Type: models.CallEventCreated, CallID: "call", At: time.Now()})
+	}
+	if err := w.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+
+	for _, name := range []string{path, path + ".1", path + ".2"} {
+		if _, err := os.Stat(name); err != nil {
+			t.Fatalf("expected %s to exist: %v", name, err)
+		}
+	}
+	if _, err := os.Stat(path + ".3"); !os.IsNotExist(err) {
+		t.Fatalf("expected %s.3 to be pruned", path)
+	}
+}
+
+func TestReadTotalsCountsRotatedFiles(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "events.jsonl")
+	if totals, err := ReadTotals(path, 2); err != nil || totals != (Totals{}) {
+		t.Fatalf("totals without a log = %+v, %v", totals, err)
+	}
+
+	w, err := NewWriter(path, 200, 2, slog.New(slog.NewTextHandler(io.Discard, nil)))
+	if err != nil {
+		t.Fatalf("NewWriter: %v", err)
+	}
+	for _, eventType := range []models.CallEventType{models.CallEventCreated, models.CallEventJoined, models.CallEventEnded, models.CallEventCreated} {
+		w.Record(models.CallEvent{Type: eventType, CallID: "call", At: time.Now()})
+	}
+	if err := w.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+	if _, err := os.Stat(path + ".1"); err != nil {
+		t.Fatalf("expected the log to have rotated: %v", err)
+	}
+
+	totals, err := ReadTotals(path, 2)
+	if err != nil {
+		t.Fatalf("ReadTotals: %v", err)
+	}
+	if want := (Totals{Created: 2, Joined: 1, Ended: 1}); totals != want {
+		t.Fatalf("totals = %+v, want %+v", totals, want)
+	}
+}
@@ -1,9 +1,13 @@
 package config
 
 import (
+	"encoding/json"
+	"fmt"
+	"net/netip"
 	"os"
 	"strconv"
 	"strings"
+	"time"
 )
 
 type Config struct {
@@ -12,13 +16,182 @@ type Config struct {
 	Domain    string
 	TURNPort  int
 	TURNRealm string
+	// TURNListenAddress binds TURN to one IPv4 address or interface name
+	// (empty = all interfaces)
+	TURNListenAddress string
+
+	TURNTCPEnabled    bool          // also accept TURN over TCP on TURNPort
+	TURNCredentialTTL time.Duration // lifetime of credentials handed to clients
+	// TURNS listener (0 = disabled). Uses the HTTPS certificate unless a
+	// cert/key pair is given.
+	TURNTLSPort     int
+	TURNTLSCertFile string
+	TURNTLSKeyFile  string
+	// TURNPublicIP skips public IP detection and relays via this address;
+	// otherwise ipify.org is asked, waiting at most TURNPublicIPTimeout
+	TURNPublicIP        string
+	TURNPublicIPTimeout time.Duration
+	// TURNIPv6 adds IPv6 TURN listeners relaying from TURNPublicIPv6 (or a
+	// detected IPv6 address)
+	TURNIPv6       bool
+	TURNPublicIPv6 string
+	// TURN public IP cache: 0 TTL disables caching
+	TURNPublicIPCacheTTL   time.Duration
+	TURNPublicIPCacheTrust bool
+	// Cache of TURN auth keys: 0 size disables it
+	TURNAuthCacheSize int
+	TURNAuthCacheTTL  time.Duration
+	// MaxConnections caps concurrent connections on the main listener (0 = unlimited)
+	MaxConnections int
+	// Proactive Let's Encrypt certificate check schedule
+	CertCheckDelay    time.Duration
+	CertCheckInterval time.Duration
+	CertRenewBefore   time.Duration
+	// HTTP protocol toggles for the HTTPS server
+	DisableHTTP2 bool
+	EnableHTTP3  bool
+	// SystemNotice is sent to every WS client after join (empty = disabled).
+	// SystemNoticeTranslations maps a language tag (e.g. "ru") to a variant.
+	SystemNotice             string
+	SystemNoticeTranslations map[string]string
+	// WSRelayPolicies overrides the relay policy per WS message type
+	// ("*" sets the fallback for unlisted types).
+	WSRelayPolicies map[string]string
+	// Limits for messages clients send over WS
+	WS WSConfig
+	// Origins allowed to open WS connections ("*" = any). Empty means
+	// same-origin only, or FrontendURI in --http-only mode.
+	AllowedWSOrigins []string
+	// Client IP policy for creating, joining and connecting to calls. With an
+	// allow list only matching IPs (and loopback) get in; the block list
+	// always wins. TrustedProxies decides whose X-Forwarded-For is believed
+	// (empty = trust every proxy, gin's default).
+	IPAllowList    []netip.Prefix
+	IPBlockList    []netip.Prefix
+	TrustedProxies []string
+	// LogClientIP controls how client IPs appear in logs: "full", "hash" or "omit"
+	LogClientIP string
+	// ClientLogEnabled exposes the client diagnostics endpoint
+	ClientLogEnabled bool
+	// External ICE server provider returning {"iceServers": [...]}
+	ICEProviderURL      string
+	ICEProviderCacheTTL time.Duration
+	ICEProviderTimeout  time.Duration
+	ICEProviderMerge    bool // append to the built-in TURN instead of replacing it
+	// Static STUN/TURN servers added to every ICE config; with
+	// DisableBuiltinTURN the bundled TURN server isn't started at all
+	ExternalICEServers []ICEServer
+	DisableBuiltinTURN bool
+	// Call analytics JSONL log (empty path = disabled)
+	AnalyticsFile     string
+	AnalyticsMaxBytes int64
+	AnalyticsMaxFiles int
+	// Export aggregated client call-stats to a UDP line protocol listener
+	// (StatsD/InfluxDB/Telegraf; empty address = disabled)
+	CallStatsExportAddr     string
+	CallStatsExportInterval time.Duration
+	// MaxCallParticipants is how many peers a call holds; above 2 peers
+	// connect as a mesh, each pair negotiating its own connection
+	MaxCallParticipants int
+	// In-memory call store: how long a call lives after its last state
+	// change, how often expired calls are swept, and how long ended calls
+	// answer 410 Gone before they become 404
+	CallTTL             time.Duration
+	CallCleanupInterval time.Duration
+	CallEndedRetention  time.Duration
+	// In-memory call store: refuse new calls while this many are live
+	// (0 = unlimited)
+	MaxConcurrentCalls int
+	// End waiting calls whose host sent nothing for this long (0 = disabled)
+	WaitingIdleTimeout time.Duration
+	// Reject a peer's WS reconnects with 429 for WSReconnectBackoff once it
+	// makes more than WSReconnectLimit attempts within WSReconnectWindow
+	// (limit 0 = disabled)
+	WSReconnectLimit   int
+	WSReconnectWindow  time.Duration
+	WSReconnectBackoff time.Duration
+	// Rebuild calls unknown to this server (e.g. after a restart) from the
+	// reconnecting client's call_id, peer_id and role
+	ResumeUnknownCalls bool
+	// Shared call store for multi-instance deployments (empty = in-memory)
+	RedisURL       string
+	RedisKeyPrefix string
+	// Call store of a single instance: "memory" or "sqlite", which keeps
+	// calls in the file at CallStoreSQLitePath across restarts. Ignored
+	// in favour of Redis when RedisURL is set.
+	CallStoreBackend    string
+	CallStoreSQLitePath string
+	// Hybrid auth for call creation and joining: "off" keeps calls
+	// anonymous, "optional" binds a call to the user of an HS256 JWT signed
+	// with CallAuthSecret when one is sent, "required" rejects requests
+	// without one. CallAuthMaxCallsPerUser caps a user's live calls (0 = unlimited).
+	// Tokens without exp expire CallAuthTokenMaxAge after their iat (0 = never).
+	CallAuthMode            string
+	CallAuthSecret          string
+	CallAuthMaxCallsPerUser int
+	CallAuthTokenMaxAge     time.Duration
+	// ClockSkewTolerance is how far past expiry or before nbf JWTs and
+	// ephemeral TURN credentials are still accepted, for clients whose
+	// clocks are slightly off.
+	ClockSkewTolerance time.Duration
+	// Bearer token for operator endpoints such as /api/turn-stats
+	// (empty = those endpoints are disabled)
+	AdminToken string
+	// Start in maintenance mode: new calls and joins get 503 with
+	// MaintenanceMessage. Operators toggle it at runtime via /api/maintenance.
+	MaintenanceMode    bool
+	MaintenanceMessage string
+	// Identifies this server in the X-Gocall-Instance header, logs and WS join
+	InstanceID string
 	// Backend-only mode fields
-	HTTPOnly    bool
-	FrontendURI string
+	HTTPOnly          bool
+	FrontendURI       string
+	DisableEmbeddedUI bool // don't serve the bundled React app at all
+}
+
+// WSConfig limits what a single WS client may send and how the server
+// writes to it. Zero values fall back to the defaults, except MessageRate
+// where 0 disables rate limiting.
+type WSConfig struct {
+	// Larger frames close the connection (1009 Message Too Big)
+	MaxMessageBytes int64
+	// Token bucket per connection: MessageRate messages per second with
+	// bursts of up to MessageBurst; clients over it are disconnected
+	MessageRate  int
+	MessageBurst int
+	// Negotiate permessage-deflate and compress outgoing messages at
+	// CompressionLevel (1 fastest .. 9 smallest, -2 Huffman only)
+	Compression      bool
+	CompressionLevel int
 }
 
-// Load loads configuration from config.json (if exists) and overrides with command-line flags
-func Load(httpOnly *bool) *Config {
+const (
+	DefaultWSMaxMessageBytes  = 256 << 10
+	DefaultWSMessageRate      = 50
+	DefaultWSMessageBurst     = 100
+	DefaultWSCompressionLevel = 1
+)
+
+const (
+	LogClientIPFull = "full"
+	LogClientIPHash = "hash"
+	LogClientIPOmit = "omit"
+)
+
+const (
+	CallStoreMemory = "memory"
+	CallStoreSQLite = "sqlite"
+)
+
+const (
+	CallAuthOff      = "off"
+	CallAuthOptional = "optional"
+	CallAuthRequired = "required"
+)
+
+// Load reads the configuration from environment variables, falling back to
+// defaults, and applies the command-line flags on top.
+func Load(httpOnly *bool) (*Config, error) {
 	var cfg *Config
 
 	// Initialize with defaults
@@ -29,9 +202,189 @@ func Load(httpOnly *bool) *Config {
 		TURNPort:  getEnvInt("TURN_PORT", 3478),
 		TURNRealm: getEnv("TURN_REALM", "familycall"),
 
-		FrontendURI: getEnv("FRONTEND_URI", ""),
+		TURNListenAddress: getEnv("TURN_LISTEN_ADDRESS", ""),
+
+		TURNTCPEnabled:    getEnvBool("TURN_TCP_ENABLED", true),
+		TURNCredentialTTL: getEnvDuration("TURN_CREDENTIAL_TTL", 12*time.Hour),
+		TURNTLSPort:       getEnvInt("TURN_TLS_PORT", 0),
+		TURNTLSCertFile:   getEnv("TURN_TLS_CERT_FILE", ""),
+		TURNTLSKeyFile:    getEnv("TURN_TLS_KEY_FILE", ""),
+
+		TURNPublicIP:        getEnv("TURN_PUBLIC_IP", ""),
+		TURNPublicIPTimeout: getEnvDuration("TURN_PUBLIC_IP_TIMEOUT", 5*time.Second),
+		TURNIPv6:            getEnvBool("TURN_IPV6", false),
+		TURNPublicIPv6:      getEnv("TURN_PUBLIC_IPV6", ""),
+
+		TURNPublicIPCacheTTL:   getEnvDuration("TURN_PUBLIC_IP_CACHE_TTL", 0),
+		TURNPublicIPCacheTrust: getEnvBool("TURN_PUBLIC_IP_CACHE_TRUST", true),
+
+		TURNAuthCacheSize: getEnvInt("TURN_AUTH_CACHE_SIZE", 1024),
+		TURNAuthCacheTTL:  getEnvDuration("TURN_AUTH_CACHE_TTL", time.Minute),
+
+		MaxConnections: getEnvInt("MAX_CONNECTIONS", 0),
+
+		CertCheckDelay:    getEnvDuration("CERT_CHECK_DELAY", 30*time.Second),
+		CertCheckInterval: getEnvDuration("CERT_CHECK_INTERVAL", 30*24*time.Hour),
+		CertRenewBefore:   getEnvDuration("CERT_RENEW_BEFORE", 30*24*time.Hour),
+
+		DisableHTTP2: getEnvBool("DISABLE_HTTP2", false),
+		EnableHTTP3:  getEnvBool("ENABLE_HTTP3", false),
+
+		SystemNotice: getEnv("SYSTEM_NOTICE", ""),
+
+		WS: WSConfig{
+			MaxMessageBytes: int64(getEnvInt("WS_MAX_MESSAGE_BYTES", DefaultWSMaxMessageBytes)),
+			MessageRate:     getEnvInt("WS_MESSAGE_RATE", DefaultWSMessageRate),
+			MessageBurst:    getEnvInt("WS_MESSAGE_BURST", DefaultWSMessageBurst),
+
+			Compression:      getEnvBool("WS_COMPRESSION", true),
+			CompressionLevel: getEnvInt("WS_COMPRESSION_LEVEL", DefaultWSCompressionLevel),
+		},
+
+		LogClientIP: getEnv("LOG_CLIENT_IP", LogClientIPFull),
+
+		ClientLogEnabled: getEnvBool("CLIENT_LOG_ENABLED", false),
+
+		ICEProviderURL:      getEnv("ICE_PROVIDER_URL", ""),
+		ICEProviderCacheTTL: getEnvDuration("ICE_PROVIDER_CACHE_TTL", 5*time.Minute),
+		ICEProviderTimeout:  getEnvDuration("ICE_PROVIDER_TIMEOUT", 3*time.Second),
+		ICEProviderMerge:    getEnvBool("ICE_PROVIDER_MERGE", true),
+
+		DisableBuiltinTURN: getEnvBool("DISABLE_BUILTIN_TURN", false),
+
+		AnalyticsFile:     getEnv("ANALYTICS_FILE", ""),
+		AnalyticsMaxBytes: int64(getEnvInt("ANALYTICS_MAX_BYTES", 10<<20)),
+		AnalyticsMaxFiles: getEnvInt("ANALYTICS_MAX_FILES", 3),
+
+		CallStatsExportAddr:     getEnv("CALL_STATS_EXPORT_ADDR", ""),
+		CallStatsExportInterval: getEnvDuration("CALL_STATS_EXPORT_INTERVAL", 10*time.Second),
+
+		MaxCallParticipants: getEnvInt("MAX_CALL_PARTICIPANTS", 2),
+
+		CallTTL:             getEnvDuration("CALL_TTL", 30*time.Minute),
+		CallCleanupInterval: getEnvDuration("CALL_CLEANUP_INTERVAL", 3*time.Hour),
+		CallEndedRetention:  getEnvDuration("CALL_ENDED_RETENTION", 5*time.Minute),
+		MaxConcurrentCalls:  getEnvInt("MAX_CONCURRENT_CALLS", 0),
+
+		WaitingIdleTimeout: getEnvDuration("WAITING_IDLE_TIMEOUT", 10*time.Minute),
+
+		WSReconnectLimit:   getEnvInt("WS_RECONNECT_LIMIT", 10),
+		WSReconnectWindow:  getEnvDuration("WS_RECONNECT_WINDOW", 30*time.Second),
+		WSReconnectBackoff: getEnvDuration("WS_RECONNECT_BACKOFF", 30*time.Second),
+
+		ResumeUnknownCalls: getEnvBool("RESUME_UNKNOWN_CALLS", false),
+
+		RedisURL:       getEnv("REDIS_URL", ""),
+		RedisKeyPrefix: getEnv("REDIS_KEY_PREFIX", "gocall:"),
+
+		CallStoreBackend:    getEnv("CALL_STORE_BACKEND", CallStoreMemory),
+		CallStoreSQLitePath: getEnv("CALL_STORE_SQLITE_PATH", "gocall.db"),
+
+		CallAuthMode:            getEnv("CALL_AUTH_MODE", CallAuthOff),
+		CallAuthSecret:          getEnv("CALL_AUTH_SECRET", ""),
+		CallAuthMaxCallsPerUser: getEnvInt("CALL_AUTH_MAX_CALLS_PER_USER", 0),
+		CallAuthTokenMaxAge:     getEnvDuration("CALL_AUTH_TOKEN_MAX_AGE", 24*time.Hour),
+		ClockSkewTolerance:      getEnvDuration("CLOCK_SKEW_TOLERANCE", 30*time.Second),
+
+		AdminToken: getEnv("ADMIN_TOKEN", ""),
+
+		MaintenanceMode:    getEnvBool("MAINTENANCE_MODE", false),
+		MaintenanceMessage: getEnv("MAINTENANCE_MESSAGE", ""),
+
+		InstanceID: getEnv("INSTANCE_ID", defaultInstanceID()),
+
+		FrontendURI:       getEnv("FRONTEND_URI", ""),
+		DisableEmbeddedUI: getEnvBool("DISABLE_EMBEDDED_UI", false),
+	}
+
+	if cfg.TURNPublicIP != "" && !isIPFamily(cfg.TURNPublicIP, false) {
+		return nil, fmt.Errorf("TURN_PUBLIC_IP: invalid IPv4 address %q", cfg.TURNPublicIP)
+	}
+	if isIPFamily(cfg.TURNListenAddress, true) {
+		return nil, fmt.Errorf("TURN_LISTEN_ADDRESS: expected an IPv4 address or an interface name, got %q", cfg.TURNListenAddress)
+	}
+	if cfg.TURNPublicIPv6 != "" && !isIPFamily(cfg.TURNPublicIPv6, true) {
+		return nil, fmt.Errorf("TURN_PUBLIC_IPV6: invalid IPv6 address %q", cfg.TURNPublicIPv6)
+	}
+
+	if cfg.TURNAuthCacheSize < 0 || cfg.TURNAuthCacheTTL < 0 {
+		return nil, fmt.Errorf("TURN_AUTH_CACHE_SIZE and TURN_AUTH_CACHE_TTL must not be negative")
 	}
 
+	if cfg.MaxCallParticipants < 2 {
+		return nil, fmt.Errorf("MAX_CALL_PARTICIPANTS: a call needs at least 2 participants, got %d", cfg.MaxCallParticipants)
+	}
+
+	if cfg.WS.MaxMessageBytes < 0 || cfg.WS.MessageRate < 0 || cfg.WS.MessageBurst < 0 {
+		return nil, fmt.Errorf("WS_MAX_MESSAGE_BYTES, WS_MESSAGE_RATE and WS_MESSAGE_BURST must not be negative")
+	}
+
+	if cfg.WS.CompressionLevel < -2 || cfg.WS.CompressionLevel > 9 {
+		return nil, fmt.Errorf("WS_COMPRESSION_LEVEL: expected -2..9, got %d", cfg.WS.CompressionLevel)
+	}
+
+	if cfg.CallAuthTokenMaxAge < 0 {
+		return nil, fmt.Errorf("CALL_AUTH_TOKEN_MAX_AGE: must not be negative, got %s", cfg.CallAuthTokenMaxAge)
+	}
+	if cfg.ClockSkewTolerance < 0 {
+		return nil, fmt.Errorf("CLOCK_SKEW_TOLERANCE: must not be negative, got %s", cfg.ClockSkewTolerance)
+	}
+	if cfg.MaxConcurrentCalls < 0 {
+		return nil, fmt.Errorf("MAX_CONCURRENT_CALLS: must not be negative, got %d", cfg.MaxConcurrentCalls)
+	}
+
+	switch cfg.CallStoreBackend {
+	case CallStoreMemory:
+	case CallStoreSQLite:
+		if cfg.RedisURL != "" {
+			return nil, fmt.Errorf("CALL_STORE_BACKEND=sqlite cannot be combined with REDIS_URL")
+		}
+	default:
+		return nil, fmt.Errorf("CALL_STORE_BACKEND: expected memory or sqlite, got %q", cfg.CallStoreBackend)
+	}
+
+	switch cfg.LogClientIP {
+	case LogClientIPFull, LogClientIPHash, LogClientIPOmit:
+	default:
+		return nil, fmt.Errorf("LOG_CLIENT_IP: expected full, hash or omit, got %q", cfg.LogClientIP)
+	}
+
+	switch cfg.CallAuthMode {
+	case CallAuthOff:
+	case CallAuthOptional, CallAuthRequired:
+		if cfg.CallAuthSecret == "" {
+			return nil, fmt.Errorf("CALL_AUTH_SECRET is required when CALL_AUTH_MODE is %q", cfg.CallAuthMode)
+		}
+	default:
+		return nil, fmt.Errorf("CALL_AUTH_MODE: expected off, optional or required, got %q", cfg.CallAuthMode)
+	}
+
+	var err error
+	if cfg.SystemNoticeTranslations, err = parseStringMap(os.Getenv("SYSTEM_NOTICE_TRANSLATIONS")); err != nil {
+		return nil, fmt.Errorf("SYSTEM_NOTICE_TRANSLATIONS: %w", err)
+	}
+	if cfg.WSRelayPolicies, err = parseStringMap(os.Getenv("WS_RELAY_POLICIES")); err != nil {
+		return nil, fmt.Errorf("WS_RELAY_POLICIES: %w", err)
+	}
+
+	servers, err := parseICEServers(os.Getenv("EXTERNAL_ICE_SERVERS"))
+	if err != nil {
+		return nil, fmt.Errorf("EXTERNAL_ICE_SERVERS: %w", err)
+	}
+	cfg.ExternalICEServers = servers
+
+	if cfg.IPAllowList, err = parsePrefixList(os.Getenv("IP_ALLOW_LIST")); err != nil {
+		return nil, fmt.Errorf("IP_ALLOW_LIST: %w", err)
+	}
+	if cfg.IPBlockList, err = parsePrefixList(os.Getenv("IP_BLOCK_LIST")); err != nil {
+		return nil, fmt.Errorf("IP_BLOCK_LIST: %w", err)
+	}
+	if _, err = parsePrefixList(os.Getenv("TRUSTED_PROXIES")); err != nil {
+		return nil, fmt.Errorf("TRUSTED_PROXIES: %w", err)
+	}
+	cfg.TrustedProxies = splitList(os.Getenv("TRUSTED_PROXIES"))
+	cfg.AllowedWSOrigins = splitList(os.Getenv("WS_ALLOWED_ORIGINS"))
+
 	// Override with command-line flags if provided
 	if httpOnly != nil {
 		cfg.HTTPOnly = *httpOnly
@@ -40,7 +393,26 @@ func Load(httpOnly *bool) *Config {
 		cfg.FrontendURI = strings.TrimSuffix(cfg.FrontendURI, "/")
 	}
 
-	return cfg
+	// A separately hosted frontend is the one origin its WS must come from.
+	if len(cfg.AllowedWSOrigins) == 0 && cfg.HTTPOnly && cfg.FrontendURI != "" {
+		cfg.AllowedWSOrigins = []string{cfg.FrontendURI}
+	}
+
+	return cfg, nil
+}
+
+// BuiltinTURNEnabled reports whether the bundled TURN server should run.
+// It can only be turned off when external servers take its place.
+func (c *Config) BuiltinTURNEnabled() bool {
+	return !c.DisableBuiltinTURN || len(c.ExternalICEServers) == 0
+}
+
+func defaultInstanceID() string {
+	hostname, err := os.Hostname()
+	if err != nil {
+		return ""
+	}
+	return hostname
 }
 
 func getEnv(key, defaultValue string) string {
@@ -58,3 +430,34 @@ func getEnvInt(key string, defaultValue int) int {
 	}
 	return defaultValue
 }
+
+func getEnvBool(key string, defaultValue bool) bool {
+	if value := os.Getenv(key); value != "" {
+		if boolValue, err := strconv.ParseBool(value); err == nil {
+			return boolValue
+		}
+	}
+	return defaultValue
+}
+
+func getEnvDuration(key string, defaultValue time.Duration) time.Duration {
+	if value := os.Getenv(key); value != "" {
+		if durationValue, err := time.ParseDuration(value); err == nil {
+			return durationValue
+		}
+	}
+	return defaultValue
+}
+
+// parseStringMap parses a JSON object of strings, e.g. {"ru":"..."}. An
+// empty value yields a nil map.
+func parseStringMap(value string) (map[string]string, error) {
+	if value == "" {
+		return nil, nil
+	}
+	var m map[string]string
+	if err := json.Unmarshal([]byte(value), &m); err != nil {
+		return nil, fmt.Errorf("expected a JSON object of strings: %w", err)
+	}
+	return m, nil
+}
@@ -0,0 +1,61 @@
+package config
+
+import "testing"
+
+func TestLoadRejectsMalformedStringMaps(t *testing.T) {
+	for _, key := range []string{"SYSTEM_NOTICE_TRANSLATIONS", "WS_RELAY_POLICIES"} {
+		t.Run(key, func(t *testing.T) {
+			t.Setenv(key, `{"ru":`)
+			if _, err := Load(nil); err == nil {
+				t.Fatalf("expected an error for malformed %s", key)
+			}
+
+			t.Setenv(key, `{"ru":"Привет"}`)
+			if _, err := Load(nil); err != nil {
+				t.Fatalf("valid %s rejected: %v", key, err)
+			}
+		})
+	}
+}
+
+func TestLoadCallStoreBackend(t *testing.T) {
+	cfg, err := Load(nil)
+	if err != nil || cfg.CallStoreBackend != CallStoreMemory {
+		t.Fatalf("default backend = %q, %v", cfg.CallStoreBackend, err)
+	}
+
+	t.Setenv("CALL_STORE_BACKEND", "sqlite")
+	if cfg, err := Load(nil); err != nil || cfg.CallStoreBackend != CallStoreSQLite {
+		t.Fatalf("sqlite backend = %+v, %v", cfg, err)
+	}
+
+	t.Setenv("REDIS_URL", "redis://localhost:6379/0")
+	if _, err := Load(nil); err == nil {
+		t.Fatalf("expected sqlite with REDIS_URL to be rejected")
+	}
+
+	t.Setenv("REDIS_URL", "")
+	t.Setenv("CALL_STORE_BACKEND", "postgres")
+	if _, err := Load(nil); err == nil {
+		t.Fatalf("expected an unknown backend to be rejected")
+	}
+}
+
+func TestLoadLogClientIP(t *testing.T) {
+	for _, mode := range []string{LogClientIPFull, LogClientIPHash, LogClientIPOmit} {
+		t.Setenv("LOG_CLIENT_IP", mode)
+		if cfg, err := Load(nil); err != nil || cfg.LogClientIP != mode {
+			t.Fatalf("LOG_CLIENT_IP=%s: got %+v, %v", mode, cfg, err)
+		}
+	}
+
+	t.Setenv("LOG_CLIENT_IP", "hashed")
+	if _, err := Load(nil); err == nil {
+		t.Fatalf("expected an unknown mode to be rejected")
+	}
+
+	cfg := &Config{LogClientIP: "hashed"}
+	if got := cfg.ClientIPForLog("192.0.2.1"); got != "" {
+		t.Fatalf("unknown mode logged %q", got)
+	}
+}
@@ -0,0 +1,127 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// ICEServer is a STUN/TURN server handed to clients alongside (or instead
+// of) the built-in TURN server, in RTCIceServer form.
+type ICEServer struct {
+	URLs       []string `json:"urls"`
+	Username   string   `json:"username,omitempty"`
+	Credential string   `json:"credential,omitempty"`
+}
+
+// UnmarshalJSON accepts "urls" as either a string or a list, like RTCIceServer.
+func (s *ICEServer) UnmarshalJSON(data []byte) error {
+	var raw struct {
+		URLs       json.RawMessage `json:"urls"`
+		Username   string          `json:"username"`
+		Credential string          `json:"credential"`
+	}
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return err
+	}
+
+	var urls []string
+	if len(raw.URLs) > 0 && raw.URLs[0] == '"' {
+		var single string
+		if err := json.Unmarshal(raw.URLs, &single); err != nil {
+			return err
+		}
+		urls = []string{single}
+	} else if len(raw.URLs) > 0 {
+		if err := json.Unmarshal(raw.URLs, &urls); err != nil {
+			return fmt.Errorf("urls: %w", err)
+		}
+	}
+
+	*s = ICEServer{URLs: urls, Username: raw.Username, Credential: raw.Credential}
+	return nil
+}
+
+// parseICEServers decodes and validates a JSON list of ICE servers.
+func parseICEServers(value string) ([]ICEServer, error) {
+	if value == "" {
+		return nil, nil
+	}
+	var servers []ICEServer
+	if err := json.Unmarshal([]byte(value), &servers); err != nil {
+		return nil, err
+	}
+	for i, server := range servers {
+		if err := server.validate(); err != nil {
+			return nil, fmt.Errorf("server %d: %w", i, err)
+		}
+	}
+	return servers, nil
+}
+
+func (s ICEServer) validate() error {
+	if len(s.URLs) == 0 {
+		return fmt.Errorf("no urls")
+	}
+	for _, raw := range s.URLs {
+		scheme, err := validateICEURL(raw)
+		if err != nil {
+			return fmt.Errorf("%q: %w", raw, err)
+		}
+		// Browsers refuse TURN entries without credentials.
+		if (scheme == "turn" || scheme == "turns") && (s.Username == "" || s.Credential == "") {
+			return fmt.Errorf("%q: username and credential are required for TURN", raw)
+		}
+	}
+	return nil
+}
+
+// validateICEURL checks a stun:/stuns:/turn:/turns: URI (RFC 7064, RFC 7065)
+// and returns its scheme.
+func validateICEURL(raw string) (string, error) {
+	u, err := url.Parse(raw)
+	if err != nil {
+		return "", err
+	}
+	scheme := strings.ToLower(u.Scheme)
+	switch scheme {
+	case "stun", "stuns", "turn", "turns":
+	default:
+		return "", fmt.Errorf("unsupported scheme %q", u.Scheme)
+	}
+	if u.Opaque == "" {
+		return "", fmt.Errorf("expected scheme:host[:port]")
+	}
+
+	host, port := u.Opaque, ""
+	if h, p, err := net.SplitHostPort(u.Opaque); err == nil {
+		host, port = h, p
+	}
+	if host == "" || strings.ContainsAny(host, "/@") {
+		return "", fmt.Errorf("invalid host")
+	}
+	if port != "" {
+		if n, err := strconv.Atoi(port); err != nil || n < 1 || n > 65535 {
+			return "", fmt.Errorf("invalid port %q", port)
+		}
+	}
+
+	query := u.Query()
+	if len(query) > 0 {
+		if scheme == "stun" || scheme == "stuns" {
+			return "", fmt.Errorf("query not allowed for %s", scheme)
+		}
+		for key := range query {
+			if key != "transport" {
+				return "", fmt.Errorf("unknown parameter %q", key)
+			}
+		}
+		if t := query.Get("transport"); t != "udp" && t != "tcp" {
+			return "", fmt.Errorf("invalid transport %q", t)
+		}
+	}
+	return scheme, nil
+}
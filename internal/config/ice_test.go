@@ -0,0 +1,50 @@
+package config
+
+import "testing"
+
+func TestParseICEServers(t *testing.T) {
+	servers, err := parseICEServers(`[
+		{"urls":"stun:stun.example.test"},
+		{"urls":["turn:turn.example.test:3478","turns:turn.example.test:443?transport=tcp"],"username":"u","credential":"p"},
+		{"urls":"stun:[2001:db8::1]:3478"}
+	]`)
+	if err != nil {
+		t.Fatalf("parse failed: %v", err)
+	}
+	if len(servers) != 3 || len(servers[1].URLs) != 2 || servers[1].Credential != "p" {
+		t.Fatalf("unexpected servers %+v", servers)
+	}
+	if servers[0].URLs[0] != "stun:stun.example.test" {
+		t.Fatalf("single url not normalized to a list: %+v", servers[0])
+	}
+}
+
+func TestParseICEServersRejectsMalformed(t *testing.T) {
+	cases := map[string]string{
+		"not json":          `{`,
+		"no urls":           `[{"username":"u"}]`,
+		"http scheme":       `[{"urls":"https://turn.example.test"}]`,
+		"missing host":      `[{"urls":"stun:"}]`,
+		"hierarchical form": `[{"urls":"turn://turn.example.test","username":"u","credential":"p"}]`,
+		"bad port":          `[{"urls":"stun:stun.example.test:99999"}]`,
+		"bad transport":     `[{"urls":"turn:turn.example.test?transport=sctp","username":"u","credential":"p"}]`,
+		"stun with query":   `[{"urls":"stun:stun.example.test?transport=tcp"}]`,
+		"turn without auth": `[{"urls":"turn:turn.example.test"}]`,
+	}
+	for name, value := range cases {
+		if _, err := parseICEServers(value); err == nil {
+			t.Errorf("%s: expected error for %s", name, value)
+		}
+	}
+}
+
+func TestBuiltinTURNEnabled(t *testing.T) {
+	cfg := &Config{DisableBuiltinTURN: true}
+	if !cfg.BuiltinTURNEnabled() {
+		t.Fatalf("built-in TURN must stay on without external servers")
+	}
+	cfg.ExternalICEServers = []ICEServer{{URLs: []string{"stun:stun.example.test"}}}
+	if cfg.BuiltinTURNEnabled() {
+		t.Fatalf("expected built-in TURN to be disabled")
+	}
+}
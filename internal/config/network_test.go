@@ -0,0 +1,24 @@
+package config
+
+import "testing"
+
+func TestIsIPFamily(t *testing.T) {
+	cases := []struct {
+		value string
+		ipv6  bool
+		want  bool
+	}{
+		{"203.0.113.10", false, true},
+		{"203.0.113.10", true, false},
+		{"::ffff:203.0.113.10", false, true},
+		{"2001:db8::1", true, true},
+		{"2001:db8::1", false, false},
+		{"fe80::1%eth0", true, false},
+		{"example.com", false, false},
+	}
+	for _, tc := range cases {
+		if got := isIPFamily(tc.value, tc.ipv6); got != tc.want {
+			t.Errorf("isIPFamily(%q, ipv6=%v) = %v, want %v", tc.value, tc.ipv6, got, tc.want)
+		}
+	}
+}
@@ -0,0 +1,29 @@
+package config
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+)
+
+// ipHashSalt is random per process so hashed IPs can't be reversed by
+// enumerating the address space, while staying stable within one run.
+var ipHashSalt = func() []byte {
+	b := make([]byte, 16)
+	_, _ = rand.Read(b)
+	return b
+}()
+
+// ClientIPForLog returns the client IP as it should appear in logs. An
+// unknown mode omits it.
+func (c *Config) ClientIPForLog(ip string) string {
+	switch c.LogClientIP {
+	case LogClientIPFull, "":
+		return ip
+	case LogClientIPHash:
+		sum := sha256.Sum256(append(ipHashSalt, ip...))
+		return hex.EncodeToString(sum[:6])
+	default:
+		return ""
+	}
+}
@@ -0,0 +1,78 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/tariel-x/gocall/internal/models"
+)
+
+// adminCallSummary describes a live call to operators. It leaves out peer
+// IDs and names: they are credentials and personal data, and nobody needs
+// them to spot a stuck call.
+type adminCallSummary struct {
+	CallID       string              `json:"call_id"`
+	Status       models.CallStatusV2 `json:"status"`
+	CreatedAt    time.Time           `json:"created_at"`
+	UpdatedAt    time.Time           `json:"updated_at"`
+	Participants int                 `json:"participants"` // connected right now
+	Joined       int                 `json:"joined"`       // everyone who holds a slot
+}
+
+type adminCallsResponse struct {
+	Calls []adminCallSummary `json:"calls"`
+}
+
+// ListCalls returns every waiting and active call, oldest first.
+func (h *Handlers) ListCalls(c *gin.Context) {
+	now := h.nowFn()
+	resp := adminCallsResponse{Calls: []adminCallSummary{}}
+	for _, status := range []models.CallStatusV2{models.CallStatusV2Waiting, models.CallStatusV2Active} {
+		calls, err := h.calls.ListByStatus(status, 0, now)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		for _, call := range calls {
+			resp.Calls = append(resp.Calls, adminCallSummary{
+				CallID:       call.ID,
+				Status:       call.Status,
+				CreatedAt:    call.CreatedAt,
+				UpdatedAt:    call.UpdatedAt,
+				Participants: call.ParticipantsCount(),
+				Joined:       len(call.Participants),
+			})
+		}
+	}
+	sort.Slice(resp.Calls, func(i, j int) bool {
+		return resp.Calls[i].CreatedAt.Before(resp.Calls[j].CreatedAt)
+	})
+	c.JSON(http.StatusOK, resp)
+}
+
+// TerminateCall force-ends a call and disconnects its peers, who are told it
+// was terminated.
+func (h *Handlers) TerminateCall(c *gin.Context) {
+	callID := c.Param("call_id")
+	now := h.nowFn()
+	call, err := h.calls.EndCall(callID, models.CallEndReasonTerminated, now)
+	switch {
+	case errors.Is(err, ErrCallNotFound) && h.calls.RecentlyEnded(callID, now), errors.Is(err, ErrCallEnded):
+		c.JSON(http.StatusGone, gin.H{"error": "call ended"})
+		return
+	case errors.Is(err, ErrCallNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "call not found"})
+		return
+	case err != nil:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	h.logger.Info("call terminated by operator", "call_id", call.ID)
+	h.wsHub.CloseCall(call.ID, stateMessage(call))
+	c.JSON(http.StatusOK, createCallResponse{CallID: call.ID, Status: call.Status})
+}
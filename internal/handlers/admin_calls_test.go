@@ -0,0 +1,102 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+
+	"github.com/tariel-x/gocall/internal/config"
+	"github.com/tariel-x/gocall/internal/models"
+)
+
+func TestAdminListAndTerminateCalls(t *testing.T) {
+	h := newTestHandlers(t, &config.Config{AdminToken: "s3cret"})
+	now := time.Unix(1_701_000_000, 0)
+	h.nowFn = func() time.Time { return now }
+
+	router := newTestRouter(h)
+	admin := router.Group("/api", h.RequireAdmin)
+	admin.GET("/admin/calls", h.ListCalls)
+	admin.DELETE("/admin/calls/:call_id", h.TerminateCall)
+	srv := httptest.NewServer(router)
+	t.Cleanup(srv.Close)
+
+	adminRequest := func(method, path string, out any) int {
+		t.Helper()
+		req := httptest.NewRequest(method, path, nil)
+		req.Header.Set("Authorization", "Bearer s3cret")
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, req)
+		if out != nil {
+			if err := json.Unmarshal(rec.Body.Bytes(), out); err != nil {
+				t.Fatalf("%s %s: %v", method, path, err)
+			}
+		}
+		return rec.Code
+	}
+
+	waiting, _ := h.calls.CreateCall(now, CreateCallOptions{})
+	now = now.Add(time.Minute)
+	active, _ := h.calls.CreateCall(now, CreateCallOptions{})
+	h.calls.Join(active.ID, now)
+
+	var list adminCallsResponse
+	if code := adminRequest(http.MethodGet, "/api/admin/calls", &list); code != http.StatusOK {
+		t.Fatalf("list: got %d", code)
+	}
+	if len(list.Calls) != 2 || list.Calls[0].CallID != waiting.ID || list.Calls[1].CallID != active.ID {
+		t.Fatalf("unexpected calls %+v", list.Calls)
+	}
+	if got := list.Calls[1]; got.Status != models.CallStatusV2Active || got.Participants != 2 || got.Joined != 2 || !got.CreatedAt.Equal(now) {
+		t.Fatalf("unexpected active call %+v", got)
+	}
+
+	conn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(srv.URL, "http")+"/api/ws?call_id="+waiting.ID, nil)
+	if err != nil {
+		t.Fatalf("dial failed: %v", err)
+	}
+	t.Cleanup(func() { _ = conn.Close() })
+	var join wsEnvelopeV2
+	if err := conn.ReadJSON(&join); err != nil || join.Type != "join" {
+		t.Fatalf("expected join, got %+v, %v", join, err)
+	}
+
+	if code := adminRequest(http.MethodDelete, "/api/admin/calls/"+waiting.ID, nil); code != http.StatusOK {
+		t.Fatalf("terminate: got %d", code)
+	}
+	_ = conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	for {
+		var msg wsEnvelopeV2
+		if err := conn.ReadJSON(&msg); err != nil {
+			t.Fatalf("connection closed before the final state: %v", err)
+		}
+		var state wsStateDataV2
+		if msg.Type == "state" && json.Unmarshal(msg.Data, &state) == nil && state.Status == models.CallStatusV2Ended {
+			if state.EndReason != models.CallEndReasonTerminated {
+				t.Fatalf("end reason %q, want %q", state.EndReason, models.CallEndReasonTerminated)
+			}
+			break
+		}
+	}
+
+	if code := adminRequest(http.MethodGet, "/api/admin/calls", &list); code != http.StatusOK || len(list.Calls) != 1 || list.Calls[0].CallID != active.ID {
+		t.Fatalf("list after terminate: got %d %+v", code, list.Calls)
+	}
+	if code := adminRequest(http.MethodDelete, "/api/admin/calls/"+waiting.ID, nil); code != http.StatusGone {
+		t.Fatalf("terminate twice: got %d, want 410", code)
+	}
+	if code := adminRequest(http.MethodDelete, "/api/admin/calls/missing", nil); code != http.StatusNotFound {
+		t.Fatalf("terminate unknown call: got %d, want 404", code)
+	}
+
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/admin/calls", nil))
+	if rec.Code != http.StatusUnauthorized {
+		t.Fatalf("list without token: got %d, want 401", rec.Code)
+	}
+}
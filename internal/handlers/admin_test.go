@@ -0,0 +1,46 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/tariel-x/gocall/internal/config"
+)
+
+func TestRequireAdmin(t *testing.T) {
+	newRouter := func(token string) *gin.Engine {
+		h := newTestHandlers(t, &config.Config{AdminToken: token})
+		gin.SetMode(gin.TestMode)
+		router := gin.New()
+		router.GET("/api/turn-stats", h.RequireAdmin, func(c *gin.Context) {
+			c.Status(http.StatusNoContent)
+		})
+		return router
+	}
+	get := func(router *gin.Engine, auth string) int {
+		req := httptest.NewRequest(http.MethodGet, "/api/turn-stats", nil)
+		if auth != "" {
+			req.Header.Set("Authorization", auth)
+		}
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, req)
+		return rec.Code
+	}
+
+	if code := get(newRouter(""), "Bearer "); code != http.StatusNotFound {
+		t.Fatalf("without ADMIN_TOKEN: got %d, want 404", code)
+	}
+
+	router := newRouter("s3cret")
+	for _, auth := range []string{"", "s3cret", "Bearer wrong", "Basic s3cret"} {
+		if code := get(router, auth); code != http.StatusUnauthorized {
+			t.Fatalf("auth %q: got %d, want 401", auth, code)
+		}
+	}
+	if code := get(router, "Bearer s3cret"); code != http.StatusNoContent {
+		t.Fatalf("valid token: got %d, want 204", code)
+	}
+}
@@ -0,0 +1,180 @@
+package handlers
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/tariel-x/gocall/internal/config"
+	"github.com/tariel-x/gocall/internal/models"
+)
+
+var (
+	errTokenMalformed   = errors.New("malformed token")
+	errTokenSignature   = errors.New("invalid token signature")
+	errTokenExpired     = errors.New("token expired")
+	errTokenNotYetValid = errors.New("token not yet valid")
+	errTokenNoSubject   = errors.New("token has no subject")
+	errTokenNoExpiry    = errors.New("token has neither exp nor iat")
+)
+
+// jwtClaims are the registered claims hybrid auth looks at; the user is "sub".
+type jwtClaims struct {
+	Subject   string `json:"sub"`
+	ExpiresAt int64  `json:"exp"`
+	NotBefore int64  `json:"nbf"`
+	IssuedAt  int64  `json:"iat"`
+}
+
+// verifyJWT checks an HS256 JWT signed with secret and returns its subject.
+// A token without exp expires maxAge after its iat; with maxAge 0 it never
+// expires, matching the v1 tokens. Expiry and nbf are both relaxed by skew.
+func verifyJWT(token string, secret []byte, now time.Time, skew, maxAge time.Duration) (string, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return "", errTokenMalformed
+	}
+
+	var header struct {
+		Alg string `json:"alg"`
+	}
+	if err := decodeJWTSegment(parts[0], &header); err != nil || header.Alg != "HS256" {
+		return "", errTokenMalformed
+	}
+
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return "", errTokenMalformed
+	}
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(parts[0] + "." + parts[1]))
+	if !hmac.Equal(signature, mac.Sum(nil)) {
+		return "", errTokenSignature
+	}
+
+	var claims jwtClaims
+	if err := decodeJWTSegment(parts[1], &claims); err != nil {
+		return "", errTokenMalformed
+	}
+	if claims.ExpiresAt != 0 && !now.Before(time.Unix(claims.ExpiresAt, 0).Add(skew)) {
+		return "", errTokenExpired
+	}
+	if claims.ExpiresAt == 0 && maxAge > 0 {
+		if claims.IssuedAt == 0 {
+			return "", errTokenNoExpiry
+		}
+		if !now.Before(time.Unix(claims.IssuedAt, 0).Add(maxAge + skew)) {
+			return "", errTokenExpired
+		}
+	}
+	if claims.NotBefore != 0 && now.Before(time.Unix(claims.NotBefore, 0).Add(-skew)) {
+		return "", errTokenNotYetValid
+	}
+	if claims.Subject == "" {
+		return "", errTokenNoSubject
+	}
+	return claims.Subject, nil
+}
+
+func decodeJWTSegment(segment string, v any) error {
+	raw, err := base64.RawURLEncoding.DecodeString(segment)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(raw, v)
+}
+
+// authenticateCaller resolves the caller's user ID under CALL_AUTH_MODE. An
+// empty ID means an anonymous caller; ok is false once the request has been
+// rejected. A token that is sent but invalid is always rejected, even when
+// auth is optional.
+func (h *Handlers) authenticateCaller(c *gin.Context) (userID string, ok bool) {
+	if h.config.CallAuthMode == "" || h.config.CallAuthMode == config.CallAuthOff {
+		return "", true
+	}
+
+	token, found := strings.CutPrefix(c.GetHeader("Authorization"), "Bearer ")
+	if !found || token == "" {
+		if h.config.CallAuthMode == config.CallAuthRequired {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "authentication required"})
+			return "", false
+		}
+		return "", true
+	}
+
+	userID, err := verifyJWT(token, []byte(h.config.CallAuthSecret), h.nowFn(), h.config.ClockSkewTolerance, h.config.CallAuthTokenMaxAge)
+	if err != nil {
+		h.logger.Warn("rejected call auth token", "error", err, "path", c.Request.URL.Path)
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid token"})
+		return "", false
+	}
+	return userID, true
+}
+
+// userCallTracker remembers which calls each authenticated user created so
+// CALL_AUTH_MAX_CALLS_PER_USER can be enforced. Counts are per instance.
+type userCallTracker struct {
+	mu       sync.Mutex
+	calls    map[string][]string // user ID -> call IDs
+	reserved map[string]int      // user ID -> creates in progress
+}
+
+func newUserCallTracker() *userCallTracker {
+	return &userCallTracker{calls: make(map[string][]string), reserved: make(map[string]int)}
+}
+
+// reserve claims a slot for a call the user is about to create. It reports
+// false when the user's live calls and creates in progress already reach
+// limit. Each successful reserve must be followed by release once the
+// create has finished, whether or not the call was added.
+func (t *userCallTracker) reserve(userID string, limit int, calls Store, now time.Time) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.liveLocked(userID, calls, now)+t.reserved[userID] >= limit {
+		return false
+	}
+	t.reserved[userID]++
+	return true
+}
+
+func (t *userCallTracker) release(userID string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.reserved[userID]--; t.reserved[userID] <= 0 {
+		delete(t.reserved, userID)
+	}
+}
+
+// liveLocked drops the user's calls that ended or expired and returns how
+// many remain.
+func (t *userCallTracker) liveLocked(userID string, calls Store, now time.Time) int {
+	remaining := t.calls[userID][:0]
+	for _, callID := range t.calls[userID] {
+		call, err := calls.GetByID(callID, now)
+		if err == nil && call.Status != models.CallStatusV2Ended {
+			remaining = append(remaining, callID)
+		}
+	}
+	if len(remaining) == 0 {
+		delete(t.calls, userID)
+	} else {
+		t.calls[userID] = remaining
+	}
+	return len(remaining)
+}
+
+func (t *userCallTracker) add(userID, callID string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.calls[userID] = append(t.calls[userID], callID)
+}
@@ -0,0 +1,213 @@
+package handlers
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/tariel-x/gocall/internal/config"
+	"github.com/tariel-x/gocall/internal/models"
+)
+
+func signTestJWT(t *testing.T, secret string, claims map[string]any) string {
+	t.Helper()
+	header := base64.RawURLEncoding.EncodeToString([]byte(`{"alg":"HS256","typ":"JWT"}`))
+	payload, err := json.Marshal(claims)
+	if err != nil {
+		t.Fatal(err)
+	}
+	unsigned := header + "." + base64.RawURLEncoding.EncodeToString(payload)
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(unsigned))
+	return unsigned + "." + base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+func TestVerifyJWT(t *testing.T) {
+	now := time.Unix(1_700_000_000, 0)
+	valid := signTestJWT(t, "secret", map[string]any{"sub": "user-1", "exp": now.Add(time.Hour).Unix()})
+
+	userID, err := verifyJWT(valid, []byte("secret"), now, 0, 0)
+	if err != nil || userID != "user-1" {
+		t.Fatalf("valid token: got %q, %v", userID, err)
+	}
+
+	cases := map[string]struct {
+		token string
+		want  error
+	}{
+		"wrong secret": {valid, errTokenSignature},
+		"expired":      {signTestJWT(t, "other", map[string]any{"sub": "user-1", "exp": now.Unix()}), errTokenExpired},
+		"not yet":      {signTestJWT(t, "other", map[string]any{"sub": "user-1", "nbf": now.Add(time.Minute).Unix()}), errTokenNotYetValid},
+		"no subject":   {signTestJWT(t, "other", map[string]any{"exp": now.Add(time.Hour).Unix()}), errTokenNoSubject},
+		"garbage":      {"not.a.jwt", errTokenMalformed},
+	}
+	for name, tc := range cases {
+		if _, err := verifyJWT(tc.token, []byte("other"), now, 0, 0); err != tc.want {
+			t.Fatalf("%s: got %v, want %v", name, err, tc.want)
+		}
+	}
+}
+
+func TestVerifyJWTClockSkew(t *testing.T) {
+	now := time.Unix(1_700_000_000, 0)
+	skew := 30 * time.Second
+	token := func(claim string, at time.Time) string {
+		return signTestJWT(t, "secret", map[string]any{"sub": "user-1", claim: at.Unix()})
+	}
+
+	cases := map[string]struct {
+		token string
+		want  error
+	}{
+		"expired within skew": {token("exp", now.Add(-skew+time.Second)), nil},
+		"expired at skew":     {token("exp", now.Add(-skew)), errTokenExpired},
+		"nbf at skew":         {token("nbf", now.Add(skew)), nil},
+		"nbf beyond skew":     {token("nbf", now.Add(skew+time.Second)), errTokenNotYetValid},
+	}
+	for name, tc := range cases {
+		if _, err := verifyJWT(tc.token, []byte("secret"), now, skew, 0); err != tc.want {
+			t.Fatalf("%s: got %v, want %v", name, err, tc.want)
+		}
+	}
+}
+
+func TestVerifyJWTMaxAge(t *testing.T) {
+	now := time.Unix(1_700_000_000, 0)
+	maxAge := 24 * time.Hour
+
+	cases := map[string]struct {
+		claims map[string]any
+		want   error
+	}{
+		"recent iat":          {map[string]any{"sub": "user-1", "iat": now.Add(-time.Hour).Unix()}, nil},
+		"old iat":             {map[string]any{"sub": "user-1", "iat": now.Add(-maxAge).Unix()}, errTokenExpired},
+		"neither exp nor iat": {map[string]any{"sub": "user-1"}, errTokenNoExpiry},
+		// exp, when present, decides on its own.
+		"old iat, valid exp": {map[string]any{"sub": "user-1", "iat": now.Add(-2 * maxAge).Unix(), "exp": now.Add(time.Hour).Unix()}, nil},
+	}
+	for name, tc := range cases {
+		if _, err := verifyJWT(signTestJWT(t, "secret", tc.claims), []byte("secret"), now, 0, maxAge); err != tc.want {
+			t.Fatalf("%s: got %v, want %v", name, err, tc.want)
+		}
+	}
+
+	// Without a max age, tokens without exp never expire, like the v1 tokens.
+	if _, err := verifyJWT(signTestJWT(t, "secret", map[string]any{"sub": "user-1"}), []byte("secret"), now, 0, 0); err != nil {
+		t.Fatalf("token without exp and max age: %v", err)
+	}
+}
+
+func createCallAs(router http.Handler, token string) (int, createCallResponse) {
+	req := httptest.NewRequest(http.MethodPost, "/api/calls", nil)
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, req)
+	var resp createCallResponse
+	_ = json.Unmarshal(rec.Body.Bytes(), &resp)
+	return rec.Code, resp
+}
+
+func TestCreateCallOptionalAuth(t *testing.T) {
+	h := newTestHandlers(t, &config.Config{CallAuthMode: config.CallAuthOptional, CallAuthSecret: "secret"})
+	router := newTestRouter(h)
+
+	code, resp := createCallAs(router, "")
+	if code != http.StatusOK {
+		t.Fatalf("anonymous create: got %d", code)
+	}
+	call, _ := h.calls.GetByID(resp.CallID, h.nowFn())
+	if call.CreatedBy != "" {
+		t.Fatalf("anonymous call has creator %q", call.CreatedBy)
+	}
+
+	code, resp = createCallAs(router, signTestJWT(t, "secret", map[string]any{"sub": "alice"}))
+	if code != http.StatusOK {
+		t.Fatalf("authenticated create: got %d", code)
+	}
+	call, _ = h.calls.GetByID(resp.CallID, h.nowFn())
+	if call.CreatedBy != "alice" {
+		t.Fatalf("creator = %q, want alice", call.CreatedBy)
+	}
+
+	if code, _ := createCallAs(router, signTestJWT(t, "wrong", map[string]any{"sub": "alice"})); code != http.StatusUnauthorized {
+		t.Fatalf("bad token: got %d, want 401", code)
+	}
+}
+
+func TestCreateCallRequiredAuth(t *testing.T) {
+	h := newTestHandlers(t, &config.Config{CallAuthMode: config.CallAuthRequired, CallAuthSecret: "secret"})
+	router := newTestRouter(h)
+
+	if code, _ := createCallAs(router, ""); code != http.StatusUnauthorized {
+		t.Fatalf("anonymous create: got %d, want 401", code)
+	}
+	if code := doJSON(t, router, http.MethodPost, "/api/calls/whatever/join", "", nil); code != http.StatusUnauthorized {
+		t.Fatalf("anonymous join: got %d, want 401", code)
+	}
+	if code, _ := createCallAs(router, signTestJWT(t, "secret", map[string]any{"sub": "alice"})); code != http.StatusOK {
+		t.Fatalf("authenticated create: got %d", code)
+	}
+}
+
+func TestCreateCallPerUserLimit(t *testing.T) {
+	h := newTestHandlers(t, &config.Config{
+		CallAuthMode:            config.CallAuthOptional,
+		CallAuthSecret:          "secret",
+		CallAuthMaxCallsPerUser: 1,
+	})
+	router := newTestRouter(h)
+	alice := signTestJWT(t, "secret", map[string]any{"sub": "alice"})
+
+	code, first := createCallAs(router, alice)
+	if code != http.StatusOK {
+		t.Fatalf("first create: got %d", code)
+	}
+	if code, _ := createCallAs(router, alice); code != http.StatusTooManyRequests {
+		t.Fatalf("second create: got %d, want 429", code)
+	}
+	if code, _ := createCallAs(router, signTestJWT(t, "secret", map[string]any{"sub": "bob"})); code != http.StatusOK {
+		t.Fatalf("other user: got %d", code)
+	}
+	if code, _ := createCallAs(router, ""); code != http.StatusOK {
+		t.Fatalf("anonymous calls aren't limited: got %d", code)
+	}
+
+	if _, err := h.calls.EndCall(first.CallID, models.CallEndReasonLeft, h.nowFn()); err != nil {
+		t.Fatal(err)
+	}
+	if code, _ := createCallAs(router, alice); code != http.StatusOK {
+		t.Fatalf("create after ending: got %d", code)
+	}
+}
+
+func TestUserCallTrackerReservesSlots(t *testing.T) {
+	store := NewCallStore()
+	tracker := newUserCallTracker()
+	now := time.Unix(1_700_000_000, 0)
+
+	if !tracker.reserve("alice", 2, store, now) || !tracker.reserve("alice", 2, store, now) {
+		t.Fatalf("expected two slots under a limit of 2")
+	}
+	// Both creates are still in flight, so a third one can't start.
+	if tracker.reserve("alice", 2, store, now) {
+		t.Fatalf("reserved a third slot while two creates were in flight")
+	}
+
+	call, _ := store.CreateCall(now, CreateCallOptions{})
+	tracker.add("alice", call.ID)
+	tracker.release("alice")
+	tracker.release("alice") // the second create failed
+	if !tracker.reserve("alice", 2, store, now) {
+		t.Fatalf("expected the failed create's slot to be free again")
+	}
+	if tracker.reserve("alice", 2, store, now) {
+		t.Fatalf("reserved past the limit with one live call and one create in flight")
+	}
+}
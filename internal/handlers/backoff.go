@@ -0,0 +1,47 @@
+package handlers
+
+import (
+	"math"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Machine-readable reasons for throttled (429) and over-capacity (503)
+// responses.
+const (
+	backoffRateLimited      = "rate_limited"
+	backoffReconnectStorm   = "reconnect_backoff"
+	backoffCapacityExceeded = "capacity_exceeded"
+	backoffMaintenance      = "maintenance"
+)
+
+type backoffResponse struct {
+	Error             string `json:"error"`
+	Code              string `json:"code"`
+	RetryAfterSeconds int    `json:"retry_after_seconds"`
+}
+
+// writeBackoff aborts the request with status, a Retry-After header and a
+// JSON body telling the client when to try again. Every 429/503 goes through
+// here so well-behaved clients can back off instead of hammering the server.
+func writeBackoff(c *gin.Context, status int, code, message string, retryAfter time.Duration) {
+	seconds := retryAfterSeconds(retryAfter)
+	c.Header("Retry-After", strconv.Itoa(seconds))
+	c.AbortWithStatusJSON(status, backoffResponse{
+		Error:             message,
+		Code:              code,
+		RetryAfterSeconds: seconds,
+	})
+}
+
+// retryAfterSeconds rounds up to whole seconds, never below one: Retry-After
+// has second granularity and zero would invite an immediate retry.
+func retryAfterSeconds(d time.Duration) int {
+	seconds := int(math.Ceil(d.Seconds()))
+	if seconds < 1 {
+		return 1
+	}
+	return seconds
+}
@@ -0,0 +1,98 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/tariel-x/gocall/internal/config"
+)
+
+func assertBackoff(t *testing.T, rec *httptest.ResponseRecorder, status int, code, retryAfter string) {
+	t.Helper()
+	if rec.Code != status {
+		t.Fatalf("status = %d, want %d", rec.Code, status)
+	}
+	if got := rec.Header().Get("Retry-After"); got != retryAfter {
+		t.Fatalf("Retry-After = %q, want %q", got, retryAfter)
+	}
+	var body backoffResponse
+	if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil {
+		t.Fatalf("decode body %q: %v", rec.Body.String(), err)
+	}
+	if body.Code != code || body.Error == "" {
+		t.Fatalf("unexpected body %+v", body)
+	}
+	if want, _ := json.Marshal(body.RetryAfterSeconds); string(want) != retryAfter {
+		t.Fatalf("retry_after_seconds = %d, want %s", body.RetryAfterSeconds, retryAfter)
+	}
+}
+
+func TestRateLimitedResponseHasBackoffHints(t *testing.T) {
+	h := newTestHandlers(t, &config.Config{ClientLogEnabled: true})
+	now := time.Unix(1_700_000_000, 0)
+	h.nowFn = func() time.Time { return now }
+	router := newTestRouter(h)
+	router.POST("/api/client-log", h.ReportClientLog)
+
+	// The status limiter allows a burst of 20, then one request per second.
+	var rec *httptest.ResponseRecorder
+	for range 21 {
+		rec = httptest.NewRecorder()
+		router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/status", nil))
+	}
+	assertBackoff(t, rec, http.StatusTooManyRequests, backoffRateLimited, "1")
+
+	// The client log limiter refills one token every 6s.
+	for range 6 {
+		rec = httptest.NewRecorder()
+		router.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/api/client-log", nil))
+	}
+	assertBackoff(t, rec, http.StatusTooManyRequests, backoffRateLimited, "6")
+}
+
+func TestReconnectBackoffHasBackoffHints(t *testing.T) {
+	h := newTestHandlers(t, &config.Config{
+		WSReconnectLimit:   1,
+		WSReconnectWindow:  time.Minute,
+		WSReconnectBackoff: 45 * time.Second,
+	})
+	now := time.Unix(1_700_000_000, 0)
+	h.nowFn = func() time.Time { return now }
+	router := newTestRouter(h)
+
+	call, _ := h.calls.CreateCall(now, CreateCallOptions{})
+	hostID, _, _ := h.calls.EnsureHostPeerID(call.ID, now)
+	path := "/api/ws?call_id=" + call.ID + "&peer_id=" + hostID
+
+	var rec *httptest.ResponseRecorder
+	for range 2 {
+		rec = httptest.NewRecorder()
+		router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+	}
+	assertBackoff(t, rec, http.StatusTooManyRequests, backoffReconnectStorm, "45")
+}
+
+func TestCapacityResponseHasBackoffHints(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.GET("/full", func(c *gin.Context) {
+		writeBackoff(c, http.StatusServiceUnavailable, backoffCapacityExceeded, "server is full", 1500*time.Millisecond)
+	})
+	router.GET("/now", func(c *gin.Context) {
+		writeBackoff(c, http.StatusServiceUnavailable, backoffCapacityExceeded, "server is full", 0)
+	})
+
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/full", nil))
+	assertBackoff(t, rec, http.StatusServiceUnavailable, backoffCapacityExceeded, "2")
+
+	// Never advertise an immediate retry.
+	rec = httptest.NewRecorder()
+	router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/now", nil))
+	assertBackoff(t, rec, http.StatusServiceUnavailable, backoffCapacityExceeded, "1")
+}
@@ -0,0 +1,196 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// Bus carries hub messages between server instances on per-call channels, so
+// peers of one call can be connected to different instances.
+type Bus interface {
+	Publish(callID string, msg BusMessage) error
+	// Subscribe starts delivering messages published for callID until the
+	// returned function is called.
+	Subscribe(callID string, deliver func(BusMessage)) (unsubscribe func(), err error)
+}
+
+type busMessageKind string
+
+const (
+	busSendTo      busMessageKind = "send-to"       // PeerID is the target
+	busSendToOther busMessageKind = "send-to-other" // PeerID is the sender
+	busBroadcast   busMessageKind = "broadcast"
+	busCloseCall   busMessageKind = "close-call"
+)
+
+// BusMessage is a hub operation forwarded to other instances.
+type BusMessage struct {
+	Origin  string         `json:"origin"` // publishing hub; it ignores its own messages
+	Kind    busMessageKind `json:"kind"`
+	PeerID  string         `json:"peer_id,omitempty"`
+	Payload []byte         `json:"payload,omitempty"`
+	// MinProtocol keeps a send-to from peers on an older WS protocol.
+	MinProtocol int `json:"min_protocol,omitempty"`
+}
+
+// SetBus enables cross-instance routing: messages for peers that aren't
+// connected to this hub are published on the bus. Call it before serving.
+func (h *WSHubV2) SetBus(bus Bus) error {
+	origin, err := newID(nil)
+	if err != nil {
+		return err
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.bus = bus
+	h.origin = origin
+	return nil
+}
+
+func (h *WSHubV2) publish(callID string, msg BusMessage) bool {
+	h.mu.Lock()
+	bus := h.bus
+	msg.Origin = h.origin
+	h.mu.Unlock()
+
+	if bus == nil {
+		return false
+	}
+	return bus.Publish(callID, msg) == nil
+}
+
+func (h *WSHubV2) subscribeLocked(callID string) {
+	if h.bus == nil {
+		return
+	}
+	unsubscribe, err := h.bus.Subscribe(callID, func(msg BusMessage) {
+		h.deliverRemote(callID, msg)
+	})
+	if err != nil {
+		return
+	}
+	h.subs[callID] = unsubscribe
+}
+
+func (h *WSHubV2) unsubscribeLocked(callID string) {
+	if unsubscribe, ok := h.subs[callID]; ok {
+		unsubscribe()
+		delete(h.subs, callID)
+	}
+}
+
+// deliverRemote applies a message from another instance to local clients only.
+func (h *WSHubV2) deliverRemote(callID string, msg BusMessage) {
+	h.mu.Lock()
+	own := msg.Origin == h.origin
+	h.mu.Unlock()
+	if own {
+		return
+	}
+
+	switch msg.Kind {
+	case busSendTo:
+		h.sendToLocal(callID, msg.PeerID, msg.MinProtocol, msg.Payload)
+	case busSendToOther:
+		h.sendToOtherLocal(callID, msg.PeerID, msg.Payload)
+	case busBroadcast:
+		h.broadcastLocal(callID, msg.Payload)
+	case busCloseCall:
+		h.closeCallLocal(callID, msg.Payload)
+	}
+}
+
+// RedisBus is a Bus over Redis pub/sub with one channel per call.
+type RedisBus struct {
+	client  redis.UniversalClient
+	prefix  string
+	pubsub  *redis.PubSub
+	logger  *slog.Logger
+	timeout time.Duration
+
+	mu       sync.Mutex
+	handlers map[string]func(BusMessage) // channel -> handler
+}
+
+func NewRedisBus(client redis.UniversalClient, prefix string, logger *slog.Logger) *RedisBus {
+	b := &RedisBus{
+		client:   client,
+		prefix:   prefix,
+		pubsub:   client.Subscribe(context.Background()),
+		logger:   logger,
+		timeout:  3 * time.Second,
+		handlers: make(map[string]func(BusMessage)),
+	}
+	go b.receive()
+	return b
+}
+
+func (b *RedisBus) Publish(callID string, msg BusMessage) error {
+	data, err := json.Marshal(msg)
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), b.timeout)
+	defer cancel()
+	return b.client.Publish(ctx, b.channel(callID), data).Err()
+}
+
+func (b *RedisBus) Subscribe(callID string, deliver func(BusMessage)) (func(), error) {
+	channel := b.channel(callID)
+
+	b.mu.Lock()
+	b.handlers[channel] = deliver
+	b.mu.Unlock()
+
+	ctx, cancel := context.WithTimeout(context.Background(), b.timeout)
+	defer cancel()
+	if err := b.pubsub.Subscribe(ctx, channel); err != nil {
+		b.mu.Lock()
+		delete(b.handlers, channel)
+		b.mu.Unlock()
+		return nil, err
+	}
+
+	return func() {
+		b.mu.Lock()
+		delete(b.handlers, channel)
+		b.mu.Unlock()
+
+		ctx, cancel := context.WithTimeout(context.Background(), b.timeout)
+		defer cancel()
+		_ = b.pubsub.Unsubscribe(ctx, channel)
+	}, nil
+}
+
+// Close stops receiving messages.
+func (b *RedisBus) Close() error {
+	return b.pubsub.Close()
+}
+
+func (b *RedisBus) receive() {
+	for m := range b.pubsub.Channel() {
+		b.mu.Lock()
+		deliver := b.handlers[m.Channel]
+		b.mu.Unlock()
+		if deliver == nil {
+			continue
+		}
+
+		var msg BusMessage
+		if err := json.Unmarshal([]byte(m.Payload), &msg); err != nil {
+			b.logger.Warn("invalid bus message", "channel", m.Channel, "error", err)
+			continue
+		}
+		deliver(msg)
+	}
+}
+
+func (b *RedisBus) channel(callID string) string {
+	return b.prefix + "ws:" + callID
+}
@@ -0,0 +1,191 @@
+package handlers
+
+import (
+	"io"
+	"log/slog"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+)
+
+// memoryBus delivers published messages synchronously to every subscriber.
+type memoryBus struct {
+	mu   sync.Mutex
+	next int
+	subs map[string]map[int]func(BusMessage)
+}
+
+func newMemoryBus() *memoryBus {
+	return &memoryBus{subs: make(map[string]map[int]func(BusMessage))}
+}
+
+func (b *memoryBus) Publish(callID string, msg BusMessage) error {
+	b.mu.Lock()
+	var handlers []func(BusMessage)
+	for _, deliver := range b.subs[callID] {
+		handlers = append(handlers, deliver)
+	}
+	b.mu.Unlock()
+
+	for _, deliver := range handlers {
+		deliver(msg)
+	}
+	return nil
+}
+
+func (b *memoryBus) Subscribe(callID string, deliver func(BusMessage)) (func(), error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.subs[callID] == nil {
+		b.subs[callID] = make(map[int]func(BusMessage))
+	}
+	id := b.next
+	b.next++
+	b.subs[callID][id] = deliver
+	return func() {
+		b.mu.Lock()
+		defer b.mu.Unlock()
+		delete(b.subs[callID], id)
+	}, nil
+}
+
+func (b *memoryBus) subscribers(callID string) int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return len(b.subs[callID])
+}
+
+func newTestHubs(t *testing.T, bus Bus) (*WSHubV2, *WSHubV2) {
+	t.Helper()
+	a, b := NewWSHubV2(), NewWSHubV2()
+	if err := a.SetBus(bus); err != nil {
+		t.Fatalf("SetBus: %v", err)
+	}
+	if err := b.SetBus(bus); err != nil {
+		t.Fatalf("SetBus: %v", err)
+	}
+	return a, b
+}
+
+func TestHubRoutesAcrossInstances(t *testing.T) {
+	bus := newMemoryBus()
+	hubA, hubB := newTestHubs(t, bus)
+
+	host := newTestClient("call", "host", PeerRoleV2Host)
+	guest := newTestClient("call", "guest", PeerRoleV2Guest)
+	hubA.Add(host)
+	hubB.Add(guest)
+
+	if !hubA.SendToOther("call", "host", []byte(`{"type":"offer"}`)) {
+		t.Fatalf("expected offer to be published")
+	}
+	if msg := receive(t, guest); msg == nil || msg.Type != "offer" {
+		t.Fatalf("guest on other instance did not get offer: %+v", msg)
+	}
+
+	hubB.SendTo("call", "host", []byte(`{"type":"answer"}`))
+	if msg := receive(t, host); msg == nil || msg.Type != "answer" {
+		t.Fatalf("host on other instance did not get answer: %+v", msg)
+	}
+
+	hubA.Broadcast("call", []byte(`{"type":"state"}`))
+	for _, client := range []*wsClientV2{host, guest} {
+		if msg := receive(t, client); msg == nil || msg.Type != "state" {
+			t.Fatalf("%s did not get broadcast exactly once: %+v", client.peerID, msg)
+		}
+		if msg := receive(t, client); msg != nil {
+			t.Fatalf("%s got duplicate broadcast", client.peerID)
+		}
+	}
+}
+
+func TestHubUnsubscribesWhenLastClientLeaves(t *testing.T) {
+	bus := newMemoryBus()
+	hubA, hubB := newTestHubs(t, bus)
+
+	hubA.Add(newTestClient("call", "host", PeerRoleV2Host))
+	hubB.Add(newTestClient("call", "guest", PeerRoleV2Guest))
+	if got := bus.subscribers("call"); got != 2 {
+		t.Fatalf("expected 2 subscriptions, got %d", got)
+	}
+
+	hubB.Remove("call", "guest")
+	if got := bus.subscribers("call"); got != 1 {
+		t.Fatalf("expected 1 subscription after leave, got %d", got)
+	}
+}
+
+func TestRedisBusDeliversToOtherInstance(t *testing.T) {
+	mr := miniredis.RunT(t)
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+
+	newHub := func() *WSHubV2 {
+		client := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+		bus := NewRedisBus(client, "test:", logger)
+		t.Cleanup(func() {
+			bus.Close()
+			client.Close()
+		})
+		hub := NewWSHubV2()
+		if err := hub.SetBus(bus); err != nil {
+			t.Fatalf("SetBus: %v", err)
+		}
+		return hub
+	}
+	hubA, hubB := newHub(), newHub()
+
+	hubA.Add(newTestClient("call", "host", PeerRoleV2Host))
+	guest := newTestClient("call", "guest", PeerRoleV2Guest)
+	hubB.Add(guest)
+
+	// The subscription is confirmed asynchronously, so keep publishing until
+	// the first message gets through.
+	deadline := time.After(2 * time.Second)
+	for {
+		hubA.SendToOther("call", "host", []byte(`{"type":"offer"}`))
+		select {
+		case payload := <-guest.send:
+			if string(payload) != `{"type":"offer"}` {
+				t.Fatalf("unexpected payload %s", payload)
+			}
+			return
+		case <-time.After(50 * time.Millisecond):
+		case <-deadline:
+			t.Fatalf("guest did not receive offer over redis")
+		}
+	}
+}
+
+func TestAckRoutedAcrossInstances(t *testing.T) {
+	bus := newMemoryBus()
+	h := newTestHandlers(t, nil)
+	if err := h.wsHub.SetBus(bus); err != nil {
+		t.Fatalf("SetBus: %v", err)
+	}
+	remote := NewWSHubV2()
+	if err := remote.SetBus(bus); err != nil {
+		t.Fatalf("SetBus: %v", err)
+	}
+
+	guest := newTestClient("call", "guest", PeerRoleV2Guest)
+	guest.protocol = wsProtocolAcks
+	h.wsHub.Add(guest)
+	host := newTestClient("call", "host", PeerRoleV2Host)
+	host.protocol = wsProtocolAcks
+	remote.Add(host)
+	legacy := newTestClient("call", "legacy", PeerRoleV2Guest)
+	remote.Add(legacy)
+
+	h.routeMessage(guest, wsEnvelopeV2{Type: "ack", ID: "m1", To: "host"})
+	if ack := receive(t, host); ack == nil || ack.Type != "ack" || ack.ID != "m1" || ack.From != "guest" {
+		t.Fatalf("expected ack for m1 on the other instance, got %+v", ack)
+	}
+
+	h.routeMessage(guest, wsEnvelopeV2{Type: "ack", ID: "m2", To: "legacy"})
+	if msg := receive(t, legacy); msg != nil {
+		t.Fatalf("legacy client on the other instance got an ack: %+v", msg)
+	}
+}
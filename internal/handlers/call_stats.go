@@ -0,0 +1,61 @@
+package handlers
+
+import (
+	"encoding/json"
+	"math"
+
+	"github.com/tariel-x/gocall/internal/models"
+)
+
+// CallStatsExporter receives quality samples clients report with "call-stats"
+// messages. It is called from the WS read loop and must not block.
+type CallStatsExporter interface {
+	ExportCallStats(sample models.CallStatsSample)
+}
+
+type nopCallStatsExporter struct{}
+
+func (nopCallStatsExporter) ExportCallStats(models.CallStatsSample) {}
+
+// SetCallStatsExporter enables forwarding of client quality samples.
+func (h *Handlers) SetCallStatsExporter(exporter CallStatsExporter) {
+	if exporter == nil {
+		exporter = nopCallStatsExporter{}
+	}
+	h.callStats = exporter
+}
+
+type wsCallStatsDataV2 struct {
+	RTTMs       float64 `json:"rtt_ms"`
+	JitterMs    float64 `json:"jitter_ms"`
+	PacketLoss  float64 `json:"packet_loss"`
+	BitrateKbps float64 `json:"bitrate_kbps"`
+	Route       string  `json:"route"` // "direct" or "relay"
+}
+
+// valid rejects negative or non-finite values and loss outside 0..1.
+func (d wsCallStatsDataV2) valid() bool {
+	for _, v := range []float64{d.RTTMs, d.JitterMs, d.PacketLoss, d.BitrateKbps} {
+		if v < 0 || math.IsNaN(v) || math.IsInf(v, 0) {
+			return false
+		}
+	}
+	return d.PacketLoss <= 1
+}
+
+func interceptCallStats(h *Handlers, client *wsClientV2, msg wsEnvelopeV2) {
+	var data wsCallStatsDataV2
+	if err := json.Unmarshal(msg.Data, &data); err != nil || !data.valid() {
+		return
+	}
+	h.callStats.ExportCallStats(models.CallStatsSample{
+		CallID:      client.callID,
+		Role:        string(client.role),
+		At:          h.nowFn(),
+		RTTMs:       data.RTTMs,
+		JitterMs:    data.JitterMs,
+		PacketLoss:  data.PacketLoss,
+		BitrateKbps: data.BitrateKbps,
+		Relayed:     data.Route == "relay",
+	})
+}
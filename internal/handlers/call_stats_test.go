@@ -0,0 +1,45 @@
+package handlers
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/tariel-x/gocall/internal/models"
+)
+
+type recordingStatsExporter struct {
+	samples []models.CallStatsSample
+}
+
+func (r *recordingStatsExporter) ExportCallStats(sample models.CallStatsSample) {
+	r.samples = append(r.samples, sample)
+}
+
+func TestCallStatsAreExportedNotRelayed(t *testing.T) {
+	h, host, guest := setupRelayCall(t, nil)
+	exporter := &recordingStatsExporter{}
+	h.SetCallStatsExporter(exporter)
+
+	h.routeMessage(host, wsEnvelopeV2{
+		Type: "call-stats",
+		Data: json.RawMessage(`{"rtt_ms":42.5,"jitter_ms":3,"packet_loss":0.02,"bitrate_kbps":900,"route":"relay"}`),
+	})
+	if msg := receive(t, guest); msg != nil {
+		t.Fatalf("call-stats must not reach the peer, got %+v", msg)
+	}
+	if len(exporter.samples) != 1 {
+		t.Fatalf("expected one exported sample, got %d", len(exporter.samples))
+	}
+	got := exporter.samples[0]
+	if got.CallID != host.callID || got.Role != string(PeerRoleV2Host) || got.RTTMs != 42.5 || got.PacketLoss != 0.02 || !got.Relayed {
+		t.Fatalf("unexpected sample %+v", got)
+	}
+
+	// Malformed or out-of-range samples are ignored.
+	for _, data := range []string{`{"packet_loss":1.5}`, `{"rtt_ms":-1}`, `"nope"`} {
+		h.routeMessage(guest, wsEnvelopeV2{Type: "call-stats", Data: json.RawMessage(data)})
+	}
+	if len(exporter.samples) != 1 {
+		t.Fatalf("invalid samples were exported: %+v", exporter.samples[1:])
+	}
+}
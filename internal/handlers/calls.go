@@ -1,52 +1,159 @@
 package handlers
 
 import (
+	"errors"
+	"io"
 	"net/http"
+	"time"
 
 	"github.com/tariel-x/gocall/internal/models"
 
 	"github.com/gin-gonic/gin"
 )
 
+// capacityRetryAfter is the Retry-After hint when MAX_CONCURRENT_CALLS is hit.
+const capacityRetryAfter = 30 * time.Second
+
+type createCallRequest struct {
+	ICEPolicy models.ICEPolicy `json:"ice_policy" binding:"omitempty,oneof=all relay"`
+	PIN       string           `json:"pin" binding:"omitempty,min=4,max=64"`
+	// WaitingRoom makes guests wait until the host admits them.
+	WaitingRoom bool `json:"waiting_room"`
+}
+
 type createCallResponse struct {
-	CallID string              `json:"call_id"`
-	Status models.CallStatusV2 `json:"status"`
+	CallID      string              `json:"call_id"`
+	Status      models.CallStatusV2 `json:"status"`
+	ICEPolicy   models.ICEPolicy    `json:"ice_policy,omitempty"`
+	RequiresPIN bool                `json:"requires_pin,omitempty"`
+	WaitingRoom bool                `json:"waiting_room,omitempty"`
+	// PeerID is the host's peer_id, returned for PIN-protected calls only:
+	// their WS doesn't hand it out to connections without one.
+	PeerID string `json:"peer_id,omitempty"`
 }
 
 type callParticipants struct {
-	Count int `json:"count"`
+	Count int                `json:"count"`
+	List  []participantState `json:"list,omitempty"` // WS state only
+}
+
+type participantState struct {
+	PeerID    string     `json:"peer_id"`
+	Name      string     `json:"name,omitempty"`
+	Role      PeerRoleV2 `json:"role"`
+	IsPresent bool       `json:"is_present"`
+	Pending   bool       `json:"pending,omitempty"` // waiting for the host to admit it
+	// Media is the peer's last reported media state, omitted until known.
+	Media *models.MediaState `json:"media,omitempty"`
 }
 
 type getCallResponse struct {
 	CallID       string              `json:"call_id"`
 	Status       models.CallStatusV2 `json:"status"`
 	Participants callParticipants    `json:"participants"`
+	ICEPolicy    models.ICEPolicy    `json:"ice_policy"`
+	RequiresPIN  bool                `json:"requires_pin"`
+	WaitingRoom  bool                `json:"waiting_room"`
+}
+
+type joinCallRequest struct {
+	PIN  string `json:"pin" binding:"max=64"`
+	Name string `json:"name"` // optional display name, sanitized and capped
+}
+
+// leaveCallRequest carries the caller's peer_id: only someone in the call
+// may end it, and the host's peer_id tells that the host ended it.
+type leaveCallRequest struct {
+	PeerID string `json:"peer_id" binding:"required"`
 }
 
 type joinCallResponse struct {
-	CallID string `json:"call_id"`
-	PeerID string `json:"peer_id"`
+	CallID      string `json:"call_id"`
+	PeerID      string `json:"peer_id"`
+	RequiresPIN bool   `json:"requires_pin,omitempty"`
+	// Pending means the guest is in the waiting room; it may connect to
+	// WS but takes part only once the host admits it.
+	Pending bool `json:"pending,omitempty"`
 }
 
 func (h *Handlers) CreateCall(c *gin.Context) {
-	call, err := h.calls.CreateCall(h.nowFn())
+	if !h.checkClientIP(c) || h.inMaintenance(c) {
+		return
+	}
+
+	userID, ok := h.authenticateCaller(c)
+	if !ok {
+		return
+	}
+
+	// The body is optional; an empty request creates a call with defaults.
+	var req createCallRequest
+	if err := c.ShouldBindJSON(&req); err != nil && !errors.Is(err, io.EOF) {
+		writeBindingError(c, &req, err)
+		return
+	}
+
+	now := h.nowFn()
+	if limit := h.config.CallAuthMaxCallsPerUser; userID != "" && limit > 0 {
+		// The slot stays reserved until the call is tracked below, so
+		// concurrent creates can't overshoot the limit.
+		if !h.userCalls.reserve(userID, limit, h.calls, now) {
+			c.JSON(http.StatusTooManyRequests, gin.H{"error": "too many active calls"})
+			return
+		}
+		defer h.userCalls.release(userID)
+	}
+
+	opts := CreateCallOptions{
+		ICEPolicy:       req.ICEPolicy,
+		MaxParticipants: h.maxParticipants(),
+		CreatedBy:       userID,
+		WaitingRoom:     req.WaitingRoom,
+	}
+	if req.PIN != "" {
+		hash, err := hashCallPIN(req.PIN)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		opts.PINHash = hash
+	}
+
+	call, err := h.calls.CreateCall(now, opts)
+	if errors.Is(err, ErrCapacityReached) {
+		writeBackoff(c, http.StatusServiceUnavailable, backoffCapacityExceeded, "server is at capacity", capacityRetryAfter)
+		return
+	}
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
+	if userID != "" {
+		h.userCalls.add(userID, call.ID)
+		h.logger.Info("authenticated call created", "call_id", call.ID, "user_id", userID)
+	}
 
-	c.JSON(http.StatusOK, createCallResponse{CallID: call.ID, Status: call.Status})
+	resp := createCallResponse{CallID: call.ID, Status: call.Status, ICEPolicy: call.ICEPolicy, WaitingRoom: call.WaitingRoom}
+	if call.RequiresPIN() {
+		resp.RequiresPIN = true
+		resp.PeerID = call.HostPeerID
+	}
+	c.JSON(http.StatusOK, resp)
+}
+
+// maxParticipants is how many peers new calls hold.
+func (h *Handlers) maxParticipants() int {
+	if h.config.MaxCallParticipants > 0 {
+		return h.config.MaxCallParticipants
+	}
+	return models.DefaultMaxParticipants
 }
 
 func (h *Handlers) GetCall(c *gin.Context) {
 	callID := c.Param("call_id")
 	call, err := h.calls.GetByID(callID, h.nowFn())
 	if err != nil {
-		if err == ErrCallNotFound {
-			c.JSON(http.StatusNotFound, gin.H{"error": "call not found"})
-			return
-		}
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		h.writeWSCallError(c, err)
 		return
 	}
 
@@ -56,11 +163,34 @@ func (h *Handlers) GetCall(c *gin.Context) {
 		Participants: callParticipants{
 			Count: call.ParticipantsCount(),
 		},
+		ICEPolicy:   call.ICEPolicy,
+		RequiresPIN: call.RequiresPIN(),
+		WaitingRoom: call.WaitingRoom,
 	})
 }
 
 func (h *Handlers) JoinCall(c *gin.Context) {
+	if !h.checkClientIP(c) || h.inMaintenance(c) {
+		return
+	}
+
+	userID, ok := h.authenticateCaller(c)
+	if !ok {
+		return
+	}
+
+	// The body is optional; it carries the PIN and the display name.
+	var req joinCallRequest
+	if err := c.ShouldBindJSON(&req); err != nil && !errors.Is(err, io.EOF) {
+		writeBindingError(c, &req, err)
+		return
+	}
+
 	callID := c.Param("call_id")
+	if !h.checkCallPIN(c, callID, req.PIN) {
+		return
+	}
+
 	peerID, call, err := h.calls.Join(callID, h.nowFn())
 	if err != nil {
 		switch err {
@@ -71,7 +201,7 @@ func (h *Handlers) JoinCall(c *gin.Context) {
 			c.JSON(http.StatusConflict, gin.H{"error": "call is full"})
 			return
 		case ErrCallEnded:
-			c.JSON(http.StatusConflict, gin.H{"error": "call ended"})
+			c.JSON(http.StatusGone, gin.H{"error": "call ended"})
 			return
 		default:
 			_ = call
@@ -80,12 +210,75 @@ func (h *Handlers) JoinCall(c *gin.Context) {
 		}
 	}
 
-	c.JSON(http.StatusOK, joinCallResponse{CallID: call.ID, PeerID: peerID})
+	if name := sanitizeDisplayName(req.Name); name != "" {
+		// The peer isn't connected yet, so nobody needs a state push.
+		if named, err := h.calls.SetParticipantName(call.ID, peerID, name, h.nowFn()); err == nil {
+			call = named
+		}
+	}
+
+	if userID != "" {
+		h.logger.Info("authenticated peer joined", "call_id", call.ID, "user_id", userID)
+	}
+
+	pending := call.Participants[peerID].Pending
+	if pending {
+		h.requestAdmission(call, peerID)
+	}
+
+	c.JSON(http.StatusOK, joinCallResponse{CallID: call.ID, PeerID: peerID, RequiresPIN: call.RequiresPIN(), Pending: pending})
+}
+
+// checkCallPIN rejects the request with 403 when callID is PIN-protected and
+// pin doesn't match. Attempts are rate limited per client IP. Missing calls
+// pass through so the caller reports them as usual.
+func (h *Handlers) checkCallPIN(c *gin.Context, callID, pin string) bool {
+	now := h.nowFn()
+	call, err := h.calls.GetByID(callID, now)
+	if err != nil || !call.RequiresPIN() {
+		return true
+	}
+	if retryAfter, ok := h.pinLimiter.Allow(c.ClientIP(), now); !ok {
+		writeBackoff(c, http.StatusTooManyRequests, backoffRateLimited, "too many PIN attempts", retryAfter)
+		return false
+	}
+	if err := verifyCallPIN(call, pin); err != nil {
+		c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+		return false
+	}
+	return true
 }
 
+// LeaveCall ends the call for everyone. The caller must be a participant
+// that has been let in; a link, or a guest still in the waiting room, isn't
+// enough.
 func (h *Handlers) LeaveCall(c *gin.Context) {
+	if !h.checkClientIP(c) {
+		return
+	}
+
+	var req leaveCallRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		writeBindingError(c, &req, err)
+		return
+	}
+
 	callID := c.Param("call_id")
-	call, err := h.calls.EndCall(callID, h.nowFn())
+	existing, err := h.calls.GetByID(callID, h.nowFn())
+	if err != nil {
+		h.writeWSCallError(c, err)
+		return
+	}
+	if p, ok := existing.Participants[req.PeerID]; !ok || p.Pending {
+		c.JSON(http.StatusForbidden, gin.H{"error": "only participants can end the call"})
+		return
+	}
+	reason := models.CallEndReasonLeft
+	if req.PeerID == existing.HostPeerID {
+		reason = models.CallEndReasonHostEnded
+	}
+
+	call, err := h.calls.EndCall(callID, reason, h.nowFn())
 	if err != nil {
 		if err == ErrCallNotFound {
 			c.JSON(http.StatusNotFound, gin.H{"error": "call not found"})
@@ -95,8 +288,8 @@ func (h *Handlers) LeaveCall(c *gin.Context) {
 		return
 	}
 
-	// Close any active WS sessions for this call.
-	h.wsHub.CloseCall(callID)
+	// Close any active WS sessions for this call, telling peers why.
+	h.wsHub.CloseCall(callID, stateMessage(call))
 
 	c.JSON(http.StatusOK, createCallResponse{CallID: call.ID, Status: call.Status})
 }
@@ -0,0 +1,345 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gorilla/websocket"
+
+	"github.com/tariel-x/gocall/internal/config"
+	"github.com/tariel-x/gocall/internal/models"
+	"github.com/tariel-x/gocall/internal/turn"
+)
+
+func newTestRouter(h *Handlers) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	api := router.Group("/api")
+	api.GET("/turn-config", h.GetTURNConfig)
+	api.GET("/status", h.GetStatus)
+	api.POST("/calls", h.CreateCall)
+	api.GET("/calls/:call_id", h.GetCall)
+	api.POST("/calls/:call_id/join", h.JoinCall)
+	api.POST("/calls/:call_id/leave", h.LeaveCall)
+	api.POST("/calls/:call_id/admit", h.AdmitPeer)
+	api.POST("/calls/:call_id/reject", h.RejectPeer)
+	api.GET("/ws", h.HandleWebSocket)
+	return router
+}
+
+func doJSON(t *testing.T, router http.Handler, method, path, body string, out any) int {
+	t.Helper()
+	req := httptest.NewRequest(method, path, strings.NewReader(body))
+	if body != "" {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, req)
+	if out != nil {
+		if err := json.Unmarshal(rec.Body.Bytes(), out); err != nil {
+			t.Fatalf("decode %s %s response %q: %v", method, path, rec.Body.String(), err)
+		}
+	}
+	return rec.Code
+}
+
+// leaveAsHost ends callID through the leave endpoint with the host's peer_id.
+func leaveAsHost(t *testing.T, h *Handlers, router http.Handler, callID string) int {
+	t.Helper()
+	hostID, _, err := h.calls.EnsureHostPeerID(callID, h.nowFn())
+	if err != nil {
+		t.Fatalf("host peer_id: %v", err)
+	}
+	return doJSON(t, router, http.MethodPost, "/api/calls/"+callID+"/leave", `{"peer_id":"`+hostID+`"}`, nil)
+}
+
+func TestCreateCallICEPolicy(t *testing.T) {
+	h := newTestHandlers(t, nil)
+	h.turnServer = &turn.TURNServer{}
+	router := newTestRouter(h)
+
+	var created createCallResponse
+	if code := doJSON(t, router, http.MethodPost, "/api/calls", "", &created); code != http.StatusOK {
+		t.Fatalf("create without body: status %d", code)
+	}
+	if created.ICEPolicy != models.ICEPolicyAll {
+		t.Fatalf("expected default policy all, got %q", created.ICEPolicy)
+	}
+
+	if code := doJSON(t, router, http.MethodPost, "/api/calls", `{"ice_policy":"relay"}`, &created); code != http.StatusOK {
+		t.Fatalf("create relay call: status %d", code)
+	}
+	if created.ICEPolicy != models.ICEPolicyRelay {
+		t.Fatalf("expected relay policy, got %q", created.ICEPolicy)
+	}
+
+	var details getCallResponse
+	doJSON(t, router, http.MethodGet, "/api/calls/"+created.CallID, "", &details)
+	if details.ICEPolicy != models.ICEPolicyRelay {
+		t.Fatalf("expected relay policy in call details, got %q", details.ICEPolicy)
+	}
+
+	var turnConfig struct {
+		ICETransportPolicy models.ICEPolicy `json:"iceTransportPolicy"`
+	}
+	doJSON(t, router, http.MethodGet, "/api/turn-config?call_id="+created.CallID, "", &turnConfig)
+	if turnConfig.ICETransportPolicy != models.ICEPolicyRelay {
+		t.Fatalf("expected relay policy in TURN config, got %q", turnConfig.ICETransportPolicy)
+	}
+
+	if code := doJSON(t, router, http.MethodPost, "/api/calls", `{"ice_policy":"direct"}`, nil); code != http.StatusBadRequest {
+		t.Fatalf("expected 400 for invalid policy, got %d", code)
+	}
+}
+
+func TestCreateCallValidationErrors(t *testing.T) {
+	router := newTestRouter(newTestHandlers(t, nil))
+
+	tests := []struct {
+		name      string
+		body      string
+		wantCode  string
+		wantField string
+	}{
+		{name: "malformed json", body: `{"ice_policy":`, wantCode: "invalid_json"},
+		{name: "wrong type", body: `{"ice_policy":5}`, wantCode: "invalid_type", wantField: "ice_policy"},
+		{name: "unknown ice policy", body: `{"ice_policy":"direct"}`, wantCode: "invalid_value", wantField: "ice_policy"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var resp struct {
+				Fields []fieldError `json:"fields"`
+			}
+			if code := doJSON(t, router, http.MethodPost, "/api/calls", tt.body, &resp); code != http.StatusBadRequest {
+				t.Fatalf("expected 400, got %d", code)
+			}
+			if len(resp.Fields) != 1 {
+				t.Fatalf("expected one field error, got %+v", resp.Fields)
+			}
+			got := resp.Fields[0]
+			if got.Code != tt.wantCode || got.Field != tt.wantField || got.Message == "" {
+				t.Fatalf("unexpected field error %+v", got)
+			}
+		})
+	}
+}
+
+func TestStatusReflectsCalls(t *testing.T) {
+	router := newTestRouter(newTestHandlers(t, nil))
+
+	var first, second createCallResponse
+	var guest joinCallResponse
+	doJSON(t, router, http.MethodPost, "/api/calls", "", &first)
+	doJSON(t, router, http.MethodPost, "/api/calls", "", &second)
+	if code := doJSON(t, router, http.MethodPost, "/api/calls/"+first.CallID+"/join", "", &guest); code != http.StatusOK {
+		t.Fatalf("join failed: %d", code)
+	}
+
+	var status statusResponse
+	if code := doJSON(t, router, http.MethodGet, "/api/status", "", &status); code != http.StatusOK {
+		t.Fatalf("status failed: %d", code)
+	}
+	if status.ActiveCalls != 1 || status.WaitingCalls != 1 || !status.AcceptingCalls || status.MaxParticipants != 2 {
+		t.Fatalf("unexpected status %+v", status)
+	}
+
+	doJSON(t, router, http.MethodPost, "/api/calls/"+first.CallID+"/leave", `{"peer_id":"`+guest.PeerID+`"}`, nil)
+	doJSON(t, router, http.MethodGet, "/api/status", "", &status)
+	if status.ActiveCalls != 0 || status.WaitingCalls != 1 {
+		t.Fatalf("expected ended call to be gone, got %+v", status)
+	}
+}
+
+func TestGetCallDistinguishesEndedFromUnknown(t *testing.T) {
+	h := newTestHandlers(t, nil)
+	router := newTestRouter(h)
+
+	var created createCallResponse
+	doJSON(t, router, http.MethodPost, "/api/calls", "", &created)
+	if code := leaveAsHost(t, h, router, created.CallID); code != http.StatusOK {
+		t.Fatalf("leave failed: %d", code)
+	}
+
+	if code := doJSON(t, router, http.MethodGet, "/api/calls/"+created.CallID, "", nil); code != http.StatusGone {
+		t.Fatalf("expected 410 for recently ended call, got %d", code)
+	}
+	if code := doJSON(t, router, http.MethodGet, "/api/calls/never-existed", "", nil); code != http.StatusNotFound {
+		t.Fatalf("expected 404 for unknown call, got %d", code)
+	}
+
+	// Tombstones are swept by the cleanup loop after the window.
+	store := h.calls.(*CallStore)
+	store.mu.Lock()
+	store.cleanupExpiredLocked(h.nowFn().Add(store.tombstoneTTL + time.Minute))
+	store.mu.Unlock()
+	if code := doJSON(t, router, http.MethodGet, "/api/calls/"+created.CallID, "", nil); code != http.StatusNotFound {
+		t.Fatalf("expected 404 after tombstone sweep, got %d", code)
+	}
+}
+
+func TestLeaveCallEndReason(t *testing.T) {
+	h := newTestHandlers(t, nil)
+	srv := httptest.NewServer(newTestRouter(h))
+	t.Cleanup(srv.Close)
+
+	for _, leaver := range []PeerRoleV2{PeerRoleV2Host, PeerRoleV2Guest} {
+		call, _ := h.calls.CreateCall(h.nowFn(), CreateCallOptions{})
+		hostID, _, _ := h.calls.EnsureHostPeerID(call.ID, h.nowFn())
+		guestID, _, _ := h.calls.Join(call.ID, h.nowFn())
+		guest, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(srv.URL, "http")+"/api/ws?call_id="+call.ID+"&peer_id="+guestID, nil)
+		if err != nil {
+			t.Fatalf("dial failed: %v", err)
+		}
+		t.Cleanup(func() { _ = guest.Close() })
+
+		peerID, want := guestID, models.CallEndReasonLeft
+		if leaver == PeerRoleV2Host {
+			peerID, want = hostID, models.CallEndReasonHostEnded
+		}
+		resp, err := http.Post(srv.URL+"/api/calls/"+call.ID+"/leave", "application/json", strings.NewReader(`{"peer_id":"`+peerID+`"}`))
+		if err != nil || resp.StatusCode != http.StatusOK {
+			t.Fatalf("%s leave: %v %v", leaver, resp, err)
+		}
+		resp.Body.Close()
+
+		_ = guest.SetReadDeadline(time.Now().Add(5 * time.Second))
+		for {
+			var msg wsEnvelopeV2
+			if err := guest.ReadJSON(&msg); err != nil {
+				t.Fatalf("%s leave: no ended state before %v", leaver, err)
+			}
+			var state wsStateDataV2
+			if msg.Type != "state" || json.Unmarshal(msg.Data, &state) != nil || state.Status != models.CallStatusV2Ended {
+				continue
+			}
+			if state.EndReason != want {
+				t.Fatalf("%s leave: reason %q, want %q", leaver, state.EndReason, want)
+			}
+			break
+		}
+	}
+}
+
+func TestLeaveCallRequiresParticipant(t *testing.T) {
+	h := newTestHandlers(t, nil)
+	router := newTestRouter(h)
+
+	hash, _ := hashCallPIN("2468")
+	call, _ := h.calls.CreateCall(h.nowFn(), CreateCallOptions{PINHash: hash, WaitingRoom: true})
+	pendingID, _, _ := h.calls.Join(call.ID, h.nowFn())
+	leave := func(body string) int {
+		return doJSON(t, router, http.MethodPost, "/api/calls/"+call.ID+"/leave", body, nil)
+	}
+
+	if code := leave(""); code != http.StatusBadRequest {
+		t.Fatalf("leave without peer_id: got %d, want 400", code)
+	}
+	if code := leave(`{"peer_id":"someone-else"}`); code != http.StatusForbidden {
+		t.Fatalf("leave with an unknown peer_id: got %d, want 403", code)
+	}
+	if code := leave(`{"peer_id":"` + pendingID + `"}`); code != http.StatusForbidden {
+		t.Fatalf("leave from the waiting room: got %d, want 403", code)
+	}
+	if _, err := h.calls.GetByID(call.ID, h.nowFn()); err != nil {
+		t.Fatalf("call ended by an outsider: %v", err)
+	}
+	if code := leave(`{"peer_id":"` + call.HostPeerID + `"}`); code != http.StatusOK {
+		t.Fatalf("host leave: got %d", code)
+	}
+}
+
+func TestEndedCallRetentionWindow(t *testing.T) {
+	h := newTestHandlers(t, nil)
+	h.calls = NewCallStoreWithOptions(CallStoreOptions{TombstoneTTL: 2 * time.Minute})
+	now := time.Unix(1_700_400_000, 0)
+	h.nowFn = func() time.Time { return now }
+	router := newTestRouter(h)
+
+	var created createCallResponse
+	doJSON(t, router, http.MethodPost, "/api/calls", "", &created)
+	leaveAsHost(t, h, router, created.CallID)
+
+	now = now.Add(time.Minute)
+	if code := doJSON(t, router, http.MethodGet, "/api/calls/"+created.CallID, "", nil); code != http.StatusGone {
+		t.Fatalf("expected 410 within the retention window, got %d", code)
+	}
+	if code := doJSON(t, router, http.MethodPost, "/api/calls/"+created.CallID+"/join", "", nil); code != http.StatusGone {
+		t.Fatalf("expected 410 for join within the retention window, got %d", code)
+	}
+
+	now = now.Add(2 * time.Minute)
+	if code := doJSON(t, router, http.MethodGet, "/api/calls/"+created.CallID, "", nil); code != http.StatusNotFound {
+		t.Fatalf("expected 404 after the retention window, got %d", code)
+	}
+
+	store := h.calls.(*CallStore)
+	store.mu.Lock()
+	store.cleanupExpiredLocked(now)
+	_, kept := store.tombstones[created.CallID]
+	store.mu.Unlock()
+	if kept {
+		t.Fatal("expected the sweep to drop the expired tombstone")
+	}
+}
+
+func TestJoinRequiresCallPIN(t *testing.T) {
+	h := newTestHandlers(t, nil)
+	router := newTestRouter(h)
+
+	var created createCallResponse
+	if code := doJSON(t, router, http.MethodPost, "/api/calls", `{"pin":"4921"}`, &created); code != http.StatusOK {
+		t.Fatalf("create failed: %d", code)
+	}
+	if !created.RequiresPIN || created.PeerID == "" {
+		t.Fatalf("expected requires_pin and the host peer_id, got %+v", created)
+	}
+
+	var details getCallResponse
+	doJSON(t, router, http.MethodGet, "/api/calls/"+created.CallID, "", &details)
+	if !details.RequiresPIN {
+		t.Fatalf("expected requires_pin in call details, got %+v", details)
+	}
+
+	joinPath := "/api/calls/" + created.CallID + "/join"
+	if code := doJSON(t, router, http.MethodPost, joinPath, "", nil); code != http.StatusForbidden {
+		t.Fatalf("join without PIN: got %d, want 403", code)
+	}
+	if code := doJSON(t, router, http.MethodPost, joinPath, `{"pin":"0000"}`, nil); code != http.StatusForbidden {
+		t.Fatalf("join with wrong PIN: got %d, want 403", code)
+	}
+	var joined joinCallResponse
+	if code := doJSON(t, router, http.MethodPost, joinPath, `{"pin":"4921"}`, &joined); code != http.StatusOK || joined.PeerID == "" {
+		t.Fatalf("join with PIN: got %d %+v", code, joined)
+	}
+
+	// The host path without a peer_id would hand out the host's identity.
+	if code := doJSON(t, router, http.MethodGet, "/api/ws?call_id="+created.CallID, "", nil); code != http.StatusForbidden {
+		t.Fatalf("ws without peer_id: got %d, want 403", code)
+	}
+}
+
+func TestCreateCallAtCapacity(t *testing.T) {
+	h := newTestHandlers(t, &config.Config{MaxConcurrentCalls: 1})
+	h.calls = NewCallStoreWithOptions(CallStoreOptions{MaxCalls: 1})
+	router := newTestRouter(h)
+
+	if code := doJSON(t, router, http.MethodPost, "/api/calls", "", nil); code != http.StatusOK {
+		t.Fatalf("first create: got %d", code)
+	}
+	var refused backoffResponse
+	if code := doJSON(t, router, http.MethodPost, "/api/calls", "", &refused); code != http.StatusServiceUnavailable || refused.Code != backoffCapacityExceeded {
+		t.Fatalf("create at capacity: got %d %+v", code, refused)
+	}
+
+	var status statusResponse
+	doJSON(t, router, http.MethodGet, "/api/status", "", &status)
+	if status.AcceptingCalls || status.MaxCalls != 1 {
+		t.Fatalf("status should report a full server, got %+v", status)
+	}
+}
@@ -0,0 +1,89 @@
+package handlers
+
+import (
+	"net/http"
+	"sort"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/tariel-x/gocall/internal/config"
+	"github.com/tariel-x/gocall/internal/models"
+)
+
+type capabilitiesResponse struct {
+	// Protocols are the WS protocol versions the server accepts.
+	Protocols []int `json:"protocols"`
+	// RelayedTypes are forwarded to peers, ServerTypes are handled by the
+	// server; other types follow UnknownTypesRelayed.
+	RelayedTypes        []string           `json:"relayed_types"`
+	ServerTypes         []string           `json:"server_types"`
+	UnknownTypesRelayed bool               `json:"unknown_types_relayed"`
+	MaxParticipants     int                `json:"max_participants"`
+	ICEPolicies         []models.ICEPolicy `json:"ice_policies"`
+	Features            capabilityFeatures `json:"features"`
+	// Maintenance is set while new calls and joins are refused.
+	Maintenance *maintenanceResponse `json:"maintenance,omitempty"`
+}
+
+type capabilityFeatures struct {
+	GroupCalls bool   `json:"group_calls"`
+	Chat       bool   `json:"chat"`
+	E2EERelay  bool   `json:"e2ee_relay"`
+	KnockMode  bool   `json:"knock_mode"`
+	CallPIN    bool   `json:"call_pin"`
+	Recording  bool   `json:"recording"`
+	CallStats  bool   `json:"call_stats"`
+	ClientLog  bool   `json:"client_log"`
+	Auth       string `json:"auth"` // CALL_AUTH_MODE
+}
+
+// GetCapabilities describes what this server supports so clients can adapt
+// before negotiating. Everything is derived from the live configuration.
+func (h *Handlers) GetCapabilities(c *gin.Context) {
+	c.JSON(http.StatusOK, h.capabilities())
+}
+
+func (h *Handlers) capabilities() capabilitiesResponse {
+	protocols := make([]int, 0, wsProtocolLatest)
+	for version := wsProtocolBase; version <= wsProtocolLatest; version++ {
+		protocols = append(protocols, version)
+	}
+
+	resp := capabilitiesResponse{
+		Protocols:           protocols,
+		RelayedTypes:        []string{},
+		ServerTypes:         []string{},
+		UnknownTypesRelayed: h.relay.relays(relayPolicyFallback),
+		MaxParticipants:     h.maxParticipants(),
+		ICEPolicies:         []models.ICEPolicy{models.ICEPolicyAll, models.ICEPolicyRelay},
+		Features: capabilityFeatures{
+			GroupCalls: h.maxParticipants() > models.DefaultMaxParticipants,
+			Chat:       h.relay.policyFor("chat") != RelayPolicyDrop,
+			E2EERelay:  h.relay.relays("e2ee-key"),
+			KnockMode:  true,
+			CallPIN:    true,
+			CallStats:  h.relay.policyFor("call-stats") == RelayPolicyIntercept,
+			ClientLog:  h.config.ClientLogEnabled,
+			Auth:       h.config.CallAuthMode,
+		},
+	}
+	if maintenance := h.maintenanceStatus(); maintenance.Enabled {
+		resp.Maintenance = &maintenance
+	}
+	if resp.Features.Auth == "" {
+		resp.Features.Auth = config.CallAuthOff
+	}
+
+	for msgType, policy := range h.relay {
+		switch {
+		case msgType == relayPolicyFallback:
+		case policy == RelayPolicyIntercept:
+			resp.ServerTypes = append(resp.ServerTypes, msgType)
+		case policy != RelayPolicyDrop:
+			resp.RelayedTypes = append(resp.RelayedTypes, msgType)
+		}
+	}
+	sort.Strings(resp.RelayedTypes)
+	sort.Strings(resp.ServerTypes)
+	return resp
+}
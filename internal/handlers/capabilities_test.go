@@ -0,0 +1,69 @@
+package handlers
+
+import (
+	"net/http"
+	"slices"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/tariel-x/gocall/internal/config"
+)
+
+func getCapabilities(t *testing.T, cfg *config.Config) capabilitiesResponse {
+	t.Helper()
+	h := newTestHandlers(t, cfg)
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.GET("/api/capabilities", h.GetCapabilities)
+
+	var resp capabilitiesResponse
+	if code := doJSON(t, router, http.MethodGet, "/api/capabilities", "", &resp); code != http.StatusOK {
+		t.Fatalf("capabilities: got %d", code)
+	}
+	return resp
+}
+
+func TestCapabilitiesDefaults(t *testing.T) {
+	resp := getCapabilities(t, &config.Config{})
+
+	if !slices.Equal(resp.Protocols, []int{wsProtocolBase, wsProtocolAcks, wsProtocolDeliveryFailed}) {
+		t.Fatalf("protocols = %v", resp.Protocols)
+	}
+	if !slices.Contains(resp.RelayedTypes, "offer") || !slices.Contains(resp.RelayedTypes, "e2ee-key") {
+		t.Fatalf("relayed types = %v", resp.RelayedTypes)
+	}
+	if slices.Contains(resp.RelayedTypes, "ping") || !slices.Contains(resp.ServerTypes, "get-state") {
+		t.Fatalf("relayed = %v, server = %v", resp.RelayedTypes, resp.ServerTypes)
+	}
+	if resp.UnknownTypesRelayed || resp.MaxParticipants != 2 || resp.Features.GroupCalls {
+		t.Fatalf("unexpected defaults %+v", resp)
+	}
+	if !resp.Features.E2EERelay || !resp.Features.Chat || resp.Features.ClientLog || resp.Features.Auth != config.CallAuthOff {
+		t.Fatalf("unexpected features %+v", resp.Features)
+	}
+}
+
+func TestCapabilitiesFollowConfig(t *testing.T) {
+	resp := getCapabilities(t, &config.Config{
+		MaxCallParticipants: 4,
+		ClientLogEnabled:    true,
+		CallAuthMode:        config.CallAuthRequired,
+		CallAuthSecret:      "secret",
+		WSRelayPolicies: map[string]string{
+			"*":        string(RelayPolicyDrop),
+			"e2ee-key": string(RelayPolicyDrop),
+			"chat":     string(RelayPolicyDrop),
+		},
+	})
+
+	if resp.UnknownTypesRelayed || resp.Features.Chat || resp.Features.E2EERelay {
+		t.Fatalf("dropped types reported as relayed: %+v", resp)
+	}
+	if slices.Contains(resp.RelayedTypes, "e2ee-key") {
+		t.Fatalf("relayed types = %v", resp.RelayedTypes)
+	}
+	if resp.MaxParticipants != 4 || !resp.Features.GroupCalls || !resp.Features.ClientLog || resp.Features.Auth != config.CallAuthRequired {
+		t.Fatalf("unexpected capabilities %+v", resp)
+	}
+}
@@ -0,0 +1,96 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"strings"
+	"unicode"
+
+	"github.com/tariel-x/gocall/internal/models"
+)
+
+const (
+	// maxChatTextBytes caps a chat message after trimming.
+	maxChatTextBytes = 2 << 10
+	// chatBacklogSize is how many recent messages a call keeps for peers
+	// that reconnect.
+	chatBacklogSize = 50
+)
+
+// Reasons a chat message is refused, reported to the sender in
+// delivery-failed.
+var (
+	errChatEmpty   = errors.New("empty")
+	errChatTooLong = errors.New("too_long")
+)
+
+type wsChatDataV2 struct {
+	Text string `json:"text"`
+}
+
+// sanitizeChatText trims the text and drops control characters other than
+// newlines and tabs.
+func sanitizeChatText(raw string) (string, error) {
+	text := strings.TrimSpace(strings.Map(func(r rune) rune {
+		if r != '\n' && r != '\t' && (unicode.IsControl(r) || unicode.Is(unicode.Cf, r)) {
+			return -1
+		}
+		return r
+	}, raw))
+	switch {
+	case text == "":
+		return "", errChatEmpty
+	case len(text) > maxChatTextBytes:
+		return "", errChatTooLong
+	}
+	return text, nil
+}
+
+// appendChat records msg in the call's backlog, dropping the oldest messages
+// beyond chatBacklogSize.
+func appendChat(call *models.CallV2, msg models.ChatMessageV2) {
+	call.Chat = append(call.Chat, msg)
+	if extra := len(call.Chat) - chatBacklogSize; extra > 0 {
+		call.Chat = append([]models.ChatMessageV2(nil), call.Chat[extra:]...)
+	}
+}
+
+// interceptChat validates a chat message, keeps it in the call backlog and
+// forwards it to the other participants. Unlike signaling, chat always goes
+// to everyone in the call.
+func interceptChat(h *Handlers, client *wsClientV2, msg wsEnvelopeV2) {
+	if client.pending.Load() {
+		return
+	}
+
+	var data wsChatDataV2
+	if err := json.Unmarshal(msg.Data, &data); err != nil {
+		h.reportDeliveryFailure(client, msg, errChatEmpty)
+		return
+	}
+	text, err := sanitizeChatText(data.Text)
+	if err != nil {
+		h.reportDeliveryFailure(client, msg, err)
+		return
+	}
+
+	now := h.nowFn()
+	if err := h.calls.AppendChat(client.callID, models.ChatMessageV2{From: client.peerID, FromName: client.name, Text: text, At: now}, now); err != nil {
+		h.logger.Debug("chat backlog not updated", "call_id", client.callID, "err", err)
+	}
+
+	forward, err := json.Marshal(wsEnvelopeV2{
+		Type:     "chat",
+		ID:       msg.ID,
+		From:     client.peerID,
+		FromRole: client.role,
+		FromName: client.name,
+		Data:     mustMarshal(wsChatDataV2{Text: text}),
+	})
+	if err != nil {
+		return
+	}
+	if err := h.wsHub.deliverToOther(client.callID, client.peerID, forward); err != nil {
+		h.reportDeliveryFailure(client, msg, err)
+	}
+}
@@ -0,0 +1,73 @@
+package handlers
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestChatForwarding(t *testing.T) {
+	h := newTestHandlers(t, nil)
+	call, _ := h.calls.CreateCall(h.nowFn(), CreateCallOptions{})
+	hostID, _, _ := h.calls.EnsureHostPeerID(call.ID, h.nowFn())
+	guestID, _, _ := h.calls.Join(call.ID, h.nowFn())
+
+	host := newTestClient(call.ID, hostID, PeerRoleV2Host)
+	host.name = "Host"
+	guest := newTestClient(call.ID, guestID, PeerRoleV2Guest)
+	h.wsHub.Add(host)
+	h.wsHub.Add(guest)
+
+	h.routeMessage(host, wsEnvelopeV2{Type: "chat", To: "nobody", Data: mustMarshal(wsChatDataV2{Text: "  hi\u0007 there \n"})})
+
+	msg := receive(t, guest)
+	if msg == nil || msg.Type != "chat" || msg.From != hostID || msg.FromName != "Host" {
+		t.Fatalf("expected chat from host, got %+v", msg)
+	}
+	var data wsChatDataV2
+	if err := json.Unmarshal(msg.Data, &data); err != nil || data.Text != "hi there" {
+		t.Fatalf("chat text = %q, %v", data.Text, err)
+	}
+
+	stored, _ := h.calls.GetByID(call.ID, h.nowFn())
+	if len(stored.Chat) != 1 || stored.Chat[0].Text != "hi there" || stored.Chat[0].From != hostID {
+		t.Fatalf("unexpected backlog %+v", stored.Chat)
+	}
+}
+
+func TestChatRejectsInvalidText(t *testing.T) {
+	h := newTestHandlers(t, nil)
+	call, _ := h.calls.CreateCall(h.nowFn(), CreateCallOptions{})
+	hostID, _, _ := h.calls.EnsureHostPeerID(call.ID, h.nowFn())
+	guestID, _, _ := h.calls.Join(call.ID, h.nowFn())
+
+	host := newTestClient(call.ID, hostID, PeerRoleV2Host)
+	host.protocol = wsProtocolDeliveryFailed
+	guest := newTestClient(call.ID, guestID, PeerRoleV2Guest)
+	h.wsHub.Add(host)
+	h.wsHub.Add(guest)
+
+	cases := map[string]string{
+		" \n\t ":                                errChatEmpty.Error(),
+		strings.Repeat("a", maxChatTextBytes+1): errChatTooLong.Error(),
+	}
+	for text, reason := range cases {
+		h.routeMessage(host, wsEnvelopeV2{Type: "chat", ID: "m1", Data: mustMarshal(wsChatDataV2{Text: text})})
+
+		if msg := receive(t, guest); msg != nil {
+			t.Fatalf("invalid chat was forwarded: %+v", msg)
+		}
+		msg := receive(t, host)
+		if msg == nil || msg.Type != "delivery-failed" {
+			t.Fatalf("expected delivery-failed, got %+v", msg)
+		}
+		var data wsDeliveryFailedDataV2
+		if err := json.Unmarshal(msg.Data, &data); err != nil || data.Reason != reason || data.ID != "m1" {
+			t.Fatalf("delivery-failed = %+v, want reason %s", data, reason)
+		}
+	}
+
+	if stored, _ := h.calls.GetByID(call.ID, h.nowFn()); len(stored.Chat) != 0 {
+		t.Fatalf("invalid chat kept in backlog %+v", stored.Chat)
+	}
+}
@@ -0,0 +1,53 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+const clientLogMaxBytes = 4 << 10
+
+type clientLogRequest struct {
+	CallID   string `json:"call_id" binding:"max=64"`
+	Browser  string `json:"browser" binding:"max=256"`
+	Reason   string `json:"reason" binding:"required,max=512"`
+	ICEState string `json:"ice_state" binding:"omitempty,oneof=new checking connected completed disconnected failed closed"`
+}
+
+// ReportClientLog records client-side diagnostics. The payload is only logged
+// and never forwarded to other clients.
+func (h *Handlers) ReportClientLog(c *gin.Context) {
+	if !h.config.ClientLogEnabled {
+		c.JSON(http.StatusNotFound, gin.H{"error": "client logging disabled"})
+		return
+	}
+
+	if retryAfter, ok := h.clientLogLimiter.Allow(c.ClientIP(), h.nowFn()); !ok {
+		writeBackoff(c, http.StatusTooManyRequests, backoffRateLimited, "too many requests", retryAfter)
+		return
+	}
+
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, clientLogMaxBytes)
+
+	var req clientLogRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": "request body too large"})
+			return
+		}
+		writeBindingError(c, &req, err)
+		return
+	}
+
+	h.logger.Warn("client report",
+		"call_id", req.CallID,
+		"browser", req.Browser,
+		"reason", req.Reason,
+		"ice_state", req.ICEState,
+	)
+
+	c.Status(http.StatusNoContent)
+}
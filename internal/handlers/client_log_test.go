@@ -0,0 +1,35 @@
+package handlers
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/tariel-x/gocall/internal/config"
+)
+
+func TestReportClientLog(t *testing.T) {
+	tests := []struct {
+		name    string
+		enabled bool
+		body    string
+		want    int
+	}{
+		{name: "disabled", body: `{"reason":"ice failed"}`, want: http.StatusNotFound},
+		{name: "accepted", enabled: true, body: `{"call_id":"abc","browser":"firefox","reason":"ice failed","ice_state":"failed"}`, want: http.StatusNoContent},
+		{name: "invalid ice state", enabled: true, body: `{"reason":"ice failed","ice_state":"bogus"}`, want: http.StatusBadRequest},
+		{name: "missing reason", enabled: true, body: `{"browser":"firefox"}`, want: http.StatusBadRequest},
+		{name: "oversized", enabled: true, body: `{"reason":"ice failed","browser":"` + strings.Repeat("a", clientLogMaxBytes) + `"}`, want: http.StatusRequestEntityTooLarge},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := newTestHandlers(t, &config.Config{ClientLogEnabled: tt.enabled})
+			router := newTestRouter(h)
+			router.POST("/api/client-log", h.ReportClientLog)
+
+			if code := doJSON(t, router, http.MethodPost, "/api/client-log", tt.body, nil); code != tt.want {
+				t.Fatalf("got %d, want %d", code, tt.want)
+			}
+		})
+	}
+}
@@ -1,9 +1,12 @@
 package handlers
 
 import (
+	"log/slog"
+	"sync/atomic"
 	"time"
 
 	"github.com/gorilla/websocket"
+	"github.com/prometheus/client_golang/prometheus"
 
 	"github.com/tariel-x/gocall/internal/config"
 	"github.com/tariel-x/gocall/internal/turn"
@@ -12,25 +15,68 @@ import (
 type Handlers struct {
 	config     *config.Config
 	turnServer *turn.TURNServer
-	calls      *CallStore
+	calls      Store
 	wsHub      *WSHubV2
 	wsUpgrader websocket.Upgrader
+	logger     *slog.Logger
 	nowFn      func() time.Time
+
+	relay            relayTable
+	iceProvider      *iceProvider
+	clientLogLimiter *rateLimiter
+	statusLimiter    *rateLimiter
+	pinLimiter       *rateLimiter
+	reconnectGuard   *reconnectGuard
+	ipPolicy         *ipPolicy
+	callStats        CallStatsExporter
+	userCalls        *userCallTracker
+	readiness        map[string]ReadinessCheck
+	metrics          *prometheus.Registry
+	statsBaseline    CallStoreStats                   // counts from earlier runs, see SetStatsBaseline
+	maintenance      atomic.Pointer[maintenanceState] // nil = accepting calls
 }
 
 func New(
 	config *config.Config,
 	turnServer *turn.TURNServer,
-	calls *CallStore,
+	calls Store,
 	wsHub *WSHubV2,
 	wsUpgrader websocket.Upgrader,
+	logger *slog.Logger,
 ) *Handlers {
-	return &Handlers{
+	relay, err := newRelayTable(config.WSRelayPolicies)
+	if err != nil {
+		logger.Error("invalid WS relay policies, using defaults", "error", err)
+		relay, _ = newRelayTable(nil)
+	}
+
+	var provider *iceProvider
+	if config.ICEProviderURL != "" {
+		provider = newICEProvider(config.ICEProviderURL, config.ICEProviderCacheTTL, config.ICEProviderTimeout)
+	}
+
+	h := &Handlers{
 		config:     config,
 		turnServer: turnServer,
 		calls:      calls,
 		wsHub:      wsHub,
 		wsUpgrader: wsUpgrader,
+		logger:     logger,
 		nowFn:      time.Now,
+
+		relay:            relay,
+		iceProvider:      provider,
+		clientLogLimiter: newRateLimiter(10, 5),
+		statusLimiter:    newRateLimiter(60, 20),
+		pinLimiter:       newRateLimiter(10, 5),
+		reconnectGuard:   newReconnectGuard(config.WSReconnectLimit, config.WSReconnectWindow, config.WSReconnectBackoff),
+		ipPolicy:         newIPPolicy(config.IPAllowList, config.IPBlockList),
+		callStats:        nopCallStatsExporter{},
+		userCalls:        newUserCallTracker(),
 	}
+	h.SetMaintenance(config.MaintenanceMode, config.MaintenanceMessage)
+	h.readiness = h.defaultReadinessChecks()
+	h.metrics = newMetricsRegistry(h)
+	calls.SetChangeSink(callChangeFunc(h.pushState))
+	return h
 }
@@ -0,0 +1,45 @@
+package handlers
+
+import (
+	"encoding/json"
+	"io"
+	"log/slog"
+	"testing"
+
+	"github.com/gorilla/websocket"
+
+	"github.com/tariel-x/gocall/internal/config"
+)
+
+func newTestHandlers(t *testing.T, cfg *config.Config) *Handlers {
+	t.Helper()
+	if cfg == nil {
+		cfg = &config.Config{}
+	}
+	return New(cfg, nil, NewCallStore(), NewWSHubV2(), websocket.Upgrader{}, slog.New(slog.NewTextHandler(io.Discard, nil)))
+}
+
+// newTestClient returns a hub client without a network connection.
+func newTestClient(callID, peerID string, role PeerRoleV2) *wsClientV2 {
+	return &wsClientV2{
+		send:   make(chan []byte, 8),
+		callID: callID,
+		peerID: peerID,
+		role:   role,
+	}
+}
+
+// receive returns the next queued envelope for client, or nil if none is queued.
+func receive(t *testing.T, client *wsClientV2) *wsEnvelopeV2 {
+	t.Helper()
+	select {
+	case payload := <-client.send:
+		var msg wsEnvelopeV2
+		if err := json.Unmarshal(payload, &msg); err != nil {
+			t.Fatalf("invalid envelope %s: %v", payload, err)
+		}
+		return &msg
+	default:
+		return nil
+	}
+}
@@ -0,0 +1,68 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// readinessTimeout bounds each readiness check.
+const readinessTimeout = 2 * time.Second
+
+// ReadinessCheck reports whether one subsystem can serve traffic.
+type ReadinessCheck func(ctx context.Context) error
+
+type readinessResponse struct {
+	Status string            `json:"status"`
+	Checks map[string]string `json:"checks"` // subsystem -> "ok" or the error
+}
+
+// defaultReadinessChecks checks the subsystems this server was built with:
+// the built-in TURN server, the WS hub and, when shared, the call store.
+func (h *Handlers) defaultReadinessChecks() map[string]ReadinessCheck {
+	checks := map[string]ReadinessCheck{
+		"ws_hub": func(context.Context) error { return h.wsHub.Check() },
+	}
+	if h.turnServer != nil {
+		checks["turn"] = func(context.Context) error { return h.turnServer.Check() }
+	}
+	if pinger, ok := h.calls.(interface{ Ping(context.Context) error }); ok {
+		checks["call_store"] = pinger.Ping
+	}
+	return checks
+}
+
+// SetReadinessChecks replaces the checks behind GET /readyz.
+func (h *Handlers) SetReadinessChecks(checks map[string]ReadinessCheck) {
+	h.readiness = checks
+}
+
+// Healthz answers as soon as the router is up.
+func (h *Handlers) Healthz(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{"status": "ok"})
+}
+
+// Readyz runs every readiness check and answers 503 if any of them fails, so
+// load balancers stop sending traffic to this instance.
+func (h *Handlers) Readyz(c *gin.Context) {
+	resp := readinessResponse{Status: "ok", Checks: make(map[string]string, len(h.readiness))}
+	for name, check := range h.readiness {
+		ctx, cancel := context.WithTimeout(c.Request.Context(), readinessTimeout)
+		err := check(ctx)
+		cancel()
+		if err != nil {
+			resp.Status = "unavailable"
+			resp.Checks[name] = err.Error()
+			continue
+		}
+		resp.Checks[name] = "ok"
+	}
+
+	status := http.StatusOK
+	if resp.Status != "ok" {
+		status = http.StatusServiceUnavailable
+	}
+	c.JSON(status, resp)
+}
@@ -0,0 +1,63 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func newHealthRouter(h *Handlers) *gin.Engine {
+	router := newTestRouter(h)
+	router.GET("/healthz", h.Healthz)
+	router.GET("/readyz", h.Readyz)
+	return router
+}
+
+func TestReadyzReportsEachCheck(t *testing.T) {
+	h := newTestHandlers(t, nil)
+	router := newHealthRouter(h)
+
+	if code := doJSON(t, router, http.MethodGet, "/healthz", "", nil); code != http.StatusOK {
+		t.Fatalf("healthz: got %d", code)
+	}
+
+	dbDown := errors.New("connection refused")
+	h.SetReadinessChecks(map[string]ReadinessCheck{
+		"turn":     func(context.Context) error { return nil },
+		"database": func(context.Context) error { return dbDown },
+	})
+	var resp readinessResponse
+	if code := doJSON(t, router, http.MethodGet, "/readyz", "", &resp); code != http.StatusServiceUnavailable {
+		t.Fatalf("readyz with a failing check: got %d", code)
+	}
+	if resp.Status != "unavailable" || resp.Checks["turn"] != "ok" || resp.Checks["database"] != dbDown.Error() {
+		t.Fatalf("unexpected readiness %+v", resp)
+	}
+}
+
+func TestReadyzFailsOnceHubShutsDown(t *testing.T) {
+	h := newTestHandlers(t, nil)
+	router := newHealthRouter(h)
+
+	var resp readinessResponse
+	if code := doJSON(t, router, http.MethodGet, "/readyz", "", &resp); code != http.StatusOK || resp.Checks["ws_hub"] != "ok" {
+		t.Fatalf("readyz: got %d %+v", code, resp)
+	}
+	// The memory store and the disabled TURN server aren't checked.
+	if len(resp.Checks) != 1 {
+		t.Fatalf("unexpected checks %+v", resp.Checks)
+	}
+
+	if err := h.wsHub.Shutdown(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if code := doJSON(t, router, http.MethodGet, "/readyz", "", &resp); code != http.StatusServiceUnavailable || resp.Checks["ws_hub"] == "ok" {
+		t.Fatalf("readyz after shutdown: got %d %+v", code, resp)
+	}
+	if code := doJSON(t, router, http.MethodGet, "/healthz", "", nil); code != http.StatusOK {
+		t.Fatalf("healthz after shutdown: got %d", code)
+	}
+}
@@ -0,0 +1,117 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+
+	"golang.org/x/sync/singleflight"
+)
+
+const iceProviderMaxBytes = 64 << 10
+
+// iceProviderRetryDelay is how long a failed fetch is remembered before the
+// provider is asked again.
+const iceProviderRetryDelay = 30 * time.Second
+
+// iceProvider fetches ICE servers from an external service (managed TURN,
+// a coturn REST endpoint, etc.) and caches the response.
+type iceProvider struct {
+	url    string
+	ttl    time.Duration
+	client *http.Client
+	group  singleflight.Group // one fetch at a time; concurrent callers share it
+
+	mu        sync.Mutex
+	cached    []map[string]interface{}
+	fetchedAt time.Time
+	failedAt  time.Time // last failed fetch; zero after a success
+	lastErr   error
+}
+
+type iceProviderResponse struct {
+	ICEServers []map[string]interface{} `json:"iceServers"`
+}
+
+func newICEProvider(url string, ttl, timeout time.Duration) *iceProvider {
+	return &iceProvider{
+		url:    url,
+		ttl:    ttl,
+		client: &http.Client{Timeout: timeout},
+	}
+}
+
+// Servers returns the provider's ICE servers, refreshing the cache when it is
+// older than the TTL. A stale cache is returned if the refresh fails, and a
+// failed refresh isn't retried for iceProviderRetryDelay.
+func (p *iceProvider) Servers(ctx context.Context, now time.Time) ([]map[string]interface{}, error) {
+	p.mu.Lock()
+	cached, fetchedAt, failedAt, lastErr := p.cached, p.fetchedAt, p.failedAt, p.lastErr
+	p.mu.Unlock()
+
+	if cached != nil && now.Sub(fetchedAt) < p.ttl {
+		return cached, nil
+	}
+	if !failedAt.IsZero() && now.Sub(failedAt) < iceProviderRetryDelay {
+		if cached != nil {
+			return cached, nil
+		}
+		return nil, lastErr
+	}
+
+	// The fetch is shared, so one caller going away mustn't cancel it for the
+	// rest; the client timeout still bounds it.
+	ctx = context.WithoutCancel(ctx)
+	v, err, _ := p.group.Do("", func() (interface{}, error) {
+		servers, err := p.fetch(ctx)
+
+		p.mu.Lock()
+		defer p.mu.Unlock()
+		if err != nil {
+			p.failedAt = now
+			p.lastErr = err
+			return nil, err
+		}
+		p.cached = servers
+		p.fetchedAt = now
+		p.failedAt = time.Time{}
+		p.lastErr = nil
+		return servers, nil
+	})
+	if err != nil {
+		if cached != nil {
+			return cached, nil
+		}
+		return nil, err
+	}
+	return v.([]map[string]interface{}), nil
+}
+
+func (p *iceProvider) fetch(ctx context.Context) ([]map[string]interface{}, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, p.url, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("ICE provider returned status %d", resp.StatusCode)
+	}
+
+	var body iceProviderResponse
+	if err := json.NewDecoder(io.LimitReader(resp.Body, iceProviderMaxBytes)).Decode(&body); err != nil {
+		return nil, fmt.Errorf("invalid ICE provider response: %w", err)
+	}
+	if len(body.ICEServers) == 0 {
+		return nil, fmt.Errorf("ICE provider returned no servers")
+	}
+	return body.ICEServers, nil
+}
@@ -0,0 +1,191 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/tariel-x/gocall/internal/config"
+)
+
+func TestICEProviderCachesResponses(t *testing.T) {
+	var hits atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits.Add(1)
+		_, _ = w.Write([]byte(`{"iceServers":[{"urls":"turn:turn.example.test:3478","username":"u","credential":"p"}]}`))
+	}))
+	defer srv.Close()
+
+	provider := newICEProvider(srv.URL, time.Minute, time.Second)
+	base := time.Unix(1_700_500_000, 0)
+
+	servers, err := provider.Servers(context.Background(), base)
+	if err != nil {
+		t.Fatalf("fetch failed: %v", err)
+	}
+	if len(servers) != 1 || servers[0]["urls"] != "turn:turn.example.test:3478" {
+		t.Fatalf("unexpected servers %+v", servers)
+	}
+
+	if _, err := provider.Servers(context.Background(), base.Add(30*time.Second)); err != nil {
+		t.Fatalf("cached fetch failed: %v", err)
+	}
+	if hits.Load() != 1 {
+		t.Fatalf("expected cached response, provider hit %d times", hits.Load())
+	}
+
+	if _, err := provider.Servers(context.Background(), base.Add(2*time.Minute)); err != nil {
+		t.Fatalf("refresh failed: %v", err)
+	}
+	if hits.Load() != 2 {
+		t.Fatalf("expected refresh after TTL, provider hit %d times", hits.Load())
+	}
+}
+
+func TestICEProviderFailure(t *testing.T) {
+	var fail atomic.Bool
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if fail.Load() {
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		}
+		_, _ = w.Write([]byte(`{"iceServers":[{"urls":"stun:stun.example.test"}]}`))
+	}))
+	defer srv.Close()
+
+	provider := newICEProvider(srv.URL, time.Minute, time.Second)
+	base := time.Unix(1_700_600_000, 0)
+
+	fail.Store(true)
+	if _, err := provider.Servers(context.Background(), base); err == nil {
+		t.Fatalf("expected error without cached servers")
+	}
+
+	fail.Store(false)
+	if _, err := provider.Servers(context.Background(), base.Add(iceProviderRetryDelay)); err != nil {
+		t.Fatalf("fetch failed: %v", err)
+	}
+
+	// A failed refresh keeps serving the stale response.
+	fail.Store(true)
+	servers, err := provider.Servers(context.Background(), base.Add(2*time.Minute))
+	if err != nil || len(servers) != 1 {
+		t.Fatalf("expected stale servers, got %+v, %v", servers, err)
+	}
+}
+
+func TestICEProviderBacksOffAfterFailure(t *testing.T) {
+	var hits atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits.Add(1)
+		w.WriteHeader(http.StatusBadGateway)
+	}))
+	defer srv.Close()
+
+	provider := newICEProvider(srv.URL, time.Minute, time.Second)
+	base := time.Unix(1_700_650_000, 0)
+
+	for _, at := range []time.Duration{0, time.Second, iceProviderRetryDelay - time.Second} {
+		if _, err := provider.Servers(context.Background(), base.Add(at)); err == nil {
+			t.Fatalf("expected error at +%s", at)
+		}
+	}
+	if hits.Load() != 1 {
+		t.Fatalf("expected one fetch while backing off, provider hit %d times", hits.Load())
+	}
+
+	_, _ = provider.Servers(context.Background(), base.Add(iceProviderRetryDelay))
+	if hits.Load() != 2 {
+		t.Fatalf("expected a retry after the delay, provider hit %d times", hits.Load())
+	}
+}
+
+func TestICEProviderSharesConcurrentFetches(t *testing.T) {
+	var hits atomic.Int32
+	release := make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits.Add(1)
+		<-release
+		_, _ = w.Write([]byte(`{"iceServers":[{"urls":"stun:stun.example.test"}]}`))
+	}))
+	defer srv.Close()
+
+	provider := newICEProvider(srv.URL, time.Minute, 5*time.Second)
+	base := time.Unix(1_700_700_000, 0)
+
+	var wg sync.WaitGroup
+	for range 5 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if servers, err := provider.Servers(context.Background(), base); err != nil || len(servers) != 1 {
+				t.Errorf("unexpected servers %+v, %v", servers, err)
+			}
+		}()
+	}
+	for hits.Load() == 0 {
+		time.Sleep(time.Millisecond)
+	}
+	time.Sleep(50 * time.Millisecond)
+	close(release)
+	wg.Wait()
+
+	if hits.Load() != 1 {
+		t.Fatalf("expected one shared fetch, provider hit %d times", hits.Load())
+	}
+}
+
+func TestTURNConfigKeepsExternalServersWithoutMerge(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(`{"iceServers":[{"urls":"turn:provider.example.test:3478"}]}`))
+	}))
+	defer srv.Close()
+
+	h := newTestHandlers(t, &config.Config{
+		ICEProviderURL:      srv.URL,
+		ICEProviderCacheTTL: time.Minute,
+		ICEProviderTimeout:  time.Second,
+		ExternalICEServers:  []config.ICEServer{{URLs: []string{"stun:stun.example.test:3478"}}},
+	})
+
+	servers := h.buildICEServers(context.Background(), "example.test")
+	if len(servers) != 2 {
+		t.Fatalf("expected the static and the provider server, got %+v", servers)
+	}
+}
+
+func TestTURNConfigIncludesExternalServers(t *testing.T) {
+	h := newTestHandlers(t, &config.Config{
+		ExternalICEServers: []config.ICEServer{
+			{URLs: []string{"stun:stun.example.test:3478"}},
+			{URLs: []string{"turns:turn.example.test:443?transport=tcp"}, Username: "u", Credential: "p"},
+		},
+	})
+	router := newTestRouter(h)
+
+	var resp struct {
+		ICEServers []struct {
+			URLs       []string `json:"urls"`
+			Username   string   `json:"username"`
+			Credential string   `json:"credential"`
+		} `json:"iceServers"`
+	}
+	if code := doJSON(t, router, http.MethodGet, "/api/turn-config", "", &resp); code != http.StatusOK {
+		t.Fatalf("unexpected status %d", code)
+	}
+
+	// The built-in TURN server is disabled (nil), so only external entries remain.
+	if len(resp.ICEServers) != 2 {
+		t.Fatalf("expected 2 ICE servers, got %+v", resp.ICEServers)
+	}
+	if resp.ICEServers[0].URLs[0] != "stun:stun.example.test:3478" || resp.ICEServers[0].Username != "" {
+		t.Fatalf("unexpected STUN entry %+v", resp.ICEServers[0])
+	}
+	if resp.ICEServers[1].Username != "u" || resp.ICEServers[1].Credential != "p" {
+		t.Fatalf("unexpected TURN entry %+v", resp.ICEServers[1])
+	}
+}
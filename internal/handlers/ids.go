@@ -0,0 +1,59 @@
+package handlers
+
+import (
+	"crypto/rand"
+	"errors"
+
+	gonanoid "github.com/matoous/go-nanoid/v2"
+)
+
+const (
+	// idLength is the length of call and peer IDs.
+	idLength = 16
+	// idAttempts bounds how often newID asks the generator before falling
+	// back, and how many collisions it tolerates.
+	idAttempts = 3
+	// idAlphabet is nanoid's default alphabet.
+	idAlphabet = "_-0123456789abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ"
+)
+
+var errIDCollision = errors.New("could not generate a unique id")
+
+// generateID is the primary ID source; tests replace it to simulate failures.
+var generateID = func() (string, error) {
+	return gonanoid.New(idLength)
+}
+
+// newID returns a fresh call or peer ID for which taken (if non-nil) reports
+// false. Generator failures are retried and then served from crypto/rand, so
+// a flaky entropy source doesn't fail user requests.
+func newID(taken func(id string) bool) (string, error) {
+	for range idAttempts {
+		id := generateIDWithFallback()
+		if taken == nil || !taken(id) {
+			return id, nil
+		}
+	}
+	return "", errIDCollision
+}
+
+func generateIDWithFallback() string {
+	for range idAttempts {
+		if id, err := generateID(); err == nil && id != "" {
+			return id
+		}
+	}
+	return fallbackID()
+}
+
+// fallbackID draws an ID from crypto/rand directly, in nanoid's alphabet so
+// it looks like any other ID. 64 symbols divide 256 evenly, so there is no
+// modulo bias.
+func fallbackID() string {
+	b := make([]byte, idLength)
+	_, _ = rand.Read(b)
+	for i := range b {
+		b[i] = idAlphabet[int(b[i])%len(idAlphabet)]
+	}
+	return string(b)
+}
@@ -0,0 +1,94 @@
+package handlers
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+// stubGenerateID replaces the primary ID source with ids, returned in order;
+// an empty entry simulates a generator failure.
+func stubGenerateID(t *testing.T, ids ...string) *int {
+	t.Helper()
+	calls := 0
+	orig := generateID
+	generateID = func() (string, error) {
+		calls++
+		if len(ids) == 0 {
+			return "", errors.New("entropy unavailable")
+		}
+		id := ids[0]
+		ids = ids[1:]
+		if id == "" {
+			return "", errors.New("entropy unavailable")
+		}
+		return id, nil
+	}
+	t.Cleanup(func() { generateID = orig })
+	return &calls
+}
+
+func TestNewIDFallsBackWhenGeneratorFails(t *testing.T) {
+	calls := stubGenerateID(t)
+
+	id, err := newID(nil)
+	if err != nil {
+		t.Fatalf("newID: %v", err)
+	}
+	if len(id) != idLength || strings.Trim(id, idAlphabet) != "" {
+		t.Fatalf("fallback id %q is not a %d-char nanoid", id, idLength)
+	}
+	if *calls != idAttempts {
+		t.Fatalf("generator called %d times, want %d retries", *calls, idAttempts)
+	}
+}
+
+func TestNewIDRetriesTransientFailures(t *testing.T) {
+	stubGenerateID(t, "", "", "aaaaaaaaaaaaaaaa")
+
+	if id, err := newID(nil); err != nil || id != "aaaaaaaaaaaaaaaa" {
+		t.Fatalf("newID = %q, %v; want the generator's id after retries", id, err)
+	}
+}
+
+func TestNewIDRegeneratesOnCollision(t *testing.T) {
+	stubGenerateID(t, "taken0000000000a", "fresh0000000000b")
+
+	id, err := newID(func(id string) bool { return id == "taken0000000000a" })
+	if err != nil || id != "fresh0000000000b" {
+		t.Fatalf("newID = %q, %v; want the second id", id, err)
+	}
+
+	if _, err := newID(func(string) bool { return true }); !errors.Is(err, errIDCollision) {
+		t.Fatalf("expected errIDCollision when every id is taken, got %v", err)
+	}
+}
+
+func TestCallStoreSurvivesFailingGenerator(t *testing.T) {
+	store := NewCallStore()
+	now := time.Now()
+
+	stubGenerateID(t, "call000000000001", "call000000000001", "call000000000002")
+	first, err := store.CreateCall(now, CreateCallOptions{})
+	if err != nil {
+		t.Fatalf("CreateCall: %v", err)
+	}
+	second, err := store.CreateCall(now, CreateCallOptions{})
+	if err != nil {
+		t.Fatalf("CreateCall: %v", err)
+	}
+	if first.ID == second.ID {
+		t.Fatalf("colliding call id %q was reused", first.ID)
+	}
+
+	// From here on the generator always fails; the fallback takes over.
+	hostID, _, err := store.EnsureHostPeerID(first.ID, now)
+	if err != nil || hostID == "" {
+		t.Fatalf("EnsureHostPeerID = %q, %v", hostID, err)
+	}
+	guestID, _, err := store.Join(first.ID, now)
+	if err != nil || guestID == "" || guestID == hostID {
+		t.Fatalf("Join = %q, %v (host %q)", guestID, err, hostID)
+	}
+}
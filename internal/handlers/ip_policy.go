@@ -0,0 +1,63 @@
+package handlers
+
+import (
+	"net/http"
+	"net/netip"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ipPolicy is a coarse CIDR allow/block list for deployments that must
+// restrict who can use the server. A nil policy allows everyone.
+type ipPolicy struct {
+	allow []netip.Prefix
+	block []netip.Prefix
+}
+
+func newIPPolicy(allow, block []netip.Prefix) *ipPolicy {
+	if len(allow) == 0 && len(block) == 0 {
+		return nil
+	}
+	return &ipPolicy{allow: allow, block: block}
+}
+
+// Allowed reports whether ip may use the server. The block list always wins;
+// loopback passes the allow list so local development keeps working.
+func (p *ipPolicy) Allowed(ip string) bool {
+	if p == nil {
+		return true
+	}
+	addr, err := netip.ParseAddr(ip)
+	if err != nil {
+		return false
+	}
+	addr = addr.Unmap()
+
+	if containsAddr(p.block, addr) {
+		return false
+	}
+	if len(p.allow) == 0 || addr.IsLoopback() {
+		return true
+	}
+	return containsAddr(p.allow, addr)
+}
+
+func containsAddr(prefixes []netip.Prefix, addr netip.Addr) bool {
+	for _, prefix := range prefixes {
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// checkClientIP rejects the request with 403 when the client IP (as resolved
+// through the trusted proxies) is outside the policy.
+func (h *Handlers) checkClientIP(c *gin.Context) bool {
+	if h.ipPolicy.Allowed(c.ClientIP()) {
+		return true
+	}
+	h.logger.Warn("request rejected by IP policy", "ip", h.config.ClientIPForLog(c.ClientIP()), "path", c.Request.URL.Path)
+	c.JSON(http.StatusForbidden, gin.H{"error": "access from this address is not allowed"})
+	return false
+}
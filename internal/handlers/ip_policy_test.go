@@ -0,0 +1,76 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"strings"
+	"testing"
+
+	"github.com/tariel-x/gocall/internal/config"
+)
+
+func TestIPPolicyAllowed(t *testing.T) {
+	allow := []netip.Prefix{netip.MustParsePrefix("10.0.0.0/8"), netip.MustParsePrefix("2001:db8::/32")}
+	block := []netip.Prefix{netip.MustParsePrefix("10.66.0.0/16"), netip.MustParsePrefix("203.0.113.0/24")}
+
+	cases := []struct {
+		name   string
+		policy *ipPolicy
+		ip     string
+		want   bool
+	}{
+		{"no policy", newIPPolicy(nil, nil), "198.51.100.1", true},
+		{"allow-only match", newIPPolicy(allow, nil), "10.1.2.3", true},
+		{"allow-only ipv6 match", newIPPolicy(allow, nil), "2001:db8::1", true},
+		{"allow-only miss", newIPPolicy(allow, nil), "198.51.100.1", false},
+		{"allow-only mapped ipv4", newIPPolicy(allow, nil), "::ffff:10.1.2.3", true},
+		{"allow-only loopback", newIPPolicy(allow, nil), "127.0.0.1", true},
+		{"allow-only ipv6 loopback", newIPPolicy(allow, nil), "::1", true},
+		{"block-only match", newIPPolicy(nil, block), "203.0.113.7", false},
+		{"block-only miss", newIPPolicy(nil, block), "198.51.100.1", true},
+		{"block-only loopback", newIPPolicy(nil, block), "127.0.0.1", true},
+		{"block wins over allow", newIPPolicy(allow, block), "10.66.1.1", false},
+		{"unparseable", newIPPolicy(allow, nil), "not-an-ip", false},
+	}
+	for _, tc := range cases {
+		if got := tc.policy.Allowed(tc.ip); got != tc.want {
+			t.Errorf("%s: Allowed(%q) = %v, want %v", tc.name, tc.ip, got, tc.want)
+		}
+	}
+}
+
+func TestIPPolicyRejectsCallRequests(t *testing.T) {
+	h := newTestHandlers(t, &config.Config{
+		IPBlockList: []netip.Prefix{netip.MustParsePrefix("203.0.113.0/24")},
+	})
+	router := newTestRouter(h)
+
+	do := func(method, path, remoteAddr string) int {
+		req := httptest.NewRequest(method, path, strings.NewReader(""))
+		req.RemoteAddr = remoteAddr
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, req)
+		return rec.Code
+	}
+
+	if code := do(http.MethodPost, "/api/calls", "203.0.113.5:40000"); code != http.StatusForbidden {
+		t.Fatalf("create from blocked IP: got %d, want 403", code)
+	}
+	if code := do(http.MethodPost, "/api/calls/abc/join", "203.0.113.5:40000"); code != http.StatusForbidden {
+		t.Fatalf("join from blocked IP: got %d, want 403", code)
+	}
+	if code := do(http.MethodPost, "/api/calls/abc/leave", "203.0.113.5:40000"); code != http.StatusForbidden {
+		t.Fatalf("leave from blocked IP: got %d, want 403", code)
+	}
+	if code := do(http.MethodGet, "/api/ws?call_id=abc", "203.0.113.5:40000"); code != http.StatusForbidden {
+		t.Fatalf("ws from blocked IP: got %d, want 403", code)
+	}
+
+	if code := do(http.MethodPost, "/api/calls", "198.51.100.1:40000"); code != http.StatusOK {
+		t.Fatalf("create from allowed IP: got %d, want 200", code)
+	}
+	if code := do(http.MethodPost, "/api/calls", "127.0.0.1:40000"); code != http.StatusOK {
+		t.Fatalf("create from loopback: got %d, want 200", code)
+	}
+}
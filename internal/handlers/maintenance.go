@@ -0,0 +1,79 @@
+package handlers
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// maintenanceRetryAfter is the Retry-After hint for calls refused during
+// maintenance.
+const maintenanceRetryAfter = time.Minute
+
+const defaultMaintenanceMessage = "the server is under maintenance, try again later"
+
+// maintenanceState is what SetMaintenance stores; a nil state means the
+// server accepts calls.
+type maintenanceState struct {
+	Message string
+}
+
+type maintenanceRequest struct {
+	Enabled bool   `json:"enabled"`
+	Message string `json:"message" binding:"max=500"`
+}
+
+type maintenanceResponse struct {
+	Enabled bool   `json:"enabled"`
+	Message string `json:"message,omitempty"`
+}
+
+// SetMaintenance stops (or resumes) accepting new calls and joins. Calls in
+// progress and their WS connections are not affected. An empty message uses
+// the default one.
+func (h *Handlers) SetMaintenance(enabled bool, message string) {
+	if !enabled {
+		h.maintenance.Store(nil)
+		return
+	}
+	if message == "" {
+		message = defaultMaintenanceMessage
+	}
+	h.maintenance.Store(&maintenanceState{Message: message})
+}
+
+// inMaintenance refuses the request with 503 while maintenance mode is on.
+func (h *Handlers) inMaintenance(c *gin.Context) bool {
+	state := h.maintenance.Load()
+	if state == nil {
+		return false
+	}
+	writeBackoff(c, http.StatusServiceUnavailable, backoffMaintenance, state.Message, maintenanceRetryAfter)
+	return true
+}
+
+func (h *Handlers) maintenanceStatus() maintenanceResponse {
+	if state := h.maintenance.Load(); state != nil {
+		return maintenanceResponse{Enabled: true, Message: state.Message}
+	}
+	return maintenanceResponse{}
+}
+
+// GetMaintenance reports whether maintenance mode is on.
+func (h *Handlers) GetMaintenance(c *gin.Context) {
+	c.JSON(http.StatusOK, h.maintenanceStatus())
+}
+
+// PutMaintenance turns maintenance mode on or off.
+func (h *Handlers) PutMaintenance(c *gin.Context) {
+	var req maintenanceRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		writeBindingError(c, &req, err)
+		return
+	}
+
+	h.SetMaintenance(req.Enabled, req.Message)
+	h.logger.Info("maintenance mode changed", "enabled", req.Enabled)
+	c.JSON(http.StatusOK, h.maintenanceStatus())
+}
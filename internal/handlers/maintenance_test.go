@@ -0,0 +1,64 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/tariel-x/gocall/internal/config"
+)
+
+func TestMaintenanceBlocksNewCallsOnly(t *testing.T) {
+	h := newTestHandlers(t, &config.Config{AdminToken: "s3cret"})
+	router := newTestRouter(h)
+	router.PUT("/api/maintenance", h.RequireAdmin, h.PutMaintenance)
+
+	var created createCallResponse
+	if code := doJSON(t, router, http.MethodPost, "/api/calls", "", &created); code != http.StatusOK {
+		t.Fatalf("create before maintenance: got %d", code)
+	}
+	hostID, _, _ := h.calls.EnsureHostPeerID(created.CallID, h.nowFn())
+	var joined joinCallResponse
+	if code := doJSON(t, router, http.MethodPost, "/api/calls/"+created.CallID+"/join", "", &joined); code != http.StatusOK {
+		t.Fatalf("join before maintenance: got %d", code)
+	}
+	host := newTestClient(created.CallID, hostID, PeerRoleV2Host)
+	guest := newTestClient(created.CallID, joined.PeerID, PeerRoleV2Guest)
+	h.wsHub.Add(host)
+	h.wsHub.Add(guest)
+
+	req := httptest.NewRequest(http.MethodPut, "/api/maintenance", strings.NewReader(`{"enabled":true,"message":"upgrading"}`))
+	req.Header.Set("Authorization", "Bearer s3cret")
+	req.Header.Set("Content-Type", "application/json")
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("enable maintenance: got %d", rec.Code)
+	}
+
+	var refused backoffResponse
+	if code := doJSON(t, router, http.MethodPost, "/api/calls", "", &refused); code != http.StatusServiceUnavailable || refused.Code != backoffMaintenance || refused.Error != "upgrading" {
+		t.Fatalf("create during maintenance: got %d %+v", code, refused)
+	}
+	if code := doJSON(t, router, http.MethodPost, "/api/calls/"+created.CallID+"/join", "", nil); code != http.StatusServiceUnavailable {
+		t.Fatalf("join during maintenance: got %d, want 503", code)
+	}
+
+	var status statusResponse
+	doJSON(t, router, http.MethodGet, "/api/status", "", &status)
+	if status.AcceptingCalls || status.Maintenance == nil || status.Maintenance.Message != "upgrading" {
+		t.Fatalf("status should report maintenance, got %+v", status)
+	}
+
+	// The existing call keeps signaling.
+	h.routeMessage(host, wsEnvelopeV2{Type: "offer"})
+	if msg := receive(t, guest); msg == nil || msg.Type != "offer" {
+		t.Fatalf("expected offer to be relayed, got %+v", msg)
+	}
+
+	h.SetMaintenance(false, "")
+	if code := doJSON(t, router, http.MethodPost, "/api/calls", "", nil); code != http.StatusOK {
+		t.Fatalf("create after maintenance: got %d", code)
+	}
+}
@@ -0,0 +1,18 @@
+package handlers
+
+import (
+	"encoding/json"
+
+	"github.com/tariel-x/gocall/internal/models"
+)
+
+// interceptMediaState records whether the sender is muted or has its camera
+// off. Recording it pushes the new state to everyone, and peers that join or
+// reconnect later see it too.
+func interceptMediaState(h *Handlers, client *wsClientV2, msg wsEnvelopeV2) {
+	var data models.MediaState
+	if err := json.Unmarshal(msg.Data, &data); err != nil {
+		return
+	}
+	_, _ = h.calls.SetMediaState(client.callID, client.peerID, data, h.nowFn())
+}
@@ -0,0 +1,78 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+
+	"github.com/tariel-x/gocall/internal/models"
+)
+
+func TestSetMediaState(t *testing.T) {
+	redisStores, _ := newTestRedisStores(t, 1)
+	stores := map[string]Store{"memory": NewCallStore(), "redis": redisStores[0], "sqlite": newTestSQLiteStore(t, "", CallStoreOptions{})}
+
+	for name, store := range stores {
+		t.Run(name, func(t *testing.T) {
+			now := time.Unix(1_700_900_000, 0)
+			call, _ := store.CreateCall(now, CreateCallOptions{})
+			guestID, call, _ := store.Join(call.ID, now)
+			if call.Participants[guestID].Media != nil {
+				t.Fatal("media state known before it was reported")
+			}
+
+			seq := call.Seq
+			updated, err := store.SetMediaState(call.ID, guestID, models.MediaState{Audio: false, Video: true}, now)
+			if err != nil {
+				t.Fatalf("set media state failed: %v", err)
+			}
+			if media := updated.Participants[guestID].Media; media == nil || media.Audio || !media.Video {
+				t.Fatalf("unexpected media state %+v", media)
+			}
+			if updated.Seq <= seq {
+				t.Fatalf("seq not bumped: %d -> %d", seq, updated.Seq)
+			}
+
+			if _, err := store.SetMediaState(call.ID, "stranger", models.MediaState{}, now); !errors.Is(err, errInvalidPeerID) {
+				t.Fatalf("unknown peer: expected errInvalidPeerID, got %v", err)
+			}
+		})
+	}
+}
+
+func TestJoinAckCarriesPeerMediaState(t *testing.T) {
+	h := newTestHandlers(t, nil)
+	srv := httptest.NewServer(newTestRouter(h))
+	t.Cleanup(srv.Close)
+
+	call, _ := h.calls.CreateCall(h.nowFn(), CreateCallOptions{})
+	hostID, _, _ := h.calls.EnsureHostPeerID(call.ID, h.nowFn())
+	guestID, _, _ := h.calls.Join(call.ID, h.nowFn())
+
+	host := newTestClient(call.ID, hostID, PeerRoleV2Host)
+	h.routeMessage(host, wsEnvelopeV2{Type: "media-state", Data: json.RawMessage(`{"audio":false,"video":true}`)})
+
+	conn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(srv.URL, "http")+"/api/ws?call_id="+call.ID+"&peer_id="+guestID, nil)
+	if err != nil {
+		t.Fatalf("dial failed: %v", err)
+	}
+	t.Cleanup(func() { _ = conn.Close() })
+
+	var msg wsEnvelopeV2
+	_ = conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	if err := conn.ReadJSON(&msg); err != nil || msg.Type != "join" {
+		t.Fatalf("expected join, got %+v, %v", msg, err)
+	}
+	var join wsJoinDataV2
+	if err := json.Unmarshal(msg.Data, &join); err != nil {
+		t.Fatal(err)
+	}
+	if got, ok := join.PeerMedia[hostID]; !ok || got.Audio || !got.Video || len(join.PeerMedia) != 1 {
+		t.Fatalf("unexpected peer media %+v", join.PeerMedia)
+	}
+}
@@ -0,0 +1,104 @@
+package handlers
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+
+	"github.com/tariel-x/gocall/internal/models"
+)
+
+// metricsCollector exposes calls and signaling traffic to Prometheus. Values
+// are read from the call store and the WS hub at scrape time, so the
+// counters stay the ones GET /api/ws-stats reports.
+type metricsCollector struct {
+	h *Handlers
+
+	calls         *prometheus.Desc
+	callsCreated  *prometheus.Desc
+	callsEnded    *prometheus.Desc
+	wsConnections *prometheus.Desc
+	wsReceived    *prometheus.Desc
+	wsReceivedB   *prometheus.Desc
+	wsSent        *prometheus.Desc
+	wsSentB       *prometheus.Desc
+	wsRelayed     *prometheus.Desc
+	wsDropped     *prometheus.Desc
+}
+
+func newMetricsCollector(h *Handlers) *metricsCollector {
+	byType := []string{"type"}
+	return &metricsCollector{
+		h:             h,
+		calls:         prometheus.NewDesc("gocall_calls", "Calls that haven't ended, by status.", []string{"status"}, nil),
+		callsCreated:  prometheus.NewDesc("gocall_calls_created_total", "Calls created, including earlier runs kept in the analytics log.", nil, nil),
+		callsEnded:    prometheus.NewDesc("gocall_calls_ended_total", "Calls ended, including earlier runs kept in the analytics log.", nil, nil),
+		wsConnections: prometheus.NewDesc("gocall_ws_connections", "WebSocket clients connected to this instance.", nil, nil),
+		wsReceived:    prometheus.NewDesc("gocall_ws_messages_received_total", "WebSocket messages read from clients.", byType, nil),
+		wsReceivedB:   prometheus.NewDesc("gocall_ws_received_bytes_total", "Bytes of WebSocket messages read from clients.", byType, nil),
+		wsSent:        prometheus.NewDesc("gocall_ws_messages_sent_total", "WebSocket messages written to clients.", byType, nil),
+		wsSentB:       prometheus.NewDesc("gocall_ws_sent_bytes_total", "Bytes of WebSocket messages written to clients.", byType, nil),
+		wsRelayed:     prometheus.NewDesc("gocall_ws_messages_relayed_total", "Client messages forwarded to peers.", byType, nil),
+		wsDropped:     prometheus.NewDesc("gocall_ws_messages_dropped_total", "Messages dropped because a client's send buffer was full.", byType, nil),
+	}
+}
+
+func (m *metricsCollector) Describe(ch chan<- *prometheus.Desc) {
+	for _, desc := range []*prometheus.Desc{m.calls, m.callsCreated, m.callsEnded, m.wsConnections, m.wsReceived, m.wsReceivedB, m.wsSent, m.wsSentB, m.wsRelayed, m.wsDropped} {
+		ch <- desc
+	}
+}
+
+func (m *metricsCollector) Collect(ch chan<- prometheus.Metric) {
+	now := m.h.nowFn()
+	for _, status := range []models.CallStatusV2{models.CallStatusV2Waiting, models.CallStatusV2Active} {
+		calls, err := m.h.calls.ListByStatus(status, 0, now)
+		if err != nil {
+			ch <- prometheus.NewInvalidMetric(m.calls, err)
+			continue
+		}
+		ch <- prometheus.MustNewConstMetric(m.calls, prometheus.GaugeValue, float64(len(calls)), string(status))
+	}
+
+	stats := m.h.calls.Stats()
+	ch <- prometheus.MustNewConstMetric(m.callsCreated, prometheus.CounterValue, float64(m.h.statsBaseline.Created+stats.Created))
+	ch <- prometheus.MustNewConstMetric(m.callsEnded, prometheus.CounterValue, float64(m.h.statsBaseline.Ended+stats.Ended))
+
+	ch <- prometheus.MustNewConstMetric(m.wsConnections, prometheus.GaugeValue, float64(m.h.wsHub.Connections()))
+	for msgType, s := range m.h.wsHub.MessageStats() {
+		for desc, value := range map[*prometheus.Desc]uint64{
+			m.wsReceived:  s.Received,
+			m.wsReceivedB: s.ReceivedBytes,
+			m.wsSent:      s.Sent,
+			m.wsSentB:     s.SentBytes,
+			m.wsRelayed:   s.Relayed,
+			m.wsDropped:   s.Dropped,
+		} {
+			ch <- prometheus.MustNewConstMetric(desc, prometheus.CounterValue, float64(value), msgType)
+		}
+	}
+}
+
+// newMetricsRegistry collects the server's metrics along with the Go runtime
+// and process ones.
+func newMetricsRegistry(h *Handlers) *prometheus.Registry {
+	registry := prometheus.NewRegistry()
+	registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		newMetricsCollector(h),
+	)
+	return registry
+}
+
+// SetStatsBaseline adds call counts from earlier runs to the lifetime
+// counters in /metrics. Call it before serving.
+func (h *Handlers) SetStatsBaseline(stats CallStoreStats) {
+	h.statsBaseline = stats
+}
+
+// GetMetrics serves the metrics in the Prometheus text format.
+func (h *Handlers) GetMetrics(c *gin.Context) {
+	promhttp.HandlerFor(h.metrics, promhttp.HandlerOpts{}).ServeHTTP(c.Writer, c.Request)
+}
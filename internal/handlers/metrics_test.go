@@ -0,0 +1,88 @@
+package handlers
+
+import (
+	"testing"
+
+	dto "github.com/prometheus/client_model/go"
+
+	"github.com/tariel-x/gocall/internal/models"
+)
+
+// gatherValue scrapes h's registry for the value of one metric series.
+func gatherValue(t *testing.T, h *Handlers, name string, labels map[string]string) (float64, bool) {
+	t.Helper()
+	families, err := h.metrics.Gather()
+	if err != nil {
+		t.Fatalf("gather failed: %v", err)
+	}
+	for _, family := range families {
+		if family.GetName() != name {
+			continue
+		}
+		for _, metric := range family.GetMetric() {
+			if !hasLabels(metric, labels) {
+				continue
+			}
+			if gauge := metric.GetGauge(); gauge != nil {
+				return gauge.GetValue(), true
+			}
+			return metric.GetCounter().GetValue(), true
+		}
+	}
+	return 0, false
+}
+
+func hasLabels(metric *dto.Metric, labels map[string]string) bool {
+	matched := 0
+	for _, pair := range metric.GetLabel() {
+		if want, ok := labels[pair.GetName()]; ok && want == pair.GetValue() {
+			matched++
+		}
+	}
+	return matched == len(labels)
+}
+
+func TestMetricsReflectCallsAndRelays(t *testing.T) {
+	h := newTestHandlers(t, nil)
+	if v, _ := gatherValue(t, h, "gocall_calls", map[string]string{"status": "waiting"}); v != 0 {
+		t.Fatalf("waiting calls before any call = %v", v)
+	}
+
+	call, _ := h.calls.CreateCall(h.nowFn(), CreateCallOptions{})
+	if v, ok := gatherValue(t, h, "gocall_calls", map[string]string{"status": "waiting"}); !ok || v != 1 {
+		t.Fatalf("waiting calls = %v, %v; want 1", v, ok)
+	}
+
+	hostID, _, _ := h.calls.EnsureHostPeerID(call.ID, h.nowFn())
+	guestID, _, _ := h.calls.Join(call.ID, h.nowFn())
+	host := newTestClient(call.ID, hostID, PeerRoleV2Host)
+	h.wsHub.Add(host)
+	h.wsHub.Add(newTestClient(call.ID, guestID, PeerRoleV2Guest))
+
+	h.routeMessage(host, wsEnvelopeV2{Type: "offer", To: guestID})
+	if v, _ := gatherValue(t, h, "gocall_calls", map[string]string{"status": "active"}); v != 1 {
+		t.Fatalf("active calls = %v, want 1", v)
+	}
+	if v, _ := gatherValue(t, h, "gocall_ws_connections", nil); v != 2 {
+		t.Fatalf("ws connections = %v, want 2", v)
+	}
+	if v, _ := gatherValue(t, h, "gocall_ws_messages_relayed_total", map[string]string{"type": "offer"}); v != 1 {
+		t.Fatalf("relayed offers = %v, want 1", v)
+	}
+}
+
+func TestMetricsLifetimeCountersIncludeBaseline(t *testing.T) {
+	h := newTestHandlers(t, nil)
+	h.SetStatsBaseline(CallStoreStats{Created: 40, Ended: 38})
+
+	call, _ := h.calls.CreateCall(h.nowFn(), CreateCallOptions{})
+	h.calls.EndCall(call.ID, models.CallEndReasonLeft, h.nowFn())
+	h.calls.CreateCall(h.nowFn(), CreateCallOptions{})
+
+	if v, _ := gatherValue(t, h, "gocall_calls_created_total", nil); v != 42 {
+		t.Fatalf("created total = %v, want 42", v)
+	}
+	if v, _ := gatherValue(t, h, "gocall_calls_ended_total", nil); v != 39 {
+		t.Fatalf("ended total = %v, want 39", v)
+	}
+}
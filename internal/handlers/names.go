@@ -0,0 +1,61 @@
+package handlers
+
+import (
+	"encoding/json"
+	"strings"
+	"unicode"
+)
+
+// maxDisplayNameRunes caps participant display names; longer names are cut.
+const maxDisplayNameRunes = 64
+
+type wsSetNameDataV2 struct {
+	Name string `json:"name"`
+}
+
+// sanitizeDisplayName strips control and formatting characters (including
+// bidi overrides), collapses whitespace and applies the length cap. An empty
+// result clears the name.
+func sanitizeDisplayName(raw string) string {
+	var b strings.Builder
+	runes := 0
+	space := false
+	for _, r := range strings.TrimSpace(raw) {
+		if runes >= maxDisplayNameRunes {
+			break
+		}
+		switch {
+		case unicode.IsSpace(r):
+			space = true
+			continue
+		case unicode.IsControl(r), unicode.Is(unicode.Cf, r), r == unicode.ReplacementChar:
+			continue
+		}
+		if space && b.Len() > 0 {
+			if runes+1 >= maxDisplayNameRunes {
+				break // no room for a word after the space
+			}
+			b.WriteByte(' ')
+			runes++
+		}
+		space = false
+		b.WriteRune(r)
+		runes++
+	}
+	return b.String()
+}
+
+// interceptSetName stores the sender's display name on the call; the store
+// then pushes the new state to everyone. Names live on the participant and go
+// away with the call.
+func interceptSetName(h *Handlers, client *wsClientV2, msg wsEnvelopeV2) {
+	var data wsSetNameDataV2
+	if err := json.Unmarshal(msg.Data, &data); err != nil {
+		return
+	}
+	name := sanitizeDisplayName(data.Name)
+	if _, err := h.calls.SetParticipantName(client.callID, client.peerID, name, h.nowFn()); err != nil {
+		return
+	}
+	client.name = name
+}
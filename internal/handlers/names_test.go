@@ -0,0 +1,75 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestSanitizeDisplayName(t *testing.T) {
+	cases := map[string]string{
+		"  Alice  ":              "Alice",
+		"Bob\n\t Smith":          "Bob Smith",
+		"Eve\u202edlrow":         "Evedlrow",
+		"\x00\x07":               "",
+		strings.Repeat("я", 100): strings.Repeat("я", maxDisplayNameRunes),
+		"Анна   Каренина":        "Анна Каренина",
+		strings.Repeat("a ", 40): strings.TrimSpace(strings.Repeat("a ", 32)),
+	}
+	for in, want := range cases {
+		if got := sanitizeDisplayName(in); got != want {
+			t.Fatalf("sanitizeDisplayName(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
+
+func TestDisplayNamesInState(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	h := newTestHandlers(t, nil)
+	router := newTestRouter(h)
+
+	call, _ := h.calls.CreateCall(h.nowFn(), CreateCallOptions{})
+	hostID, _, _ := h.calls.EnsureHostPeerID(call.ID, h.nowFn())
+
+	var joined joinCallResponse
+	if code := doJSON(t, router, http.MethodPost, "/api/calls/"+call.ID+"/join", `{"name":" Guest\u0000 "}`, &joined); code != http.StatusOK {
+		t.Fatalf("join: got %d", code)
+	}
+
+	host := newTestClient(call.ID, hostID, PeerRoleV2Host)
+	guest := newTestClient(call.ID, joined.PeerID, PeerRoleV2Guest)
+	guest.name = "Guest"
+	h.wsHub.Add(host)
+	h.wsHub.Add(guest)
+
+	h.routeMessage(host, wsEnvelopeV2{Type: "set-name", Data: json.RawMessage(`{"name":"Host"}`)})
+
+	want := map[string]string{hostID: "Host", joined.PeerID: "Guest"}
+	for _, client := range []*wsClientV2{host, guest} {
+		msg := receive(t, client)
+		if msg == nil || msg.Type != "state" {
+			t.Fatalf("%s: expected state, got %+v", client.role, msg)
+		}
+		var data wsStateDataV2
+		if err := json.Unmarshal(msg.Data, &data); err != nil {
+			t.Fatal(err)
+		}
+		if len(data.Participants.List) != len(want) {
+			t.Fatalf("%s: unexpected participants %+v", client.role, data.Participants.List)
+		}
+		for _, p := range data.Participants.List {
+			if p.Name != want[p.PeerID] {
+				t.Fatalf("%s: peer %s named %q, want %q", client.role, p.PeerID, p.Name, want[p.PeerID])
+			}
+		}
+	}
+
+	// Relayed messages carry the sender's name, not whatever it claims.
+	h.routeMessage(host, wsEnvelopeV2{Type: "offer", FromName: "Mallory"})
+	if msg := receive(t, guest); msg == nil || msg.FromName != "Host" {
+		t.Fatalf("expected offer from Host, got %+v", msg)
+	}
+}
@@ -0,0 +1,25 @@
+package handlers
+
+import (
+	"golang.org/x/crypto/bcrypt"
+
+	"github.com/tariel-x/gocall/internal/models"
+)
+
+// hashCallPIN hashes a call PIN for storage on the call. Hashing is slow on
+// purpose, so it runs before the store is locked.
+func hashCallPIN(pin string) ([]byte, error) {
+	return bcrypt.GenerateFromPassword([]byte(pin), bcrypt.DefaultCost)
+}
+
+// verifyCallPIN checks pin against a protected call; unprotected calls accept
+// any PIN.
+func verifyCallPIN(call *models.CallV2, pin string) error {
+	if !call.RequiresPIN() {
+		return nil
+	}
+	if bcrypt.CompareHashAndPassword(call.PINHash, []byte(pin)) != nil {
+		return ErrCallUnauthorized
+	}
+	return nil
+}
@@ -0,0 +1,88 @@
+package handlers
+
+import (
+	"sync"
+	"time"
+)
+
+// reconnectGuard rejects peers that reconnect too often, e.g. a buggy client
+// stuck in a connect/disconnect loop flooding the other peer with events.
+type reconnectGuard struct {
+	mu      sync.Mutex
+	limit   int           // attempts allowed per window; 0 disables the guard
+	window  time.Duration // sliding window for counting attempts
+	backoff time.Duration // how long a peer is rejected once over the limit
+	peers   map[string]*reconnectHistory
+
+	lastSweep time.Time
+}
+
+type reconnectHistory struct {
+	attempts     []time.Time
+	blockedUntil time.Time
+}
+
+func newReconnectGuard(limit int, window, backoff time.Duration) *reconnectGuard {
+	return &reconnectGuard{
+		limit:   limit,
+		window:  window,
+		backoff: backoff,
+		peers:   make(map[string]*reconnectHistory),
+	}
+}
+
+// Allow records a connection attempt by peerID and returns how long the peer
+// must wait when it is over the limit.
+func (g *reconnectGuard) Allow(callID, peerID string, now time.Time) (retryAfter time.Duration, ok bool) {
+	if g.limit <= 0 {
+		return 0, true
+	}
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	g.sweepLocked(now)
+
+	key := callID + "/" + peerID
+	history, exists := g.peers[key]
+	if !exists {
+		history = &reconnectHistory{}
+		g.peers[key] = history
+	}
+
+	if now.Before(history.blockedUntil) {
+		return history.blockedUntil.Sub(now), false
+	}
+
+	history.attempts = pruneAttempts(history.attempts, now.Add(-g.window))
+	history.attempts = append(history.attempts, now)
+	if len(history.attempts) > g.limit {
+		history.attempts = nil
+		history.blockedUntil = now.Add(g.backoff)
+		return g.backoff, false
+	}
+	return 0, true
+}
+
+// sweepLocked drops peers with no recent attempts and no active block.
+func (g *reconnectGuard) sweepLocked(now time.Time) {
+	if now.Sub(g.lastSweep) < time.Minute {
+		return
+	}
+	g.lastSweep = now
+
+	for key, history := range g.peers {
+		history.attempts = pruneAttempts(history.attempts, now.Add(-g.window))
+		if len(history.attempts) == 0 && !now.Before(history.blockedUntil) {
+			delete(g.peers, key)
+		}
+	}
+}
+
+func pruneAttempts(attempts []time.Time, cutoff time.Time) []time.Time {
+	i := 0
+	for i < len(attempts) && !attempts[i].After(cutoff) {
+		i++
+	}
+	return attempts[i:]
+}
@@ -0,0 +1,70 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/tariel-x/gocall/internal/config"
+)
+
+func TestReconnectStormGetsBackoff(t *testing.T) {
+	h := newTestHandlers(t, &config.Config{
+		WSReconnectLimit:   3,
+		WSReconnectWindow:  10 * time.Second,
+		WSReconnectBackoff: 30 * time.Second,
+	})
+	now := time.Unix(1_700_000_000, 0)
+	h.nowFn = func() time.Time { return now }
+	router := newTestRouter(h)
+
+	call, _ := h.calls.CreateCall(now, CreateCallOptions{})
+	hostID, _, _ := h.calls.EnsureHostPeerID(call.ID, now)
+	path := "/api/ws?call_id=" + call.ID + "&peer_id=" + hostID
+
+	reconnect := func() *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+		return rec
+	}
+
+	for i := range 3 {
+		if rec := reconnect(); rec.Code == http.StatusTooManyRequests {
+			t.Fatalf("attempt %d rejected before the limit", i+1)
+		}
+		now = now.Add(time.Second)
+	}
+
+	rec := reconnect()
+	if rec.Code != http.StatusTooManyRequests {
+		t.Fatalf("expected 429 for reconnect storm, got %d", rec.Code)
+	}
+	if got := rec.Header().Get("Retry-After"); got != "30" {
+		t.Fatalf("Retry-After = %q, want 30", got)
+	}
+
+	now = now.Add(10 * time.Second)
+	if rec := reconnect(); rec.Code != http.StatusTooManyRequests || rec.Header().Get("Retry-After") != "20" {
+		t.Fatalf("expected backoff to continue with Retry-After 20, got %d %q", rec.Code, rec.Header().Get("Retry-After"))
+	}
+
+	now = now.Add(21 * time.Second)
+	if rec := reconnect(); rec.Code == http.StatusTooManyRequests {
+		t.Fatalf("expected reconnect to be allowed after backoff")
+	}
+}
+
+func TestReconnectGuardSlidingWindow(t *testing.T) {
+	g := newReconnectGuard(2, 10*time.Second, time.Minute)
+	now := time.Unix(1_700_000_000, 0)
+
+	for i := range 5 {
+		if _, ok := g.Allow("call", "peer", now.Add(time.Duration(i)*6*time.Second)); !ok {
+			t.Fatalf("attempt %d rejected although spaced out", i+1)
+		}
+	}
+	if _, ok := g.Allow("call", "other", now); !ok {
+		t.Fatalf("peers must be tracked separately")
+	}
+}
@@ -0,0 +1,63 @@
+package handlers
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+
+	"github.com/tariel-x/gocall/internal/models"
+)
+
+// reconnectTokenBytes is the entropy of a reconnect token.
+const reconnectTokenBytes = 32
+
+// newReconnectToken returns a fresh opaque reconnect token and the hash kept
+// on the participant. The token itself is only ever sent to its peer.
+func newReconnectToken() (token string, hash []byte) {
+	b := make([]byte, reconnectTokenBytes)
+	_, _ = rand.Read(b)
+	token = base64.RawURLEncoding.EncodeToString(b)
+	return token, hashReconnectToken(token)
+}
+
+// hashReconnectToken hashes a token for storage. Tokens are random, so a
+// plain SHA-256 is enough; unlike PINs they can't be brute-forced.
+func hashReconnectToken(token string) []byte {
+	sum := sha256.Sum256([]byte(token))
+	return sum[:]
+}
+
+// hasReconnectToken reports whether peerID was already given a token and must
+// reconnect with it rather than with its peer_id.
+func hasReconnectToken(call *models.CallV2, peerID string) bool {
+	return len(call.Participants[peerID].ReconnectTokenHash) > 0
+}
+
+// setReconnectToken stores the token hash on a peer that has none yet.
+func setReconnectToken(call *models.CallV2, peerID string, hash []byte) error {
+	p, exists := call.Participants[peerID]
+	if !exists {
+		return errInvalidPeerID
+	}
+	if len(p.ReconnectTokenHash) > 0 {
+		return errReconnectTokenRequired
+	}
+	p.ReconnectTokenHash = hash
+	call.Participants[peerID] = p
+	return nil
+}
+
+// peerByReconnectToken finds the participant the token was issued to.
+func peerByReconnectToken(call *models.CallV2, token string) (string, bool) {
+	if token == "" {
+		return "", false
+	}
+	hash := hashReconnectToken(token)
+	for peerID, p := range call.Participants {
+		if len(p.ReconnectTokenHash) > 0 && subtle.ConstantTimeCompare(hash, p.ReconnectTokenHash) == 1 {
+			return peerID, true
+		}
+	}
+	return "", false
+}
@@ -0,0 +1,123 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+func TestReconnectToken(t *testing.T) {
+	redisStores, _ := newTestRedisStores(t, 1)
+	stores := map[string]Store{"memory": NewCallStore(), "redis": redisStores[0], "sqlite": newTestSQLiteStore(t, "", CallStoreOptions{})}
+
+	for name, store := range stores {
+		t.Run(name, func(t *testing.T) {
+			now := time.Unix(1_700_800_000, 0)
+			call, _ := store.CreateCall(now, CreateCallOptions{})
+			guestID, _, _ := store.Join(call.ID, now)
+
+			token, err := store.IssueReconnectToken(call.ID, guestID, now)
+			if err != nil || token == "" || strings.Contains(token, guestID) {
+				t.Fatalf("issue = %q, %v", token, err)
+			}
+			if _, err := store.IssueReconnectToken(call.ID, guestID, now); !errors.Is(err, errReconnectTokenRequired) {
+				t.Fatalf("second issue: expected errReconnectTokenRequired, got %v", err)
+			}
+			stored, _ := store.GetByID(call.ID, now)
+			if strings.Contains(string(stored.Participants[guestID].ReconnectTokenHash), token) {
+				t.Fatal("token stored in the clear")
+			}
+
+			store.MarkPeerDisconnected(call.ID, guestID, now.Add(time.Second))
+
+			if _, _, _, err := store.ValidatePeer(call.ID, guestID, now.Add(2*time.Second)); !errors.Is(err, errReconnectTokenRequired) {
+				t.Fatalf("peer_id reconnect: expected errReconnectTokenRequired, got %v", err)
+			}
+			if _, _, _, _, err := store.ReconnectWithToken(call.ID, token+"x", now.Add(2*time.Second)); !errors.Is(err, errInvalidReconnectToken) {
+				t.Fatalf("wrong token: expected errInvalidReconnectToken, got %v", err)
+			}
+
+			peerID, role, call, reconnected, err := store.ReconnectWithToken(call.ID, token, now.Add(3*time.Second))
+			if err != nil {
+				t.Fatalf("reconnect failed: %v", err)
+			}
+			if peerID != guestID || role != PeerRoleV2Guest || !reconnected {
+				t.Fatalf("reconnect = %s, %s, %v", peerID, role, reconnected)
+			}
+			if p := call.Participants[guestID]; !p.IsPresent || p.ReconnectCount != 1 {
+				t.Fatalf("unexpected participant after reconnect %+v", p)
+			}
+		})
+	}
+}
+
+func TestWSReconnectToken(t *testing.T) {
+	h := newTestHandlers(t, nil)
+	srv := httptest.NewServer(newTestRouter(h))
+	t.Cleanup(srv.Close)
+
+	call, _ := h.calls.CreateCall(h.nowFn(), CreateCallOptions{})
+	base := "ws" + strings.TrimPrefix(srv.URL, "http") + "/api/ws?call_id=" + call.ID
+	dial := func(query string) (*websocket.Conn, int) {
+		conn, resp, err := websocket.DefaultDialer.Dial(base+query, nil)
+		if err != nil {
+			if resp == nil {
+				t.Fatalf("dial failed: %v", err)
+			}
+			return nil, resp.StatusCode
+		}
+		t.Cleanup(func() { _ = conn.Close() })
+		return conn, http.StatusSwitchingProtocols
+	}
+	readJoin := func(conn *websocket.Conn) wsJoinDataV2 {
+		t.Helper()
+		var msg wsEnvelopeV2
+		_ = conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+		if err := conn.ReadJSON(&msg); err != nil || msg.Type != "join" {
+			t.Fatalf("expected join, got %+v, %v", msg, err)
+		}
+		var data wsJoinDataV2
+		if err := json.Unmarshal(msg.Data, &data); err != nil {
+			t.Fatal(err)
+		}
+		return data
+	}
+
+	conn, _ := dial("")
+	first := readJoin(conn)
+	if first.ReconnectToken == "" {
+		t.Fatal("first connection got no reconnect token")
+	}
+	_ = conn.Close()
+	for deadline := time.Now().Add(5 * time.Second); ; time.Sleep(10 * time.Millisecond) {
+		if c, _ := h.calls.GetByID(call.ID, h.nowFn()); !c.Participants[first.PeerID].IsPresent {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("server did not notice the disconnect")
+		}
+	}
+
+	// Neither the link nor the peer_id is enough any more.
+	if _, code := dial(""); code != http.StatusForbidden {
+		t.Fatalf("host without token: got %d", code)
+	}
+	if _, code := dial("&peer_id=" + first.PeerID); code != http.StatusForbidden {
+		t.Fatalf("peer_id without token: got %d", code)
+	}
+	if _, code := dial("&reconnect_token=wrong"); code != http.StatusForbidden {
+		t.Fatalf("wrong token: got %d", code)
+	}
+
+	conn, _ = dial("&reconnect_token=" + first.ReconnectToken)
+	again := readJoin(conn)
+	if again.PeerID != first.PeerID || again.Role != PeerRoleV2Host || !again.IsReconnect || again.ReconnectToken != "" {
+		t.Fatalf("unexpected join after reconnect %+v", again)
+	}
+}
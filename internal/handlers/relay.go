@@ -0,0 +1,241 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+
+	"github.com/tariel-x/gocall/internal/models"
+)
+
+// RelayPolicy decides what readPump does with a client message of a given type.
+type RelayPolicy string
+
+const (
+	// RelayPolicyToOther delivers to the other participant, ignoring "to".
+	RelayPolicyToOther RelayPolicy = "relay-to-other"
+	// RelayPolicyToSpecific delivers to the "to" peer, or to the other
+	// participant when "to" is omitted.
+	RelayPolicyToSpecific RelayPolicy = "relay-to-specific"
+	// RelayPolicyIntercept hands the message to a server-side handler.
+	RelayPolicyIntercept RelayPolicy = "server-intercept"
+	// RelayPolicyDrop discards the message.
+	RelayPolicyDrop RelayPolicy = "drop"
+)
+
+// relayPolicyFallback is the key for types without an explicit policy.
+const relayPolicyFallback = "*"
+
+// defaultRelayPolicies relays only the signaling types clients exchange.
+// Unlisted types are dropped, and so are the types only the server sends
+// (wsServerMessageTypes), so a peer can't forge state or call-ended for
+// the other side.
+var defaultRelayPolicies = map[string]RelayPolicy{
+	relayPolicyFallback:   RelayPolicyDrop,
+	"offer":               RelayPolicyToSpecific,
+	"answer":              RelayPolicyToSpecific,
+	"ice-candidate":       RelayPolicyToSpecific,
+	"renegotiate-request": RelayPolicyToSpecific,
+	"leave":               RelayPolicyToSpecific,
+	"e2ee-key":            RelayPolicyToSpecific,
+	"ping":                RelayPolicyDrop,
+	"get-state":           RelayPolicyIntercept,
+	"ack":                 RelayPolicyIntercept,
+	"call-stats":          RelayPolicyIntercept,
+	"set-name":            RelayPolicyIntercept,
+	"chat":                RelayPolicyIntercept,
+	"media-state":         RelayPolicyIntercept,
+}
+
+// wsMaxDataBytes caps the data size of specific message types; larger
+// messages are dropped.
+//
+// e2ee-key carries opaque key-exchange material for end-to-end encrypted
+// media (insertable streams). The server is a blind relay for it: the data is
+// forwarded as-is, never parsed, stored or logged.
+var wsMaxDataBytes = map[string]int{
+	"e2ee-key":    4 << 10,
+	"call-stats":  1 << 10,
+	"set-name":    1 << 10,
+	"chat":        8 << 10, // room for escaping; the text itself is capped at 2KB
+	"media-state": 1 << 10,
+}
+
+// wsPendingAllowed lists what guests in the waiting room may send. Anything
+// else, including messages the server handles itself, waits until the host
+// admits them, so a pending guest can't change call state the host sees.
+var wsPendingAllowed = map[string]bool{
+	"ping":      true,
+	"get-state": true,
+}
+
+type wsInterceptor func(h *Handlers, client *wsClientV2, msg wsEnvelopeV2)
+
+// wsInterceptors handle message types with the server-intercept policy.
+var wsInterceptors = map[string]wsInterceptor{
+	// Periodic quality samples go to the stats exporter, never to the peer.
+	"call-stats": interceptCallStats,
+	// Display names are kept in call state rather than relayed.
+	"set-name": interceptSetName,
+	// Chat text is validated and kept for reconnecting peers.
+	"chat": interceptChat,
+	// Mute state is kept in call state so late joiners see it.
+	"media-state": interceptMediaState,
+	// Clients that detect a gap in state seq ask for a fresh snapshot.
+	"get-state": func(h *Handlers, client *wsClientV2, _ wsEnvelopeV2) {
+		if call, err := h.calls.GetByID(client.callID, h.nowFn()); err == nil {
+			h.wsHub.SendTo(client.callID, client.peerID, stateMessage(call))
+		}
+	},
+	// Delivery acknowledgments are relayed back to the original sender, on
+	// this instance or another, but only between clients that negotiated ack
+	// support.
+	"ack": func(h *Handlers, client *wsClientV2, msg wsEnvelopeV2) {
+		if msg.ID == "" || client.protocol < wsProtocolAcks {
+			return
+		}
+		to := msg.To
+		if to == "" {
+			call, err := h.calls.GetByID(client.callID, h.nowFn())
+			if err != nil {
+				return
+			}
+			if to, err = ackRecipient(call, client.peerID); err != nil {
+				h.reportDeliveryFailure(client, msg, err)
+				return
+			}
+		}
+		ack, err := json.Marshal(wsEnvelopeV2{Type: "ack", ID: msg.ID, From: client.peerID, FromRole: client.role})
+		if err != nil {
+			return
+		}
+		if err := h.wsHub.deliverToProtocol(client.callID, to, wsProtocolAcks, ack); err != nil {
+			h.reportDeliveryFailure(client, msg, err)
+		}
+	},
+}
+
+// errRecipientRequired is reported for an ack without "to" in a call where
+// more than one peer could have sent the acknowledged message.
+var errRecipientRequired = errors.New("recipient_required")
+
+// ackRecipient picks who an ack without "to" is for: the only other
+// participant of the call.
+func ackRecipient(call *models.CallV2, peerID string) (string, error) {
+	if len(call.Participants) > 2 {
+		return "", errRecipientRequired
+	}
+	for id := range call.Participants {
+		if id != peerID {
+			return id, nil
+		}
+	}
+	return "", errPeerOffline
+}
+
+type relayTable map[string]RelayPolicy
+
+// newRelayTable merges overrides (message type -> policy) into the defaults.
+func newRelayTable(overrides map[string]string) (relayTable, error) {
+	table := make(relayTable, len(defaultRelayPolicies)+len(overrides))
+	for msgType, policy := range defaultRelayPolicies {
+		table[msgType] = policy
+	}
+	for _, msgType := range wsServerMessageTypes {
+		table[msgType] = RelayPolicyDrop
+	}
+	for msgType, raw := range overrides {
+		policy := RelayPolicy(raw)
+		if slices.Contains(wsServerMessageTypes, msgType) && policy != RelayPolicyDrop {
+			return nil, fmt.Errorf("message type %q is sent by the server only", msgType)
+		}
+		switch policy {
+		case RelayPolicyToOther, RelayPolicyToSpecific, RelayPolicyDrop:
+		case RelayPolicyIntercept:
+			if _, ok := wsInterceptors[msgType]; !ok {
+				return nil, fmt.Errorf("no server handler for message type %q", msgType)
+			}
+		default:
+			return nil, fmt.Errorf("unknown relay policy %q for message type %q", raw, msgType)
+		}
+		table[msgType] = policy
+	}
+	return table, nil
+}
+
+func (t relayTable) policyFor(msgType string) RelayPolicy {
+	if policy, ok := t[msgType]; ok {
+		return policy
+	}
+	return t[relayPolicyFallback]
+}
+
+// relays reports whether messages of msgType are forwarded to peers.
+func (t relayTable) relays(msgType string) bool {
+	policy := t.policyFor(msgType)
+	return policy == RelayPolicyToOther || policy == RelayPolicyToSpecific
+}
+
+// routeMessage applies the relay policy for msg sent by client.
+func (h *Handlers) routeMessage(client *wsClientV2, msg wsEnvelopeV2) {
+	if limit, ok := wsMaxDataBytes[msg.Type]; ok && len(msg.Data) > limit {
+		return
+	}
+
+	// Guests in the waiting room can't reach the call yet.
+	if client.pending.Load() && !wsPendingAllowed[msg.Type] {
+		return
+	}
+
+	policy := h.relay.policyFor(msg.Type)
+	switch policy {
+	case RelayPolicyDrop:
+		return
+	case RelayPolicyIntercept:
+		if intercept, ok := wsInterceptors[msg.Type]; ok {
+			intercept(h, client, msg)
+		}
+		return
+	}
+
+	msg.From = client.peerID
+	msg.FromRole = client.role
+	msg.FromName = client.name
+	forward, err := json.Marshal(msg)
+	if err != nil {
+		return
+	}
+
+	if policy == RelayPolicyToSpecific && msg.To != "" {
+		err = h.wsHub.deliverTo(client.callID, msg.To, forward)
+	} else {
+		// If 'to' is omitted, route to the other participant.
+		err = h.wsHub.deliverToOther(client.callID, client.peerID, forward)
+	}
+	if err != nil {
+		h.reportDeliveryFailure(client, msg, err)
+		return
+	}
+	h.wsHub.metrics.relayed(msg.Type)
+}
+
+// reportDeliveryFailure tells the sender its message was dropped, so it can
+// retry or show that the other side isn't connected. Older clients don't
+// expect the event and only get the log line.
+func (h *Handlers) reportDeliveryFailure(client *wsClientV2, msg wsEnvelopeV2, reason error) {
+	h.logger.Debug("ws message not delivered", "call_id", client.callID, "peer_id", client.peerID, "type", msg.Type, "reason", reason)
+	if client.protocol < wsProtocolDeliveryFailed {
+		return
+	}
+
+	data, err := json.Marshal(wsDeliveryFailedDataV2{Type: msg.Type, ID: msg.ID, Reason: reason.Error()})
+	if err != nil {
+		return
+	}
+	payload, err := json.Marshal(wsEnvelopeV2{Type: "delivery-failed", ID: msg.ID, Data: data})
+	if err != nil {
+		return
+	}
+	h.wsHub.SendTo(client.callID, client.peerID, payload)
+}
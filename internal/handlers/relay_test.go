@@ -0,0 +1,267 @@
+package handlers
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/tariel-x/gocall/internal/config"
+)
+
+func setupRelayCall(t *testing.T, overrides map[string]string) (*Handlers, *wsClientV2, *wsClientV2) {
+	t.Helper()
+	h := newTestHandlers(t, &config.Config{WSRelayPolicies: overrides})
+	call, err := h.calls.CreateCall(h.nowFn(), CreateCallOptions{})
+	if err != nil {
+		t.Fatalf("create call failed: %v", err)
+	}
+	host := newTestClient(call.ID, "host", PeerRoleV2Host)
+	guest := newTestClient(call.ID, "guest", PeerRoleV2Guest)
+	h.wsHub.Add(host)
+	h.wsHub.Add(guest)
+	return h, host, guest
+}
+
+func TestRelayToSpecificUsesTarget(t *testing.T) {
+	h, host, guest := setupRelayCall(t, nil)
+
+	h.routeMessage(host, wsEnvelopeV2{Type: "offer", To: "guest"})
+	msg := receive(t, guest)
+	if msg == nil || msg.Type != "offer" || msg.From != "host" || msg.FromRole != PeerRoleV2Host {
+		t.Fatalf("expected offer from host, got %+v", msg)
+	}
+
+	// Without "to" the message goes to the other participant.
+	h.routeMessage(guest, wsEnvelopeV2{Type: "answer"})
+	if msg := receive(t, host); msg == nil || msg.Type != "answer" {
+		t.Fatalf("expected answer for host, got %+v", msg)
+	}
+}
+
+func TestRelayToOtherIgnoresTarget(t *testing.T) {
+	h, host, guest := setupRelayCall(t, map[string]string{"offer": string(RelayPolicyToOther)})
+
+	h.routeMessage(host, wsEnvelopeV2{Type: "offer", To: "host"})
+	if msg := receive(t, host); msg != nil {
+		t.Fatalf("sender should not receive its own offer, got %+v", msg)
+	}
+	if msg := receive(t, guest); msg == nil || msg.Type != "offer" {
+		t.Fatalf("expected offer for guest, got %+v", msg)
+	}
+}
+
+func TestRelayDropDiscards(t *testing.T) {
+	h, host, guest := setupRelayCall(t, map[string]string{"custom": string(RelayPolicyDrop)})
+
+	h.routeMessage(host, wsEnvelopeV2{Type: "custom"})
+	h.routeMessage(host, wsEnvelopeV2{Type: "ping"})
+	if msg := receive(t, guest); msg != nil {
+		t.Fatalf("expected dropped message, got %+v", msg)
+	}
+}
+
+func TestRelayInterceptAnswersSender(t *testing.T) {
+	h, host, guest := setupRelayCall(t, nil)
+
+	h.routeMessage(host, wsEnvelopeV2{Type: "get-state"})
+	if msg := receive(t, host); msg == nil || msg.Type != "state" {
+		t.Fatalf("expected state for sender, got %+v", msg)
+	}
+	if msg := receive(t, guest); msg != nil {
+		t.Fatalf("intercepted message should not be relayed, got %+v", msg)
+	}
+}
+
+func TestRelayTableRejectsInvalidPolicies(t *testing.T) {
+	if _, err := newRelayTable(map[string]string{"offer": "broadcast"}); err == nil {
+		t.Fatalf("expected error for unknown policy")
+	}
+	if _, err := newRelayTable(map[string]string{"offer": string(RelayPolicyIntercept)}); err == nil {
+		t.Fatalf("expected error for intercept without handler")
+	}
+}
+
+func TestOfferAckRoundTrip(t *testing.T) {
+	h, host, guest := setupRelayCall(t, nil)
+	host.protocol, guest.protocol = wsProtocolAcks, wsProtocolAcks
+
+	h.routeMessage(host, wsEnvelopeV2{Type: "offer", ID: "m1", To: "guest"})
+	offer := receive(t, guest)
+	if offer == nil || offer.ID != "m1" {
+		t.Fatalf("expected offer with id m1, got %+v", offer)
+	}
+
+	h.routeMessage(guest, wsEnvelopeV2{Type: "ack", ID: offer.ID, To: offer.From})
+	ack := receive(t, host)
+	if ack == nil || ack.Type != "ack" || ack.ID != "m1" || ack.From != "guest" {
+		t.Fatalf("expected ack for m1 from guest, got %+v", ack)
+	}
+}
+
+func TestAckNotRelayedToLegacyClient(t *testing.T) {
+	h, host, guest := setupRelayCall(t, nil)
+	host.protocol, guest.protocol = wsProtocolBase, wsProtocolAcks
+
+	h.routeMessage(guest, wsEnvelopeV2{Type: "ack", ID: "m1"})
+	if msg := receive(t, host); msg != nil {
+		t.Fatalf("legacy client should not receive acks, got %+v", msg)
+	}
+}
+
+func TestAckWithoutRecipient(t *testing.T) {
+	h := newTestHandlers(t, nil)
+	now := h.nowFn()
+	call, _ := h.calls.CreateCall(now, CreateCallOptions{MaxParticipants: 3})
+	hostID, _, _ := h.calls.EnsureHostPeerID(call.ID, now)
+	guestID, _, _ := h.calls.Join(call.ID, now)
+	host := newTestClient(call.ID, hostID, PeerRoleV2Host)
+	guest := newTestClient(call.ID, guestID, PeerRoleV2Guest)
+	for _, client := range []*wsClientV2{host, guest} {
+		client.protocol = wsProtocolLatest
+		h.wsHub.Add(client)
+	}
+
+	// With two participants the ack can only be for the other one.
+	h.routeMessage(guest, wsEnvelopeV2{Type: "ack", ID: "m1"})
+	if msg := receive(t, host); msg == nil || msg.Type != "ack" || msg.ID != "m1" || msg.From != guestID {
+		t.Fatalf("expected ack for m1 from guest, got %+v", msg)
+	}
+
+	// With a third one the sender has to say whose message it acknowledges.
+	thirdID, _, _ := h.calls.Join(call.ID, now)
+	third := newTestClient(call.ID, thirdID, PeerRoleV2Guest)
+	third.protocol = wsProtocolLatest
+	h.wsHub.Add(third)
+	for _, client := range []*wsClientV2{host, guest} {
+		for receive(t, client) != nil {
+			// Drop the state update for the join.
+		}
+	}
+
+	h.routeMessage(guest, wsEnvelopeV2{Type: "ack", ID: "m2"})
+	for _, client := range []*wsClientV2{host, third} {
+		if msg := receive(t, client); msg != nil {
+			t.Fatalf("%s: ack without recipient delivered, got %+v", client.peerID, msg)
+		}
+	}
+	msg := receive(t, guest)
+	if msg == nil || msg.Type != "delivery-failed" || msg.ID != "m2" {
+		t.Fatalf("expected delivery-failed for m2, got %+v", msg)
+	}
+	var data wsDeliveryFailedDataV2
+	if err := json.Unmarshal(msg.Data, &data); err != nil || data.Reason != errRecipientRequired.Error() {
+		t.Fatalf("unexpected delivery-failed data %+v, %v", data, err)
+	}
+
+	// An ack for a peer that isn't connected is reported too.
+	h.wsHub.Remove(call.ID, thirdID)
+	h.routeMessage(guest, wsEnvelopeV2{Type: "ack", ID: "m3", To: thirdID})
+	if msg := receive(t, guest); msg == nil || msg.Type != "delivery-failed" || msg.ID != "m3" {
+		t.Fatalf("expected delivery-failed for m3, got %+v", msg)
+	}
+}
+
+func TestRelayE2EEKeyIsForwardedVerbatim(t *testing.T) {
+	h, host, guest := setupRelayCall(t, nil)
+
+	// Unknown fields and their order survive: the server doesn't decode data.
+	data := json.RawMessage(`{"zeta":1,"alg":"x25519","blob":"c2VjcmV0","n":[1,2]}`)
+	h.routeMessage(host, wsEnvelopeV2{Type: "e2ee-key", Data: data})
+	msg := receive(t, guest)
+	if msg == nil || msg.Type != "e2ee-key" || msg.From != "host" {
+		t.Fatalf("expected e2ee-key from host, got %+v", msg)
+	}
+	if string(msg.Data) != string(data) {
+		t.Fatalf("key data changed in transit: %s", msg.Data)
+	}
+
+	oversized := json.RawMessage(`"` + strings.Repeat("a", wsMaxDataBytes["e2ee-key"]) + `"`)
+	h.routeMessage(host, wsEnvelopeV2{Type: "e2ee-key", Data: oversized})
+	if msg := receive(t, guest); msg != nil {
+		t.Fatalf("oversized e2ee-key should be dropped, got %d bytes", len(msg.Data))
+	}
+}
+
+func TestOfferToAbsentPeerReportsDeliveryFailed(t *testing.T) {
+	h, host, guest := setupRelayCall(t, nil)
+	host.protocol = wsProtocolDeliveryFailed
+	h.wsHub.Remove(guest.callID, guest.peerID)
+
+	h.routeMessage(host, wsEnvelopeV2{Type: "offer", ID: "m1", To: "guest"})
+	msg := receive(t, host)
+	if msg == nil || msg.Type != "delivery-failed" || msg.ID != "m1" {
+		t.Fatalf("expected delivery-failed for m1, got %+v", msg)
+	}
+	var data wsDeliveryFailedDataV2
+	if err := json.Unmarshal(msg.Data, &data); err != nil {
+		t.Fatalf("decode delivery-failed data: %v", err)
+	}
+	if data.Type != "offer" || data.ID != "m1" || data.Reason != "peer_offline" {
+		t.Fatalf("unexpected delivery-failed data: %+v", data)
+	}
+
+	// Without "to" the other participant is just as absent.
+	h.routeMessage(host, wsEnvelopeV2{Type: "ice-candidate"})
+	if msg := receive(t, host); msg == nil || msg.Type != "delivery-failed" {
+		t.Fatalf("expected delivery-failed for ice-candidate, got %+v", msg)
+	}
+}
+
+func TestDeliveryFailedNotSentToOlderClients(t *testing.T) {
+	h, host, guest := setupRelayCall(t, nil)
+	host.protocol = wsProtocolAcks
+	h.wsHub.Remove(guest.callID, guest.peerID)
+
+	h.routeMessage(host, wsEnvelopeV2{Type: "offer", ID: "m1", To: "guest"})
+	if msg := receive(t, host); msg != nil {
+		t.Fatalf("older client should not get delivery-failed, got %+v", msg)
+	}
+}
+
+func TestGroupCallRelaysToEachOtherPeer(t *testing.T) {
+	h, host, guest := setupRelayCall(t, map[string]string{"peer-hello": string(RelayPolicyToSpecific)})
+	third := newTestClient(host.callID, "third", PeerRoleV2Guest)
+	h.wsHub.Add(third)
+
+	// Without "to" every other peer gets its own copy.
+	h.routeMessage(host, wsEnvelopeV2{Type: "peer-hello"})
+	for _, client := range []*wsClientV2{guest, third} {
+		if msg := receive(t, client); msg == nil || msg.Type != "peer-hello" || msg.From != "host" {
+			t.Fatalf("%s: expected peer-hello from host, got %+v", client.peerID, msg)
+		}
+	}
+	if msg := receive(t, host); msg != nil {
+		t.Fatalf("sender should not receive its own message, got %+v", msg)
+	}
+
+	// Offers for a mesh pair go to that peer only.
+	h.routeMessage(third, wsEnvelopeV2{Type: "offer", To: "guest"})
+	if msg := receive(t, guest); msg == nil || msg.Type != "offer" || msg.From != "third" {
+		t.Fatalf("expected offer from third, got %+v", msg)
+	}
+	if msg := receive(t, host); msg != nil {
+		t.Fatalf("host should not see an offer meant for guest, got %+v", msg)
+	}
+}
+
+func TestRelayDropsServerMessageTypes(t *testing.T) {
+	h, host, guest := setupRelayCall(t, nil)
+
+	// A forged state with a huge seq would hide every real update after it.
+	forged, _ := json.Marshal(wsStateDataV2{CallID: host.callID, Seq: 1 << 40})
+	h.routeMessage(host, wsEnvelopeV2{Type: "state", To: "guest", Data: forged})
+	h.routeMessage(host, wsEnvelopeV2{Type: "call-ended", To: "guest"})
+	h.routeMessage(host, wsEnvelopeV2{Type: "made-up", To: "guest"})
+	if msg := receive(t, guest); msg != nil {
+		t.Fatalf("expected client-sent server message to be dropped, got %+v", msg)
+	}
+
+	h.routeMessage(host, wsEnvelopeV2{Type: "renegotiate-request", To: "guest"})
+	if msg := receive(t, guest); msg == nil || msg.Type != "renegotiate-request" {
+		t.Fatalf("expected renegotiate-request for guest, got %+v", msg)
+	}
+
+	if _, err := newRelayTable(map[string]string{"state": string(RelayPolicyToSpecific)}); err == nil {
+		t.Fatalf("expected error for relaying a server message type")
+	}
+}
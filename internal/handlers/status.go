@@ -0,0 +1,53 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/tariel-x/gocall/internal/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+type statusResponse struct {
+	ActiveCalls     int  `json:"active_calls"`
+	WaitingCalls    int  `json:"waiting_calls"`
+	MaxCalls        int  `json:"max_calls"` // 0 means unlimited
+	MaxParticipants int  `json:"max_participants"`
+	AcceptingCalls  bool `json:"accepting_calls"`
+	// Maintenance is set while new calls are refused for maintenance;
+	// clients show its message as a banner.
+	Maintenance *maintenanceResponse `json:"maintenance,omitempty"`
+}
+
+// GetStatus reports current load and whether new calls can be created.
+func (h *Handlers) GetStatus(c *gin.Context) {
+	now := h.nowFn()
+	if retryAfter, ok := h.statusLimiter.Allow(c.ClientIP(), now); !ok {
+		writeBackoff(c, http.StatusTooManyRequests, backoffRateLimited, "too many requests", retryAfter)
+		return
+	}
+
+	active, err := h.calls.ListByStatus(models.CallStatusV2Active, 0, now)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	waiting, err := h.calls.ListByStatus(models.CallStatusV2Waiting, 0, now)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	resp := statusResponse{
+		ActiveCalls:     len(active),
+		WaitingCalls:    len(waiting),
+		MaxCalls:        h.config.MaxConcurrentCalls,
+		MaxParticipants: h.maxParticipants(),
+		AcceptingCalls:  h.config.MaxConcurrentCalls == 0 || len(active)+len(waiting) < h.config.MaxConcurrentCalls,
+	}
+	if maintenance := h.maintenanceStatus(); maintenance.Enabled {
+		resp.AcceptingCalls = false
+		resp.Maintenance = &maintenance
+	}
+	c.JSON(http.StatusOK, resp)
+}
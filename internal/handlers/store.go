@@ -7,81 +7,297 @@ import (
 	"time"
 
 	"github.com/tariel-x/gocall/internal/models"
-
-	gonanoid "github.com/matoous/go-nanoid/v2"
 )
 
 var (
 	ErrCallNotFound = errors.New("call not found")
-	ErrCallFull     = errors.New("call already has two participants")
+	ErrCallFull     = errors.New("call is full")
 	ErrCallEnded    = errors.New("call already ended")
+	// ErrCallUnauthorized means the PIN of a protected call didn't match.
+	ErrCallUnauthorized = errors.New("wrong call PIN")
+	// ErrCapacityReached means the store holds its maximum number of live calls.
+	ErrCapacityReached = errors.New("too many concurrent calls")
+
+	// ErrPeerNotPending means the peer isn't waiting for admission.
+	ErrPeerNotPending = errors.New("peer is not waiting for admission")
+
+	errInvalidPeerID = errors.New("invalid peer_id")
+	// errReconnectTokenRequired means the peer was given a reconnect token
+	// and its peer_id alone no longer lets it in.
+	errReconnectTokenRequired = errors.New("reconnect_token is required")
+	errInvalidReconnectToken  = errors.New("invalid reconnect_token")
 )
 
+// Store holds call state. CallStore keeps it in memory, SQLiteCallStore keeps
+// it across restarts and RedisCallStore shares it between instances.
+type Store interface {
+	CreateCall(now time.Time, opts CreateCallOptions) (*models.CallV2, error)
+	GetByID(callID string, now time.Time) (*models.CallV2, error)
+	ListByStatus(status models.CallStatusV2, limit int, now time.Time) ([]*models.CallV2, error)
+	Join(callID string, now time.Time) (peerID string, call *models.CallV2, err error)
+	EnsureHostPeerID(callID string, now time.Time) (peerID string, call *models.CallV2, err error)
+	ValidatePeer(callID, peerID string, now time.Time) (role PeerRoleV2, call *models.CallV2, reconnected bool, err error)
+	IssueReconnectToken(callID, peerID string, now time.Time) (string, error)
+	ReconnectWithToken(callID, token string, now time.Time) (peerID string, role PeerRoleV2, call *models.CallV2, reconnected bool, err error)
+	ResumeCall(callID, peerID string, role PeerRoleV2, icePolicy models.ICEPolicy, now time.Time) (*models.CallV2, error)
+	EndCall(callID string, reason models.CallEndReason, now time.Time) (*models.CallV2, error)
+	RecentlyEnded(callID string, now time.Time) bool
+	MarkPeerDisconnected(callID, peerID string, now time.Time)
+	SetParticipantName(callID, peerID, name string, now time.Time) (*models.CallV2, error)
+	SetMediaState(callID, peerID string, state models.MediaState, now time.Time) (*models.CallV2, error)
+	AppendChat(callID string, msg models.ChatMessageV2, now time.Time) error
+	AdmitPeer(callID, peerID string, now time.Time) (*models.CallV2, error)
+	RejectPeer(callID, peerID string, now time.Time) (*models.CallV2, error)
+	Stats() CallStoreStats
+	SetEventSink(sink CallEventSink)
+	SetChangeSink(sink CallChangeSink)
+}
+
 type CallStore struct {
 	mu              sync.Mutex
 	calls           map[string]*models.CallV2
 	statusIndex     map[models.CallStatusV2]map[string]struct{}
+	tombstones      map[string]time.Time // callID -> ended at
 	callTTL         time.Duration
 	reconnectTTL    time.Duration
+	tombstoneTTL    time.Duration
 	cleanupInterval time.Duration
+	maxCalls        int
+
+	events  CallEventSink
+	changes CallChangeSink
+	changed []string // calls touched under the current lock; see unlock
+
+	// Cumulative counters for the lifetime of the store.
+	totalCreated   int
+	totalEnded     int
+	peakConcurrent int
+}
+
+// CallEventSink receives call lifecycle events. Record is called with the
+// store lock held and must not block.
+type CallEventSink interface {
+	Record(event models.CallEvent)
+}
+
+// CallChangeSink is told when a call's visible state changed, i.e. its Seq
+// was bumped. CallChanged is called once the change is stored and without
+// store locks held, so it may read the call back.
+type CallChangeSink interface {
+	CallChanged(callID string)
+}
+
+// CallStoreStats holds cumulative call counters since the store was created.
+type CallStoreStats struct {
+	Created        int
+	Ended          int
+	PeakConcurrent int
+}
+
+// CallStoreOptions tunes a call store; zero fields keep the defaults.
+type CallStoreOptions struct {
+	// TTL is how long a call lives after its last state change.
+	TTL time.Duration
+	// CleanupInterval is how often expired calls and old tombstones are
+	// swept in the background. Only the in-memory store sweeps; Redis
+	// expires its keys itself.
+	CleanupInterval time.Duration
+	// TombstoneTTL is how long an ended call answers 410 Gone before it is
+	// forgotten and becomes 404 Not Found.
+	TombstoneTTL time.Duration
+	// MaxCalls caps live (not ended) calls; 0 = unlimited.
+	MaxCalls int
 }
 
+const (
+	defaultCallTTL         = 30 * time.Minute
+	defaultCleanupInterval = 3 * time.Hour
+	defaultTombstoneTTL    = 5 * time.Minute
+)
+
 func NewCallStore() *CallStore {
+	return NewCallStoreWithOptions(CallStoreOptions{})
+}
+
+// withDefaults fills zero fields with the default settings.
+func (opts CallStoreOptions) withDefaults() CallStoreOptions {
+	if opts.TTL <= 0 {
+		opts.TTL = defaultCallTTL
+	}
+	if opts.CleanupInterval <= 0 {
+		opts.CleanupInterval = defaultCleanupInterval
+	}
+	if opts.TombstoneTTL <= 0 {
+		opts.TombstoneTTL = defaultTombstoneTTL
+	}
+	return opts
+}
+
+func NewCallStoreWithOptions(opts CallStoreOptions) *CallStore {
+	opts = opts.withDefaults()
+
 	s := &CallStore{
 		calls: make(map[string]*models.CallV2),
 		statusIndex: map[models.CallStatusV2]map[string]struct{}{
 			models.CallStatusV2Waiting: {},
 			models.CallStatusV2Active:  {},
 		},
-		callTTL:         30 * time.Minute,
+		tombstones:      make(map[string]time.Time),
+		callTTL:         opts.TTL,
 		reconnectTTL:    30 * time.Minute,
-		cleanupInterval: 3 * time.Hour,
+		tombstoneTTL:    opts.TombstoneTTL,
+		cleanupInterval: opts.CleanupInterval,
+		maxCalls:        opts.MaxCalls,
 	}
 	go s.cleanupLoop()
 	return s
 }
 
-func (s *CallStore) CreateCall(now time.Time) (*models.CallV2, error) {
+// SetEventSink enables call lifecycle events.
+func (s *CallStore) SetEventSink(sink CallEventSink) {
 	s.mu.Lock()
 	defer s.mu.Unlock()
+	s.events = sink
+}
 
-	id, err := gonanoid.New(16)
-	if err != nil {
-		return nil, err
+// SetChangeSink enables state change notifications.
+func (s *CallStore) SetChangeSink(sink CallChangeSink) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.changes = sink
+}
+
+// unlock releases the store lock and then reports the calls touched while it
+// was held.
+func (s *CallStore) unlock() {
+	changed, sink := s.changed, s.changes
+	s.changed = nil
+	s.mu.Unlock()
+	if sink == nil {
+		return
+	}
+	for _, callID := range changed {
+		sink.CallChanged(callID)
+	}
+}
+
+func (s *CallStore) emitLocked(eventType models.CallEventType, call *models.CallV2, now time.Time) {
+	if s.events == nil {
+		return
+	}
+	event := models.CallEvent{Type: eventType, CallID: call.ID, At: now}
+	if eventType == models.CallEventEnded {
+		event.Duration = now.Sub(call.CreatedAt)
+	}
+	s.events.Record(event)
+}
+
+// CreateCallOptions holds per-call settings chosen by the creator.
+type CreateCallOptions struct {
+	ICEPolicy       models.ICEPolicy
+	MaxParticipants int    // 0 = models.DefaultMaxParticipants
+	CreatedBy       string // authenticated user ID, empty for anonymous calls
+	PINHash         []byte // from hashCallPIN, empty = anyone with the link may join
+	WaitingRoom     bool   // guests stay pending until the host admits them
+}
+
+// newCall builds a waiting call whose only participant is the host.
+func newCall(id, hostPeerID string, now time.Time, ttl time.Duration, opts CreateCallOptions) *models.CallV2 {
+	if opts.ICEPolicy == "" {
+		opts.ICEPolicy = models.ICEPolicyAll
+	}
+	if opts.MaxParticipants <= 0 {
+		opts.MaxParticipants = models.DefaultMaxParticipants
 	}
 
 	call := &models.CallV2{
-		ID:        id,
-		Status:    models.CallStatusV2Waiting,
-		CreatedAt: now,
-		UpdatedAt: now,
-		ExpiresAt: now.Add(s.callTTL),
-		Host: models.CallParticipantV2{
-			JoinedAt:       now,
-			IsPresent:      true,
-			ReconnectCount: 0,
-		},
+		ID:              id,
+		Status:          models.CallStatusV2Waiting,
+		Seq:             1,
+		CreatedAt:       now,
+		UpdatedAt:       now,
+		ExpiresAt:       now.Add(ttl),
+		ICEPolicy:       opts.ICEPolicy,
+		MaxParticipants: opts.MaxParticipants,
+		CreatedBy:       opts.CreatedBy,
+		PINHash:         opts.PINHash,
+		WaitingRoom:     opts.WaitingRoom,
+		HostPeerID:      hostPeerID,
+	}
+	addParticipant(call, hostPeerID, now)
+	return call
+}
+
+func (s *CallStore) CreateCall(now time.Time, opts CreateCallOptions) (*models.CallV2, error) {
+	s.mu.Lock()
+	defer s.unlock()
+
+	if s.atCapacityLocked(now) {
+		return nil, ErrCapacityReached
 	}
 
+	id, err := newID(func(id string) bool {
+		_, live := s.calls[id]
+		_, ended := s.tombstones[id]
+		return live || ended
+	})
+	if err != nil {
+		return nil, err
+	}
+	hostPeerID, err := newID(nil)
+	if err != nil {
+		return nil, err
+	}
+
+	call := newCall(id, hostPeerID, now, s.callTTL, opts)
+
 	s.calls[id] = call
 	s.syncStatusIndexLocked(id, models.CallStatusV2Waiting)
-	return call, nil
+	s.totalCreated++
+	s.emitLocked(models.CallEventCreated, call, now)
+	if len(s.calls) > s.peakConcurrent {
+		s.peakConcurrent = len(s.calls)
+	}
+	return call.Clone(), nil
+}
+
+// atCapacityLocked reports whether MaxCalls live calls exist. Ended calls
+// leave the map right away, so its size is the live count; expired calls
+// that haven't been swept yet are only cleared once the limit is hit.
+func (s *CallStore) atCapacityLocked(now time.Time) bool {
+	if s.maxCalls <= 0 || len(s.calls) < s.maxCalls {
+		return false
+	}
+	s.cleanupExpiredLocked(now)
+	return len(s.calls) >= s.maxCalls
+}
+
+// Stats returns cumulative call counters.
+func (s *CallStore) Stats() CallStoreStats {
+	s.mu.Lock()
+	defer s.unlock()
+
+	return CallStoreStats{
+		Created:        s.totalCreated,
+		Ended:          s.totalEnded,
+		PeakConcurrent: s.peakConcurrent,
+	}
 }
 
 func (s *CallStore) GetByID(callID string, now time.Time) (*models.CallV2, error) {
 	s.mu.Lock()
-	defer s.mu.Unlock()
+	defer s.unlock()
 
 	call, err := s.loadActiveCallLocked(callID, now)
 	if err != nil {
 		return nil, err
 	}
-	return call, nil
+	return call.Clone(), nil
 }
 
 func (s *CallStore) ListByStatus(status models.CallStatusV2, limit int, now time.Time) ([]*models.CallV2, error) {
 	s.mu.Lock()
-	defer s.mu.Unlock()
+	defer s.unlock()
 
 	s.cleanupExpiredLocked(now)
 
@@ -93,7 +309,7 @@ func (s *CallStore) ListByStatus(status models.CallStatusV2, limit int, now time
 	calls := make([]*models.CallV2, 0, len(bucket))
 	for id := range bucket {
 		if call, exists := s.calls[id]; exists {
-			calls = append(calls, call)
+			calls = append(calls, call.Clone())
 		}
 	}
 
@@ -113,63 +329,53 @@ func (s *CallStore) ListByStatus(status models.CallStatusV2, limit int, now time
 
 func (s *CallStore) Join(callID string, now time.Time) (peerID string, call *models.CallV2, err error) {
 	s.mu.Lock()
-	defer s.mu.Unlock()
+	defer s.unlock()
 
 	call, err = s.loadActiveCallLocked(callID, now)
 	if err != nil {
 		return "", nil, err
 	}
 
-	if call.ParticipantsCount() >= 2 {
-		return "", call, ErrCallFull
-	}
-
-	id, err := gonanoid.New(16)
+	id, err := joinGuest(call, now)
 	if err != nil {
+		if errors.Is(err, ErrCallFull) {
+			return "", call.Clone(), err
+		}
 		return "", nil, err
 	}
 
-	call.Guest = models.CallParticipantV2{
-		PeerID:         id,
-		JoinedAt:       now,
-		IsPresent:      true,
-		ReconnectCount: 0,
-	}
-	call.Status = models.CallStatusV2Active
-	call.UpdatedAt = now
+	s.touchLocked(call, now)
 	call.ExpiresAt = now.Add(s.callTTL)
 	s.syncStatusIndexLocked(call.ID, call.Status)
+	s.emitLocked(models.CallEventJoined, call, now)
 
-	return id, call, nil
+	return id, call.Clone(), nil
 }
 
-// EnsureHostPeerID assigns a peer_id for the host if it wasn't assigned yet.
+// EnsureHostPeerID returns the host's peer_id, assigning one if the host
+// slot is still empty (e.g. a resumed call only a guest has claimed).
 // This keeps CreateCall response minimal (no peer_id) while allowing WS signaling.
 func (s *CallStore) EnsureHostPeerID(callID string, now time.Time) (peerID string, call *models.CallV2, err error) {
 	s.mu.Lock()
-	defer s.mu.Unlock()
+	defer s.unlock()
 
 	call, err = s.loadActiveCallLocked(callID, now)
 	if err != nil {
 		return "", nil, err
 	}
 
-	if call.Host.PeerID != "" {
-		return call.Host.PeerID, call, nil
+	if call.HostPeerID != "" {
+		return call.HostPeerID, call.Clone(), nil
 	}
 
-	id, err := gonanoid.New(16)
+	id, err := assignHost(call, now)
 	if err != nil {
 		return "", nil, err
 	}
-
-	call.Host.PeerID = id
-	call.Host.JoinedAt = now
-	call.Host.IsPresent = true
-	call.UpdatedAt = now
+	s.touchLocked(call, now)
 	call.ExpiresAt = now.Add(s.callTTL)
 
-	return id, call, nil
+	return id, call.Clone(), nil
 }
 
 type PeerRoleV2 string
@@ -181,85 +387,417 @@ const (
 
 func (s *CallStore) ValidatePeer(callID, peerID string, now time.Time) (role PeerRoleV2, call *models.CallV2, reconnected bool, err error) {
 	s.mu.Lock()
-	defer s.mu.Unlock()
+	defer s.unlock()
 
 	call, err = s.loadActiveCallLocked(callID, now)
 	if err != nil {
 		return "", nil, false, err
 	}
+	if hasReconnectToken(call, peerID) {
+		return "", nil, false, errReconnectTokenRequired
+	}
+
+	role, reconnected, ok := markPeerPresent(call, peerID)
+	if !ok {
+		return "", call.Clone(), false, errInvalidPeerID
+	}
+	s.touchLocked(call, now)
+	call.ExpiresAt = now.Add(s.callTTL)
+	return role, call.Clone(), reconnected, nil
+}
+
+// IssueReconnectToken gives peerID its reconnect token. A peer gets one token
+// only; later calls fail with errReconnectTokenRequired.
+func (s *CallStore) IssueReconnectToken(callID, peerID string, now time.Time) (string, error) {
+	token, hash := newReconnectToken()
+
+	s.mu.Lock()
+	defer s.unlock()
+
+	call, err := s.loadActiveCallLocked(callID, now)
+	if err != nil {
+		return "", err
+	}
+	if err := setReconnectToken(call, peerID, hash); err != nil {
+		return "", err
+	}
+	return token, nil
+}
+
+// ReconnectWithToken is ValidatePeer for a peer identified by its reconnect
+// token.
+func (s *CallStore) ReconnectWithToken(callID, token string, now time.Time) (peerID string, role PeerRoleV2, call *models.CallV2, reconnected bool, err error) {
+	s.mu.Lock()
+	defer s.unlock()
+
+	call, err = s.loadActiveCallLocked(callID, now)
+	if err != nil {
+		return "", "", nil, false, err
+	}
+	peerID, ok := peerByReconnectToken(call, token)
+	if !ok {
+		return "", "", nil, false, errInvalidReconnectToken
+	}
 
+	role, reconnected, _ = markPeerPresent(call, peerID)
+	s.touchLocked(call, now)
+	call.ExpiresAt = now.Add(s.callTTL)
+	return peerID, role, call.Clone(), reconnected, nil
+}
+
+// ResumeCall rebuilds a call this store doesn't know (e.g. after a restart)
+// from the reconnecting peer's own call_id, peer_id and role. The other peer
+// can later claim its slot the same way. The ICE policy the client remembers
+// can only make the call stricter; other settings (PIN, waiting room, owner)
+// are not known and the call has none of them.
+func (s *CallStore) ResumeCall(callID, peerID string, role PeerRoleV2, icePolicy models.ICEPolicy, now time.Time) (*models.CallV2, error) {
+	s.mu.Lock()
+	defer s.unlock()
+
+	call, err := s.loadActiveCallLocked(callID, now)
 	switch {
-	case peerID != "" && peerID == call.Host.PeerID:
-		wasPresent := call.Host.IsPresent
-		call.Host.IsPresent = true
-		if !wasPresent {
-			call.Host.ReconnectCount++
+	case errors.Is(err, ErrCallNotFound):
+		call = newResumedCall(callID, now)
+		if !claimResumedSlot(call, peerID, role, icePolicy, now) {
+			return nil, errInvalidPeerID
 		}
-		call.Host.DisconnectedAt = time.Time{}
-		call.UpdatedAt = now
-		call.ExpiresAt = now.Add(s.callTTL)
-		return PeerRoleV2Host, call, !wasPresent, nil
-	case peerID != "" && peerID == call.Guest.PeerID:
-		wasPresent := call.Guest.IsPresent
-		call.Guest.IsPresent = true
-		if !wasPresent {
-			call.Guest.ReconnectCount++
+		s.calls[callID] = call
+	case err != nil:
+		return nil, err
+	case !call.Resumed || !claimResumedSlot(call, peerID, role, icePolicy, now):
+		return nil, errInvalidPeerID
+	}
+
+	s.touchLocked(call, now)
+	call.ExpiresAt = now.Add(s.callTTL)
+	s.syncStatusIndexLocked(call.ID, call.Status)
+	return call.Clone(), nil
+}
+
+func newResumedCall(callID string, now time.Time) *models.CallV2 {
+	return &models.CallV2{
+		ID:        callID,
+		Status:    models.CallStatusV2Waiting,
+		CreatedAt: now,
+		ICEPolicy: models.ICEPolicyAll,
+		Resumed:   true,
+	}
+}
+
+// claimResumedSlot adds peerID to a resumed call as the host (if that slot
+// is empty) or as another guest. The call turns active once the host and a
+// guest are in. A relay-only icePolicy claimed by any peer sticks; nobody can
+// relax it.
+func claimResumedSlot(call *models.CallV2, peerID string, role PeerRoleV2, icePolicy models.ICEPolicy, now time.Time) bool {
+	if _, exists := call.Participants[peerID]; peerID == "" || exists {
+		return false
+	}
+	switch role {
+	case PeerRoleV2Host:
+		if call.HostPeerID != "" {
+			return false
+		}
+		call.HostPeerID = peerID
+	case PeerRoleV2Guest:
+		if len(call.Participants) >= call.Capacity() {
+			return false
 		}
-		call.Guest.DisconnectedAt = time.Time{}
-		call.UpdatedAt = now
-		call.ExpiresAt = now.Add(s.callTTL)
-		return PeerRoleV2Guest, call, !wasPresent, nil
 	default:
-		return "", call, false, errors.New("invalid peer_id")
+		return false
+	}
+
+	addParticipant(call, peerID, now)
+	if icePolicy == models.ICEPolicyRelay {
+		call.ICEPolicy = models.ICEPolicyRelay
+	}
+	if call.HostPeerID != "" && len(call.Participants) > 1 {
+		call.Status = models.CallStatusV2Active
+	}
+	return true
+}
+
+// addParticipant records peerID as a present participant.
+func addParticipant(call *models.CallV2, peerID string, now time.Time) {
+	if call.Participants == nil {
+		call.Participants = make(map[string]models.CallParticipantV2)
+	}
+	call.Participants[peerID] = models.CallParticipantV2{PeerID: peerID, JoinedAt: now, IsPresent: true}
+}
+
+// joinGuest adds a new guest with a fresh peer_id and activates the call; with
+// a waiting room the guest is pending instead and the call stays as is. A
+// full call first frees the slot of the guest who has been away longest; it
+// reports ErrCallFull when everyone is present. Pending guests hold a slot.
+func joinGuest(call *models.CallV2, now time.Time) (string, error) {
+	if call.ParticipantsCount() >= call.Capacity() {
+		return "", ErrCallFull
+	}
+	if len(call.Participants) >= call.Capacity() {
+		var stale *models.CallParticipantV2
+		for _, p := range call.Participants {
+			if p.IsPresent || p.PeerID == call.HostPeerID {
+				continue
+			}
+			if stale == nil || p.DisconnectedAt.Before(stale.DisconnectedAt) {
+				stale = &p
+			}
+		}
+		if stale == nil {
+			return "", ErrCallFull
+		}
+		delete(call.Participants, stale.PeerID)
+	}
+
+	id, err := newID(func(id string) bool {
+		_, taken := call.Participants[id]
+		return taken
+	})
+	if err != nil {
+		return "", err
+	}
+	addParticipant(call, id, now)
+	if call.WaitingRoom {
+		p := call.Participants[id]
+		p.Pending = true
+		call.Participants[id] = p
+		return id, nil
+	}
+	call.Status = models.CallStatusV2Active
+	return id, nil
+}
+
+// admitPeer lets a pending guest into the call and activates it.
+func admitPeer(call *models.CallV2, peerID string) error {
+	p, exists := call.Participants[peerID]
+	if !exists || !p.Pending {
+		return ErrPeerNotPending
+	}
+	p.Pending = false
+	call.Participants[peerID] = p
+	call.Status = models.CallStatusV2Active
+	return nil
+}
+
+// rejectPeer drops a pending guest, freeing its slot.
+func rejectPeer(call *models.CallV2, peerID string) error {
+	if p, exists := call.Participants[peerID]; !exists || !p.Pending {
+		return ErrPeerNotPending
+	}
+	delete(call.Participants, peerID)
+	return nil
+}
+
+// assignHost gives an empty host slot a fresh peer_id.
+func assignHost(call *models.CallV2, now time.Time) (string, error) {
+	id, err := newID(func(id string) bool {
+		_, taken := call.Participants[id]
+		return taken
+	})
+	if err != nil {
+		return "", err
+	}
+	call.HostPeerID = id
+	addParticipant(call, id, now)
+	return id, nil
+}
+
+// peerRole tells the host from the guests.
+func peerRole(call *models.CallV2, peerID string) PeerRoleV2 {
+	if peerID == call.HostPeerID {
+		return PeerRoleV2Host
+	}
+	return PeerRoleV2Guest
+}
+
+// markPeerPresent flags the peer as connected, counting a reconnect if it had
+// dropped. It reports false for an unknown peer.
+func markPeerPresent(call *models.CallV2, peerID string) (role PeerRoleV2, reconnected bool, ok bool) {
+	p, exists := call.Participants[peerID]
+	if peerID == "" || !exists {
+		return "", false, false
+	}
+
+	wasPresent := p.IsPresent
+	p.IsPresent = true
+	if !wasPresent {
+		p.ReconnectCount++
+	}
+	p.DisconnectedAt = time.Time{}
+	call.Participants[peerID] = p
+	return peerRole(call, peerID), !wasPresent, true
+}
+
+// markPeerAbsent flags the peer as disconnected. It reports false for an
+// unknown peer.
+func markPeerAbsent(call *models.CallV2, peerID string, now time.Time) bool {
+	p, exists := call.Participants[peerID]
+	if !exists {
+		return false
 	}
+	p.IsPresent = false
+	p.DisconnectedAt = now
+	call.Participants[peerID] = p
+	return true
 }
 
-// EndCall marks the call as ended. This is a minimal MVP implementation and does not
+// setParticipantName changes the peer's display name. It reports false for
+// an unknown peer.
+func setParticipantName(call *models.CallV2, peerID, name string) bool {
+	p, exists := call.Participants[peerID]
+	if !exists {
+		return false
+	}
+	p.Name = name
+	call.Participants[peerID] = p
+	return true
+}
+
+// setMediaState records the peer's media state. It reports false for an
+// unknown peer.
+func setMediaState(call *models.CallV2, peerID string, state models.MediaState) bool {
+	p, exists := call.Participants[peerID]
+	if !exists {
+		return false
+	}
+	p.Media = &state
+	call.Participants[peerID] = p
+	return true
+}
+
+// markAllAbsent flags every participant as gone, e.g. when the call ends.
+func markAllAbsent(call *models.CallV2) {
+	for id, p := range call.Participants {
+		p.IsPresent = false
+		call.Participants[id] = p
+	}
+}
+
+// EndCall marks the call as ended for reason. This is a minimal MVP implementation and does not
 // attempt to authenticate who is allowed to end the call.
-func (s *CallStore) EndCall(callID string, now time.Time) (*models.CallV2, error) {
+func (s *CallStore) EndCall(callID string, reason models.CallEndReason, now time.Time) (*models.CallV2, error) {
 	s.mu.Lock()
-	defer s.mu.Unlock()
+	defer s.unlock()
 
 	call, exists := s.calls[callID]
 	if !exists {
 		return nil, ErrCallNotFound
 	}
 
-	s.markEndedLocked(call, now)
-	snapshot := *call
+	s.markEndedLocked(call, reason, now)
 	s.removeCallLocked(callID)
 
-	return &snapshot, nil
+	return call.Clone(), nil
+}
+
+// RecentlyEnded reports whether the call ended within the tombstone window.
+func (s *CallStore) RecentlyEnded(callID string, now time.Time) bool {
+	s.mu.Lock()
+	defer s.unlock()
+
+	return s.recentlyEndedLocked(callID, now)
+}
+
+func (s *CallStore) recentlyEndedLocked(callID string, now time.Time) bool {
+	endedAt, ok := s.tombstones[callID]
+	return ok && now.Sub(endedAt) <= s.tombstoneTTL
 }
 
 // MarkPeerDisconnected flags peer presence as lost but keeps the call active to allow reconnection.
 func (s *CallStore) MarkPeerDisconnected(callID, peerID string, now time.Time) {
 	s.mu.Lock()
-	defer s.mu.Unlock()
+	defer s.unlock()
 
 	call, ok := s.calls[callID]
 	if !ok {
 		return
 	}
 
-	switch {
-	case peerID == call.Host.PeerID:
-		call.Host.IsPresent = false
-		call.Host.DisconnectedAt = now
-	case peerID == call.Guest.PeerID:
-		call.Guest.IsPresent = false
-		call.Guest.DisconnectedAt = now
-	default:
+	if !markPeerAbsent(call, peerID, now) {
 		return
 	}
 
-	call.UpdatedAt = now
+	s.touchLocked(call, now)
 	// Не обновляем ExpiresAt, чтобы использовать reconnectTTL логически
 }
 
+// SetParticipantName sets the display name shown for peerID in call state.
+func (s *CallStore) SetParticipantName(callID, peerID, name string, now time.Time) (*models.CallV2, error) {
+	s.mu.Lock()
+	defer s.unlock()
+
+	call, err := s.loadActiveCallLocked(callID, now)
+	if err != nil {
+		return nil, err
+	}
+	if !setParticipantName(call, peerID, name) {
+		return nil, errInvalidPeerID
+	}
+	s.touchLocked(call, now)
+	return call.Clone(), nil
+}
+
+// SetMediaState records whether peerID sends audio and video.
+func (s *CallStore) SetMediaState(callID, peerID string, state models.MediaState, now time.Time) (*models.CallV2, error) {
+	s.mu.Lock()
+	defer s.unlock()
+
+	call, err := s.loadActiveCallLocked(callID, now)
+	if err != nil {
+		return nil, err
+	}
+	if !setMediaState(call, peerID, state) {
+		return nil, errInvalidPeerID
+	}
+	s.touchLocked(call, now)
+	return call.Clone(), nil
+}
+
+// AppendChat adds msg to the call's chat backlog. Chat isn't call state, so
+// it doesn't bump the call's seq.
+func (s *CallStore) AppendChat(callID string, msg models.ChatMessageV2, now time.Time) error {
+	s.mu.Lock()
+	defer s.unlock()
+
+	call, err := s.loadActiveCallLocked(callID, now)
+	if err != nil {
+		return err
+	}
+	appendChat(call, msg)
+	return nil
+}
+
+// AdmitPeer moves a pending guest out of the waiting room.
+func (s *CallStore) AdmitPeer(callID, peerID string, now time.Time) (*models.CallV2, error) {
+	return s.updateWaitingRoom(callID, peerID, now, admitPeer)
+}
+
+// RejectPeer turns a pending guest away.
+func (s *CallStore) RejectPeer(callID, peerID string, now time.Time) (*models.CallV2, error) {
+	return s.updateWaitingRoom(callID, peerID, now, rejectPeer)
+}
+
+func (s *CallStore) updateWaitingRoom(callID, peerID string, now time.Time, fn func(call *models.CallV2, peerID string) error) (*models.CallV2, error) {
+	s.mu.Lock()
+	defer s.unlock()
+
+	call, err := s.loadActiveCallLocked(callID, now)
+	if err != nil {
+		return nil, err
+	}
+	if err := fn(call, peerID); err != nil {
+		return nil, err
+	}
+	s.touchLocked(call, now)
+	s.syncStatusIndexLocked(call.ID, call.Status)
+	return call.Clone(), nil
+}
+
 func (s *CallStore) loadActiveCallLocked(callID string, now time.Time) (*models.CallV2, error) {
 	call, ok := s.calls[callID]
 	if !ok {
+		if s.recentlyEndedLocked(callID, now) {
+			return nil, ErrCallEnded
+		}
 		return nil, ErrCallNotFound
 	}
 
@@ -269,7 +807,7 @@ func (s *CallStore) loadActiveCallLocked(callID string, now time.Time) (*models.
 	}
 
 	if s.isExpired(call, now) {
-		s.markEndedLocked(call, now)
+		s.markEndedLocked(call, models.CallEndReasonExpired, now)
 		s.removeCallLocked(callID)
 		return nil, ErrCallEnded
 	}
@@ -285,24 +823,35 @@ func (s *CallStore) cleanupLoop() {
 	for range ticker.C {
 		s.mu.Lock()
 		s.cleanupExpiredLocked(time.Now())
-		s.mu.Unlock()
+		s.unlock()
 	}
 }
 
 func (s *CallStore) cleanupExpiredLocked(now time.Time) {
+	for id, endedAt := range s.tombstones {
+		if now.Sub(endedAt) > s.tombstoneTTL {
+			delete(s.tombstones, id)
+		}
+	}
 	for id, call := range s.calls {
 		if call.Status == models.CallStatusV2Ended {
 			s.removeCallLocked(id)
 			continue
 		}
 		if s.isExpired(call, now) {
-			s.markEndedLocked(call, now)
+			s.markEndedLocked(call, models.CallEndReasonExpired, now)
 			s.removeCallLocked(id)
 		}
 	}
 }
 
 func (s *CallStore) isExpired(call *models.CallV2, now time.Time) bool {
+	return callExpired(call, now, s.reconnectTTL)
+}
+
+// callExpired reports whether the call outlived its TTL or every peer stayed
+// away longer than the reconnect window.
+func callExpired(call *models.CallV2, now time.Time, reconnectTTL time.Duration) bool {
 	if call == nil {
 		return true
 	}
@@ -312,13 +861,15 @@ func (s *CallStore) isExpired(call *models.CallV2, now time.Time) bool {
 		return true
 	}
 
-	// Reconnect window: if оба участника отсутствуют дольше reconnectTTL
-	if !call.Host.IsPresent && !call.Guest.IsPresent {
-		latestDisc := call.Host.DisconnectedAt
-		if call.Guest.DisconnectedAt.After(latestDisc) {
-			latestDisc = call.Guest.DisconnectedAt
+	// Reconnect window: if все участники отсутствуют дольше reconnectTTL
+	if call.ParticipantsCount() == 0 {
+		var latestDisc time.Time
+		for _, p := range call.Participants {
+			if p.DisconnectedAt.After(latestDisc) {
+				latestDisc = p.DisconnectedAt
+			}
 		}
-		if !latestDisc.IsZero() && now.After(latestDisc.Add(s.reconnectTTL)) {
+		if !latestDisc.IsZero() && now.After(latestDisc.Add(reconnectTTL)) {
 			return true
 		}
 	}
@@ -326,15 +877,38 @@ func (s *CallStore) isExpired(call *models.CallV2, now time.Time) bool {
 	return false
 }
 
-func (s *CallStore) markEndedLocked(call *models.CallV2, now time.Time) {
+// markEndedLocked ends the call. The first reason given sticks.
+func (s *CallStore) markEndedLocked(call *models.CallV2, reason models.CallEndReason, now time.Time) {
+	if call.Status != models.CallStatusV2Ended {
+		s.totalEnded++
+		call.EndReason = reason
+		s.emitLocked(models.CallEventEnded, call, now)
+	}
 	call.Status = models.CallStatusV2Ended
-	call.UpdatedAt = now
+	s.touchLocked(call, now)
 	call.ExpiresAt = now
-	call.Host.IsPresent = false
-	call.Guest.IsPresent = false
+	markAllAbsent(call)
 }
 
+// touchLocked records a state change so clients can detect missed updates.
+func (s *CallStore) touchLocked(call *models.CallV2, now time.Time) {
+	touchCall(call, now)
+	if n := len(s.changed); n == 0 || s.changed[n-1] != call.ID {
+		s.changed = append(s.changed, call.ID)
+	}
+}
+
+func touchCall(call *models.CallV2, now time.Time) {
+	call.Seq++
+	call.UpdatedAt = now
+}
+
+// removeCallLocked drops an ended call, keeping a short tombstone so clients
+// can tell a just-ended call from one that never existed.
 func (s *CallStore) removeCallLocked(callID string) {
+	if call, ok := s.calls[callID]; ok {
+		s.tombstones[callID] = call.UpdatedAt
+	}
 	delete(s.calls, callID)
 	s.untrackStatusLocked(callID)
 }
@@ -0,0 +1,742 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+
+	"github.com/tariel-x/gocall/internal/models"
+)
+
+// redisTxRetries bounds optimistic-lock retries when several instances update
+// the same call at once.
+const redisTxRetries = 10
+
+var errRedisContention = errors.New("call store: too many concurrent updates")
+
+// createCallScript stores a new call unless its ID is taken or MaxCalls live
+// calls are indexed, checking both atomically so instances can't overshoot
+// the limit together. It returns 1 when created, 0 on an ID collision and -1
+// at capacity.
+//
+// KEYS: call key, waiting set, active set.
+// ARGV: payload, key TTL in ms, call ID, max calls (0 = unlimited).
+var createCallScript = redis.NewScript(`
+local max = tonumber(ARGV[4])
+if max > 0 and redis.call('SCARD', KEYS[2]) + redis.call('SCARD', KEYS[3]) >= max then
+	return -1
+end
+if not redis.call('SET', KEYS[1], ARGV[1], 'PX', ARGV[2], 'NX') then
+	return 0
+end
+redis.call('SADD', KEYS[2], ARGV[3])
+return 1
+`)
+
+// RedisCallStore keeps call state in Redis so that any instance behind a load
+// balancer can serve any call. Records are written with a TTL that outlives the
+// call by the tombstone window, so expired calls are still reported as ended.
+type RedisCallStore struct {
+	client       redis.UniversalClient
+	prefix       string
+	callTTL      time.Duration
+	reconnectTTL time.Duration
+	tombstoneTTL time.Duration
+	maxCalls     int
+	timeout      time.Duration
+
+	mu             sync.Mutex
+	events         CallEventSink
+	changes        CallChangeSink
+	peakConcurrent int
+}
+
+// callRecord is the stored form of a call in Redis and SQLite; CallV2 hides
+// participants from its JSON.
+type callRecord struct {
+	models.CallV2
+	HostPeerID   string                              `json:"host_peer_id,omitempty"`
+	Participants map[string]models.CallParticipantV2 `json:"participants,omitempty"`
+	// Host and Guest are the two-party layout written by older versions,
+	// read so their calls survive a rolling upgrade.
+	Host  *models.CallParticipantV2 `json:"host,omitempty"`
+	Guest *models.CallParticipantV2 `json:"guest,omitempty"`
+}
+
+// upgradeLegacy moves participants from the two-party layout into call.
+func (r *callRecord) upgradeLegacy(call *models.CallV2) {
+	if call.Participants != nil {
+		return
+	}
+	for _, p := range []*models.CallParticipantV2{r.Host, r.Guest} {
+		if p == nil || p.PeerID == "" {
+			continue
+		}
+		if call.Participants == nil {
+			call.Participants = make(map[string]models.CallParticipantV2)
+		}
+		call.Participants[p.PeerID] = *p
+	}
+	if r.Host != nil {
+		call.HostPeerID = r.Host.PeerID
+	}
+}
+
+// NewRedisCallStore stores calls under prefix. It honours the TTL, tombstone
+// window and call limit in opts like the in-memory store does; the limit
+// counts live calls across all instances.
+func NewRedisCallStore(client redis.UniversalClient, prefix string, opts CallStoreOptions) *RedisCallStore {
+	opts = opts.withDefaults()
+	return &RedisCallStore{
+		client:       client,
+		prefix:       prefix,
+		callTTL:      opts.TTL,
+		reconnectTTL: 30 * time.Minute,
+		tombstoneTTL: opts.TombstoneTTL,
+		maxCalls:     opts.MaxCalls,
+		timeout:      3 * time.Second,
+	}
+}
+
+// SetEventSink enables call lifecycle events.
+func (s *RedisCallStore) SetEventSink(sink CallEventSink) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.events = sink
+}
+
+// SetChangeSink enables state change notifications. Only changes made
+// through this instance are reported.
+func (s *RedisCallStore) SetChangeSink(sink CallChangeSink) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.changes = sink
+}
+
+func (s *RedisCallStore) CreateCall(now time.Time, opts CreateCallOptions) (*models.CallV2, error) {
+	ctx, cancel := s.context()
+	defer cancel()
+
+	hostPeerID, err := newID(nil)
+	if err != nil {
+		return nil, err
+	}
+	call := newCall("", hostPeerID, now, s.callTTL, opts)
+
+	// The script claims the ID, so a collision with a live or recently ended
+	// call just draws another one.
+	var id string
+	swept := false
+	for attempt := 0; id == ""; attempt++ {
+		if attempt == idAttempts {
+			return nil, errIDCollision
+		}
+		candidate, err := newID(nil)
+		if err != nil {
+			return nil, err
+		}
+		call.ID = candidate
+
+		payload, ttl, err := s.encode(call, now)
+		if err != nil {
+			return nil, err
+		}
+		keys := []string{s.callKey(candidate), s.statusKey(models.CallStatusV2Waiting), s.statusKey(models.CallStatusV2Active)}
+		created, err := createCallScript.Run(ctx, s.client, keys, payload, ttl.Milliseconds(), candidate, s.maxCalls).Int()
+		if err != nil {
+			return nil, err
+		}
+		switch {
+		case created == 1:
+			id = candidate
+		case created < 0 && swept:
+			return nil, ErrCapacityReached
+		case created < 0:
+			// Expired calls stay indexed until something reads them; end
+			// them once before giving up, like the in-memory store does.
+			if err := s.sweepExpired(now); err != nil {
+				return nil, err
+			}
+			swept = true
+			attempt--
+		}
+	}
+
+	if err := s.client.HIncrBy(ctx, s.statsKey(), "created", 1).Err(); err != nil {
+		return nil, err
+	}
+
+	s.trackPeak(ctx)
+	s.emit(models.CallEventCreated, call, now)
+	return call, nil
+}
+
+func (s *RedisCallStore) GetByID(callID string, now time.Time) (*models.CallV2, error) {
+	return s.update(callID, now, func(call *models.CallV2) (bool, error) {
+		return false, nil
+	})
+}
+
+// sweepExpired ends expired calls and drops index entries whose records are
+// gone, so they stop counting against MaxCalls.
+func (s *RedisCallStore) sweepExpired(now time.Time) error {
+	for _, status := range []models.CallStatusV2{models.CallStatusV2Waiting, models.CallStatusV2Active} {
+		if _, err := s.ListByStatus(status, 0, now); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *RedisCallStore) ListByStatus(status models.CallStatusV2, limit int, now time.Time) ([]*models.CallV2, error) {
+	ctx, cancel := s.context()
+	defer cancel()
+
+	ids, err := s.client.SMembers(ctx, s.statusKey(status)).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	calls := make([]*models.CallV2, 0, len(ids))
+	for _, id := range ids {
+		call, err := s.GetByID(id, now)
+		switch {
+		case errors.Is(err, ErrCallNotFound):
+			// The record expired in Redis; drop the stale index entry.
+			s.client.SRem(ctx, s.statusKey(status), id)
+			continue
+		case errors.Is(err, ErrCallEnded):
+			continue
+		case err != nil:
+			return nil, err
+		}
+		if call.Status == status {
+			calls = append(calls, call)
+		}
+	}
+
+	sort.Slice(calls, func(i, j int) bool {
+		if calls[i].CreatedAt.Equal(calls[j].CreatedAt) {
+			return calls[i].ID < calls[j].ID
+		}
+		return calls[i].CreatedAt.Before(calls[j].CreatedAt)
+	})
+
+	if limit > 0 && len(calls) > limit {
+		calls = calls[:limit]
+	}
+
+	return calls, nil
+}
+
+func (s *RedisCallStore) Join(callID string, now time.Time) (peerID string, call *models.CallV2, err error) {
+	call, err = s.update(callID, now, func(call *models.CallV2) (bool, error) {
+		id, err := joinGuest(call, now)
+		if err != nil {
+			return false, err
+		}
+
+		peerID = id
+		touchCall(call, now)
+		call.ExpiresAt = now.Add(s.callTTL)
+		return true, nil
+	})
+	if err != nil {
+		return "", call, err
+	}
+
+	s.emit(models.CallEventJoined, call, now)
+	return peerID, call, nil
+}
+
+// EnsureHostPeerID returns the host's peer_id, assigning one if the host
+// slot is still empty.
+func (s *RedisCallStore) EnsureHostPeerID(callID string, now time.Time) (peerID string, call *models.CallV2, err error) {
+	call, err = s.update(callID, now, func(call *models.CallV2) (bool, error) {
+		if call.HostPeerID != "" {
+			peerID = call.HostPeerID
+			return false, nil
+		}
+
+		id, err := assignHost(call, now)
+		if err != nil {
+			return false, err
+		}
+
+		peerID = id
+		touchCall(call, now)
+		call.ExpiresAt = now.Add(s.callTTL)
+		return true, nil
+	})
+	if err != nil {
+		return "", nil, err
+	}
+	return peerID, call, nil
+}
+
+func (s *RedisCallStore) ValidatePeer(callID, peerID string, now time.Time) (role PeerRoleV2, call *models.CallV2, reconnected bool, err error) {
+	call, err = s.update(callID, now, func(call *models.CallV2) (bool, error) {
+		if hasReconnectToken(call, peerID) {
+			return false, errReconnectTokenRequired
+		}
+		var ok bool
+		role, reconnected, ok = markPeerPresent(call, peerID)
+		if !ok {
+			return false, errInvalidPeerID
+		}
+		touchCall(call, now)
+		call.ExpiresAt = now.Add(s.callTTL)
+		return true, nil
+	})
+	if err != nil {
+		if errors.Is(err, errInvalidPeerID) {
+			return "", call, false, err
+		}
+		return "", nil, false, err
+	}
+	return role, call, reconnected, nil
+}
+
+// IssueReconnectToken gives peerID its reconnect token; see
+// CallStore.IssueReconnectToken.
+func (s *RedisCallStore) IssueReconnectToken(callID, peerID string, now time.Time) (string, error) {
+	token, hash := newReconnectToken()
+	_, err := s.update(callID, now, func(call *models.CallV2) (bool, error) {
+		if err := setReconnectToken(call, peerID, hash); err != nil {
+			return false, err
+		}
+		return true, nil
+	})
+	if err != nil {
+		return "", err
+	}
+	return token, nil
+}
+
+// ReconnectWithToken is ValidatePeer for a peer identified by its reconnect
+// token.
+func (s *RedisCallStore) ReconnectWithToken(callID, token string, now time.Time) (peerID string, role PeerRoleV2, call *models.CallV2, reconnected bool, err error) {
+	call, err = s.update(callID, now, func(call *models.CallV2) (bool, error) {
+		var ok bool
+		peerID, ok = peerByReconnectToken(call, token)
+		if !ok {
+			return false, errInvalidReconnectToken
+		}
+		role, reconnected, _ = markPeerPresent(call, peerID)
+		touchCall(call, now)
+		call.ExpiresAt = now.Add(s.callTTL)
+		return true, nil
+	})
+	if err != nil {
+		return "", "", nil, false, err
+	}
+	return peerID, role, call, reconnected, nil
+}
+
+// ResumeCall rebuilds a call from the reconnecting peer's context; see
+// CallStore.ResumeCall.
+func (s *RedisCallStore) ResumeCall(callID, peerID string, role PeerRoleV2, icePolicy models.ICEPolicy, now time.Time) (*models.CallV2, error) {
+	ctx, cancel := s.context()
+	defer cancel()
+
+	var result *models.CallV2
+	err := s.watch(ctx, callID, func(tx *redis.Tx) error {
+		call, err := s.get(ctx, tx, callID)
+		if err != nil {
+			return err
+		}
+		switch {
+		case call == nil && s.recentlyEnded(ctx, tx, callID, now):
+			return ErrCallEnded
+		case call == nil:
+			call = newResumedCall(callID, now)
+		case call.Status == models.CallStatusV2Ended || callExpired(call, now, s.reconnectTTL):
+			return ErrCallEnded
+		case !call.Resumed:
+			return errInvalidPeerID
+		}
+		if !claimResumedSlot(call, peerID, role, icePolicy, now) {
+			return errInvalidPeerID
+		}
+		touchCall(call, now)
+		call.ExpiresAt = now.Add(s.callTTL)
+
+		payload, ttl, err := s.encode(call, now)
+		if err != nil {
+			return err
+		}
+		_, err = tx.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+			pipe.Set(ctx, s.callKey(callID), payload, ttl)
+			s.indexStatus(ctx, pipe, callID, call.Status)
+			return nil
+		})
+		result = call
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	s.changed(callID)
+	return result, nil
+}
+
+// EndCall marks the call as ended and removes it, leaving a tombstone.
+func (s *RedisCallStore) EndCall(callID string, reason models.CallEndReason, now time.Time) (*models.CallV2, error) {
+	ctx, cancel := s.context()
+	defer cancel()
+
+	var snapshot *models.CallV2
+	err := s.watch(ctx, callID, func(tx *redis.Tx) error {
+		call, err := s.get(ctx, tx, callID)
+		if err != nil {
+			return err
+		}
+		if call == nil {
+			return ErrCallNotFound
+		}
+		if err := s.end(ctx, tx, call, reason, now); err != nil {
+			return err
+		}
+		snapshot = call
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return snapshot, nil
+}
+
+// RecentlyEnded reports whether the call ended within the tombstone window.
+func (s *RedisCallStore) RecentlyEnded(callID string, now time.Time) bool {
+	ctx, cancel := s.context()
+	defer cancel()
+	return s.recentlyEnded(ctx, s.client, callID, now)
+}
+
+// MarkPeerDisconnected flags peer presence as lost but keeps the call active to allow reconnection.
+func (s *RedisCallStore) MarkPeerDisconnected(callID, peerID string, now time.Time) {
+	_, _ = s.update(callID, now, func(call *models.CallV2) (bool, error) {
+		if !markPeerAbsent(call, peerID, now) {
+			return false, nil
+		}
+		touchCall(call, now)
+		return true, nil
+	})
+}
+
+// SetParticipantName sets the display name shown for peerID in call state.
+func (s *RedisCallStore) SetParticipantName(callID, peerID, name string, now time.Time) (*models.CallV2, error) {
+	call, err := s.update(callID, now, func(call *models.CallV2) (bool, error) {
+		if !setParticipantName(call, peerID, name) {
+			return false, errInvalidPeerID
+		}
+		touchCall(call, now)
+		return true, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return call, nil
+}
+
+// SetMediaState records whether peerID sends audio and video.
+func (s *RedisCallStore) SetMediaState(callID, peerID string, state models.MediaState, now time.Time) (*models.CallV2, error) {
+	call, err := s.update(callID, now, func(call *models.CallV2) (bool, error) {
+		if !setMediaState(call, peerID, state) {
+			return false, errInvalidPeerID
+		}
+		touchCall(call, now)
+		return true, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return call, nil
+}
+
+// AppendChat adds msg to the call's chat backlog.
+func (s *RedisCallStore) AppendChat(callID string, msg models.ChatMessageV2, now time.Time) error {
+	_, err := s.update(callID, now, func(call *models.CallV2) (bool, error) {
+		appendChat(call, msg)
+		return true, nil
+	})
+	return err
+}
+
+// AdmitPeer moves a pending guest out of the waiting room.
+func (s *RedisCallStore) AdmitPeer(callID, peerID string, now time.Time) (*models.CallV2, error) {
+	return s.updateWaitingRoom(callID, peerID, now, admitPeer)
+}
+
+// RejectPeer turns a pending guest away.
+func (s *RedisCallStore) RejectPeer(callID, peerID string, now time.Time) (*models.CallV2, error) {
+	return s.updateWaitingRoom(callID, peerID, now, rejectPeer)
+}
+
+func (s *RedisCallStore) updateWaitingRoom(callID, peerID string, now time.Time, fn func(call *models.CallV2, peerID string) error) (*models.CallV2, error) {
+	call, err := s.update(callID, now, func(call *models.CallV2) (bool, error) {
+		if err := fn(call, peerID); err != nil {
+			return false, err
+		}
+		touchCall(call, now)
+		return true, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return call, nil
+}
+
+// Stats returns call counters shared by all instances. PeakConcurrent is the
+// highest count this instance has observed.
+func (s *RedisCallStore) Stats() CallStoreStats {
+	ctx, cancel := s.context()
+	defer cancel()
+
+	var stats CallStoreStats
+	if counters, err := s.client.HMGet(ctx, s.statsKey(), "created", "ended").Result(); err == nil {
+		stats.Created = counterValue(counters[0])
+		stats.Ended = counterValue(counters[1])
+	}
+
+	s.mu.Lock()
+	stats.PeakConcurrent = s.peakConcurrent
+	s.mu.Unlock()
+	return stats
+}
+
+// update loads an active call, applies fn and writes the call back if fn
+// asks for it. Expired calls are ended and reported as ErrCallEnded. The call
+// is returned alongside errors from fn.
+func (s *RedisCallStore) update(callID string, now time.Time, fn func(call *models.CallV2) (bool, error)) (*models.CallV2, error) {
+	ctx, cancel := s.context()
+	defer cancel()
+
+	var (
+		result  *models.CallV2
+		fnErr   error
+		touched bool
+	)
+	err := s.watch(ctx, callID, func(tx *redis.Tx) error {
+		result, fnErr, touched = nil, nil, false
+
+		call, err := s.get(ctx, tx, callID)
+		if err != nil {
+			return err
+		}
+		if call == nil {
+			if s.recentlyEnded(ctx, tx, callID, now) {
+				return ErrCallEnded
+			}
+			return ErrCallNotFound
+		}
+		if call.Status == models.CallStatusV2Ended || callExpired(call, now, s.reconnectTTL) {
+			if err := s.end(ctx, tx, call, models.CallEndReasonExpired, now); err != nil {
+				return err
+			}
+			return ErrCallEnded
+		}
+
+		result = call
+		seq := call.Seq
+		write, err := fn(call)
+		if err != nil {
+			fnErr = err
+			return nil
+		}
+		if !write {
+			return nil
+		}
+		touched = call.Seq != seq
+
+		payload, ttl, err := s.encode(call, now)
+		if err != nil {
+			return err
+		}
+		_, err = tx.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+			pipe.Set(ctx, s.callKey(callID), payload, ttl)
+			s.indexStatus(ctx, pipe, callID, call.Status)
+			return nil
+		})
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	if touched {
+		s.changed(callID)
+	}
+	return result, fnErr
+}
+
+// watch runs fn in an optimistic transaction on the call key, retrying when
+// another instance modified the call concurrently.
+func (s *RedisCallStore) watch(ctx context.Context, callID string, fn func(tx *redis.Tx) error) error {
+	for range redisTxRetries {
+		err := s.client.Watch(ctx, fn, s.callKey(callID))
+		if errors.Is(err, redis.TxFailedErr) {
+			continue
+		}
+		return err
+	}
+	return errRedisContention
+}
+
+// end marks the call ended for reason, replaces it with a tombstone and
+// counts it.
+func (s *RedisCallStore) end(ctx context.Context, tx *redis.Tx, call *models.CallV2, reason models.CallEndReason, now time.Time) error {
+	wasEnded := call.Status == models.CallStatusV2Ended
+	if !wasEnded {
+		call.EndReason = reason
+	}
+
+	call.Status = models.CallStatusV2Ended
+	touchCall(call, now)
+	call.ExpiresAt = now
+	markAllAbsent(call)
+
+	_, err := tx.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.Del(ctx, s.callKey(call.ID))
+		s.indexStatus(ctx, pipe, call.ID, "")
+		pipe.Set(ctx, s.endedKey(call.ID), call.UpdatedAt.UnixNano(), s.tombstoneTTL)
+		if !wasEnded {
+			pipe.HIncrBy(ctx, s.statsKey(), "ended", 1)
+		}
+		return nil
+	})
+	if err == nil && !wasEnded {
+		s.emit(models.CallEventEnded, call, now)
+	}
+	return err
+}
+
+func (s *RedisCallStore) get(ctx context.Context, r redis.Cmdable, callID string) (*models.CallV2, error) {
+	payload, err := r.Get(ctx, s.callKey(callID)).Bytes()
+	if errors.Is(err, redis.Nil) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return decodeCallRecord(payload)
+}
+
+// encode serializes the call and picks a key TTL that keeps it around for the
+// tombstone window after it expires.
+func (s *RedisCallStore) encode(call *models.CallV2, now time.Time) ([]byte, time.Duration, error) {
+	payload, err := encodeCallRecord(call)
+	if err != nil {
+		return nil, 0, err
+	}
+	ttl := call.ExpiresAt.Sub(now) + s.tombstoneTTL
+	if ttl < time.Second {
+		ttl = time.Second
+	}
+	return payload, ttl, nil
+}
+
+func encodeCallRecord(call *models.CallV2) ([]byte, error) {
+	return json.Marshal(callRecord{CallV2: *call, HostPeerID: call.HostPeerID, Participants: call.Participants})
+}
+
+func decodeCallRecord(payload []byte) (*models.CallV2, error) {
+	var record callRecord
+	if err := json.Unmarshal(payload, &record); err != nil {
+		return nil, err
+	}
+	call := record.CallV2
+	call.HostPeerID = record.HostPeerID
+	call.Participants = record.Participants
+	record.upgradeLegacy(&call)
+	return &call, nil
+}
+
+func (s *RedisCallStore) recentlyEnded(ctx context.Context, r redis.Cmdable, callID string, now time.Time) bool {
+	endedAt, err := r.Get(ctx, s.endedKey(callID)).Int64()
+	if err != nil {
+		return false
+	}
+	return now.Sub(time.Unix(0, endedAt)) <= s.tombstoneTTL
+}
+
+// indexStatus moves the call into the set for status; an empty status just
+// removes it from all sets.
+func (s *RedisCallStore) indexStatus(ctx context.Context, pipe redis.Pipeliner, callID string, status models.CallStatusV2) {
+	for _, st := range []models.CallStatusV2{models.CallStatusV2Waiting, models.CallStatusV2Active} {
+		if st == status {
+			pipe.SAdd(ctx, s.statusKey(st), callID)
+		} else {
+			pipe.SRem(ctx, s.statusKey(st), callID)
+		}
+	}
+}
+
+func (s *RedisCallStore) trackPeak(ctx context.Context) {
+	waiting, err1 := s.client.SCard(ctx, s.statusKey(models.CallStatusV2Waiting)).Result()
+	active, err2 := s.client.SCard(ctx, s.statusKey(models.CallStatusV2Active)).Result()
+	if err1 != nil || err2 != nil {
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.peakConcurrent = max(s.peakConcurrent, int(waiting+active))
+}
+
+func (s *RedisCallStore) emit(eventType models.CallEventType, call *models.CallV2, now time.Time) {
+	s.mu.Lock()
+	sink := s.events
+	s.mu.Unlock()
+	if sink == nil {
+		return
+	}
+
+	event := models.CallEvent{Type: eventType, CallID: call.ID, At: now}
+	if eventType == models.CallEventEnded {
+		event.Duration = now.Sub(call.CreatedAt)
+	}
+	sink.Record(event)
+}
+
+// Ping checks that Redis answers.
+func (s *RedisCallStore) Ping(ctx context.Context) error {
+	return s.client.Ping(ctx).Err()
+}
+
+// changed reports a stored state change to the change sink.
+func (s *RedisCallStore) changed(callID string) {
+	s.mu.Lock()
+	sink := s.changes
+	s.mu.Unlock()
+	if sink != nil {
+		sink.CallChanged(callID)
+	}
+}
+
+func (s *RedisCallStore) context() (context.Context, context.CancelFunc) {
+	return context.WithTimeout(context.Background(), s.timeout)
+}
+
+func (s *RedisCallStore) callKey(callID string) string  { return s.prefix + "call:" + callID }
+func (s *RedisCallStore) endedKey(callID string) string { return s.prefix + "ended:" + callID }
+func (s *RedisCallStore) statsKey() string              { return s.prefix + "stats" }
+
+func (s *RedisCallStore) statusKey(status models.CallStatusV2) string {
+	return s.prefix + "status:" + string(status)
+}
+
+func counterValue(v any) int {
+	str, ok := v.(string)
+	if !ok {
+		return 0
+	}
+	n, _ := strconv.Atoi(str)
+	return n
+}
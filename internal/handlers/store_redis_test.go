@@ -0,0 +1,235 @@
+package handlers
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+
+	"github.com/tariel-x/gocall/internal/models"
+)
+
+func newTestRedisStores(t *testing.T, n int) ([]*RedisCallStore, *miniredis.Miniredis) {
+	t.Helper()
+	return newTestRedisStoresWithOptions(t, n, CallStoreOptions{})
+}
+
+func newTestRedisStoresWithOptions(t *testing.T, n int, opts CallStoreOptions) ([]*RedisCallStore, *miniredis.Miniredis) {
+	t.Helper()
+	mr := miniredis.RunT(t)
+
+	stores := make([]*RedisCallStore, n)
+	for i := range stores {
+		client := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+		t.Cleanup(func() { client.Close() })
+		stores[i] = NewRedisCallStore(client, "test:", opts)
+	}
+	return stores, mr
+}
+
+func TestRedisStoreSharedBetweenInstances(t *testing.T) {
+	stores, _ := newTestRedisStores(t, 2)
+	a, b := stores[0], stores[1]
+	base := time.Unix(1_700_000_000, 0)
+
+	call, err := a.CreateCall(base, CreateCallOptions{ICEPolicy: models.ICEPolicyRelay})
+	if err != nil {
+		t.Fatalf("create call failed: %v", err)
+	}
+	hostID, _, err := a.EnsureHostPeerID(call.ID, base.Add(time.Second))
+	if err != nil {
+		t.Fatalf("ensure host failed: %v", err)
+	}
+
+	guestID, joined, err := b.Join(call.ID, base.Add(2*time.Second))
+	if err != nil {
+		t.Fatalf("join on second instance failed: %v", err)
+	}
+	if joined.Status != models.CallStatusV2Active || joined.ICEPolicy != models.ICEPolicyRelay {
+		t.Fatalf("unexpected joined call %+v", joined)
+	}
+	if _, _, err := a.Join(call.ID, base.Add(3*time.Second)); !errors.Is(err, ErrCallFull) {
+		t.Fatalf("expected ErrCallFull, got %v", err)
+	}
+
+	role, _, _, err := a.ValidatePeer(call.ID, guestID, base.Add(4*time.Second))
+	if err != nil || role != PeerRoleV2Guest {
+		t.Fatalf("guest validation on first instance = %s, %v", role, err)
+	}
+	b.MarkPeerDisconnected(call.ID, hostID, base.Add(5*time.Second))
+	role, got, reconnected, err := a.ValidatePeer(call.ID, hostID, base.Add(6*time.Second))
+	if err != nil || role != PeerRoleV2Host || !reconnected {
+		t.Fatalf("host reconnect = %s, %v, %v", role, reconnected, err)
+	}
+	if got.Participants[hostID].ReconnectCount != 1 {
+		t.Fatalf("expected one host reconnect, got %d", got.Participants[hostID].ReconnectCount)
+	}
+	if _, _, _, err := a.ValidatePeer(call.ID, "unknown", base.Add(7*time.Second)); err == nil {
+		t.Fatalf("expected unknown peer to be rejected")
+	}
+
+	active, err := b.ListByStatus(models.CallStatusV2Active, 0, base.Add(8*time.Second))
+	if err != nil || len(active) != 1 || active[0].ID != call.ID {
+		t.Fatalf("active calls = %v, %v", active, err)
+	}
+
+	stats := b.Stats()
+	if stats.Created != 1 || stats.Ended != 0 {
+		t.Fatalf("unexpected stats %+v", stats)
+	}
+}
+
+func TestRedisStoreEndLeavesTombstone(t *testing.T) {
+	stores, mr := newTestRedisStores(t, 1)
+	store := stores[0]
+	base := time.Unix(1_700_100_000, 0)
+
+	call, _ := store.CreateCall(base, CreateCallOptions{})
+	if _, err := store.EndCall(call.ID, models.CallEndReasonLeft, base.Add(time.Second)); err != nil {
+		t.Fatalf("end call failed: %v", err)
+	}
+
+	if _, err := store.GetByID(call.ID, base.Add(2*time.Second)); !errors.Is(err, ErrCallEnded) {
+		t.Fatalf("expected ErrCallEnded, got %v", err)
+	}
+	if !store.RecentlyEnded(call.ID, base.Add(2*time.Second)) {
+		t.Fatalf("expected call to be recently ended")
+	}
+	if waiting, _ := store.ListByStatus(models.CallStatusV2Waiting, 0, base.Add(2*time.Second)); len(waiting) != 0 {
+		t.Fatalf("ended call still listed as waiting")
+	}
+
+	mr.FastForward(store.tombstoneTTL + time.Second)
+	if _, err := store.GetByID(call.ID, base.Add(store.tombstoneTTL+2*time.Second)); !errors.Is(err, ErrCallNotFound) {
+		t.Fatalf("expected ErrCallNotFound after tombstone expiry, got %v", err)
+	}
+	if stats := store.Stats(); stats.Ended != 1 {
+		t.Fatalf("expected one ended call, got %+v", stats)
+	}
+}
+
+func TestRedisStoreExpiredCallEnds(t *testing.T) {
+	stores, _ := newTestRedisStores(t, 1)
+	store := stores[0]
+	base := time.Unix(1_700_200_000, 0)
+
+	call, _ := store.CreateCall(base, CreateCallOptions{})
+
+	if _, err := store.GetByID(call.ID, base.Add(store.callTTL+time.Second)); !errors.Is(err, ErrCallEnded) {
+		t.Fatalf("expected expired call to be ended, got %v", err)
+	}
+	if stats := store.Stats(); stats.Ended != 1 {
+		t.Fatalf("expected expiry to count as ended, got %+v", stats)
+	}
+}
+
+func TestRedisStoreResumeCall(t *testing.T) {
+	stores, _ := newTestRedisStores(t, 1)
+	store := stores[0]
+	base := time.Unix(1_700_300_000, 0)
+
+	if _, err := store.ResumeCall("lost-call", "host-peer", PeerRoleV2Host, "", base); err != nil {
+		t.Fatalf("host resume failed: %v", err)
+	}
+	call, err := store.ResumeCall("lost-call", "guest-peer", PeerRoleV2Guest, "", base.Add(time.Second))
+	if err != nil {
+		t.Fatalf("guest resume failed: %v", err)
+	}
+	if call.Status != models.CallStatusV2Active {
+		t.Fatalf("expected resumed call to be active, got %s", call.Status)
+	}
+	if _, err := store.ResumeCall("lost-call", "intruder", PeerRoleV2Guest, "", base.Add(2*time.Second)); !errors.Is(err, errInvalidPeerID) {
+		t.Fatalf("expected taken slot to be rejected, got %v", err)
+	}
+	if role, _, _, err := store.ValidatePeer("lost-call", "guest-peer", base.Add(3*time.Second)); err != nil || role != PeerRoleV2Guest {
+		t.Fatalf("guest validation after resume = %s, %v", role, err)
+	}
+}
+
+func TestRedisStoreRetriesCallIDCollision(t *testing.T) {
+	stores, _ := newTestRedisStores(t, 2)
+	base := time.Unix(1_700_000_000, 0)
+
+	// Each create draws the host's peer_id first, then call IDs.
+	stubGenerateID(t,
+		"host000000000001", "same000000000001",
+		"host000000000002", "same000000000001", "next000000000002")
+	first, err := stores[0].CreateCall(base, CreateCallOptions{})
+	if err != nil {
+		t.Fatalf("create call failed: %v", err)
+	}
+	second, err := stores[1].CreateCall(base, CreateCallOptions{})
+	if err != nil {
+		t.Fatalf("create call after collision failed: %v", err)
+	}
+	if first.ID != "same000000000001" || second.ID != "next000000000002" {
+		t.Fatalf("unexpected ids %q and %q", first.ID, second.ID)
+	}
+}
+
+func TestRedisStoreCustomTTL(t *testing.T) {
+	stores, _ := newTestRedisStoresWithOptions(t, 1, CallStoreOptions{TTL: time.Minute})
+	store := stores[0]
+	base := time.Unix(1_700_300_000, 0)
+
+	call, err := store.CreateCall(base, CreateCallOptions{})
+	if err != nil {
+		t.Fatalf("create call failed: %v", err)
+	}
+	if want := base.Add(time.Minute); !call.ExpiresAt.Equal(want) {
+		t.Fatalf("expires at %v, want %v", call.ExpiresAt, want)
+	}
+	if _, err := store.GetByID(call.ID, base.Add(61*time.Second)); !errors.Is(err, ErrCallEnded) {
+		t.Fatalf("expected ErrCallEnded after TTL, got %v", err)
+	}
+}
+
+func TestRedisStoreCustomTombstoneTTL(t *testing.T) {
+	stores, mr := newTestRedisStoresWithOptions(t, 1, CallStoreOptions{TombstoneTTL: time.Minute})
+	store := stores[0]
+	base := time.Unix(1_700_400_000, 0)
+
+	call, _ := store.CreateCall(base, CreateCallOptions{})
+	if _, err := store.EndCall(call.ID, models.CallEndReasonLeft, base); err != nil {
+		t.Fatalf("end call failed: %v", err)
+	}
+	if !store.RecentlyEnded(call.ID, base.Add(50*time.Second)) {
+		t.Fatalf("expected call to be recently ended within the window")
+	}
+
+	mr.FastForward(61 * time.Second)
+	if _, err := store.GetByID(call.ID, base.Add(61*time.Second)); !errors.Is(err, ErrCallNotFound) {
+		t.Fatalf("expected ErrCallNotFound after the window, got %v", err)
+	}
+}
+
+func TestRedisStoreMaxCallsAcrossInstances(t *testing.T) {
+	stores, _ := newTestRedisStoresWithOptions(t, 2, CallStoreOptions{MaxCalls: 2, TTL: time.Minute})
+	a, b := stores[0], stores[1]
+	now := time.Unix(1_700_600_000, 0)
+
+	first, err := a.CreateCall(now, CreateCallOptions{})
+	if err != nil {
+		t.Fatalf("first create failed: %v", err)
+	}
+	if _, err := b.CreateCall(now, CreateCallOptions{}); err != nil {
+		t.Fatalf("second create failed: %v", err)
+	}
+	if _, err := a.CreateCall(now, CreateCallOptions{}); !errors.Is(err, ErrCapacityReached) {
+		t.Fatalf("create over the limit: got %v, want ErrCapacityReached", err)
+	}
+
+	if _, err := b.EndCall(first.ID, models.CallEndReasonLeft, now); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := a.CreateCall(now, CreateCallOptions{}); err != nil {
+		t.Fatalf("create after ending a call failed: %v", err)
+	}
+
+	// Expired calls free their slots even though they are still indexed.
+	if _, err := b.CreateCall(now.Add(2*time.Minute), CreateCallOptions{}); err != nil {
+		t.Fatalf("create after expiry failed: %v", err)
+	}
+}
@@ -0,0 +1,745 @@
+package handlers
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/url"
+	"sync"
+	"time"
+
+	_ "modernc.org/sqlite" // registers the "sqlite" driver
+
+	"github.com/tariel-x/gocall/internal/models"
+)
+
+const sqliteSchema = `
+CREATE TABLE IF NOT EXISTS calls (
+	id         TEXT PRIMARY KEY,
+	status     TEXT NOT NULL,
+	created_at INTEGER NOT NULL,
+	data       BLOB NOT NULL
+);
+CREATE INDEX IF NOT EXISTS calls_status ON calls (status, created_at, id);
+CREATE TABLE IF NOT EXISTS ended_calls (
+	id       TEXT PRIMARY KEY,
+	ended_at INTEGER NOT NULL
+);
+CREATE TABLE IF NOT EXISTS call_stats (
+	name  TEXT PRIMARY KEY,
+	value INTEGER NOT NULL
+);
+`
+
+// SQLiteCallStore keeps call state in a SQLite file so calls and peer IDs
+// survive a restart of a single instance. Every operation runs in its own
+// transaction on one connection, which serialises them like the in-memory
+// store's mutex does.
+type SQLiteCallStore struct {
+	db           *sql.DB
+	callTTL      time.Duration
+	reconnectTTL time.Duration
+	tombstoneTTL time.Duration
+	maxCalls     int
+	timeout      time.Duration
+
+	mu      sync.Mutex
+	events  CallEventSink
+	changes CallChangeSink
+}
+
+// sqliteTx is a store transaction. Calls ended in it are reported to the
+// event sink once it commits.
+type sqliteTx struct {
+	*sql.Tx
+	ctx   context.Context
+	ended []*models.CallV2
+}
+
+// NewSQLiteCallStore opens or creates the database at path. It honours the
+// TTL, tombstone window and call limit in opts like the in-memory store does.
+func NewSQLiteCallStore(path string, opts CallStoreOptions) (*SQLiteCallStore, error) {
+	opts = opts.withDefaults()
+
+	dsn := "file:" + path + "?" + url.Values{"_pragma": {"busy_timeout(5000)", "journal_mode(WAL)"}}.Encode()
+	db, err := sql.Open("sqlite", dsn)
+	if err != nil {
+		return nil, err
+	}
+	db.SetMaxOpenConns(1)
+
+	s := &SQLiteCallStore{
+		db:           db,
+		callTTL:      opts.TTL,
+		reconnectTTL: 30 * time.Minute,
+		tombstoneTTL: opts.TombstoneTTL,
+		maxCalls:     opts.MaxCalls,
+		timeout:      3 * time.Second,
+	}
+
+	ctx, cancel := s.context()
+	defer cancel()
+	if _, err := db.ExecContext(ctx, sqliteSchema); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("create schema: %w", err)
+	}
+	if err := s.markAllAbsent(time.Now()); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("reset presence: %w", err)
+	}
+	return s, nil
+}
+
+// markAllAbsent marks every participant absent. Connections don't survive a
+// restart; peers show up as present again once they reconnect.
+func (s *SQLiteCallStore) markAllAbsent(now time.Time) error {
+	return s.inTx(func(tx *sqliteTx) error {
+		calls, err := s.query(tx, `SELECT data FROM calls`)
+		if err != nil {
+			return err
+		}
+		for _, call := range calls {
+			changed := false
+			for peerID, p := range call.Participants {
+				if p.IsPresent {
+					changed = markPeerAbsent(call, peerID, now) || changed
+				}
+			}
+			if !changed {
+				continue
+			}
+			if err := s.put(tx, call); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// Close closes the database.
+func (s *SQLiteCallStore) Close() error {
+	return s.db.Close()
+}
+
+// Ping checks that the database answers.
+func (s *SQLiteCallStore) Ping(ctx context.Context) error {
+	return s.db.PingContext(ctx)
+}
+
+// SetEventSink enables call lifecycle events.
+func (s *SQLiteCallStore) SetEventSink(sink CallEventSink) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.events = sink
+}
+
+// SetChangeSink enables state change notifications.
+func (s *SQLiteCallStore) SetChangeSink(sink CallChangeSink) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.changes = sink
+}
+
+func (s *SQLiteCallStore) CreateCall(now time.Time, opts CreateCallOptions) (*models.CallV2, error) {
+	var call *models.CallV2
+	err := s.inTx(func(tx *sqliteTx) error {
+		atCapacity, err := s.atCapacity(tx, now)
+		if err != nil {
+			return err
+		}
+		if atCapacity {
+			return ErrCapacityReached
+		}
+
+		var lookupErr error
+		id, err := newID(func(id string) bool {
+			var n int
+			if err := tx.QueryRowContext(tx.ctx, `SELECT (SELECT COUNT(*) FROM calls WHERE id = ?1) + (SELECT COUNT(*) FROM ended_calls WHERE id = ?1)`, id).Scan(&n); err != nil {
+				lookupErr = err
+				return false
+			}
+			return n > 0
+		})
+		if lookupErr != nil {
+			return lookupErr
+		}
+		if err != nil {
+			return err
+		}
+		hostPeerID, err := newID(nil)
+		if err != nil {
+			return err
+		}
+
+		call = newCall(id, hostPeerID, now, s.callTTL, opts)
+		if err := s.put(tx, call); err != nil {
+			return err
+		}
+		if err := addStat(tx, "created", 1); err != nil {
+			return err
+		}
+		var live int
+		if err := tx.QueryRowContext(tx.ctx, `SELECT COUNT(*) FROM calls`).Scan(&live); err != nil {
+			return err
+		}
+		_, err = tx.ExecContext(tx.ctx, `INSERT INTO call_stats (name, value) VALUES ('peak', ?1)
+			ON CONFLICT (name) DO UPDATE SET value = max(value, excluded.value)`, live)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	s.emit(models.CallEventCreated, call, now)
+	return call, nil
+}
+
+// atCapacity reports whether MaxCalls live calls are stored, ending expired
+// ones first once the limit is hit.
+func (s *SQLiteCallStore) atCapacity(tx *sqliteTx, now time.Time) (bool, error) {
+	if s.maxCalls <= 0 {
+		return false, nil
+	}
+	var live int
+	if err := tx.QueryRowContext(tx.ctx, `SELECT COUNT(*) FROM calls`).Scan(&live); err != nil {
+		return false, err
+	}
+	if live < s.maxCalls {
+		return false, nil
+	}
+
+	calls, err := s.query(tx, `SELECT data FROM calls`)
+	if err != nil {
+		return false, err
+	}
+	for _, call := range calls {
+		if callExpired(call, now, s.reconnectTTL) {
+			if err := s.end(tx, call, models.CallEndReasonExpired, now); err != nil {
+				return false, err
+			}
+			live--
+		}
+	}
+	return live >= s.maxCalls, nil
+}
+
+func (s *SQLiteCallStore) GetByID(callID string, now time.Time) (*models.CallV2, error) {
+	return s.update(callID, now, func(call *models.CallV2) (bool, error) {
+		return false, nil
+	})
+}
+
+func (s *SQLiteCallStore) ListByStatus(status models.CallStatusV2, limit int, now time.Time) ([]*models.CallV2, error) {
+	var calls []*models.CallV2
+	err := s.inTx(func(tx *sqliteTx) error {
+		stored, err := s.query(tx, `SELECT data FROM calls WHERE status = ? ORDER BY created_at, id`, string(status))
+		if err != nil {
+			return err
+		}
+		calls = make([]*models.CallV2, 0, len(stored))
+		for _, call := range stored {
+			if callExpired(call, now, s.reconnectTTL) {
+				if err := s.end(tx, call, models.CallEndReasonExpired, now); err != nil {
+					return err
+				}
+				continue
+			}
+			calls = append(calls, call)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if limit > 0 && len(calls) > limit {
+		calls = calls[:limit]
+	}
+	return calls, nil
+}
+
+func (s *SQLiteCallStore) Join(callID string, now time.Time) (peerID string, call *models.CallV2, err error) {
+	call, err = s.update(callID, now, func(call *models.CallV2) (bool, error) {
+		id, err := joinGuest(call, now)
+		if err != nil {
+			return false, err
+		}
+
+		peerID = id
+		touchCall(call, now)
+		call.ExpiresAt = now.Add(s.callTTL)
+		return true, nil
+	})
+	if err != nil {
+		return "", call, err
+	}
+
+	s.emit(models.CallEventJoined, call, now)
+	return peerID, call, nil
+}
+
+// EnsureHostPeerID returns the host's peer_id, assigning one if the host
+// slot is still empty.
+func (s *SQLiteCallStore) EnsureHostPeerID(callID string, now time.Time) (peerID string, call *models.CallV2, err error) {
+	call, err = s.update(callID, now, func(call *models.CallV2) (bool, error) {
+		if call.HostPeerID != "" {
+			peerID = call.HostPeerID
+			return false, nil
+		}
+
+		id, err := assignHost(call, now)
+		if err != nil {
+			return false, err
+		}
+
+		peerID = id
+		touchCall(call, now)
+		call.ExpiresAt = now.Add(s.callTTL)
+		return true, nil
+	})
+	if err != nil {
+		return "", nil, err
+	}
+	return peerID, call, nil
+}
+
+func (s *SQLiteCallStore) ValidatePeer(callID, peerID string, now time.Time) (role PeerRoleV2, call *models.CallV2, reconnected bool, err error) {
+	call, err = s.update(callID, now, func(call *models.CallV2) (bool, error) {
+		if hasReconnectToken(call, peerID) {
+			return false, errReconnectTokenRequired
+		}
+		var ok bool
+		role, reconnected, ok = markPeerPresent(call, peerID)
+		if !ok {
+			return false, errInvalidPeerID
+		}
+		touchCall(call, now)
+		call.ExpiresAt = now.Add(s.callTTL)
+		return true, nil
+	})
+	if err != nil {
+		if errors.Is(err, errInvalidPeerID) {
+			return "", call, false, err
+		}
+		return "", nil, false, err
+	}
+	return role, call, reconnected, nil
+}
+
+// IssueReconnectToken gives peerID its reconnect token; see
+// CallStore.IssueReconnectToken.
+func (s *SQLiteCallStore) IssueReconnectToken(callID, peerID string, now time.Time) (string, error) {
+	token, hash := newReconnectToken()
+	_, err := s.update(callID, now, func(call *models.CallV2) (bool, error) {
+		if err := setReconnectToken(call, peerID, hash); err != nil {
+			return false, err
+		}
+		return true, nil
+	})
+	if err != nil {
+		return "", err
+	}
+	return token, nil
+}
+
+// ReconnectWithToken is ValidatePeer for a peer identified by its reconnect
+// token.
+func (s *SQLiteCallStore) ReconnectWithToken(callID, token string, now time.Time) (peerID string, role PeerRoleV2, call *models.CallV2, reconnected bool, err error) {
+	call, err = s.update(callID, now, func(call *models.CallV2) (bool, error) {
+		var ok bool
+		peerID, ok = peerByReconnectToken(call, token)
+		if !ok {
+			return false, errInvalidReconnectToken
+		}
+		role, reconnected, _ = markPeerPresent(call, peerID)
+		touchCall(call, now)
+		call.ExpiresAt = now.Add(s.callTTL)
+		return true, nil
+	})
+	if err != nil {
+		return "", "", nil, false, err
+	}
+	return peerID, role, call, reconnected, nil
+}
+
+// ResumeCall rebuilds a call from the reconnecting peer's context; see
+// CallStore.ResumeCall.
+func (s *SQLiteCallStore) ResumeCall(callID, peerID string, role PeerRoleV2, icePolicy models.ICEPolicy, now time.Time) (*models.CallV2, error) {
+	var result *models.CallV2
+	err := s.inTx(func(tx *sqliteTx) error {
+		call, err := s.get(tx, callID)
+		if err != nil {
+			return err
+		}
+		switch {
+		case call == nil:
+			ended, err := s.recentlyEnded(tx, callID, now)
+			if err != nil {
+				return err
+			}
+			if ended {
+				return ErrCallEnded
+			}
+			call = newResumedCall(callID, now)
+		case call.Status == models.CallStatusV2Ended || callExpired(call, now, s.reconnectTTL):
+			return ErrCallEnded
+		case !call.Resumed:
+			return errInvalidPeerID
+		}
+		if !claimResumedSlot(call, peerID, role, icePolicy, now) {
+			return errInvalidPeerID
+		}
+		touchCall(call, now)
+		call.ExpiresAt = now.Add(s.callTTL)
+
+		result = call
+		return s.put(tx, call)
+	})
+	if err != nil {
+		return nil, err
+	}
+	s.changed(callID)
+	return result, nil
+}
+
+// EndCall marks the call as ended and removes it, leaving a tombstone.
+func (s *SQLiteCallStore) EndCall(callID string, reason models.CallEndReason, now time.Time) (*models.CallV2, error) {
+	var snapshot *models.CallV2
+	err := s.inTx(func(tx *sqliteTx) error {
+		call, err := s.get(tx, callID)
+		if err != nil {
+			return err
+		}
+		if call == nil {
+			return ErrCallNotFound
+		}
+		snapshot = call
+		return s.end(tx, call, reason, now)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return snapshot, nil
+}
+
+// RecentlyEnded reports whether the call ended within the tombstone window.
+func (s *SQLiteCallStore) RecentlyEnded(callID string, now time.Time) bool {
+	var ended bool
+	_ = s.inTx(func(tx *sqliteTx) error {
+		var err error
+		ended, err = s.recentlyEnded(tx, callID, now)
+		return err
+	})
+	return ended
+}
+
+// MarkPeerDisconnected flags peer presence as lost but keeps the call active to allow reconnection.
+func (s *SQLiteCallStore) MarkPeerDisconnected(callID, peerID string, now time.Time) {
+	_, _ = s.update(callID, now, func(call *models.CallV2) (bool, error) {
+		if !markPeerAbsent(call, peerID, now) {
+			return false, nil
+		}
+		touchCall(call, now)
+		return true, nil
+	})
+}
+
+// SetParticipantName sets the display name shown for peerID in call state.
+func (s *SQLiteCallStore) SetParticipantName(callID, peerID, name string, now time.Time) (*models.CallV2, error) {
+	call, err := s.update(callID, now, func(call *models.CallV2) (bool, error) {
+		if !setParticipantName(call, peerID, name) {
+			return false, errInvalidPeerID
+		}
+		touchCall(call, now)
+		return true, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return call, nil
+}
+
+// SetMediaState records whether peerID sends audio and video.
+func (s *SQLiteCallStore) SetMediaState(callID, peerID string, state models.MediaState, now time.Time) (*models.CallV2, error) {
+	call, err := s.update(callID, now, func(call *models.CallV2) (bool, error) {
+		if !setMediaState(call, peerID, state) {
+			return false, errInvalidPeerID
+		}
+		touchCall(call, now)
+		return true, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return call, nil
+}
+
+// AppendChat adds msg to the call's chat backlog.
+func (s *SQLiteCallStore) AppendChat(callID string, msg models.ChatMessageV2, now time.Time) error {
+	_, err := s.update(callID, now, func(call *models.CallV2) (bool, error) {
+		appendChat(call, msg)
+		return true, nil
+	})
+	return err
+}
+
+// AdmitPeer moves a pending guest out of the waiting room.
+func (s *SQLiteCallStore) AdmitPeer(callID, peerID string, now time.Time) (*models.CallV2, error) {
+	return s.updateWaitingRoom(callID, peerID, now, admitPeer)
+}
+
+// RejectPeer turns a pending guest away.
+func (s *SQLiteCallStore) RejectPeer(callID, peerID string, now time.Time) (*models.CallV2, error) {
+	return s.updateWaitingRoom(callID, peerID, now, rejectPeer)
+}
+
+func (s *SQLiteCallStore) updateWaitingRoom(callID, peerID string, now time.Time, fn func(call *models.CallV2, peerID string) error) (*models.CallV2, error) {
+	call, err := s.update(callID, now, func(call *models.CallV2) (bool, error) {
+		if err := fn(call, peerID); err != nil {
+			return false, err
+		}
+		touchCall(call, now)
+		return true, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return call, nil
+}
+
+// Stats returns call counters, which are kept in the database and so cover
+// earlier runs too.
+func (s *SQLiteCallStore) Stats() CallStoreStats {
+	ctx, cancel := s.context()
+	defer cancel()
+
+	var stats CallStoreStats
+	rows, err := s.db.QueryContext(ctx, `SELECT name, value FROM call_stats`)
+	if err != nil {
+		return stats
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var (
+			name  string
+			value int
+		)
+		if rows.Scan(&name, &value) != nil {
+			continue
+		}
+		switch name {
+		case "created":
+			stats.Created = value
+		case "ended":
+			stats.Ended = value
+		case "peak":
+			stats.PeakConcurrent = value
+		}
+	}
+	return stats
+}
+
+// update loads an active call, applies fn and writes the call back if fn
+// asks for it. Expired calls are ended and reported as ErrCallEnded. The call
+// is returned alongside errors from fn.
+func (s *SQLiteCallStore) update(callID string, now time.Time, fn func(call *models.CallV2) (bool, error)) (*models.CallV2, error) {
+	var (
+		result   *models.CallV2
+		fnErr    error
+		endedErr error
+		touched  bool
+	)
+	err := s.inTx(func(tx *sqliteTx) error {
+		call, err := s.get(tx, callID)
+		if err != nil {
+			return err
+		}
+		if call == nil {
+			ended, err := s.recentlyEnded(tx, callID, now)
+			if err != nil {
+				return err
+			}
+			if ended {
+				return ErrCallEnded
+			}
+			return ErrCallNotFound
+		}
+		if call.Status == models.CallStatusV2Ended || callExpired(call, now, s.reconnectTTL) {
+			// Commit the end before reporting it.
+			endedErr = ErrCallEnded
+			return s.end(tx, call, models.CallEndReasonExpired, now)
+		}
+
+		result = call
+		seq := call.Seq
+		write, err := fn(call)
+		if err != nil {
+			fnErr = err
+			return nil
+		}
+		if !write {
+			return nil
+		}
+		touched = call.Seq != seq
+		return s.put(tx, call)
+	})
+	if err != nil {
+		return nil, err
+	}
+	if endedErr != nil {
+		return nil, endedErr
+	}
+	if touched {
+		s.changed(callID)
+	}
+	return result, fnErr
+}
+
+// inTx runs fn in a transaction, committing unless fn fails.
+func (s *SQLiteCallStore) inTx(fn func(tx *sqliteTx) error) error {
+	ctx, cancel := s.context()
+	defer cancel()
+
+	sqlTx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	tx := &sqliteTx{Tx: sqlTx, ctx: ctx}
+	if err := fn(tx); err != nil {
+		_ = sqlTx.Rollback()
+		return err
+	}
+	if err := sqlTx.Commit(); err != nil {
+		return err
+	}
+
+	for _, call := range tx.ended {
+		s.emit(models.CallEventEnded, call, call.UpdatedAt)
+	}
+	return nil
+}
+
+// end marks the call ended for reason, replaces it with a tombstone and
+// counts it. Tombstones older than the window are dropped on the way.
+func (s *SQLiteCallStore) end(tx *sqliteTx, call *models.CallV2, reason models.CallEndReason, now time.Time) error {
+	wasEnded := call.Status == models.CallStatusV2Ended
+	if !wasEnded {
+		call.EndReason = reason
+	}
+
+	call.Status = models.CallStatusV2Ended
+	touchCall(call, now)
+	call.ExpiresAt = now
+	markAllAbsent(call)
+
+	if _, err := tx.ExecContext(tx.ctx, `DELETE FROM calls WHERE id = ?`, call.ID); err != nil {
+		return err
+	}
+	if _, err := tx.ExecContext(tx.ctx, `DELETE FROM ended_calls WHERE ended_at < ?`, now.Add(-s.tombstoneTTL).UnixNano()); err != nil {
+		return err
+	}
+	if _, err := tx.ExecContext(tx.ctx, `INSERT OR REPLACE INTO ended_calls (id, ended_at) VALUES (?, ?)`, call.ID, call.UpdatedAt.UnixNano()); err != nil {
+		return err
+	}
+	if wasEnded {
+		return nil
+	}
+	if err := addStat(tx, "ended", 1); err != nil {
+		return err
+	}
+	tx.ended = append(tx.ended, call)
+	return nil
+}
+
+func (s *SQLiteCallStore) get(tx *sqliteTx, callID string) (*models.CallV2, error) {
+	var payload []byte
+	err := tx.QueryRowContext(tx.ctx, `SELECT data FROM calls WHERE id = ?`, callID).Scan(&payload)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return decodeCallRecord(payload)
+}
+
+func (s *SQLiteCallStore) query(tx *sqliteTx, query string, args ...any) ([]*models.CallV2, error) {
+	rows, err := tx.QueryContext(tx.ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var calls []*models.CallV2
+	for rows.Next() {
+		var payload []byte
+		if err := rows.Scan(&payload); err != nil {
+			return nil, err
+		}
+		call, err := decodeCallRecord(payload)
+		if err != nil {
+			return nil, err
+		}
+		calls = append(calls, call)
+	}
+	return calls, rows.Err()
+}
+
+func (s *SQLiteCallStore) put(tx *sqliteTx, call *models.CallV2) error {
+	payload, err := encodeCallRecord(call)
+	if err != nil {
+		return err
+	}
+	_, err = tx.ExecContext(tx.ctx, `INSERT INTO calls (id, status, created_at, data) VALUES (?1, ?2, ?3, ?4)
+		ON CONFLICT (id) DO UPDATE SET status = ?2, data = ?4`,
+		call.ID, string(call.Status), call.CreatedAt.UnixNano(), payload)
+	return err
+}
+
+func (s *SQLiteCallStore) recentlyEnded(tx *sqliteTx, callID string, now time.Time) (bool, error) {
+	var endedAt int64
+	err := tx.QueryRowContext(tx.ctx, `SELECT ended_at FROM ended_calls WHERE id = ?`, callID).Scan(&endedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return now.Sub(time.Unix(0, endedAt)) <= s.tombstoneTTL, nil
+}
+
+func addStat(tx *sqliteTx, name string, delta int) error {
+	_, err := tx.ExecContext(tx.ctx, `INSERT INTO call_stats (name, value) VALUES (?1, ?2)
+		ON CONFLICT (name) DO UPDATE SET value = value + ?2`, name, delta)
+	return err
+}
+
+func (s *SQLiteCallStore) emit(eventType models.CallEventType, call *models.CallV2, now time.Time) {
+	s.mu.Lock()
+	sink := s.events
+	s.mu.Unlock()
+	if sink == nil {
+		return
+	}
+
+	event := models.CallEvent{Type: eventType, CallID: call.ID, At: now}
+	if eventType == models.CallEventEnded {
+		event.Duration = now.Sub(call.CreatedAt)
+	}
+	sink.Record(event)
+}
+
+// changed reports a stored state change to the change sink.
+func (s *SQLiteCallStore) changed(callID string) {
+	s.mu.Lock()
+	sink := s.changes
+	s.mu.Unlock()
+	if sink != nil {
+		sink.CallChanged(callID)
+	}
+}
+
+func (s *SQLiteCallStore) context() (context.Context, context.CancelFunc) {
+	return context.WithTimeout(context.Background(), s.timeout)
+}
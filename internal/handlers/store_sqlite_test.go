@@ -0,0 +1,207 @@
+package handlers
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/tariel-x/gocall/internal/models"
+)
+
+func newTestSQLiteStore(t *testing.T, path string, opts CallStoreOptions) *SQLiteCallStore {
+	t.Helper()
+	if path == "" {
+		path = filepath.Join(t.TempDir(), "calls.db")
+	}
+	store, err := NewSQLiteCallStore(path, opts)
+	if err != nil {
+		t.Fatalf("open store: %v", err)
+	}
+	t.Cleanup(func() { store.Close() })
+	return store
+}
+
+func TestSQLiteStoreSurvivesRestart(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "calls.db")
+	base := time.Unix(1_700_000_000, 0)
+
+	before := newTestSQLiteStore(t, path, CallStoreOptions{})
+	call, err := before.CreateCall(base, CreateCallOptions{ICEPolicy: models.ICEPolicyRelay})
+	if err != nil {
+		t.Fatalf("create call failed: %v", err)
+	}
+	hostID, _, err := before.EnsureHostPeerID(call.ID, base)
+	if err != nil {
+		t.Fatalf("ensure host failed: %v", err)
+	}
+	guestID, _, err := before.Join(call.ID, base.Add(time.Second))
+	if err != nil {
+		t.Fatalf("join failed: %v", err)
+	}
+	if err := before.AppendChat(call.ID, models.ChatMessageV2{From: hostID, Text: "hi"}, base.Add(time.Second)); err != nil {
+		t.Fatalf("append chat failed: %v", err)
+	}
+	ended, _ := before.CreateCall(base, CreateCallOptions{})
+	if _, err := before.EndCall(ended.ID, models.CallEndReasonLeft, base.Add(time.Second)); err != nil {
+		t.Fatalf("end call failed: %v", err)
+	}
+	if err := before.Close(); err != nil {
+		t.Fatalf("close: %v", err)
+	}
+
+	after := newTestSQLiteStore(t, path, CallStoreOptions{})
+	now := base.Add(time.Minute)
+
+	// Nobody is connected to a freshly started server.
+	reopened, err := after.GetByID(call.ID, now)
+	if err != nil {
+		t.Fatalf("get after restart: %v", err)
+	}
+	if len(reopened.Participants) != 2 {
+		t.Fatalf("participants after restart = %+v", reopened.Participants)
+	}
+	for _, p := range reopened.Participants {
+		if p.IsPresent || p.DisconnectedAt.IsZero() {
+			t.Fatalf("participant %s still present after restart: %+v", p.PeerID, p)
+		}
+	}
+
+	if role, _, _, err := after.ValidatePeer(call.ID, hostID, now); err != nil || role != PeerRoleV2Host {
+		t.Fatalf("host after restart = %s, %v", role, err)
+	}
+	role, restored, _, err := after.ValidatePeer(call.ID, guestID, now)
+	if err != nil || role != PeerRoleV2Guest {
+		t.Fatalf("guest after restart = %s, %v", role, err)
+	}
+	if restored.Status != models.CallStatusV2Active || restored.ICEPolicy != models.ICEPolicyRelay || len(restored.Chat) != 1 {
+		t.Fatalf("call not restored: %+v", restored)
+	}
+	if _, err := after.GetByID(ended.ID, now); !errors.Is(err, ErrCallEnded) {
+		t.Fatalf("ended call after restart: got %v, want ErrCallEnded", err)
+	}
+	if stats := after.Stats(); stats.Created != 2 || stats.Ended != 1 || stats.PeakConcurrent != 2 {
+		t.Fatalf("stats after restart = %+v", stats)
+	}
+}
+
+func TestSQLiteStoreListByStatus(t *testing.T) {
+	store := newTestSQLiteStore(t, "", CallStoreOptions{TTL: time.Minute})
+	base := time.Unix(1_700_200_000, 0)
+
+	callA, _ := store.CreateCall(base, CreateCallOptions{})
+	callB, _ := store.CreateCall(base.Add(time.Second), CreateCallOptions{})
+	if _, _, err := store.Join(callA.ID, base.Add(2*time.Second)); err != nil {
+		t.Fatalf("join callA failed: %v", err)
+	}
+
+	waiting, err := store.ListByStatus(models.CallStatusV2Waiting, 0, base.Add(3*time.Second))
+	if err != nil || len(waiting) != 1 || waiting[0].ID != callB.ID {
+		t.Fatalf("expected only callB waiting, got %+v, %v", waiting, err)
+	}
+	active, err := store.ListByStatus(models.CallStatusV2Active, 0, base.Add(3*time.Second))
+	if err != nil || len(active) != 1 || active[0].ID != callA.ID {
+		t.Fatalf("expected callA active, got %+v, %v", active, err)
+	}
+
+	// callB expires first; listing ends it.
+	waiting, _ = store.ListByStatus(models.CallStatusV2Waiting, 0, base.Add(62*time.Second))
+	if len(waiting) != 0 || !store.RecentlyEnded(callB.ID, base.Add(62*time.Second)) {
+		t.Fatalf("expired call still listed: %+v", waiting)
+	}
+}
+
+func TestSQLiteStoreEndLeavesTombstone(t *testing.T) {
+	store := newTestSQLiteStore(t, "", CallStoreOptions{TombstoneTTL: time.Minute})
+	base := time.Unix(1_700_100_000, 0)
+
+	call, _ := store.CreateCall(base, CreateCallOptions{})
+	ended, err := store.EndCall(call.ID, models.CallEndReasonHostEnded, base)
+	if err != nil || ended.EndReason != models.CallEndReasonHostEnded {
+		t.Fatalf("end call = %+v, %v", ended, err)
+	}
+	if _, err := store.GetByID(call.ID, base.Add(time.Second)); !errors.Is(err, ErrCallEnded) {
+		t.Fatalf("expected ErrCallEnded, got %v", err)
+	}
+	if !store.RecentlyEnded(call.ID, base.Add(50*time.Second)) {
+		t.Fatalf("expected call to be recently ended within the window")
+	}
+	if _, err := store.GetByID(call.ID, base.Add(61*time.Second)); !errors.Is(err, ErrCallNotFound) {
+		t.Fatalf("expected ErrCallNotFound after the window, got %v", err)
+	}
+	if stats := store.Stats(); stats.Ended != 1 {
+		t.Fatalf("expected one ended call, got %+v", stats)
+	}
+}
+
+func TestSQLiteStoreExpiredCallEnds(t *testing.T) {
+	store := newTestSQLiteStore(t, "", CallStoreOptions{TTL: time.Minute})
+	base := time.Unix(1_700_300_000, 0)
+
+	call, err := store.CreateCall(base, CreateCallOptions{})
+	if err != nil {
+		t.Fatalf("create call failed: %v", err)
+	}
+	if want := base.Add(time.Minute); !call.ExpiresAt.Equal(want) {
+		t.Fatalf("expires at %v, want %v", call.ExpiresAt, want)
+	}
+	if _, err := store.GetByID(call.ID, base.Add(30*time.Second)); err != nil {
+		t.Fatalf("call should still be live: %v", err)
+	}
+	if _, err := store.GetByID(call.ID, base.Add(61*time.Second)); !errors.Is(err, ErrCallEnded) {
+		t.Fatalf("expected ErrCallEnded after TTL, got %v", err)
+	}
+	if stats := store.Stats(); stats.Ended != 1 {
+		t.Fatalf("expected expiry to count as ended, got %+v", stats)
+	}
+}
+
+func TestSQLiteStoreResumeCall(t *testing.T) {
+	store := newTestSQLiteStore(t, "", CallStoreOptions{})
+	base := time.Unix(1_700_300_000, 0)
+
+	if _, err := store.ResumeCall("lost-call", "host-peer", PeerRoleV2Host, "", base); err != nil {
+		t.Fatalf("host resume failed: %v", err)
+	}
+	call, err := store.ResumeCall("lost-call", "guest-peer", PeerRoleV2Guest, "", base.Add(time.Second))
+	if err != nil {
+		t.Fatalf("guest resume failed: %v", err)
+	}
+	if call.Status != models.CallStatusV2Active {
+		t.Fatalf("expected resumed call to be active, got %s", call.Status)
+	}
+	if _, err := store.ResumeCall("lost-call", "intruder", PeerRoleV2Guest, "", base.Add(2*time.Second)); !errors.Is(err, errInvalidPeerID) {
+		t.Fatalf("expected taken slot to be rejected, got %v", err)
+	}
+	if role, _, _, err := store.ValidatePeer("lost-call", "guest-peer", base.Add(3*time.Second)); err != nil || role != PeerRoleV2Guest {
+		t.Fatalf("guest validation after resume = %s, %v", role, err)
+	}
+}
+
+func TestSQLiteStoreMaxCalls(t *testing.T) {
+	store := newTestSQLiteStore(t, "", CallStoreOptions{MaxCalls: 2, TTL: time.Minute})
+	now := time.Unix(1_700_600_000, 0)
+
+	first, err := store.CreateCall(now, CreateCallOptions{})
+	if err != nil {
+		t.Fatalf("first create failed: %v", err)
+	}
+	if _, err := store.CreateCall(now, CreateCallOptions{}); err != nil {
+		t.Fatalf("second create failed: %v", err)
+	}
+	if _, err := store.CreateCall(now, CreateCallOptions{}); !errors.Is(err, ErrCapacityReached) {
+		t.Fatalf("create over the limit: got %v, want ErrCapacityReached", err)
+	}
+
+	if _, err := store.EndCall(first.ID, models.CallEndReasonLeft, now); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := store.CreateCall(now, CreateCallOptions{}); err != nil {
+		t.Fatalf("create after ending a call failed: %v", err)
+	}
+
+	// Expired calls free their slots once the limit is hit.
+	if _, err := store.CreateCall(now.Add(2*time.Minute), CreateCallOptions{}); err != nil {
+		t.Fatalf("create after expiry failed: %v", err)
+	}
+}
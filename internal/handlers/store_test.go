@@ -12,11 +12,11 @@ func TestCreateCallGeneratesUniqueIDs(t *testing.T) {
 	store := NewCallStore()
 	base := time.Unix(1_700_000_000, 0)
 
-	first, err := store.CreateCall(base)
+	first, err := store.CreateCall(base, CreateCallOptions{})
 	if err != nil {
 		t.Fatalf("first create call failed: %v", err)
 	}
-	second, err := store.CreateCall(base.Add(10 * time.Second))
+	second, err := store.CreateCall(base.Add(10*time.Second), CreateCallOptions{})
 	if err != nil {
 		t.Fatalf("second create call failed: %v", err)
 	}
@@ -30,8 +30,8 @@ func TestJoinIndependentCalls(t *testing.T) {
 	store := NewCallStore()
 	base := time.Unix(1_700_100_000, 0)
 
-	callA, _ := store.CreateCall(base)
-	callB, _ := store.CreateCall(base.Add(time.Second))
+	callA, _ := store.CreateCall(base, CreateCallOptions{})
+	callB, _ := store.CreateCall(base.Add(time.Second), CreateCallOptions{})
 
 	guestA, callRefA, err := store.Join(callA.ID, base.Add(2*time.Second))
 	if err != nil {
@@ -60,8 +60,8 @@ func TestListByStatusTracksUpdates(t *testing.T) {
 	store := NewCallStore()
 	base := time.Unix(1_700_200_000, 0)
 
-	callA, _ := store.CreateCall(base)
-	callB, _ := store.CreateCall(base.Add(time.Second))
+	callA, _ := store.CreateCall(base, CreateCallOptions{})
+	callB, _ := store.CreateCall(base.Add(time.Second), CreateCallOptions{})
 
 	waiting, err := store.ListByStatus(models.CallStatusV2Waiting, 0, base.Add(2*time.Second))
 	if err != nil {
@@ -96,20 +96,20 @@ func TestEndAndExpiryRemoveCall(t *testing.T) {
 	store := NewCallStore()
 	base := time.Unix(1_700_300_000, 0)
 
-	call, _ := store.CreateCall(base)
+	call, _ := store.CreateCall(base, CreateCallOptions{})
 
-	// Manual end removes the call
-	if _, err := store.EndCall(call.ID, base.Add(time.Second)); err != nil {
+	// Manual end removes the call, leaving a tombstone
+	if _, err := store.EndCall(call.ID, models.CallEndReasonLeft, base.Add(time.Second)); err != nil {
 		t.Fatalf("end call failed: %v", err)
 	}
-	if _, err := store.GetByID(call.ID, base.Add(2*time.Second)); !errors.Is(err, ErrCallNotFound) {
-		t.Fatalf("expected ErrCallNotFound after end, got %v", err)
+	if _, err := store.GetByID(call.ID, base.Add(2*time.Second)); !errors.Is(err, ErrCallEnded) {
+		t.Fatalf("expected ErrCallEnded after end, got %v", err)
 	}
 
 	// Expiry after TTL
 	store.callTTL = time.Millisecond
 	call2Created := base.Add(3 * time.Second)
-	call2, _ := store.CreateCall(call2Created)
+	call2, _ := store.CreateCall(call2Created, CreateCallOptions{})
 	beforeExpiry := call2Created.Add(500 * time.Microsecond)
 	if _, err := store.GetByID(call2.ID, beforeExpiry); err != nil {
 		t.Fatalf("call2 should be available before TTL, got %v", err)
@@ -119,3 +119,314 @@ func TestEndAndExpiryRemoveCall(t *testing.T) {
 		t.Fatalf("expected ErrCallEnded after ttl, got %v", err)
 	}
 }
+
+func TestSeqIncreasesOnStateChanges(t *testing.T) {
+	store := NewCallStore()
+	base := time.Unix(1_700_400_000, 0)
+
+	call, _ := store.CreateCall(base, CreateCallOptions{})
+	seq := func() uint64 {
+		t.Helper()
+		current, err := store.GetByID(call.ID, base.Add(5*time.Second))
+		if err != nil {
+			t.Fatalf("get call failed: %v", err)
+		}
+		return current.Seq
+	}
+	if _, _, err := store.EnsureHostPeerID(call.ID, base.Add(time.Second)); err != nil {
+		t.Fatalf("ensure host peer failed: %v", err)
+	}
+	afterHost := seq()
+
+	guestID, _, err := store.Join(call.ID, base.Add(2*time.Second))
+	if err != nil {
+		t.Fatalf("join failed: %v", err)
+	}
+	afterJoin := seq()
+	if afterJoin <= afterHost {
+		t.Fatalf("expected seq to increase on join, got %d -> %d", afterHost, afterJoin)
+	}
+
+	store.MarkPeerDisconnected(call.ID, guestID, base.Add(3*time.Second))
+	afterDisconnect := seq()
+	if afterDisconnect <= afterJoin {
+		t.Fatalf("expected seq to increase on disconnect, got %d -> %d", afterJoin, afterDisconnect)
+	}
+
+	if _, _, _, err := store.ValidatePeer(call.ID, guestID, base.Add(4*time.Second)); err != nil {
+		t.Fatalf("reconnect failed: %v", err)
+	}
+	if afterReconnect := seq(); afterReconnect <= afterDisconnect {
+		t.Fatalf("expected seq to increase on reconnect, got %d -> %d", afterDisconnect, afterReconnect)
+	}
+}
+
+func TestRecentlyEndedTombstone(t *testing.T) {
+	store := NewCallStore()
+	base := time.Unix(1_700_700_000, 0)
+
+	call, _ := store.CreateCall(base, CreateCallOptions{})
+	if store.RecentlyEnded(call.ID, base) {
+		t.Fatalf("active call must not be reported as ended")
+	}
+	if _, err := store.EndCall(call.ID, models.CallEndReasonLeft, base.Add(time.Second)); err != nil {
+		t.Fatalf("end call failed: %v", err)
+	}
+
+	if !store.RecentlyEnded(call.ID, base.Add(time.Minute)) {
+		t.Fatalf("expected tombstone right after end")
+	}
+	if store.RecentlyEnded(call.ID, base.Add(time.Second+store.tombstoneTTL+time.Second)) {
+		t.Fatalf("expected tombstone to lapse after the window")
+	}
+	if store.RecentlyEnded("never-existed", base) {
+		t.Fatalf("unknown call must not be reported as ended")
+	}
+}
+
+func TestCallStoreCustomTTL(t *testing.T) {
+	store := NewCallStoreWithOptions(CallStoreOptions{TTL: time.Minute})
+	base := time.Unix(1_700_300_000, 0)
+
+	call, err := store.CreateCall(base, CreateCallOptions{})
+	if err != nil {
+		t.Fatalf("create call failed: %v", err)
+	}
+	if want := base.Add(time.Minute); !call.ExpiresAt.Equal(want) {
+		t.Fatalf("expires at %v, want %v", call.ExpiresAt, want)
+	}
+	if _, err := store.GetByID(call.ID, base.Add(30*time.Second)); err != nil {
+		t.Fatalf("call should still be live: %v", err)
+	}
+	if _, err := store.GetByID(call.ID, base.Add(61*time.Second)); !errors.Is(err, ErrCallEnded) {
+		t.Fatalf("expected ErrCallEnded after TTL, got %v", err)
+	}
+}
+
+func TestCallStoreCleanupInterval(t *testing.T) {
+	store := NewCallStoreWithOptions(CallStoreOptions{TTL: time.Minute, CleanupInterval: 10 * time.Millisecond})
+
+	// Created long enough ago that the sweep, which uses the wall clock,
+	// finds it expired.
+	if _, err := store.CreateCall(time.Now().Add(-time.Hour), CreateCallOptions{}); err != nil {
+		t.Fatalf("create call failed: %v", err)
+	}
+
+	deadline := time.Now().Add(time.Second)
+	for {
+		store.mu.Lock()
+		remaining := len(store.calls)
+		store.mu.Unlock()
+		if remaining == 0 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("expired call was not swept")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	if ended := store.Stats().Ended; ended != 1 {
+		t.Fatalf("ended = %d, want 1", ended)
+	}
+}
+
+func TestGroupCallJoinAndValidate(t *testing.T) {
+	store := NewCallStore()
+	base := time.Unix(1_700_500_000, 0)
+
+	call, _ := store.CreateCall(base, CreateCallOptions{MaxParticipants: 3})
+	hostID, _, err := store.EnsureHostPeerID(call.ID, base)
+	if err != nil {
+		t.Fatalf("ensure host failed: %v", err)
+	}
+	first, _, err := store.Join(call.ID, base.Add(time.Second))
+	if err != nil {
+		t.Fatalf("first join failed: %v", err)
+	}
+	second, joined, err := store.Join(call.ID, base.Add(2*time.Second))
+	if err != nil {
+		t.Fatalf("second join failed: %v", err)
+	}
+	if joined.ParticipantsCount() != 3 || joined.Status != models.CallStatusV2Active {
+		t.Fatalf("expected 3 present participants in an active call, got %d (%s)", joined.ParticipantsCount(), joined.Status)
+	}
+	if _, _, err := store.Join(call.ID, base.Add(3*time.Second)); !errors.Is(err, ErrCallFull) {
+		t.Fatalf("expected ErrCallFull for a fourth peer, got %v", err)
+	}
+
+	for peerID, want := range map[string]PeerRoleV2{hostID: PeerRoleV2Host, first: PeerRoleV2Guest, second: PeerRoleV2Guest} {
+		if role, _, _, err := store.ValidatePeer(call.ID, peerID, base.Add(4*time.Second)); err != nil || role != want {
+			t.Fatalf("ValidatePeer(%s) = %s, %v; want %s", peerID, role, err, want)
+		}
+	}
+
+	// A newcomer takes the place of a guest who dropped out.
+	store.MarkPeerDisconnected(call.ID, first, base.Add(5*time.Second))
+	third, _, err := store.Join(call.ID, base.Add(6*time.Second))
+	if err != nil {
+		t.Fatalf("join after a guest left failed: %v", err)
+	}
+	if _, _, _, err := store.ValidatePeer(call.ID, first, base.Add(7*time.Second)); !errors.Is(err, errInvalidPeerID) {
+		t.Fatalf("expected the replaced guest to be rejected, got %v", err)
+	}
+	if _, _, _, err := store.ValidatePeer(call.ID, third, base.Add(7*time.Second)); err != nil {
+		t.Fatalf("newcomer validation failed: %v", err)
+	}
+}
+
+func TestTwoPartyCallIsDefault(t *testing.T) {
+	store := NewCallStore()
+	base := time.Unix(1_700_600_000, 0)
+
+	call, _ := store.CreateCall(base, CreateCallOptions{})
+	if call.Capacity() != models.DefaultMaxParticipants {
+		t.Fatalf("capacity = %d, want %d", call.Capacity(), models.DefaultMaxParticipants)
+	}
+	if _, _, err := store.Join(call.ID, base.Add(time.Second)); err != nil {
+		t.Fatalf("join failed: %v", err)
+	}
+	if _, _, err := store.Join(call.ID, base.Add(2*time.Second)); !errors.Is(err, ErrCallFull) {
+		t.Fatalf("expected ErrCallFull, got %v", err)
+	}
+}
+
+func TestCallPINProtection(t *testing.T) {
+	store := NewCallStore()
+	base := time.Unix(1_700_800_000, 0)
+
+	hash, err := hashCallPIN("4921")
+	if err != nil {
+		t.Fatalf("hash PIN: %v", err)
+	}
+	protected, _ := store.CreateCall(base, CreateCallOptions{PINHash: hash})
+	open, _ := store.CreateCall(base, CreateCallOptions{})
+
+	call, err := store.GetByID(protected.ID, base)
+	if err != nil || !call.RequiresPIN() {
+		t.Fatalf("expected a PIN-protected call, got %v", err)
+	}
+	if err := verifyCallPIN(call, "4921"); err != nil {
+		t.Fatalf("correct PIN rejected: %v", err)
+	}
+	for _, pin := range []string{"", "1234", "49211"} {
+		if err := verifyCallPIN(call, pin); !errors.Is(err, ErrCallUnauthorized) {
+			t.Fatalf("PIN %q: expected ErrCallUnauthorized, got %v", pin, err)
+		}
+	}
+
+	call, _ = store.GetByID(open.ID, base)
+	if call.RequiresPIN() || verifyCallPIN(call, "anything") != nil {
+		t.Fatalf("call without PIN should accept anyone")
+	}
+}
+
+func TestWaitingRoomAdmission(t *testing.T) {
+	store := NewCallStore()
+	now := time.Unix(1_700_500_000, 0)
+
+	call, _ := store.CreateCall(now, CreateCallOptions{WaitingRoom: true, MaxParticipants: 3})
+	first, joined, err := store.Join(call.ID, now)
+	if err != nil {
+		t.Fatalf("join failed: %v", err)
+	}
+	if !joined.Participants[first].Pending || joined.Status != models.CallStatusV2Waiting {
+		t.Fatalf("guest should be pending in a waiting call, got %+v status %s", joined.Participants[first], joined.Status)
+	}
+	second, _, _ := store.Join(call.ID, now)
+
+	admitted, err := store.AdmitPeer(call.ID, first, now)
+	if err != nil {
+		t.Fatalf("admit failed: %v", err)
+	}
+	if admitted.Participants[first].Pending || admitted.Status != models.CallStatusV2Active {
+		t.Fatalf("admitted guest should activate the call, got %+v status %s", admitted.Participants[first], admitted.Status)
+	}
+	if _, err := store.AdmitPeer(call.ID, first, now); !errors.Is(err, ErrPeerNotPending) {
+		t.Fatalf("second admit: got %v, want ErrPeerNotPending", err)
+	}
+
+	rejected, err := store.RejectPeer(call.ID, second, now)
+	if err != nil {
+		t.Fatalf("reject failed: %v", err)
+	}
+	if _, ok := rejected.Participants[second]; ok {
+		t.Fatalf("rejected guest should be removed")
+	}
+	if _, _, _, err := store.ValidatePeer(call.ID, second, now); !errors.Is(err, errInvalidPeerID) {
+		t.Fatalf("rejected guest reconnect: got %v", err)
+	}
+	if _, err := store.RejectPeer(call.ID, call.HostPeerID, now); !errors.Is(err, ErrPeerNotPending) {
+		t.Fatalf("rejecting the host: got %v", err)
+	}
+}
+
+func TestCallStoreMaxCalls(t *testing.T) {
+	store := NewCallStoreWithOptions(CallStoreOptions{MaxCalls: 2, TTL: time.Minute})
+	now := time.Unix(1_700_600_000, 0)
+
+	first, err := store.CreateCall(now, CreateCallOptions{})
+	if err != nil {
+		t.Fatalf("first create failed: %v", err)
+	}
+	if _, err := store.CreateCall(now, CreateCallOptions{}); err != nil {
+		t.Fatalf("second create failed: %v", err)
+	}
+	if _, err := store.CreateCall(now, CreateCallOptions{}); !errors.Is(err, ErrCapacityReached) {
+		t.Fatalf("create over the limit: got %v, want ErrCapacityReached", err)
+	}
+
+	if _, err := store.EndCall(first.ID, models.CallEndReasonLeft, now); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := store.CreateCall(now, CreateCallOptions{}); err != nil {
+		t.Fatalf("create after ending a call failed: %v", err)
+	}
+
+	// Expired calls free their slots even before the background sweep.
+	if _, err := store.CreateCall(now.Add(2*time.Minute), CreateCallOptions{}); err != nil {
+		t.Fatalf("create after expiry failed: %v", err)
+	}
+}
+
+func TestEndReasons(t *testing.T) {
+	store := NewCallStoreWithOptions(CallStoreOptions{TTL: time.Minute})
+	now := time.Unix(1_700_700_000, 0)
+
+	for _, reason := range []models.CallEndReason{models.CallEndReasonLeft, models.CallEndReasonHostEnded} {
+		call, _ := store.CreateCall(now, CreateCallOptions{})
+		ended, err := store.EndCall(call.ID, reason, now)
+		if err != nil || ended.EndReason != reason {
+			t.Fatalf("EndCall(%s) = %v, %v", reason, ended.EndReason, err)
+		}
+	}
+
+	// Expiry noticed on access and by the background sweep.
+	onAccess, _ := store.CreateCall(now, CreateCallOptions{})
+	swept, _ := store.CreateCall(now, CreateCallOptions{})
+	// Getters return copies; keep the stored calls to see how they ended.
+	store.mu.Lock()
+	stored := []*models.CallV2{store.calls[onAccess.ID], store.calls[swept.ID]}
+	store.mu.Unlock()
+	later := now.Add(2 * time.Minute)
+	if _, err := store.GetByID(onAccess.ID, later); !errors.Is(err, ErrCallEnded) {
+		t.Fatalf("expected ErrCallEnded, got %v", err)
+	}
+	store.mu.Lock()
+	store.cleanupExpiredLocked(later)
+	store.mu.Unlock()
+	for _, call := range stored {
+		if call.EndReason != models.CallEndReasonExpired {
+			t.Fatalf("expired call ended with %q", call.EndReason)
+		}
+	}
+
+	// An ended call keeps its first reason.
+	call, _ := store.CreateCall(later, CreateCallOptions{})
+	store.mu.Lock()
+	store.markEndedLocked(call, models.CallEndReasonHostEnded, later)
+	store.markEndedLocked(call, models.CallEndReasonExpired, later)
+	store.mu.Unlock()
+	if call.EndReason != models.CallEndReasonHostEnded {
+		t.Fatalf("reason overwritten with %q", call.EndReason)
+	}
+}
@@ -1,9 +1,11 @@
 package handlers
 
 import (
-	"fmt"
+	"context"
 	"log"
+	"net"
 	"net/http"
+	"strconv"
 	"strings"
 
 	"github.com/gin-gonic/gin"
@@ -19,40 +21,123 @@ type PushSubscribeRequest struct {
 	Keys     PushSubscribeKeys `json:"keys" binding:"required"`
 }
 
-func (h *Handlers) GetTURNConfig(c *gin.Context) {
-	// Get TURN server configuration - use only our TURN server
-	// TURN servers also support STUN, so we don't need separate STUN servers
-	// Note: We use "turn:" (not "turns:") because our TURN server is UDP-only
-	// TURNS (TLS) requires TCP/TLS, but we're using UDP which doesn't support TLS
-	// Media encryption is handled by DTLS-SRTP in WebRTC
+// builtinTURNURLs lists the STUN and TURN URLs of the built-in server as
+// reached through host. With a dual-stack relay the IPv6 address is listed
+// too, so IPv6-only clients can reach it even when host has no AAAA record.
+func (h *Handlers) builtinTURNURLs(host string, relayIPv6 net.IP) (stunURLs, turnURLs []string) {
+	hosts := []string{host}
+	if relayIPv6 != nil && !relayIPv6.Equal(net.ParseIP(host)) {
+		hosts = append(hosts, relayIPv6.String())
+	}
 
-	host := c.Request.Host
-	if idx := strings.Index(host, ":"); idx != -1 {
-		host = host[:idx]
+	for i, host := range hosts {
+		// TURN server URL - format: turn:host:port
+		// Also include STUN URL (TURN servers support STUN protocol)
+		addr := net.JoinHostPort(host, strconv.Itoa(h.config.TURNPort))
+		stunURLs = append(stunURLs, "stun:"+addr)
+		turnURLs = append(turnURLs, "turn:"+addr)
+		if h.config.TURNTCPEnabled {
+			turnURLs = append(turnURLs, "turn:"+addr+"?transport=tcp")
+		}
+		// TURNS needs the certificate's host name, not the bare relay IP.
+		if h.config.TURNTLSPort > 0 && i == 0 {
+			turnURLs = append(turnURLs, "turns:"+net.JoinHostPort(host, strconv.Itoa(h.config.TURNTLSPort))+"?transport=tcp")
+		}
 	}
+	return stunURLs, turnURLs
+}
 
-	// Get credentials from TURN server
-	creds := h.turnServer.GetCredentials()
+// requestHost is the host name the client used to reach the server, which is
+// also how it reaches the built-in TURN server.
+func requestHost(r *http.Request) string {
+	host := r.Host
+	if hostname, _, err := net.SplitHostPort(host); err == nil {
+		host = hostname
+	}
+	return strings.TrimSuffix(strings.TrimPrefix(host, "["), "]")
+}
 
-	// TURN server URL - format: turn:host:port
-	// Also include STUN URL (TURN servers support STUN protocol)
-	turnURL := fmt.Sprintf("turn:%s:%d", host, h.config.TURNPort)
-	stunURL := fmt.Sprintf("stun:%s:%d", host, h.config.TURNPort)
+// buildICEServers lists the ICE servers for a client that reached the server
+// through host: the built-in TURN server plus any configured external
+// servers. TURN servers also support STUN, so we don't need separate STUN
+// servers for the built-in one.
+//
+// Media encryption is handled by DTLS-SRTP in WebRTC either way; the TCP
+// and TURNS URLs help clients on networks that block UDP or non-TLS traffic.
+func (h *Handlers) buildICEServers(ctx context.Context, host string) []map[string]interface{} {
+	var provided []map[string]interface{}
+	if h.iceProvider != nil {
+		servers, err := h.iceProvider.Servers(ctx, h.nowFn())
+		if err != nil {
+			log.Printf("ICE provider unavailable, using built-in TURN: %v", err)
+		} else {
+			provided = servers
+		}
+	}
 
-	iceServers := []map[string]interface{}{
-		{
-			"urls": stunURL,
-		},
-		{
-			"urls":       turnURL,
-			"username":   creds.Username,
-			"credential": creds.Password,
-		},
+	var iceServers []map[string]interface{}
+	// Without ICE_PROVIDER_MERGE the provider's servers stand in for the
+	// built-in TURN server; EXTERNAL_ICE_SERVERS are kept either way.
+	if h.turnServer != nil && (provided == nil || h.config.ICEProviderMerge) {
+		// Fresh short-lived credentials for every request
+		creds := h.turnServer.GenerateEphemeralCredentials(h.config.TURNCredentialTTL)
+
+		_, relayIPv6 := h.turnServer.RelayIPs()
+		stunURLs, turnURLs := h.builtinTURNURLs(host, relayIPv6)
+
+		iceServers = append(iceServers,
+			map[string]interface{}{
+				"urls": stunURLs,
+			},
+			map[string]interface{}{
+				"urls":       turnURLs,
+				"username":   creds.Username,
+				"credential": creds.Password,
+			},
+		)
 	}
 
+	// Statically configured servers (managed STUN/TURN providers)
+	for _, server := range h.config.ExternalICEServers {
+		entry := map[string]interface{}{"urls": server.URLs}
+		if server.Username != "" {
+			entry["username"] = server.Username
+			entry["credential"] = server.Credential
+		}
+		iceServers = append(iceServers, entry)
+	}
+
+	return append(iceServers, provided...)
+}
+
+func (h *Handlers) GetTURNConfig(c *gin.Context) {
+	host := requestHost(c.Request)
+	iceServers := h.buildICEServers(c.Request.Context(), host)
+
 	log.Printf("TURN config requested - returning %d ICE servers for host %s", len(iceServers), host)
 
-	c.JSON(http.StatusOK, gin.H{
+	resp := gin.H{
 		"iceServers": iceServers,
-	})
+	}
+
+	// Call-scoped config also carries the call's ICE transport policy.
+	if callID := c.Query("call_id"); callID != "" {
+		call, err := h.calls.GetByID(callID, h.nowFn())
+		if err != nil {
+			h.writeWSCallError(c, err)
+			return
+		}
+		resp["iceTransportPolicy"] = call.ICEPolicy
+	}
+
+	c.JSON(http.StatusOK, resp)
+}
+
+// GetTURNStats reports relay usage of the built-in TURN server.
+func (h *Handlers) GetTURNStats(c *gin.Context) {
+	if h.turnServer == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "built-in TURN server is disabled"})
+		return
+	}
+	c.JSON(http.StatusOK, h.turnServer.Stats())
 }
@@ -0,0 +1,42 @@
+package handlers
+
+import (
+	"net"
+	"reflect"
+	"testing"
+
+	"github.com/tariel-x/gocall/internal/config"
+)
+
+func TestBuiltinTURNURLs(t *testing.T) {
+	h := newTestHandlers(t, &config.Config{TURNPort: 3478, TURNTCPEnabled: true, TURNTLSPort: 5349})
+
+	stun, turn := h.builtinTURNURLs("call.example.test", nil)
+	if want := []string{"stun:call.example.test:3478"}; !reflect.DeepEqual(stun, want) {
+		t.Fatalf("stun = %v, want %v", stun, want)
+	}
+	want := []string{
+		"turn:call.example.test:3478",
+		"turn:call.example.test:3478?transport=tcp",
+		"turns:call.example.test:5349?transport=tcp",
+	}
+	if !reflect.DeepEqual(turn, want) {
+		t.Fatalf("turn = %v, want %v", turn, want)
+	}
+
+	// Dual-stack adds the bracketed IPv6 relay address, without TURNS.
+	stun, turn = h.builtinTURNURLs("call.example.test", net.ParseIP("2001:db8::1"))
+	if want := []string{"stun:call.example.test:3478", "stun:[2001:db8::1]:3478"}; !reflect.DeepEqual(stun, want) {
+		t.Fatalf("dual-stack stun = %v, want %v", stun, want)
+	}
+	want = append(want, "turn:[2001:db8::1]:3478", "turn:[2001:db8::1]:3478?transport=tcp")
+	if !reflect.DeepEqual(turn, want) {
+		t.Fatalf("dual-stack turn = %v, want %v", turn, want)
+	}
+
+	// An IPv6 request host equal to the relay address isn't listed twice.
+	stun, _ = h.builtinTURNURLs("2001:db8::1", net.ParseIP("2001:db8::1"))
+	if want := []string{"stun:[2001:db8::1]:3478"}; !reflect.DeepEqual(stun, want) {
+		t.Fatalf("IPv6 host stun = %v, want %v", stun, want)
+	}
+}
@@ -0,0 +1,101 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"reflect"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/go-playground/validator/v10"
+)
+
+// fieldError describes one invalid field of a request body.
+type fieldError struct {
+	Code    string `json:"code"`
+	Field   string `json:"field,omitempty"`
+	Message string `json:"message"`
+}
+
+// writeBindingError responds with 400 and a list of invalid fields of req.
+func writeBindingError(c *gin.Context, req any, err error) {
+	c.JSON(http.StatusBadRequest, gin.H{
+		"error":  "invalid request body",
+		"fields": bindingErrors(req, err),
+	})
+}
+
+func bindingErrors(req any, err error) []fieldError {
+	var typeErr *json.UnmarshalTypeError
+	if errors.As(err, &typeErr) {
+		return []fieldError{{
+			Code:    "invalid_type",
+			Field:   typeErr.Field,
+			Message: fmt.Sprintf("%s must be a %s", typeErr.Field, typeErr.Type.Kind()),
+		}}
+	}
+
+	var validationErrs validator.ValidationErrors
+	if !errors.As(err, &validationErrs) {
+		return []fieldError{{Code: "invalid_json", Message: "request body is not valid JSON"}}
+	}
+
+	out := make([]fieldError, 0, len(validationErrs))
+	for _, fe := range validationErrs {
+		field := jsonFieldName(req, fe.StructField())
+		out = append(out, fieldError{
+			Code:    validationCode(fe.Tag()),
+			Field:   field,
+			Message: validationMessage(field, fe),
+		})
+	}
+	return out
+}
+
+// jsonFieldName maps a struct field of req to its JSON name.
+func jsonFieldName(req any, structField string) string {
+	t := reflect.TypeOf(req)
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	if t.Kind() == reflect.Struct {
+		if f, ok := t.FieldByName(structField); ok {
+			if name, _, _ := strings.Cut(f.Tag.Get("json"), ","); name != "" && name != "-" {
+				return name
+			}
+		}
+	}
+	return structField
+}
+
+func validationCode(tag string) string {
+	switch tag {
+	case "required":
+		return "required"
+	case "oneof":
+		return "invalid_value"
+	case "max":
+		return "too_long"
+	case "min":
+		return "too_short"
+	default:
+		return "invalid"
+	}
+}
+
+func validationMessage(field string, fe validator.FieldError) string {
+	switch fe.Tag() {
+	case "required":
+		return fmt.Sprintf("%s is required", field)
+	case "oneof":
+		return fmt.Sprintf("%s must be one of: %s", field, strings.ReplaceAll(fe.Param(), " ", ", "))
+	case "max":
+		return fmt.Sprintf("%s must be at most %s characters", field, fe.Param())
+	case "min":
+		return fmt.Sprintf("%s must be at least %s characters", field, fe.Param())
+	default:
+		return fmt.Sprintf("%s is invalid", field)
+	}
+}
@@ -0,0 +1,121 @@
+package handlers
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/tariel-x/gocall/internal/models"
+)
+
+// admissionRequest is sent by the host; its own peer_id proves it is the host.
+type admissionRequest struct {
+	HostPeerID string `json:"host_peer_id" binding:"required"`
+	PeerID     string `json:"peer_id" binding:"required"`
+}
+
+type admissionResponse struct {
+	CallID string              `json:"call_id"`
+	PeerID string              `json:"peer_id"`
+	Status models.CallStatusV2 `json:"status"`
+}
+
+// wsAdmitRequestDataV2 tells the host a guest is waiting to be let in.
+type wsAdmitRequestDataV2 struct {
+	PeerID string `json:"peer_id"`
+	Name   string `json:"name,omitempty"`
+}
+
+// requestAdmission asks the host to admit a guest that just joined a call
+// with a waiting room. A host that isn't connected sees the guest as pending
+// in the next state message.
+func (h *Handlers) requestAdmission(call *models.CallV2, peerID string) {
+	msg, _ := json.Marshal(wsEnvelopeV2{
+		Type: "admit-request",
+		Data: mustMarshal(wsAdmitRequestDataV2{PeerID: peerID, Name: call.Participants[peerID].Name}),
+	})
+	h.wsHub.SendTo(call.ID, call.HostPeerID, msg)
+}
+
+// AdmitPeer lets a pending guest into the call. Only the host may call it.
+func (h *Handlers) AdmitPeer(c *gin.Context) {
+	req, ok := h.bindAdmission(c)
+	if !ok {
+		return
+	}
+
+	call, err := h.calls.AdmitPeer(c.Param("call_id"), req.PeerID, h.nowFn())
+	if err != nil {
+		writeAdmissionError(c, err)
+		return
+	}
+
+	if client := h.wsHub.lookup(call.ID, "", req.PeerID); client != nil {
+		client.pending.Store(false)
+	}
+	admitted, _ := json.Marshal(wsEnvelopeV2{Type: "admitted"})
+	h.wsHub.SendTo(call.ID, req.PeerID, admitted)
+
+	c.JSON(http.StatusOK, admissionResponse{CallID: call.ID, PeerID: req.PeerID, Status: call.Status})
+}
+
+// RejectPeer turns a pending guest away and frees its slot. Only the host may
+// call it.
+func (h *Handlers) RejectPeer(c *gin.Context) {
+	req, ok := h.bindAdmission(c)
+	if !ok {
+		return
+	}
+
+	call, err := h.calls.RejectPeer(c.Param("call_id"), req.PeerID, h.nowFn())
+	if err != nil {
+		writeAdmissionError(c, err)
+		return
+	}
+
+	rejected, _ := json.Marshal(wsEnvelopeV2{Type: "admission-rejected"})
+	if client := h.wsHub.lookup(call.ID, "", req.PeerID); client != nil {
+		h.wsHub.Expel(client, rejected)
+	} else {
+		h.wsHub.SendTo(call.ID, req.PeerID, rejected)
+	}
+
+	c.JSON(http.StatusOK, admissionResponse{CallID: call.ID, PeerID: req.PeerID, Status: call.Status})
+}
+
+// bindAdmission parses an admit/reject request and checks that it comes from
+// the call's host.
+func (h *Handlers) bindAdmission(c *gin.Context) (admissionRequest, bool) {
+	var req admissionRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		writeBindingError(c, &req, err)
+		return req, false
+	}
+
+	call, err := h.calls.GetByID(c.Param("call_id"), h.nowFn())
+	if err != nil {
+		writeAdmissionError(c, err)
+		return req, false
+	}
+	if subtle.ConstantTimeCompare([]byte(req.HostPeerID), []byte(call.HostPeerID)) != 1 {
+		c.JSON(http.StatusForbidden, gin.H{"error": "only the host can admit guests"})
+		return req, false
+	}
+	return req, true
+}
+
+func writeAdmissionError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, ErrCallNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "call not found"})
+	case errors.Is(err, ErrCallEnded):
+		c.JSON(http.StatusGone, gin.H{"error": "call ended"})
+	case errors.Is(err, ErrPeerNotPending):
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	}
+}
@@ -0,0 +1,87 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/tariel-x/gocall/internal/config"
+)
+
+func TestWaitingRoomAdmitAndReject(t *testing.T) {
+	h := newTestHandlers(t, &config.Config{MaxCallParticipants: 3})
+	router := newTestRouter(h)
+
+	var created createCallResponse
+	if code := doJSON(t, router, http.MethodPost, "/api/calls", `{"waiting_room":true}`, &created); code != http.StatusOK || !created.WaitingRoom {
+		t.Fatalf("create: got %d %+v", code, created)
+	}
+	hostID, _, _ := h.calls.EnsureHostPeerID(created.CallID, h.nowFn())
+	host := newTestClient(created.CallID, hostID, PeerRoleV2Host)
+	h.wsHub.Add(host)
+
+	var joined joinCallResponse
+	if code := doJSON(t, router, http.MethodPost, "/api/calls/"+created.CallID+"/join", "", &joined); code != http.StatusOK || !joined.Pending {
+		t.Fatalf("join: got %d %+v", code, joined)
+	}
+	receive(t, host) // state
+	if msg := receive(t, host); msg == nil || msg.Type != "admit-request" {
+		t.Fatalf("expected admit-request for host, got %+v", msg)
+	}
+
+	guest := newTestClient(created.CallID, joined.PeerID, PeerRoleV2Guest)
+	guest.pending.Store(true)
+	h.wsHub.Add(guest)
+
+	// Pending guests neither relay nor receive peer messages.
+	h.routeMessage(guest, wsEnvelopeV2{Type: "offer"})
+	if msg := receive(t, host); msg != nil {
+		t.Fatalf("pending guest reached the host: %+v", msg)
+	}
+	h.routeMessage(host, wsEnvelopeV2{Type: "offer"})
+	if msg := receive(t, guest); msg != nil {
+		t.Fatalf("pending guest got a peer message: %+v", msg)
+	}
+
+	// Nor can they change call state; they may only ask for it.
+	h.routeMessage(guest, wsEnvelopeV2{Type: "set-name", Data: json.RawMessage(`{"name":"Mallory"}`)})
+	h.routeMessage(guest, wsEnvelopeV2{Type: "media-state", Data: json.RawMessage(`{"audio":true,"video":true}`)})
+	if msg := receive(t, host); msg != nil {
+		t.Fatalf("pending guest changed call state: %+v", msg)
+	}
+	if call, _ := h.calls.GetByID(created.CallID, h.nowFn()); call.Participants[joined.PeerID].Name != "" || call.Participants[joined.PeerID].Media != nil {
+		t.Fatalf("pending guest changed its participant: %+v", call.Participants[joined.PeerID])
+	}
+	h.routeMessage(guest, wsEnvelopeV2{Type: "get-state"})
+	if msg := receive(t, guest); msg == nil || msg.Type != "state" {
+		t.Fatalf("expected state for pending guest, got %+v", msg)
+	}
+
+	path := "/api/calls/" + created.CallID + "/admit"
+	if code := doJSON(t, router, http.MethodPost, path, `{"host_peer_id":"`+joined.PeerID+`","peer_id":"`+joined.PeerID+`"}`, nil); code != http.StatusForbidden {
+		t.Fatalf("admit by guest: got %d, want 403", code)
+	}
+	var admitted admissionResponse
+	if code := doJSON(t, router, http.MethodPost, path, `{"host_peer_id":"`+hostID+`","peer_id":"`+joined.PeerID+`"}`, &admitted); code != http.StatusOK || admitted.Status != "active" {
+		t.Fatalf("admit: got %d %+v", code, admitted)
+	}
+	receive(t, guest) // state
+	if msg := receive(t, guest); msg == nil || msg.Type != "admitted" {
+		t.Fatalf("expected admitted, got %+v", msg)
+	}
+	if guest.pending.Load() {
+		t.Fatalf("admitted guest is still pending")
+	}
+
+	var second joinCallResponse
+	if code := doJSON(t, router, http.MethodPost, "/api/calls/"+created.CallID+"/join", "", &second); code != http.StatusOK {
+		t.Fatalf("second join: got %d", code)
+	}
+	path = "/api/calls/" + created.CallID + "/reject"
+	if code := doJSON(t, router, http.MethodPost, path, `{"host_peer_id":"`+hostID+`","peer_id":"`+second.PeerID+`"}`, nil); code != http.StatusOK {
+		t.Fatalf("reject: got %d", code)
+	}
+	if code := doJSON(t, router, http.MethodPost, path, `{"host_peer_id":"`+hostID+`","peer_id":"`+second.PeerID+`"}`, nil); code != http.StatusNotFound {
+		t.Fatalf("reject twice: got %d, want 404", code)
+	}
+}
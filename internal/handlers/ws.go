@@ -4,8 +4,11 @@ import (
 	"encoding/json"
 	"errors"
 	"net/http"
+	"strconv"
+	"strings"
 	"time"
 
+	"github.com/tariel-x/gocall/internal/config"
 	"github.com/tariel-x/gocall/internal/models"
 
 	"github.com/gin-gonic/gin"
@@ -16,13 +19,25 @@ const (
 	wsWriteWait       = 10 * time.Second
 	wsPongWait        = 70 * time.Second
 	wsPingPeriod      = 30 * time.Second
-	wsHeartbeatPeriod = 5 * time.Second
+	wsHeartbeatPeriod = 30 * time.Second
+)
+
+// WS protocol versions negotiated via the "protocol" query parameter.
+const (
+	wsProtocolBase           = 1 // original signaling
+	wsProtocolAcks           = 2 // message ids and ack relay
+	wsProtocolDeliveryFailed = 3 // delivery-failed feedback for undeliverable messages
+
+	wsProtocolLatest = wsProtocolDeliveryFailed
 )
 
 type wsEnvelopeV2 struct {
 	Type     string          `json:"type"`
+	ID       string          `json:"id,omitempty"`
 	To       string          `json:"to,omitempty"`
 	From     string          `json:"from,omitempty"`
+	FromRole PeerRoleV2      `json:"from_role,omitempty"`
+	FromName string          `json:"from_name,omitempty"`
 	CallType string          `json:"call_type,omitempty"`
 	Data     json.RawMessage `json:"data,omitempty"`
 }
@@ -32,17 +47,67 @@ type wsJoinDataV2 struct {
 	Role        PeerRoleV2 `json:"role"`
 	IsReconnect bool       `json:"is_reconnect"`
 	PeerOnline  bool       `json:"peer_online"`
+	Protocol    int        `json:"protocol"`
+	Instance    string     `json:"instance,omitempty"`
+	Pending     bool       `json:"pending,omitempty"` // waiting for the host to admit this peer
+	// ReconnectToken is sent once, on the peer's first connection; the
+	// client reconnects with it instead of its peer_id.
+	ReconnectToken string `json:"reconnect_token,omitempty"`
+	// PeerMedia is the last known media state of the other peers, keyed
+	// by peer ID.
+	PeerMedia map[string]models.MediaState `json:"peer_media,omitempty"`
+	// Chat is the call's recent chat, sent to reconnecting peers.
+	Chat []models.ChatMessageV2 `json:"chat,omitempty"`
+	// ICEServers is what GET /api/turn-config would return, so the client
+	// doesn't need to fetch it before the call starts.
+	ICEServers []map[string]interface{} `json:"ice_servers,omitempty"`
+	// ICETransportPolicy is the call's ice_policy, the RTCPeerConnection
+	// iceTransportPolicy to use with ICEServers.
+	ICETransportPolicy models.ICEPolicy `json:"ice_transport_policy,omitempty"`
+	// Protected is set when the call has a PIN or a waiting room. Clients
+	// send it back on reconnect so a server that lost the call won't
+	// rebuild it without them.
+	Protected bool `json:"protected,omitempty"`
+}
+
+type wsSystemNoticeDataV2 struct {
+	Text string `json:"text"`
+}
+
+// wsDeliveryFailedDataV2 tells a sender which of its messages wasn't
+// delivered and why ("peer_offline" or "buffer_full").
+type wsDeliveryFailedDataV2 struct {
+	Type   string `json:"type"`
+	ID     string `json:"id,omitempty"`
+	Reason string `json:"reason"`
+}
+
+type wsCallExpiredDataV2 struct {
+	CallID string `json:"call_id"`
+}
+
+type wsCallEndedDataV2 struct {
+	CallID string `json:"call_id"`
+	Reason string `json:"reason"`
 }
 
 type wsStateDataV2 struct {
 	CallID       string              `json:"call_id"`
 	Status       models.CallStatusV2 `json:"status"`
+	Seq          uint64              `json:"seq"`
 	Participants callParticipants    `json:"participants"`
+	// EndReason says why the call ended; set only with status "ended".
+	EndReason models.CallEndReason `json:"end_reason,omitempty"`
 }
 
 func (h *Handlers) HandleWebSocket(c *gin.Context) {
+	if !h.checkClientIP(c) {
+		return
+	}
+
 	callID := c.Query("call_id")
 	peerID := c.Query("peer_id")
+	reconnectToken := c.Query("reconnect_token")
 	if callID == "" {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "call_id is required"})
 		return
@@ -53,42 +118,115 @@ func (h *Handlers) HandleWebSocket(c *gin.Context) {
 	var role PeerRoleV2
 	var call *models.CallV2
 	reconnected := false
-	if peerID == "" {
+	if reconnectToken != "" {
+		// The peer_id, if sent as well, only matters for resuming a call
+		// this server doesn't know.
+		guardKey := peerID
+		if guardKey == "" {
+			guardKey = reconnectToken
+		}
+		if retryAfter, ok := h.reconnectGuard.Allow(callID, guardKey, now); !ok {
+			writeBackoff(c, http.StatusTooManyRequests, backoffReconnectStorm, "too many reconnects", retryAfter)
+			return
+		}
+
+		var err error
+		peerID, role, call, reconnected, err = h.reconnectWithToken(callID, reconnectToken, peerID, resumeClaimFromQuery(c), now)
+		if err != nil {
+			if errors.Is(err, errInvalidReconnectToken) {
+				c.JSON(http.StatusForbidden, gin.H{"error": "invalid reconnect_token"})
+				return
+			}
+			h.writeWSCallError(c, err)
+			return
+		}
+	} else if peerID == "" {
+		// The host of a PIN-protected call got its peer_id on creation;
+		// handing it to anyone with the link would bypass the PIN.
+		if existing, err := h.calls.GetByID(callID, now); err == nil && existing.RequiresPIN() {
+			c.JSON(http.StatusForbidden, gin.H{"error": "peer_id is required"})
+			return
+		}
+
 		var err error
 		peerID, call, err = h.calls.EnsureHostPeerID(callID, now)
 		if err != nil {
 			h.writeWSCallError(c, err)
 			return
 		}
+		// Once the host has its token, the link alone no longer makes
+		// anyone the host.
+		if hasReconnectToken(call, peerID) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "reconnect_token is required"})
+			return
+		}
 		role = PeerRoleV2Host
 	} else {
+		if retryAfter, ok := h.reconnectGuard.Allow(callID, peerID, now); !ok {
+			writeBackoff(c, http.StatusTooManyRequests, backoffReconnectStorm, "too many reconnects", retryAfter)
+			return
+		}
+
 		var err error
-		role, call, reconnected, err = h.calls.ValidatePeer(callID, peerID, now)
+		role, call, reconnected, err = h.validatePeer(callID, peerID, resumeClaimFromQuery(c), now)
+		if err != nil {
+			if errors.Is(err, errInvalidPeerID) || errors.Is(err, errReconnectTokenRequired) {
+				c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+				return
+			}
+			h.writeWSCallError(c, err)
+			return
+		}
+	}
+
+	// The first connection of a peer gets the token it reconnects with.
+	issuedToken := ""
+	if !hasReconnectToken(call, peerID) {
+		token, err := h.calls.IssueReconnectToken(callID, peerID, now)
 		if err != nil {
-			if err.Error() == "invalid peer_id" {
-				c.JSON(http.StatusForbidden, gin.H{"error": "invalid peer_id"})
+			if errors.Is(err, errInvalidPeerID) || errors.Is(err, errReconnectTokenRequired) {
+				c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
 				return
 			}
 			h.writeWSCallError(c, err)
 			return
 		}
+		issuedToken = token
 	}
 
 	conn, err := h.wsUpgrader.Upgrade(c.Writer, c.Request, nil)
 	if err != nil {
 		return
 	}
+	limits := h.wsLimits()
+	conn.SetReadLimit(limits.MaxMessageBytes)
+	if limits.Compression {
+		// Only takes effect when the client negotiated permessage-deflate.
+		conn.EnableWriteCompression(true)
+		_ = conn.SetCompressionLevel(limits.CompressionLevel)
+	}
 
 	client := &wsClientV2{
-		conn:   conn,
-		send:   make(chan []byte, 32),
-		callID: callID,
-		peerID: peerID,
+		conn:     conn,
+		send:     make(chan []byte, 32),
+		callID:   callID,
+		peerID:   peerID,
+		role:     role,
+		name:     call.Participants[peerID].Name,
+		protocol: negotiateWSProtocol(c.Query("protocol")),
+		written:  make(chan struct{}),
 	}
+	client.touch(now)
+	client.messages = tokenBucket{tokens: float64(limits.MessageBurst), last: now}
+	client.pending.Store(call.Participants[peerID].Pending)
 
-	h.wsHub.Add(client)
+	var chatBacklog []models.ChatMessageV2
+	if reconnected && !client.pending.Load() && h.relay.policyFor("chat") == RelayPolicyIntercept {
+		chatBacklog = call.Chat
+	}
 
-	// Initial join ack to the client.
+	// The join ack is built before the client is registered: from then on a
+	// newer connection of the same peer may close its send channel.
 	joinMsg, _ := json.Marshal(wsEnvelopeV2{
 		Type: "join",
 		Data: mustMarshal(wsJoinDataV2{
@@ -96,20 +234,57 @@ func (h *Handlers) HandleWebSocket(c *gin.Context) {
 			Role:        role,
 			IsReconnect: reconnected,
 			PeerOnline:  otherPeerOnline(call, peerID),
+			Protocol:    client.protocol,
+			Instance:    h.config.InstanceID,
+			Pending:     client.pending.Load(),
+
+			ReconnectToken:     issuedToken,
+			PeerMedia:          peerMediaStates(call, peerID),
+			Chat:               chatBacklog,
+			ICEServers:         h.buildICEServers(c.Request.Context(), requestHost(c.Request)),
+			ICETransportPolicy: call.ICEPolicy,
+			Protected:          call.RequiresPIN() || call.WaitingRoom,
 		}),
 	})
-	client.send <- joinMsg
 
-	if reconnected {
-		reconnectMsg, _ := json.Marshal(wsEnvelopeV2{Type: "peer-reconnected", From: peerID})
+	if !h.wsHub.Add(client) {
+		_ = conn.SetWriteDeadline(time.Now().Add(wsWriteWait))
+		_ = conn.WriteMessage(websocket.TextMessage, serverShutdownMessage())
+		_ = conn.Close()
+		return
+	}
+	h.logger.Debug("ws connected",
+		"call_id", callID,
+		"role", role,
+		"reconnect", reconnected,
+		"ip", h.config.ClientIPForLog(c.ClientIP()),
+	)
+
+	_ = h.wsHub.trySend(client, joinMsg)
+
+	if notice := h.systemNotice(c.GetHeader("Accept-Language")); notice != "" {
+		noticeMsg, _ := json.Marshal(wsEnvelopeV2{
+			Type: "system-notice",
+			Data: mustMarshal(wsSystemNoticeDataV2{Text: notice}),
+		})
+		_ = h.wsHub.trySend(client, noticeMsg)
+	}
+
+	if reconnected && !client.pending.Load() {
+		reconnectMsg, _ := json.Marshal(wsEnvelopeV2{Type: "peer-reconnected", From: peerID, FromRole: role, FromName: client.name})
 		h.wsHub.SendToOther(callID, peerID, reconnectMsg)
 	}
 
-	h.broadcastState(call)
+	// Everyone else got the new state when the store recorded the
+	// connection, possibly before this client was registered. Read it again
+	// so nothing that changed in between is missed.
+	if current, err := h.calls.GetByID(callID, h.nowFn()); err == nil {
+		_ = h.wsHub.trySend(client, stateMessage(current))
+	}
 
 	stopHeartbeat := make(chan struct{})
 	go h.writePump(client)
-	go h.heartbeatState(client, stopHeartbeat)
+	go h.heartbeat(client, stopHeartbeat)
 	h.readPump(client)
 	close(stopHeartbeat)
 }
@@ -117,12 +292,20 @@ func (h *Handlers) HandleWebSocket(c *gin.Context) {
 func (h *Handlers) readPump(client *wsClientV2) {
 	defer func() {
 		_ = client.conn.Close()
+		h.wsHub.removeClient(client)
+		// A newer connection of the same peer took over and is the one
+		// present now.
+		if client.replaced.Load() {
+			return
+		}
 		h.calls.MarkPeerDisconnected(client.callID, client.peerID, h.nowFn())
-		h.wsHub.Remove(client.callID, client.peerID)
 
 		// Do not end the call on disconnect.
 		// Clients may navigate between SPA screens and reconnect.
-		disconnectMsg, _ := json.Marshal(wsEnvelopeV2{Type: "peer-disconnected", From: client.peerID})
+		if client.pending.Load() {
+			return
+		}
+		disconnectMsg, _ := json.Marshal(wsEnvelopeV2{Type: "peer-disconnected", From: client.peerID, FromRole: client.role, FromName: client.name})
 		h.wsHub.SendToOther(client.callID, client.peerID, disconnectMsg)
 	}()
 
@@ -132,40 +315,44 @@ func (h *Handlers) readPump(client *wsClientV2) {
 		return nil
 	})
 
+	limits := h.wsLimits()
 	for {
 		_, payload, err := client.conn.ReadMessage()
 		if err != nil {
+			if errors.Is(err, websocket.ErrReadLimit) {
+				h.logger.Warn("ws message too large, disconnecting", "call_id", client.callID, "peer_id", client.peerID, "limit", limits.MaxMessageBytes)
+			}
 			return
 		}
 
-		var msg wsEnvelopeV2
-		if err := json.Unmarshal(payload, &msg); err != nil {
-			continue
-		}
-
-		if msg.Type == "ping" {
-			continue
+		if limits.MessageRate > 0 {
+			if _, ok := client.messages.take(h.nowFn(), float64(limits.MessageRate), float64(limits.MessageBurst)); !ok {
+				h.logger.Warn("ws message rate exceeded, disconnecting", "call_id", client.callID, "peer_id", client.peerID, "rate", limits.MessageRate)
+				closeMsg := websocket.FormatCloseMessage(websocket.ClosePolicyViolation, "message rate exceeded")
+				_ = client.conn.WriteControl(websocket.CloseMessage, closeMsg, time.Now().Add(wsWriteWait))
+				return
+			}
 		}
 
-		msg.From = client.peerID
-		forward, err := json.Marshal(msg)
+		var msg wsEnvelopeV2
+		err = json.Unmarshal(payload, &msg)
+		h.wsHub.metrics.received(msg.Type, len(payload))
 		if err != nil {
 			continue
 		}
-
-		if msg.To != "" {
-			h.wsHub.SendTo(client.callID, msg.To, forward)
-			continue
+		// Keepalive pings don't count as activity for the waiting-room timeout.
+		if msg.Type != "ping" {
+			client.touch(h.nowFn())
 		}
 
-		// If 'to' is omitted, route to the other participant.
-		h.wsHub.SendToOther(client.callID, client.peerID, forward)
+		h.routeMessage(client, msg)
 	}
 }
 
 func (h *Handlers) writePump(client *wsClientV2) {
 	defer func() {
 		_ = client.conn.Close()
+		close(client.written)
 	}()
 
 	ticker := time.NewTicker(wsPingPeriod)
@@ -181,6 +368,7 @@ func (h *Handlers) writePump(client *wsClientV2) {
 			if err := client.conn.WriteMessage(websocket.TextMessage, msg); err != nil {
 				return
 			}
+			h.wsHub.metrics.sent(msg)
 		case <-ticker.C:
 			_ = client.conn.SetWriteDeadline(time.Now().Add(wsWriteWait))
 			if err := client.conn.WriteMessage(websocket.PingMessage, nil); err != nil {
@@ -190,37 +378,32 @@ func (h *Handlers) writePump(client *wsClientV2) {
 	}
 }
 
-func (h *Handlers) broadcastState(call *models.CallV2) {
-	msg := stateMessage(call)
-	if len(msg) == 0 {
+// callChangeFunc adapts a function to CallChangeSink.
+type callChangeFunc func(callID string)
+
+func (f callChangeFunc) CallChanged(callID string) { f(callID) }
+
+// pushState sends the current state of a call to everyone in it. The store
+// calls it after every change; ended calls are closed with their final state
+// instead.
+func (h *Handlers) pushState(callID string) {
+	call, err := h.calls.GetByID(callID, h.nowFn())
+	if err != nil {
 		return
 	}
-	h.wsHub.Broadcast(call.ID, msg)
+	h.wsHub.Broadcast(call.ID, stateMessage(call))
 }
 
-func (h *Handlers) heartbeatState(client *wsClientV2, stop <-chan struct{}) {
+// heartbeat periodically checks that client still belongs to a live call.
+// State changes are pushed as they happen; see pushState.
+func (h *Handlers) heartbeat(client *wsClientV2, stop <-chan struct{}) {
 	ticker := time.NewTicker(wsHeartbeatPeriod)
 	defer ticker.Stop()
 
 	for {
 		select {
 		case <-ticker.C:
-			call, err := h.calls.GetByID(client.callID, h.nowFn())
-			if err != nil {
-				if errors.Is(err, ErrCallNotFound) || errors.Is(err, ErrCallEnded) {
-					_ = client.conn.Close()
-					return
-				}
-				continue
-			}
-			msg := stateMessage(call)
-			if len(msg) == 0 {
-				continue
-			}
-			select {
-			case client.send <- msg:
-			default:
-				_ = client.conn.Close()
+			if !h.checkHeartbeat(client) {
 				return
 			}
 		case <-stop:
@@ -229,14 +412,185 @@ func (h *Handlers) heartbeatState(client *wsClientV2, stop <-chan struct{}) {
 	}
 }
 
+// systemNotice picks the configured notice for the client's preferred language.
+func (h *Handlers) systemNotice(acceptLanguage string) string {
+	if h.config.SystemNotice == "" {
+		return ""
+	}
+	for _, part := range strings.Split(acceptLanguage, ",") {
+		tag, _, _ := strings.Cut(strings.TrimSpace(part), ";")
+		lang, _, _ := strings.Cut(strings.ToLower(tag), "-")
+		if text, ok := h.config.SystemNoticeTranslations[lang]; ok && text != "" {
+			return text
+		}
+	}
+	return h.config.SystemNotice
+}
+
+// resumeClaim is what a reconnecting client says about a call the server may
+// have lost: its own role and the settings it saw in the join ack.
+type resumeClaim struct {
+	Role      PeerRoleV2
+	ICEPolicy models.ICEPolicy
+	// Protected is set when the call had a PIN or a waiting room, which a
+	// rebuilt call couldn't enforce.
+	Protected bool
+}
+
+func resumeClaimFromQuery(c *gin.Context) resumeClaim {
+	return resumeClaim{
+		Role:      PeerRoleV2(c.Query("role")),
+		ICEPolicy: models.ICEPolicy(c.Query("ice_policy")),
+		Protected: c.Query("protected") == "1",
+	}
+}
+
+// resumable reports whether the claim may rebuild a lost call. Calls with a
+// PIN or waiting room are never rebuilt: the rebuilt call would let anyone
+// with the link straight in.
+func (h *Handlers) resumable(claim resumeClaim) bool {
+	return h.config.ResumeUnknownCalls && claim.Role != "" && !claim.Protected
+}
+
+// validatePeer checks a reconnecting peer. With ResumeUnknownCalls, a peer of
+// a call this server doesn't know is trusted to rebuild it from its own
+// call_id, peer_id and role.
+func (h *Handlers) validatePeer(callID, peerID string, claim resumeClaim, now time.Time) (role PeerRoleV2, call *models.CallV2, reconnected bool, err error) {
+	role, call, reconnected, err = h.calls.ValidatePeer(callID, peerID, now)
+	if err == nil || !h.resumable(claim) {
+		return role, call, reconnected, err
+	}
+	if !errors.Is(err, ErrCallNotFound) && !errors.Is(err, errInvalidPeerID) {
+		return role, call, reconnected, err
+	}
+
+	resumed, resumeErr := h.calls.ResumeCall(callID, peerID, claim.Role, claim.ICEPolicy, now)
+	if resumeErr != nil {
+		return "", nil, false, err
+	}
+	h.logger.Info("resumed call from client state", "call_id", callID, "role", claim.Role, "ice_policy", resumed.ICEPolicy)
+	return claim.Role, resumed, true, nil
+}
+
+// reconnectWithToken checks a peer reconnecting with its token. Like
+// validatePeer, with ResumeUnknownCalls a call this server doesn't know is
+// rebuilt from the peer_id and role the client sent along.
+func (h *Handlers) reconnectWithToken(callID, token, peerID string, claim resumeClaim, now time.Time) (string, PeerRoleV2, *models.CallV2, bool, error) {
+	foundID, role, call, reconnected, err := h.calls.ReconnectWithToken(callID, token, now)
+	if err == nil || !errors.Is(err, ErrCallNotFound) || !h.resumable(claim) || peerID == "" {
+		return foundID, role, call, reconnected, err
+	}
+
+	resumed, resumeErr := h.calls.ResumeCall(callID, peerID, claim.Role, claim.ICEPolicy, now)
+	if resumeErr != nil {
+		return "", "", nil, false, err
+	}
+	h.logger.Info("resumed call from client state", "call_id", callID, "role", claim.Role, "ice_policy", resumed.ICEPolicy)
+	return peerID, claim.Role, resumed, true, nil
+}
+
+// wsLimits is the configured WSConfig with defaults filled in.
+func (h *Handlers) wsLimits() config.WSConfig {
+	limits := h.config.WS
+	if limits.MaxMessageBytes <= 0 {
+		limits.MaxMessageBytes = config.DefaultWSMaxMessageBytes
+	}
+	if limits.MessageBurst <= 0 {
+		limits.MessageBurst = config.DefaultWSMessageBurst
+	}
+	if limits.CompressionLevel == 0 {
+		limits.CompressionLevel = config.DefaultWSCompressionLevel
+	}
+	return limits
+}
+
+// negotiateWSProtocol picks the highest protocol version both sides support.
+func negotiateWSProtocol(requested string) int {
+	version, err := strconv.Atoi(requested)
+	if err != nil || version < wsProtocolBase {
+		return wsProtocolBase
+	}
+	return min(version, wsProtocolLatest)
+}
+
+// checkHeartbeat handles what no state change announces: calls that ended
+// elsewhere and idle waiting rooms. It returns false once the connection
+// should stop, e.g. because the call is gone.
+func (h *Handlers) checkHeartbeat(client *wsClientV2) bool {
+	now := h.nowFn()
+	call, err := h.calls.GetByID(client.callID, now)
+	if err != nil {
+		if !errors.Is(err, ErrCallNotFound) && !errors.Is(err, ErrCallEnded) {
+			return true
+		}
+		// A call that just ended gets an explicit notice so the client can
+		// offer to start a new one instead of retrying the socket.
+		if h.calls.RecentlyEnded(client.callID, now) {
+			expired, _ := json.Marshal(wsEnvelopeV2{
+				Type: "call-expired",
+				Data: mustMarshal(wsCallExpiredDataV2{CallID: client.callID}),
+			})
+			h.wsHub.Expel(client, expired)
+			return false
+		}
+		_ = client.conn.Close()
+		return false
+	}
+
+	if h.waitingRoomAbandoned(client, call, now) {
+		if _, err := h.calls.EndCall(call.ID, models.CallEndReasonExpired, now); err != nil {
+			return true
+		}
+		ended, _ := json.Marshal(wsEnvelopeV2{
+			Type: "call-ended",
+			Data: mustMarshal(wsCallEndedDataV2{CallID: call.ID, Reason: "waiting-timeout"}),
+		})
+		h.wsHub.Expel(client, ended)
+		return false
+	}
+
+	// Admission may have been decided on another instance.
+	if p, ok := call.Participants[client.peerID]; ok {
+		client.pending.Store(p.Pending)
+	}
+	return true
+}
+
+// waitingRoomAbandoned reports whether the host has been alone and silent in a
+// waiting call for longer than the configured idle timeout.
+func (h *Handlers) waitingRoomAbandoned(client *wsClientV2, call *models.CallV2, now time.Time) bool {
+	timeout := h.config.WaitingIdleTimeout
+	if timeout <= 0 || client.role != PeerRoleV2Host || call.Status != models.CallStatusV2Waiting {
+		return false
+	}
+	return client.idleFor(now) >= timeout
+}
+
+// peerMediaStates collects the known media states of everyone but selfPeerID.
+func peerMediaStates(call *models.CallV2, selfPeerID string) map[string]models.MediaState {
+	var states map[string]models.MediaState
+	for peerID, p := range call.Participants {
+		if peerID == selfPeerID || p.Media == nil {
+			continue
+		}
+		if states == nil {
+			states = make(map[string]models.MediaState)
+		}
+		states[peerID] = *p.Media
+	}
+	return states
+}
+
 func otherPeerOnline(call *models.CallV2, selfPeerID string) bool {
 	if call == nil {
 		return false
 	}
-	if selfPeerID == call.Host.PeerID {
-		return call.Guest.IsPresent
+	for peerID, p := range call.Participants {
+		if peerID != selfPeerID && p.IsPresent && !p.Pending {
+			return true
+		}
 	}
-	return call.Host.IsPresent
+	return false
 }
 
 func stateMessage(call *models.CallV2) []byte {
@@ -248,20 +602,34 @@ func stateMessage(call *models.CallV2) []byte {
 		Data: mustMarshal(wsStateDataV2{
 			CallID: call.ID,
 			Status: call.Status,
+			Seq:    call.Seq,
 			Participants: callParticipants{
 				Count: call.ParticipantsCount(),
+				List:  participantList(call),
 			},
+			EndReason: call.EndReason,
 		}),
 	})
 	return msg
 }
 
+// participantList lists every peer of the call in join order, so group call
+// clients know whom to negotiate with.
+func participantList(call *models.CallV2) []participantState {
+	participants := call.SortedParticipants()
+	list := make([]participantState, 0, len(participants))
+	for _, p := range participants {
+		list = append(list, participantState{PeerID: p.PeerID, Name: p.Name, Role: peerRole(call, p.PeerID), IsPresent: p.IsPresent, Pending: p.Pending, Media: p.Media})
+	}
+	return list
+}
+
 func (h *Handlers) writeWSCallError(c *gin.Context, err error) {
 	switch err {
 	case ErrCallNotFound:
 		c.JSON(http.StatusNotFound, gin.H{"error": "call not found"})
 	case ErrCallEnded:
-		c.JSON(http.StatusConflict, gin.H{"error": "call ended"})
+		c.JSON(http.StatusGone, gin.H{"error": "call ended"})
 	default:
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 	}
@@ -1,53 +1,208 @@
 package handlers
 
 import (
+	"context"
+	"encoding/json"
+	"errors"
 	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/gorilla/websocket"
 )
 
 type wsClientV2 struct {
-	conn      *websocket.Conn
-	send      chan []byte
-	callID    string
-	peerID    string
-	closeOnce sync.Once
+	conn     *websocket.Conn
+	send     chan []byte
+	callID   string
+	peerID   string
+	role     PeerRoleV2
+	protocol int
+	name     string // display name; only touched by the client's read loop
+	// written is closed by writePump once it stopped writing; nil for
+	// clients without a network connection.
+	written chan struct{}
+
+	lastActivity atomic.Int64 // unix nanos of the last client message
+	messages     tokenBucket  // WS_MESSAGE_RATE budget; only touched by the read loop
+	// pending is set while the peer waits for admission: it gets state and
+	// admission notices but doesn't relay or receive peer messages.
+	pending atomic.Bool
+
+	// sendMu guards closing send, so queueing never races with the close.
+	sendMu     sync.Mutex
+	sendClosed bool
+	// replaced is set when a newer connection of the same peer took over.
+	replaced atomic.Bool
+}
+
+func (c *wsClientV2) touch(now time.Time) {
+	c.lastActivity.Store(now.UnixNano())
+}
+
+func (c *wsClientV2) idleFor(now time.Time) time.Duration {
+	return now.Sub(time.Unix(0, c.lastActivity.Load()))
+}
+
+// enqueue queues payload without blocking. It fails with errPeerOffline once
+// the send channel is closed and errSendBufferFull when the buffer is full.
+func (c *wsClientV2) enqueue(payload []byte) error {
+	c.sendMu.Lock()
+	defer c.sendMu.Unlock()
+
+	if c.sendClosed {
+		return errPeerOffline
+	}
+	select {
+	case c.send <- payload:
+		return nil
+	default:
+		return errSendBufferFull
+	}
 }
 
 func (c *wsClientV2) closeSend() {
-	c.closeOnce.Do(func() {
+	c.sendMu.Lock()
+	defer c.sendMu.Unlock()
+
+	if !c.sendClosed {
+		c.sendClosed = true
 		close(c.send)
-	})
+	}
 }
 
 type WSHubV2 struct {
 	mu    sync.Mutex
 	calls map[string]map[string]*wsClientV2 // callID -> peerID -> client
+
+	// Optional cross-instance routing; see SetBus.
+	bus    Bus
+	origin string
+	subs   map[string]func() // callID -> unsubscribe
+
+	connections     int
+	peakConnections int
+	metrics         *wsMetrics
+
+	shuttingDown bool
 }
 
 func NewWSHubV2() *WSHubV2 {
 	return &WSHubV2{
-		calls: make(map[string]map[string]*wsClientV2),
+		calls:   make(map[string]map[string]*wsClientV2),
+		subs:    make(map[string]func()),
+		metrics: newWSMetrics(),
 	}
 }
 
-func (h *WSHubV2) Add(client *wsClientV2) {
+// Add registers client. It returns false once Shutdown has been called.
+func (h *WSHubV2) Add(client *wsClientV2) bool {
 	h.mu.Lock()
 	defer h.mu.Unlock()
 
+	if h.shuttingDown {
+		return false
+	}
+
 	peers, ok := h.calls[client.callID]
 	if !ok {
 		peers = make(map[string]*wsClientV2)
 		h.calls[client.callID] = peers
+		h.subscribeLocked(client.callID)
 	}
 
 	// Replace existing connection for the same peer_id.
 	if old := peers[client.peerID]; old != nil {
+		old.replaced.Store(true)
 		_ = old.conn.Close()
 		old.closeSend()
+	} else {
+		h.connections++
+		if h.connections > h.peakConnections {
+			h.peakConnections = h.connections
+		}
 	}
 
 	peers[client.peerID] = client
+	return true
+}
+
+// Shutdown tells every connected client that the server is going away and
+// closes their connections, waiting until the notice is written or ctx ends.
+// Add refuses clients from then on.
+func (h *WSHubV2) Shutdown(ctx context.Context) error {
+	payload := serverShutdownMessage()
+
+	h.mu.Lock()
+	h.shuttingDown = true
+	calls := h.calls
+	h.calls = make(map[string]map[string]*wsClientV2)
+	h.connections = 0
+	for callID := range calls {
+		h.unsubscribeLocked(callID)
+	}
+	h.mu.Unlock()
+
+	var clients []*wsClientV2
+	for _, peers := range calls {
+		for _, client := range peers {
+			sendAndClose(client, payload)
+			clients = append(clients, client)
+		}
+	}
+
+	for _, client := range clients {
+		if client.written == nil {
+			continue
+		}
+		select {
+		case <-client.written:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	return nil
+}
+
+func serverShutdownMessage() []byte {
+	payload, _ := json.Marshal(wsEnvelopeV2{Type: "server-shutdown"})
+	return payload
+}
+
+// sendAndClose queues a final message and closes the client's send channel;
+// writePump flushes it and closes the connection.
+func sendAndClose(client *wsClientV2, payload []byte) {
+	_ = client.enqueue(payload)
+	client.closeSend()
+}
+
+// Connections returns the number of clients connected to this instance.
+func (h *WSHubV2) Connections() int {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.connections
+}
+
+// PeakConnections returns the highest number of simultaneously connected clients.
+func (h *WSHubV2) PeakConnections() int {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.peakConnections
+}
+
+// Check reports whether the hub still accepts clients.
+func (h *WSHubV2) Check() error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.shuttingDown {
+		return errors.New("shutting down")
+	}
+	return nil
+}
+
+// MessageStats returns message counters by type since the hub was created.
+func (h *WSHubV2) MessageStats() map[string]WSMessageTypeStats {
+	return h.metrics.stats()
 }
 
 func (h *WSHubV2) Remove(callID, peerID string) {
@@ -61,14 +216,127 @@ func (h *WSHubV2) Remove(callID, peerID string) {
 
 	if client, exists := peers[peerID]; exists {
 		client.closeSend()
+		h.connections--
 	}
 	delete(peers, peerID)
 	if len(peers) == 0 {
 		delete(h.calls, callID)
+		h.unsubscribeLocked(callID)
+	}
+}
+
+// removeClient detaches client if it is still the connection registered for
+// its peer; a newer connection that replaced it stays.
+func (h *WSHubV2) removeClient(client *wsClientV2) {
+	h.mu.Lock()
+	h.detachLocked(client)
+	h.mu.Unlock()
+
+	client.closeSend()
+}
+
+func (h *WSHubV2) detachLocked(client *wsClientV2) {
+	peers, ok := h.calls[client.callID]
+	if !ok || peers[client.peerID] != client {
+		return
+	}
+	delete(peers, client.peerID)
+	h.connections--
+	if len(peers) == 0 {
+		delete(h.calls, client.callID)
+		h.unsubscribeLocked(client.callID)
 	}
 }
 
+// lookup returns the connected client for peerID, or the other participant
+// when peerID is empty.
+func (h *WSHubV2) lookup(callID, selfPeerID, peerID string) *wsClientV2 {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	peers := h.calls[callID]
+	if peerID != "" {
+		return peers[peerID]
+	}
+	for id, client := range peers {
+		if id != selfPeerID {
+			return client
+		}
+	}
+	return nil
+}
+
+// Expel detaches client from the hub and queues a final message. The
+// connection closes once writePump has flushed it.
+func (h *WSHubV2) Expel(client *wsClientV2, payload []byte) {
+	h.mu.Lock()
+	h.detachLocked(client)
+	h.mu.Unlock()
+
+	sendAndClose(client, payload)
+}
+
+// Reasons a message couldn't be handed to a connected client.
+var (
+	errPeerOffline     = errors.New("peer_offline")
+	errSendBufferFull  = errors.New("buffer_full")
+	errPeerUnsupported = errors.New("peer_unsupported") // below the message's minimum protocol
+)
+
+// SendTo delivers payload to peerID, publishing it to other instances when the
+// peer isn't connected here.
 func (h *WSHubV2) SendTo(callID, peerID string, payload []byte) bool {
+	return h.deliverTo(callID, peerID, payload) == nil
+}
+
+// SendToOther delivers payload to the participant other than fromPeerID,
+// publishing it to other instances when that participant isn't connected here.
+func (h *WSHubV2) SendToOther(callID, fromPeerID string, payload []byte) bool {
+	return h.deliverToOther(callID, fromPeerID, payload) == nil
+}
+
+// deliverTo is SendTo reporting why delivery failed. A message handed to the
+// bus counts as delivered.
+func (h *WSHubV2) deliverTo(callID, peerID string, payload []byte) error {
+	return h.deliverToProtocol(callID, peerID, 0, payload)
+}
+
+// deliverToProtocol is deliverTo for message types older clients don't
+// understand: a peer below minProtocol, here or on another instance, doesn't
+// get payload.
+func (h *WSHubV2) deliverToProtocol(callID, peerID string, minProtocol int, payload []byte) error {
+	err := h.sendToLocal(callID, peerID, minProtocol, payload)
+	if errors.Is(err, errPeerOffline) && h.publish(callID, BusMessage{Kind: busSendTo, PeerID: peerID, MinProtocol: minProtocol, Payload: payload}) {
+		return nil
+	}
+	return err
+}
+
+// deliverToOther is SendToOther reporting why delivery failed. It is always
+// published as well, since other peers of a group call may be connected
+// elsewhere.
+func (h *WSHubV2) deliverToOther(callID, fromPeerID string, payload []byte) error {
+	err := h.sendToOtherLocal(callID, fromPeerID, payload)
+	if h.publish(callID, BusMessage{Kind: busSendToOther, PeerID: fromPeerID, Payload: payload}) && errors.Is(err, errPeerOffline) {
+		return nil
+	}
+	return err
+}
+
+// Broadcast delivers payload to every participant on every instance.
+func (h *WSHubV2) Broadcast(callID string, payload []byte) {
+	h.broadcastLocal(callID, payload)
+	h.publish(callID, BusMessage{Kind: busBroadcast, Payload: payload})
+}
+
+// CloseCall disconnects every participant on every instance. A non-empty
+// payload is written to each of them before their connection closes.
+func (h *WSHubV2) CloseCall(callID string, payload []byte) {
+	h.closeCallLocal(callID, payload)
+	h.publish(callID, BusMessage{Kind: busCloseCall, Payload: payload})
+}
+
+func (h *WSHubV2) sendToLocal(callID, peerID string, minProtocol int, payload []byte) error {
 	h.mu.Lock()
 	client := func() *wsClientV2 {
 		peers := h.calls[callID]
@@ -77,46 +345,49 @@ func (h *WSHubV2) SendTo(callID, peerID string, payload []byte) bool {
 	h.mu.Unlock()
 
 	if client == nil {
-		return false
+		return errPeerOffline
 	}
-
-	select {
-	case client.send <- payload:
-		return true
-	default:
-		_ = client.conn.Close()
-		return false
+	if client.protocol < minProtocol {
+		return errPeerUnsupported
 	}
+	return h.trySend(client, payload)
 }
 
-func (h *WSHubV2) SendToOther(callID, fromPeerID string, payload []byte) bool {
+// sendToOtherLocal delivers payload to every local participant except
+// fromPeerID. It fails only if nobody got it.
+func (h *WSHubV2) sendToOtherLocal(callID, fromPeerID string, payload []byte) error {
 	h.mu.Lock()
-	var other *wsClientV2
-	if peers, ok := h.calls[callID]; ok {
-		for peerID, client := range peers {
-			if peerID == fromPeerID {
-				continue
-			}
-			other = client
-			break
+	var others []*wsClientV2
+	for peerID, client := range h.calls[callID] {
+		if peerID != fromPeerID && !client.pending.Load() {
+			others = append(others, client)
 		}
 	}
 	h.mu.Unlock()
 
-	if other == nil {
-		return false
+	err := errPeerOffline
+	for _, other := range others {
+		if sendErr := h.trySend(other, payload); sendErr == nil {
+			err = nil
+		} else if err != nil {
+			err = sendErr
+		}
 	}
+	return err
+}
 
-	select {
-	case other.send <- payload:
-		return true
-	default:
-		_ = other.conn.Close()
-		return false
+// trySend queues payload without blocking; a client that can't keep up is
+// disconnected.
+func (h *WSHubV2) trySend(client *wsClientV2, payload []byte) error {
+	err := client.enqueue(payload)
+	if errors.Is(err, errSendBufferFull) {
+		h.metrics.dropped(payload)
+		_ = client.conn.Close()
 	}
+	return err
 }
 
-func (h *WSHubV2) Broadcast(callID string, payload []byte) {
+func (h *WSHubV2) broadcastLocal(callID string, payload []byte) {
 	h.mu.Lock()
 	var clients []*wsClientV2
 	if peers, ok := h.calls[callID]; ok {
@@ -128,15 +399,11 @@ func (h *WSHubV2) Broadcast(callID string, payload []byte) {
 	h.mu.Unlock()
 
 	for _, client := range clients {
-		select {
-		case client.send <- payload:
-		default:
-			_ = client.conn.Close()
-		}
+		_ = h.trySend(client, payload)
 	}
 }
 
-func (h *WSHubV2) CloseCall(callID string) {
+func (h *WSHubV2) closeCallLocal(callID string, payload []byte) {
 	h.mu.Lock()
 	peers, ok := h.calls[callID]
 	if !ok {
@@ -144,9 +411,15 @@ func (h *WSHubV2) CloseCall(callID string) {
 		return
 	}
 	delete(h.calls, callID)
+	h.connections -= len(peers)
+	h.unsubscribeLocked(callID)
 	h.mu.Unlock()
 
 	for _, client := range peers {
+		if len(payload) > 0 {
+			sendAndClose(client, payload)
+			continue
+		}
 		_ = client.conn.Close()
 		client.closeSend()
 	}
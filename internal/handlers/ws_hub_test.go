@@ -0,0 +1,69 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestHubShutdownNotifiesAndClosesClients(t *testing.T) {
+	hub := NewWSHubV2()
+	host := newTestClient("call-a", "host", PeerRoleV2Host)
+	guest := newTestClient("call-a", "guest", PeerRoleV2Guest)
+	other := newTestClient("call-b", "host", PeerRoleV2Host)
+	for _, client := range []*wsClientV2{host, guest, other} {
+		if !hub.Add(client) {
+			t.Fatalf("Add refused before shutdown")
+		}
+	}
+
+	if err := hub.Shutdown(context.Background()); err != nil {
+		t.Fatalf("Shutdown: %v", err)
+	}
+
+	for _, client := range []*wsClientV2{host, guest, other} {
+		if msg := receive(t, client); msg == nil || msg.Type != "server-shutdown" {
+			t.Fatalf("%s/%s: expected server-shutdown, got %+v", client.callID, client.peerID, msg)
+		}
+		if _, open := <-client.send; open {
+			t.Fatalf("%s/%s: send channel left open", client.callID, client.peerID)
+		}
+	}
+	if hub.lookup("call-a", "", "host") != nil {
+		t.Fatalf("clients still registered after shutdown")
+	}
+
+	late := newTestClient("call-c", "host", PeerRoleV2Host)
+	if hub.Add(late) {
+		t.Fatalf("Add accepted a client after shutdown")
+	}
+}
+
+func TestHubShutdownWaitsForWriters(t *testing.T) {
+	hub := NewWSHubV2()
+	client := newTestClient("call", "host", PeerRoleV2Host)
+	client.written = make(chan struct{})
+	hub.Add(client)
+
+	// A stuck writer makes Shutdown give up when ctx ends.
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if err := hub.Shutdown(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected deadline error for stuck writer, got %v", err)
+	}
+
+	// A writer that drains its queue lets Shutdown return.
+	hub = NewWSHubV2()
+	client = newTestClient("call", "host", PeerRoleV2Host)
+	client.written = make(chan struct{})
+	hub.Add(client)
+	go func() {
+		for range client.send {
+		}
+		close(client.written)
+	}()
+	if err := hub.Shutdown(context.Background()); err != nil {
+		t.Fatalf("Shutdown: %v", err)
+	}
+}
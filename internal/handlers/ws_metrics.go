@@ -0,0 +1,156 @@
+package handlers
+
+import (
+	"bytes"
+	"net/http"
+	"sync/atomic"
+
+	"github.com/gin-gonic/gin"
+)
+
+// wsServerMessageTypes are the types the server sends on its own. Together
+// with the relay policy types they are counted separately; anything else is
+// counted as wsOtherMessageType, so clients can't grow the set with made-up
+// types.
+var wsServerMessageTypes = []string{
+	"join",
+	"state",
+	"peer-reconnected",
+	"peer-disconnected",
+	"admit-request",
+	"admitted",
+	"admission-rejected",
+	"delivery-failed",
+	"system-notice",
+	"call-ended",
+	"call-expired",
+	"server-shutdown",
+}
+
+const wsOtherMessageType = "other"
+
+// WSMessageTypeStats counts WebSocket messages of one type. Bytes are
+// payload sizes before compression.
+type WSMessageTypeStats struct {
+	Received      uint64 `json:"received"`
+	ReceivedBytes uint64 `json:"received_bytes"`
+	Sent          uint64 `json:"sent"`
+	SentBytes     uint64 `json:"sent_bytes"`
+	// Relayed messages were forwarded to peers by their relay policy.
+	Relayed uint64 `json:"relayed"`
+	// Dropped messages were not queued because the client's send buffer
+	// was full.
+	Dropped uint64 `json:"dropped"`
+}
+
+type wsStatsResponse struct {
+	Messages map[string]WSMessageTypeStats `json:"messages"`
+}
+
+// GetWSStats reports signaling traffic handled by this instance by message
+// type.
+func (h *Handlers) GetWSStats(c *gin.Context) {
+	c.JSON(http.StatusOK, wsStatsResponse{Messages: h.wsHub.MessageStats()})
+}
+
+type wsTypeCounters struct {
+	received      atomic.Uint64
+	receivedBytes atomic.Uint64
+	sent          atomic.Uint64
+	sentBytes     atomic.Uint64
+	relayed       atomic.Uint64
+	dropped       atomic.Uint64
+}
+
+// wsMetrics counts messages by type. The set of types is fixed when it is
+// created, so counting takes no locks.
+type wsMetrics struct {
+	byType map[string]*wsTypeCounters
+}
+
+func newWSMetrics() *wsMetrics {
+	m := &wsMetrics{byType: make(map[string]*wsTypeCounters)}
+	for msgType := range defaultRelayPolicies {
+		if msgType != relayPolicyFallback {
+			m.byType[msgType] = &wsTypeCounters{}
+		}
+	}
+	for _, msgType := range wsServerMessageTypes {
+		m.byType[msgType] = &wsTypeCounters{}
+	}
+	m.byType[wsOtherMessageType] = &wsTypeCounters{}
+	return m
+}
+
+func (m *wsMetrics) counters(msgType string) *wsTypeCounters {
+	if c, ok := m.byType[msgType]; ok {
+		return c
+	}
+	return m.byType[wsOtherMessageType]
+}
+
+// payloadCounters is counters for a marshaled envelope. The lookup doesn't
+// copy the type out of payload.
+func (m *wsMetrics) payloadCounters(payload []byte) *wsTypeCounters {
+	if c, ok := m.byType[string(envelopeType(payload))]; ok {
+		return c
+	}
+	return m.byType[wsOtherMessageType]
+}
+
+// received counts a message read from a client.
+func (m *wsMetrics) received(msgType string, size int) {
+	c := m.counters(msgType)
+	c.received.Add(1)
+	c.receivedBytes.Add(uint64(size))
+}
+
+// sent counts a message written to a client.
+func (m *wsMetrics) sent(payload []byte) {
+	c := m.payloadCounters(payload)
+	c.sent.Add(1)
+	c.sentBytes.Add(uint64(len(payload)))
+}
+
+// relayed counts a client message forwarded to its peers.
+func (m *wsMetrics) relayed(msgType string) {
+	m.counters(msgType).relayed.Add(1)
+}
+
+// dropped counts a message that didn't fit in a client's send buffer.
+func (m *wsMetrics) dropped(payload []byte) {
+	m.payloadCounters(payload).dropped.Add(1)
+}
+
+// stats returns the counters of every type that saw any traffic.
+func (m *wsMetrics) stats() map[string]WSMessageTypeStats {
+	stats := make(map[string]WSMessageTypeStats)
+	for msgType, c := range m.byType {
+		s := WSMessageTypeStats{
+			Received:      c.received.Load(),
+			ReceivedBytes: c.receivedBytes.Load(),
+			Sent:          c.sent.Load(),
+			SentBytes:     c.sentBytes.Load(),
+			Relayed:       c.relayed.Load(),
+			Dropped:       c.dropped.Load(),
+		}
+		if s != (WSMessageTypeStats{}) {
+			stats[msgType] = s
+		}
+	}
+	return stats
+}
+
+// envelopeType reads the type of a marshaled wsEnvelopeV2 without decoding
+// it; Type is always the first field.
+func envelopeType(payload []byte) []byte {
+	rest, ok := bytes.CutPrefix(payload, []byte(`{"type":"`))
+	if !ok {
+		return nil
+	}
+	end := bytes.IndexByte(rest, '"')
+	if end < 0 {
+		return nil
+	}
+	return rest[:end]
+}
@@ -0,0 +1,85 @@
+package handlers
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+
+	"github.com/tariel-x/gocall/internal/config"
+)
+
+func TestWSMetricsCountRelayedMessages(t *testing.T) {
+	// Unknown types are dropped by default; relay one to see it counted.
+	h := newTestHandlers(t, &config.Config{WSRelayPolicies: map[string]string{"made-up": string(RelayPolicyToSpecific)}})
+	srv := httptest.NewServer(newTestRouter(h))
+	t.Cleanup(srv.Close)
+
+	call, _ := h.calls.CreateCall(h.nowFn(), CreateCallOptions{})
+	guestID, _, _ := h.calls.Join(call.ID, h.nowFn())
+	base := "ws" + strings.TrimPrefix(srv.URL, "http") + "/api/ws?call_id=" + call.ID
+	dial := func(query string) *websocket.Conn {
+		conn, _, err := websocket.DefaultDialer.Dial(base+query, nil)
+		if err != nil {
+			t.Fatalf("dial failed: %v", err)
+		}
+		t.Cleanup(func() { _ = conn.Close() })
+		return conn
+	}
+	host := dial("")
+	guest := dial("&peer_id=" + guestID)
+
+	offer := `{"type":"offer","to":"` + guestID + `","data":{"sdp":"v=0"}}`
+	for _, payload := range []string{offer, `{"type":"made-up","data":{}}`} {
+		if err := host.WriteMessage(websocket.TextMessage, []byte(payload)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	_ = guest.SetReadDeadline(time.Now().Add(5 * time.Second))
+	for got := 0; got < 2; {
+		var msg wsEnvelopeV2
+		if err := guest.ReadJSON(&msg); err != nil {
+			t.Fatalf("guest read failed: %v", err)
+		}
+		if msg.Type == "offer" || msg.Type == "made-up" {
+			got++
+		}
+	}
+
+	// Sent messages are counted once written, just after the guest got them.
+	var stats map[string]WSMessageTypeStats
+	for deadline := time.Now().Add(5 * time.Second); ; time.Sleep(10 * time.Millisecond) {
+		stats = h.wsHub.MessageStats()
+		if stats["offer"].Sent == 1 && stats[wsOtherMessageType].Sent == 1 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("relayed messages not counted as sent: %+v", stats)
+		}
+	}
+	if s := stats["offer"]; s.Received != 1 || s.ReceivedBytes != uint64(len(offer)) || s.SentBytes <= s.ReceivedBytes {
+		t.Fatalf("unexpected offer counters %+v", s)
+	}
+	if _, ok := stats["made-up"]; ok || stats[wsOtherMessageType].Received != 1 {
+		t.Fatalf("unknown type not counted as %s: %+v", wsOtherMessageType, stats)
+	}
+	if stats["join"].Sent != 2 || stats["state"].Sent == 0 {
+		t.Fatalf("server messages not counted: %+v", stats)
+	}
+}
+
+func TestEnvelopeType(t *testing.T) {
+	cases := map[string]string{
+		`{"type":"ice-candidate","data":{}}`: "ice-candidate",
+		`{"type":"state"}`:                   "state",
+		`{"data":{}}`:                        "",
+		`{"type":"unterminated`:              "",
+	}
+	for payload, want := range cases {
+		if got := string(envelopeType([]byte(payload))); got != want {
+			t.Errorf("envelopeType(%s) = %q, want %q", payload, got, want)
+		}
+	}
+}
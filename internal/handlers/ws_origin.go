@@ -0,0 +1,43 @@
+package handlers
+
+import (
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// CheckWSOrigin builds the upgrader's CheckOrigin from WS_ALLOWED_ORIGINS.
+// Browsers always send Origin on WebSocket handshakes, so requests without one
+// come from other clients and are let through. "*" allows any origin; an
+// empty list allows only the server's own origin.
+func CheckWSOrigin(allowed []string) func(r *http.Request) bool {
+	origins := make(map[string]struct{}, len(allowed))
+	for _, origin := range allowed {
+		if origin == "*" {
+			return func(*http.Request) bool { return true }
+		}
+		origins[normalizeOrigin(origin)] = struct{}{}
+	}
+
+	return func(r *http.Request) bool {
+		origin := r.Header.Get("Origin")
+		if origin == "" {
+			return true
+		}
+		if len(origins) == 0 {
+			u, err := url.Parse(origin)
+			return err == nil && strings.EqualFold(u.Host, r.Host)
+		}
+		_, ok := origins[normalizeOrigin(origin)]
+		return ok
+	}
+}
+
+// normalizeOrigin reduces a URL to lowercase scheme://host[:port].
+func normalizeOrigin(raw string) string {
+	u, err := url.Parse(strings.TrimSpace(raw))
+	if err != nil || u.Scheme == "" || u.Host == "" {
+		return strings.ToLower(strings.TrimSuffix(raw, "/"))
+	}
+	return strings.ToLower(u.Scheme + "://" + u.Host)
+}
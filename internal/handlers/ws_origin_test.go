@@ -0,0 +1,36 @@
+package handlers
+
+import (
+	"net/http/httptest"
+	"testing"
+)
+
+func TestCheckWSOrigin(t *testing.T) {
+	check := func(allowed []string, origin string) bool {
+		req := httptest.NewRequest("GET", "http://call.example.com/api/ws", nil)
+		if origin != "" {
+			req.Header.Set("Origin", origin)
+		}
+		return CheckWSOrigin(allowed)(req)
+	}
+
+	cases := []struct {
+		name    string
+		allowed []string
+		origin  string
+		want    bool
+	}{
+		{"listed origin", []string{"https://app.example.com/"}, "https://APP.example.com", true},
+		{"unlisted origin", []string{"https://app.example.com"}, "https://evil.example", false},
+		{"other scheme", []string{"https://app.example.com"}, "http://app.example.com", false},
+		{"wildcard", []string{"*"}, "https://evil.example", true},
+		{"same origin by default", nil, "http://call.example.com", true},
+		{"cross origin by default", nil, "https://evil.example", false},
+		{"no origin header", []string{"https://app.example.com"}, "", true},
+	}
+	for _, tc := range cases {
+		if got := check(tc.allowed, tc.origin); got != tc.want {
+			t.Fatalf("%s: got %v, want %v", tc.name, got, tc.want)
+		}
+	}
+}
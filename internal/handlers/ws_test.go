@@ -0,0 +1,449 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"log/slog"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+
+	"github.com/tariel-x/gocall/internal/config"
+	"github.com/tariel-x/gocall/internal/models"
+)
+
+func TestHeartbeatSendsCallExpired(t *testing.T) {
+	h := newTestHandlers(t, nil)
+	call, _ := h.calls.CreateCall(h.nowFn(), CreateCallOptions{})
+	client := newTestClient(call.ID, "host", PeerRoleV2Host)
+	h.wsHub.Add(client)
+
+	if _, err := h.calls.EndCall(call.ID, models.CallEndReasonLeft, h.nowFn()); err != nil {
+		t.Fatalf("end call failed: %v", err)
+	}
+
+	if h.checkHeartbeat(client) {
+		t.Fatalf("heartbeat should stop for an ended call")
+	}
+	msg := receive(t, client)
+	if msg == nil || msg.Type != "call-expired" {
+		t.Fatalf("expected call-expired, got %+v", msg)
+	}
+	if _, open := <-client.send; open {
+		t.Fatalf("expected send channel to be closed after call-expired")
+	}
+}
+
+func TestHeartbeatEndsAbandonedWaitingRoom(t *testing.T) {
+	h := newTestHandlers(t, &config.Config{WaitingIdleTimeout: 10 * time.Minute})
+	now := time.Unix(1_700_000_000, 0)
+	h.nowFn = func() time.Time { return now }
+
+	call, _ := h.calls.CreateCall(now, CreateCallOptions{})
+	hostID, _, _ := h.calls.EnsureHostPeerID(call.ID, now)
+	client := newTestClient(call.ID, hostID, PeerRoleV2Host)
+	client.touch(now)
+	h.wsHub.Add(client)
+
+	now = now.Add(9 * time.Minute)
+	if !h.checkHeartbeat(client) {
+		t.Fatalf("heartbeat stopped before the idle timeout")
+	}
+	if msg := receive(t, client); msg != nil {
+		t.Fatalf("heartbeat sent %+v although nothing changed", msg)
+	}
+
+	now = now.Add(2 * time.Minute)
+	if h.checkHeartbeat(client) {
+		t.Fatalf("heartbeat should stop for an abandoned waiting room")
+	}
+	msg := receive(t, client)
+	if msg == nil || msg.Type != "call-ended" {
+		t.Fatalf("expected call-ended, got %+v", msg)
+	}
+	var data wsCallEndedDataV2
+	if err := json.Unmarshal(msg.Data, &data); err != nil || data.Reason != "waiting-timeout" {
+		t.Fatalf("expected waiting-timeout reason, got %s", msg.Data)
+	}
+	if _, err := h.calls.GetByID(call.ID, now); !errors.Is(err, ErrCallEnded) {
+		t.Fatalf("expected call to be ended, got %v", err)
+	}
+}
+
+func TestHeartbeatKeepsActiveWaitingRoom(t *testing.T) {
+	h := newTestHandlers(t, &config.Config{WaitingIdleTimeout: 10 * time.Minute})
+	now := time.Unix(1_700_000_000, 0)
+	h.nowFn = func() time.Time { return now }
+
+	call, _ := h.calls.CreateCall(now, CreateCallOptions{})
+	hostID, _, _ := h.calls.EnsureHostPeerID(call.ID, now)
+	client := newTestClient(call.ID, hostID, PeerRoleV2Host)
+	client.touch(now)
+	h.wsHub.Add(client)
+
+	now = now.Add(8 * time.Minute)
+	client.touch(now)
+	now = now.Add(8 * time.Minute)
+	if !h.checkHeartbeat(client) {
+		t.Fatalf("heartbeat stopped although the host was active")
+	}
+}
+
+func TestValidatePeerResumesUnknownCall(t *testing.T) {
+	h := newTestHandlers(t, &config.Config{ResumeUnknownCalls: true})
+	now := h.nowFn()
+
+	role, call, reconnected, err := h.validatePeer("lost-call", "host-peer", resumeClaim{Role: PeerRoleV2Host}, now)
+	if err != nil {
+		t.Fatalf("host resume failed: %v", err)
+	}
+	if role != PeerRoleV2Host || !reconnected || call.Status != models.CallStatusV2Waiting || !call.Resumed {
+		t.Fatalf("unexpected host resume: role=%s reconnected=%v call=%+v", role, reconnected, call)
+	}
+
+	role, call, _, err = h.validatePeer("lost-call", "guest-peer", resumeClaim{Role: PeerRoleV2Guest}, now)
+	if err != nil {
+		t.Fatalf("guest resume failed: %v", err)
+	}
+	if role != PeerRoleV2Guest || call.Status != models.CallStatusV2Active {
+		t.Fatalf("unexpected guest resume: role=%s call=%+v", role, call)
+	}
+
+	// Both slots are taken; a third peer can't claim one.
+	if _, _, _, err := h.validatePeer("lost-call", "intruder", resumeClaim{Role: PeerRoleV2Guest}, now); !errors.Is(err, errInvalidPeerID) {
+		t.Fatalf("expected invalid peer for a taken slot, got %v", err)
+	}
+	// Resumed peers reconnect normally afterwards.
+	if role, _, _, err := h.validatePeer("lost-call", "host-peer", resumeClaim{}, now); err != nil || role != PeerRoleV2Host {
+		t.Fatalf("host reconnect after resume = %s, %v", role, err)
+	}
+}
+
+func TestValidatePeerResumeRules(t *testing.T) {
+	disabled := newTestHandlers(t, nil)
+	if _, _, _, err := disabled.validatePeer("lost-call", "host-peer", resumeClaim{Role: PeerRoleV2Host}, disabled.nowFn()); !errors.Is(err, ErrCallNotFound) {
+		t.Fatalf("expected ErrCallNotFound with resume disabled, got %v", err)
+	}
+
+	h := newTestHandlers(t, &config.Config{ResumeUnknownCalls: true})
+	now := h.nowFn()
+
+	if _, _, _, err := h.validatePeer("lost-call", "peer", resumeClaim{Role: "admin"}, now); !errors.Is(err, ErrCallNotFound) {
+		t.Fatalf("expected unknown role to be rejected, got %v", err)
+	}
+
+	// Calls the server created itself can't have slots claimed.
+	call, _ := h.calls.CreateCall(now, CreateCallOptions{})
+	if _, _, _, err := h.validatePeer(call.ID, "guest-peer", resumeClaim{Role: PeerRoleV2Guest}, now); !errors.Is(err, errInvalidPeerID) {
+		t.Fatalf("expected invalid peer for a live call, got %v", err)
+	}
+
+	// Ended calls stay ended.
+	if _, err := h.calls.EndCall(call.ID, models.CallEndReasonLeft, now); err != nil {
+		t.Fatalf("end call failed: %v", err)
+	}
+	if _, _, _, err := h.validatePeer(call.ID, "host-peer", resumeClaim{Role: PeerRoleV2Host}, now); !errors.Is(err, ErrCallEnded) {
+		t.Fatalf("expected ErrCallEnded, got %v", err)
+	}
+}
+
+func TestValidatePeerResumeCannotDowngradeCall(t *testing.T) {
+	h := newTestHandlers(t, &config.Config{ResumeUnknownCalls: true})
+	now := h.nowFn()
+
+	// A call that had a PIN or waiting room isn't rebuilt without them.
+	if _, _, _, err := h.validatePeer("protected-call", "host-peer", resumeClaim{Role: PeerRoleV2Host, Protected: true}, now); !errors.Is(err, ErrCallNotFound) {
+		t.Fatalf("expected ErrCallNotFound for a protected call, got %v", err)
+	}
+
+	// Relay-only sticks once any peer remembers it.
+	_, call, _, err := h.validatePeer("relay-call", "host-peer", resumeClaim{Role: PeerRoleV2Host, ICEPolicy: models.ICEPolicyRelay}, now)
+	if err != nil || call.ICEPolicy != models.ICEPolicyRelay {
+		t.Fatalf("host resume = %+v, %v; want relay policy", call, err)
+	}
+	_, call, _, err = h.validatePeer("relay-call", "guest-peer", resumeClaim{Role: PeerRoleV2Guest, ICEPolicy: models.ICEPolicyAll}, now)
+	if err != nil || call.ICEPolicy != models.ICEPolicyRelay {
+		t.Fatalf("guest resume = %+v, %v; want relay policy kept", call, err)
+	}
+
+	_, call, _, err = h.validatePeer("open-call", "host-peer", resumeClaim{Role: PeerRoleV2Host}, now)
+	if err != nil || call.ICEPolicy != models.ICEPolicyAll {
+		t.Fatalf("host resume = %+v, %v; want default policy", call, err)
+	}
+	_, call, _, err = h.validatePeer("open-call", "guest-peer", resumeClaim{Role: PeerRoleV2Guest, ICEPolicy: models.ICEPolicyRelay}, now)
+	if err != nil || call.ICEPolicy != models.ICEPolicyRelay {
+		t.Fatalf("guest resume = %+v, %v; want relay policy", call, err)
+	}
+}
+
+func TestCallChangePushesStateOnce(t *testing.T) {
+	redisStores, _ := newTestRedisStores(t, 1)
+	stores := map[string]Store{"memory": NewCallStore(), "redis": redisStores[0], "sqlite": newTestSQLiteStore(t, "", CallStoreOptions{})}
+
+	for name, store := range stores {
+		t.Run(name, func(t *testing.T) {
+			h := New(&config.Config{}, nil, store, NewWSHubV2(), websocket.Upgrader{}, slog.New(slog.NewTextHandler(io.Discard, nil)))
+			now := h.nowFn()
+			call, _ := store.CreateCall(now, CreateCallOptions{})
+			hostID, _, _ := store.EnsureHostPeerID(call.ID, now)
+			host := newTestClient(call.ID, hostID, PeerRoleV2Host)
+			h.wsHub.Add(host)
+
+			expectOneState := func(step string) wsStateDataV2 {
+				t.Helper()
+				msg := receive(t, host)
+				if msg == nil || msg.Type != "state" {
+					t.Fatalf("%s: expected state, got %+v", step, msg)
+				}
+				if extra := receive(t, host); extra != nil {
+					t.Fatalf("%s: expected a single push, also got %+v", step, extra)
+				}
+				var state wsStateDataV2
+				if err := json.Unmarshal(msg.Data, &state); err != nil {
+					t.Fatal(err)
+				}
+				return state
+			}
+
+			guestID, _, _ := store.Join(call.ID, now)
+			if state := expectOneState("join"); state.Participants.Count != 2 {
+				t.Fatalf("join: unexpected participants %+v", state.Participants)
+			}
+			store.MarkPeerDisconnected(call.ID, guestID, now)
+			if state := expectOneState("disconnect"); state.Participants.Count != 1 {
+				t.Fatalf("disconnect: unexpected participants %+v", state.Participants)
+			}
+
+			// Reads and changes nobody sees in the state push nothing.
+			_, _ = store.GetByID(call.ID, now)
+			_ = store.AppendChat(call.ID, models.ChatMessageV2{From: hostID, Text: "hi", At: now}, now)
+			if msg := receive(t, host); msg != nil {
+				t.Fatalf("unexpected push %+v", msg)
+			}
+		})
+	}
+}
+
+func TestStateMessageListsParticipants(t *testing.T) {
+	store := NewCallStore()
+	now := time.Unix(1_700_700_000, 0)
+	call, _ := store.CreateCall(now, CreateCallOptions{MaxParticipants: 3})
+	guestID, call, _ := store.Join(call.ID, now.Add(time.Second))
+	store.MarkPeerDisconnected(call.ID, guestID, now.Add(2*time.Second))
+	call, _ = store.GetByID(call.ID, now.Add(2*time.Second))
+
+	var envelope wsEnvelopeV2
+	if err := json.Unmarshal(stateMessage(call), &envelope); err != nil {
+		t.Fatal(err)
+	}
+	var state wsStateDataV2
+	if err := json.Unmarshal(envelope.Data, &state); err != nil {
+		t.Fatal(err)
+	}
+	want := []participantState{
+		{PeerID: call.HostPeerID, Role: PeerRoleV2Host, IsPresent: true},
+		{PeerID: guestID, Role: PeerRoleV2Guest, IsPresent: false},
+	}
+	if state.Participants.Count != 1 || !reflect.DeepEqual(state.Participants.List, want) {
+		t.Fatalf("unexpected participants %+v", state.Participants)
+	}
+}
+
+// dialTestCall creates a call on a live server and connects to it as host.
+func dialTestCall(t *testing.T, h *Handlers) *websocket.Conn {
+	t.Helper()
+	srv := httptest.NewServer(newTestRouter(h))
+	t.Cleanup(srv.Close)
+
+	call, err := h.calls.CreateCall(h.nowFn(), CreateCallOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	url := "ws" + strings.TrimPrefix(srv.URL, "http") + "/api/ws?call_id=" + call.ID
+	conn, _, err := websocket.DefaultDialer.Dial(url, nil)
+	if err != nil {
+		t.Fatalf("dial failed: %v", err)
+	}
+	t.Cleanup(func() { _ = conn.Close() })
+	return conn
+}
+
+// readUntilClosed drains conn and returns the close code it ended with.
+func readUntilClosed(t *testing.T, conn *websocket.Conn) int {
+	t.Helper()
+	_ = conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	for {
+		if _, _, err := conn.ReadMessage(); err != nil {
+			var closeErr *websocket.CloseError
+			if !errors.As(err, &closeErr) {
+				t.Fatalf("expected a close frame, got %v", err)
+			}
+			return closeErr.Code
+		}
+	}
+}
+
+func TestWSOversizedMessageClosesConnection(t *testing.T) {
+	h := newTestHandlers(t, &config.Config{WS: config.WSConfig{MaxMessageBytes: 1024}})
+	conn := dialTestCall(t, h)
+
+	sdp := strings.Repeat("a", 4096)
+	if err := conn.WriteJSON(wsEnvelopeV2{Type: "offer", Data: mustMarshal(sdp)}); err != nil {
+		t.Fatal(err)
+	}
+	if code := readUntilClosed(t, conn); code != websocket.CloseMessageTooBig {
+		t.Fatalf("close code = %d, want %d", code, websocket.CloseMessageTooBig)
+	}
+}
+
+func TestWSMessageFloodClosesConnection(t *testing.T) {
+	h := newTestHandlers(t, &config.Config{WS: config.WSConfig{MessageRate: 1, MessageBurst: 3}})
+	conn := dialTestCall(t, h)
+
+	for range 10 {
+		if err := conn.WriteJSON(wsEnvelopeV2{Type: "ice-candidate"}); err != nil {
+			break
+		}
+	}
+	if code := readUntilClosed(t, conn); code != websocket.ClosePolicyViolation {
+		t.Fatalf("close code = %d, want %d", code, websocket.ClosePolicyViolation)
+	}
+}
+
+func TestWSCompressionRoundTrip(t *testing.T) {
+	h := newTestHandlers(t, &config.Config{WS: config.WSConfig{Compression: true, CompressionLevel: 9}})
+	h.wsUpgrader.EnableCompression = true
+	srv := httptest.NewServer(newTestRouter(h))
+	t.Cleanup(srv.Close)
+
+	call, _ := h.calls.CreateCall(h.nowFn(), CreateCallOptions{})
+	hostID, _, _ := h.calls.EnsureHostPeerID(call.ID, h.nowFn())
+	guestID, _, _ := h.calls.Join(call.ID, h.nowFn())
+
+	dialer := websocket.Dialer{EnableCompression: true}
+	base := "ws" + strings.TrimPrefix(srv.URL, "http") + "/api/ws?call_id=" + call.ID + "&peer_id="
+	dial := func(peerID string) *websocket.Conn {
+		conn, resp, err := dialer.Dial(base+peerID, nil)
+		if err != nil {
+			t.Fatalf("dial failed: %v", err)
+		}
+		t.Cleanup(func() { _ = conn.Close() })
+		if ext := resp.Header.Get("Sec-Websocket-Extensions"); !strings.Contains(ext, "permessage-deflate") {
+			t.Fatalf("compression not negotiated, extensions %q", ext)
+		}
+		return conn
+	}
+	host := dial(hostID)
+	guest := dial(guestID)
+
+	sdp := strings.Repeat("a=candidate:1 1 udp 2122260223 192.0.2.1 54321 typ host\r\n", 2000)
+	if err := host.WriteJSON(wsEnvelopeV2{Type: "offer", Data: mustMarshal(sdp)}); err != nil {
+		t.Fatal(err)
+	}
+
+	_ = guest.SetReadDeadline(time.Now().Add(5 * time.Second))
+	for {
+		var msg wsEnvelopeV2
+		if err := guest.ReadJSON(&msg); err != nil {
+			t.Fatalf("read failed: %v", err)
+		}
+		if msg.Type != "offer" {
+			continue
+		}
+		var got string
+		if err := json.Unmarshal(msg.Data, &got); err != nil || got != sdp {
+			t.Fatalf("offer did not round-trip intact (%d bytes, err %v)", len(got), err)
+		}
+		return
+	}
+}
+
+func TestJoinAckIncludesICEConfig(t *testing.T) {
+	servers := []config.ICEServer{
+		{URLs: []string{"stun:stun.example.test:3478"}},
+		{URLs: []string{"turns:turn.example.test:443?transport=tcp"}, Username: "u", Credential: "p"},
+	}
+	h := newTestHandlers(t, &config.Config{ExternalICEServers: servers})
+	srv := httptest.NewServer(newTestRouter(h))
+	t.Cleanup(srv.Close)
+
+	call, _ := h.calls.CreateCall(h.nowFn(), CreateCallOptions{ICEPolicy: models.ICEPolicyRelay})
+	conn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(srv.URL, "http")+"/api/ws?call_id="+call.ID, nil)
+	if err != nil {
+		t.Fatalf("dial failed: %v", err)
+	}
+	t.Cleanup(func() { _ = conn.Close() })
+
+	var msg wsEnvelopeV2
+	_ = conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	if err := conn.ReadJSON(&msg); err != nil || msg.Type != "join" {
+		t.Fatalf("expected join, got %+v, %v", msg, err)
+	}
+	var join struct {
+		ICEServers         []config.ICEServer `json:"ice_servers"`
+		ICETransportPolicy models.ICEPolicy   `json:"ice_transport_policy"`
+	}
+	if err := json.Unmarshal(msg.Data, &join); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(join.ICEServers, servers) {
+		t.Fatalf("join ack ICE servers = %+v, want %+v", join.ICEServers, servers)
+	}
+	if join.ICETransportPolicy != models.ICEPolicyRelay {
+		t.Fatalf("join ack ICE transport policy = %q, want relay", join.ICETransportPolicy)
+	}
+}
+
+func TestWSReplacedConnectionKeepsPeerPresent(t *testing.T) {
+	h := newTestHandlers(t, nil)
+	srv := httptest.NewServer(newTestRouter(h))
+	t.Cleanup(srv.Close)
+
+	call, _ := h.calls.CreateCall(h.nowFn(), CreateCallOptions{})
+	base := "ws" + strings.TrimPrefix(srv.URL, "http") + "/api/ws?call_id=" + call.ID
+	dial := func(query string) (*websocket.Conn, wsJoinDataV2) {
+		t.Helper()
+		conn, _, err := websocket.DefaultDialer.Dial(base+query, nil)
+		if err != nil {
+			t.Fatalf("dial failed: %v", err)
+		}
+		t.Cleanup(func() { _ = conn.Close() })
+
+		var msg wsEnvelopeV2
+		_ = conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+		if err := conn.ReadJSON(&msg); err != nil || msg.Type != "join" {
+			t.Fatalf("expected join, got %+v, %v", msg, err)
+		}
+		var data wsJoinDataV2
+		if err := json.Unmarshal(msg.Data, &data); err != nil {
+			t.Fatal(err)
+		}
+		return conn, data
+	}
+
+	first, join := dial("")
+	dial("&reconnect_token=" + join.ReconnectToken)
+
+	// The server drops the first connection once the second one is in.
+	_ = first.SetReadDeadline(time.Now().Add(5 * time.Second))
+	for {
+		if _, _, err := first.ReadMessage(); err != nil {
+			break
+		}
+	}
+
+	// Its read loop winding down must not take the new connection with it.
+	for deadline := time.Now().Add(200 * time.Millisecond); time.Now().Before(deadline); time.Sleep(10 * time.Millisecond) {
+		if c, _ := h.calls.GetByID(call.ID, h.nowFn()); !c.Participants[join.PeerID].IsPresent {
+			t.Fatal("replaced connection marked the peer absent")
+		}
+		if n := h.wsHub.Connections(); n != 1 {
+			t.Fatalf("connections = %d, want 1", n)
+		}
+	}
+}
@@ -1,6 +1,9 @@
 package models
 
-import "time"
+import (
+	"sort"
+	"time"
+)
 
 // CallStatusV2 is the lifecycle state of a v2 call room.
 // Keep values stable because they are part of the public API.
@@ -12,32 +15,161 @@ const (
 	CallStatusV2Ended   CallStatusV2 = "ended"
 )
 
+// CallEndReason tells peers why a call ended.
+type CallEndReason string
+
+const (
+	CallEndReasonLeft       CallEndReason = "left"       // a guest ended it
+	CallEndReasonHostEnded  CallEndReason = "host_ended" // the host ended it
+	CallEndReasonExpired    CallEndReason = "expired"    // TTL or reconnect window ran out
+	CallEndReasonTerminated CallEndReason = "terminated" // an operator ended it
+)
+
+// ICEPolicy is the RTCPeerConnection iceTransportPolicy clients should use.
+type ICEPolicy string
+
+const (
+	ICEPolicyAll   ICEPolicy = "all"
+	ICEPolicyRelay ICEPolicy = "relay" // TURN only, hides peer IPs
+)
+
+// DefaultMaxParticipants is how many peers a call holds unless configured
+// otherwise.
+const DefaultMaxParticipants = 2
+
 type CallParticipantV2 struct {
-	PeerID         string    `json:"peer_id"`
-	JoinedAt       time.Time `json:"joined_at"`
-	LeftAt         time.Time `json:"left_at,omitempty"`
-	IsPresent      bool      `json:"is_present"`
-	DisconnectedAt time.Time `json:"disconnected_at,omitempty"`
-	ReconnectCount int       `json:"reconnect_count,omitempty"`
+	PeerID         string      `json:"peer_id"`
+	Name           string      `json:"name,omitempty"` // display name chosen by the client
+	JoinedAt       time.Time   `json:"joined_at"`
+	LeftAt         time.Time   `json:"left_at,omitempty"`
+	IsPresent      bool        `json:"is_present"`
+	DisconnectedAt time.Time   `json:"disconnected_at,omitempty"`
+	ReconnectCount int         `json:"reconnect_count,omitempty"`
+	Pending        bool        `json:"pending,omitempty"` // in the waiting room until the host admits it
+	Media          *MediaState `json:"media,omitempty"`   // last reported media state, nil = unknown
+	// ReconnectTokenHash is the SHA-256 of the peer's reconnect token; once
+	// set, the peer reconnects with the token instead of its peer_id.
+	ReconnectTokenHash []byte `json:"reconnect_token_hash,omitempty"`
+}
+
+// MediaState is whether a peer sends audio and video, as it last reported.
+type MediaState struct {
+	Audio bool `json:"audio"`
+	Video bool `json:"video"`
+}
+
+// ChatMessageV2 is a text message sent over the signaling socket.
+type ChatMessageV2 struct {
+	From     string    `json:"from"`
+	FromName string    `json:"from_name,omitempty"`
+	Text     string    `json:"text"`
+	At       time.Time `json:"at"`
 }
 
 type CallV2 struct {
-	ID        string            `json:"call_id"`
-	Status    CallStatusV2      `json:"status"`
-	CreatedAt time.Time         `json:"created_at"`
-	UpdatedAt time.Time         `json:"updated_at"`
-	ExpiresAt time.Time         `json:"expires_at"`
-	Host      CallParticipantV2 `json:"-"`
-	Guest     CallParticipantV2 `json:"-"`
+	ID              string        `json:"call_id"`
+	Status          CallStatusV2  `json:"status"`
+	Seq             uint64        `json:"seq"` // incremented on every state change
+	CreatedAt       time.Time     `json:"created_at"`
+	UpdatedAt       time.Time     `json:"updated_at"`
+	ExpiresAt       time.Time     `json:"expires_at"`
+	ICEPolicy       ICEPolicy     `json:"ice_policy"`
+	MaxParticipants int           `json:"max_participants,omitempty"` // 0 = DefaultMaxParticipants
+	Resumed         bool          `json:"resumed,omitempty"`          // rebuilt from client-provided state
+	CreatedBy       string        `json:"created_by,omitempty"`       // authenticated creator, empty for anonymous calls
+	PINHash         []byte        `json:"pin_hash,omitempty"`         // bcrypt hash of the join PIN, empty = no PIN
+	WaitingRoom     bool          `json:"waiting_room,omitempty"`     // guests wait for the host to admit them
+	EndReason       CallEndReason `json:"end_reason,omitempty"`       // set once the call has ended
+	// Chat holds the latest chat messages, replayed to reconnecting peers.
+	Chat []ChatMessageV2 `json:"chat,omitempty"`
+	// HostPeerID is the creator's peer; everyone else is a guest.
+	HostPeerID   string                       `json:"-"`
+	Participants map[string]CallParticipantV2 `json:"-"` // keyed by peer ID
 }
 
 func (c *CallV2) ParticipantsCount() int {
 	count := 0
-	if c.Host.IsPresent {
-		count++
-	}
-	if c.Guest.IsPresent {
-		count++
+	for _, p := range c.Participants {
+		if p.IsPresent {
+			count++
+		}
 	}
 	return count
 }
+
+// Clone returns a deep copy of the call, safe to read after the store that
+// owns c has changed it.
+func (c *CallV2) Clone() *CallV2 {
+	clone := *c
+	clone.PINHash = append([]byte(nil), c.PINHash...)
+	clone.Chat = append([]ChatMessageV2(nil), c.Chat...)
+	if c.Participants != nil {
+		clone.Participants = make(map[string]CallParticipantV2, len(c.Participants))
+		for id, p := range c.Participants {
+			if p.Media != nil {
+				media := *p.Media
+				p.Media = &media
+			}
+			p.ReconnectTokenHash = append([]byte(nil), p.ReconnectTokenHash...)
+			clone.Participants[id] = p
+		}
+	}
+	return &clone
+}
+
+// RequiresPIN reports whether joining needs the call PIN.
+func (c *CallV2) RequiresPIN() bool {
+	return len(c.PINHash) > 0
+}
+
+// Capacity is the number of peers the call can hold.
+func (c *CallV2) Capacity() int {
+	if c.MaxParticipants <= 0 {
+		return DefaultMaxParticipants
+	}
+	return c.MaxParticipants
+}
+
+// SortedParticipants returns the participants in join order.
+func (c *CallV2) SortedParticipants() []CallParticipantV2 {
+	list := make([]CallParticipantV2, 0, len(c.Participants))
+	for _, p := range c.Participants {
+		list = append(list, p)
+	}
+	sort.Slice(list, func(i, j int) bool {
+		if list[i].JoinedAt.Equal(list[j].JoinedAt) {
+			return list[i].PeerID < list[j].PeerID
+		}
+		return list[i].JoinedAt.Before(list[j].JoinedAt)
+	})
+	return list
+}
+
+// CallEventType identifies a call lifecycle event.
+type CallEventType string
+
+const (
+	CallEventCreated CallEventType = "created"
+	CallEventJoined  CallEventType = "joined"
+	CallEventEnded   CallEventType = "ended"
+)
+
+// CallEvent is a call lifecycle record used for usage analytics.
+type CallEvent struct {
+	Type     CallEventType `json:"type"`
+	CallID   string        `json:"call_id"`
+	At       time.Time     `json:"at"`
+	Duration time.Duration `json:"duration_ns,omitempty"` // set for ended events
+}
+
+// CallStatsSample is one client-reported connection quality sample.
+type CallStatsSample struct {
+	CallID      string
+	Role        string
+	At          time.Time
+	RTTMs       float64
+	JitterMs    float64
+	PacketLoss  float64 // fraction of packets lost, 0..1
+	BitrateKbps float64
+	Relayed     bool // media goes through TURN
+}
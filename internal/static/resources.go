@@ -19,6 +19,15 @@ const (
 	apiAddressPlaceholder = "window.API_ADDRESS=\"http://localhost:8080\""
 )
 
+// assetExtensions are file types that are never SPA routes. A missing asset
+// gets a real 404 instead of index.html, which the browser would otherwise try
+// to parse as a script or stylesheet.
+var assetExtensions = map[string]struct{}{
+	".js": {}, ".mjs": {}, ".css": {}, ".map": {}, ".wasm": {}, ".json": {},
+	".png": {}, ".jpg": {}, ".jpeg": {}, ".gif": {}, ".svg": {}, ".ico": {}, ".webp": {},
+	".woff": {}, ".woff2": {}, ".ttf": {},
+}
+
 //go:embed all:dist
 var distFiles embed.FS
 
@@ -37,7 +46,10 @@ func newUIHandler(cfg *config.Config) gin.HandlerFunc {
 			c.String(http.StatusServiceUnavailable, "new UI bundle is missing (run `npm run build` inside frontend/)")
 		}
 	}
+	return newUIHandlerFS(distFS, cfg)
+}
 
+func newUIHandlerFS(distFS fs.FS, cfg *config.Config) gin.HandlerFunc {
 	fileServer := http.FileServer(http.FS(distFS))
 
 	return func(c *gin.Context) {
@@ -67,6 +79,10 @@ func newUIHandler(cfg *config.Config) gin.HandlerFunc {
 
 		info, err := fs.Stat(distFS, requestPath)
 		if err != nil || info.IsDir() {
+			if isAssetPath(requestPath) {
+				c.Status(http.StatusNotFound)
+				return
+			}
 			serveNewUIIndex(c, distFS, cfg)
 			return
 		}
@@ -78,6 +94,11 @@ func newUIHandler(cfg *config.Config) gin.HandlerFunc {
 	}
 }
 
+func isAssetPath(requestPath string) bool {
+	_, ok := assetExtensions[strings.ToLower(pathpkg.Ext(requestPath))]
+	return ok
+}
+
 func serveNewUIIndex(c *gin.Context, distFS fs.FS, cfg *config.Config) {
 	indexFile, err := distFS.Open("index.html")
 	if err != nil {
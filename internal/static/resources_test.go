@@ -0,0 +1,56 @@
+package static
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"testing/fstest"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/tariel-x/gocall/internal/config"
+)
+
+func newTestUIRouter() *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	distFS := fstest.MapFS{
+		"index.html":       {Data: []byte("<html>index</html>")},
+		"assets/app.js":    {Data: []byte("console.log(1)")},
+		"assets/style.css": {Data: []byte("body{}")},
+	}
+	router := gin.New()
+	router.NoRoute(newUIHandlerFS(distFS, &config.Config{}))
+	return router
+}
+
+func TestUIFallback(t *testing.T) {
+	router := newTestUIRouter()
+
+	tests := []struct {
+		path      string
+		status    int
+		wantIndex bool
+	}{
+		{path: "/", status: http.StatusOK, wantIndex: true},
+		{path: "/call/abc123", status: http.StatusOK, wantIndex: true},
+		{path: "/join/abc123/", status: http.StatusOK, wantIndex: true},
+		{path: "/assets/app.js", status: http.StatusOK},
+		{path: "/assets/missing.js", status: http.StatusNotFound},
+		{path: "/assets/missing.css", status: http.StatusNotFound},
+		{path: "/assets/app.js.map", status: http.StatusNotFound},
+		{path: "/logo.PNG", status: http.StatusNotFound},
+		{path: "/api/unknown", status: http.StatusNotFound},
+	}
+
+	for _, tt := range tests {
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, tt.path, nil))
+		if rec.Code != tt.status {
+			t.Fatalf("%s: status = %d, want %d", tt.path, rec.Code, tt.status)
+		}
+		if gotIndex := strings.Contains(rec.Body.String(), "index"); gotIndex != tt.wantIndex {
+			t.Fatalf("%s: served index = %v, want %v", tt.path, gotIndex, tt.wantIndex)
+		}
+	}
+}
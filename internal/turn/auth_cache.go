@@ -0,0 +1,100 @@
+package turn
+
+import (
+	"net"
+	"sync"
+	"time"
+
+	"github.com/pion/turn/v3"
+)
+
+// Defaults for the auth key cache.
+const (
+	DefaultAuthCacheSize = 1024
+	DefaultAuthCacheTTL  = time.Minute
+)
+
+// authKeyCache remembers auth keys derived for recently seen usernames, so
+// the HMAC and MD5 work isn't redone on every request of an allocation.
+// Entries never outlive the credentials they belong to. The cache is tied to
+// one auth handler and thus one secret; a new secret gets a new cache.
+type authKeyCache struct {
+	mu      sync.Mutex
+	size    int
+	ttl     time.Duration
+	entries map[string]authCacheEntry
+}
+
+type authCacheEntry struct {
+	key       []byte
+	expiresAt time.Time
+}
+
+func newAuthKeyCache(size int, ttl time.Duration) *authKeyCache {
+	if ttl <= 0 {
+		ttl = DefaultAuthCacheTTL
+	}
+	return &authKeyCache{size: size, ttl: ttl, entries: make(map[string]authCacheEntry, size)}
+}
+
+func (c *authKeyCache) get(id string, now time.Time) ([]byte, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	entry, ok := c.entries[id]
+	if !ok {
+		return nil, false
+	}
+	if !now.Before(entry.expiresAt) {
+		delete(c.entries, id)
+		return nil, false
+	}
+	return entry.key, true
+}
+
+// put stores key until the cache TTL or the credential expiry, whichever
+// comes first. A full cache drops expired entries, then arbitrary ones.
+func (c *authKeyCache) put(id string, key []byte, credentialExpiry, now time.Time) {
+	expiresAt := now.Add(c.ttl)
+	if credentialExpiry.Before(expiresAt) {
+		expiresAt = credentialExpiry
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if _, exists := c.entries[id]; !exists && len(c.entries) >= c.size {
+		for other, entry := range c.entries {
+			if !now.Before(entry.expiresAt) {
+				delete(c.entries, other)
+			}
+		}
+		for other := range c.entries {
+			if len(c.entries) < c.size {
+				break
+			}
+			delete(c.entries, other)
+		}
+	}
+	c.entries[id] = authCacheEntry{key: key, expiresAt: expiresAt}
+}
+
+// cachedAuthHandler serves auth keys from cache, asking next on a miss.
+// Only accepted credentials are cached.
+func cachedAuthHandler(next turn.AuthHandler, cache *authKeyCache, now func() time.Time) turn.AuthHandler {
+	return func(username string, realm string, srcAddr net.Addr) ([]byte, bool) {
+		id := realm + "\x00" + username
+		t := now()
+		if key, ok := cache.get(id, t); ok {
+			return key, true
+		}
+		key, ok := next(username, realm, srcAddr)
+		if !ok {
+			return nil, false
+		}
+		if expiresAt, ok := usernameExpiry(username); ok {
+			cache.put(id, key, expiresAt, t)
+		}
+		return key, true
+	}
+}
@@ -0,0 +1,105 @@
+package turn
+
+import (
+	"bytes"
+	"fmt"
+	"net"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestCachedAuthHandler(t *testing.T) {
+	secret := []byte("shared-secret")
+	now := time.Unix(1_700_000_000, 0)
+	clock := func() time.Time { return now }
+
+	var calls atomic.Int32
+	uncached := ephemeralAuthHandler(secret, 0, clock)
+	counting := func(username, realm string, srcAddr net.Addr) ([]byte, bool) {
+		calls.Add(1)
+		return uncached(username, realm, srcAddr)
+	}
+	auth := cachedAuthHandler(counting, newAuthKeyCache(2, time.Minute), clock)
+
+	creds := ephemeralCredentials(secret, now.Add(90*time.Second))
+	want, _ := uncached(creds.Username, "realm", nil)
+	for range 3 {
+		if key, ok := auth(creds.Username, "realm", nil); !ok || !bytes.Equal(key, want) {
+			t.Fatalf("cached auth returned a different key")
+		}
+	}
+	if calls.Load() != 1 {
+		t.Fatalf("expected one derivation, got %d", calls.Load())
+	}
+
+	// Another realm derives a different key.
+	if key, _ := auth(creds.Username, "other", nil); bytes.Equal(key, want) {
+		t.Fatalf("key reused across realms")
+	}
+
+	// Entries are refreshed after the TTL and dropped at credential expiry.
+	now = now.Add(61 * time.Second)
+	auth(creds.Username, "realm", nil)
+	if calls.Load() != 3 {
+		t.Fatalf("expected a fresh derivation after the TTL, got %d calls", calls.Load())
+	}
+	now = now.Add(30 * time.Second)
+	if _, ok := auth(creds.Username, "realm", nil); ok {
+		t.Fatalf("expired credentials served from cache")
+	}
+
+	// Rejected usernames are never cached.
+	before := calls.Load()
+	auth("malformed", "realm", nil)
+	auth("malformed", "realm", nil)
+	if calls.Load() != before+2 {
+		t.Fatalf("rejected username was cached")
+	}
+}
+
+func TestAuthKeyCacheIsBounded(t *testing.T) {
+	cache := newAuthKeyCache(3, time.Minute)
+	now := time.Unix(1_700_000_000, 0)
+	for i := range 10 {
+		cache.put(fmt.Sprint(i), []byte{byte(i)}, now.Add(time.Hour), now)
+	}
+	if len(cache.entries) != 3 {
+		t.Fatalf("cache holds %d entries, want 3", len(cache.entries))
+	}
+	if key, ok := cache.get("9", now); !ok || key[0] != 9 {
+		t.Fatalf("latest entry missing")
+	}
+}
+
+func BenchmarkEphemeralAuth(b *testing.B) {
+	secret := []byte("shared-secret")
+	now := time.Now()
+	clock := func() time.Time { return now }
+
+	// A realistic working set: a few hundred live allocations refreshing
+	// their permissions and channels.
+	usernames := make([]string, 256)
+	for i := range usernames {
+		usernames[i] = ephemeralCredentials(secret, now.Add(time.Hour)).Username
+	}
+
+	handlers := map[string]func(string, string, net.Addr) ([]byte, bool){
+		"uncached": ephemeralAuthHandler(secret, 0, clock),
+		"cached":   cachedAuthHandler(ephemeralAuthHandler(secret, 0, clock), newAuthKeyCache(DefaultAuthCacheSize, DefaultAuthCacheTTL), clock),
+	}
+	for _, name := range []string{"uncached", "cached"} {
+		auth := handlers[name]
+		b.Run(name, func(b *testing.B) {
+			b.RunParallel(func(pb *testing.PB) {
+				i := 0
+				for pb.Next() {
+					if _, ok := auth(usernames[i%len(usernames)], "realm", nil); !ok {
+						b.Fatal("auth failed")
+					}
+					i++
+				}
+			})
+		})
+	}
+}
@@ -0,0 +1,61 @@
+package turn
+
+import (
+	"crypto/hmac"
+	"crypto/sha1"
+	"encoding/base64"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pion/turn/v3"
+)
+
+// GenerateEphemeralCredentials returns short-lived credentials following the
+// TURN REST API scheme: the username carries its expiry time and the password
+// is an HMAC of the username, so the server can verify it without state.
+func (ts *TURNServer) GenerateEphemeralCredentials(ttl time.Duration) Credentials {
+	return ephemeralCredentials(ts.secret, time.Now().Add(ttl))
+}
+
+func ephemeralCredentials(secret []byte, expiresAt time.Time) Credentials {
+	username := fmt.Sprintf("%d:%s", expiresAt.Unix(), generatePassword()[:8])
+	return Credentials{
+		Username: username,
+		Password: ephemeralPassword(secret, username),
+	}
+}
+
+func ephemeralPassword(secret []byte, username string) string {
+	mac := hmac.New(sha1.New, secret)
+	mac.Write([]byte(username))
+	return base64.StdEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// ephemeralAuthHandler accepts usernames of the form "<expiry-unix>:<random>"
+// that haven't been expired for longer than skew, deriving the password from
+// the shared secret.
+func ephemeralAuthHandler(secret []byte, skew time.Duration, now func() time.Time) turn.AuthHandler {
+	return func(username string, realm string, srcAddr net.Addr) ([]byte, bool) {
+		expiresAt, ok := usernameExpiry(username)
+		if !ok || now().Unix() > expiresAt.Add(skew).Unix() {
+			return nil, false
+		}
+		return turn.GenerateAuthKey(username, realm, ephemeralPassword(secret, username)), true
+	}
+}
+
+// usernameExpiry reads the expiry from an ephemeral username.
+func usernameExpiry(username string) (time.Time, bool) {
+	expiry, _, ok := strings.Cut(username, ":")
+	if !ok {
+		return time.Time{}, false
+	}
+	expiresAt, err := strconv.ParseInt(expiry, 10, 64)
+	if err != nil {
+		return time.Time{}, false
+	}
+	return time.Unix(expiresAt, 0), true
+}
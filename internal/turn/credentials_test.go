@@ -0,0 +1,67 @@
+package turn
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/pion/turn/v3"
+)
+
+func TestEphemeralCredentials(t *testing.T) {
+	secret := []byte("shared-secret")
+	now := time.Unix(1_700_000_000, 0)
+	auth := ephemeralAuthHandler(secret, 0, func() time.Time { return now })
+
+	creds := ephemeralCredentials(secret, now.Add(time.Hour))
+	key, ok := auth(creds.Username, "realm", nil)
+	if !ok {
+		t.Fatalf("valid credentials rejected")
+	}
+	if want := turn.GenerateAuthKey(creds.Username, "realm", creds.Password); !bytes.Equal(key, want) {
+		t.Fatalf("auth key does not match the issued password")
+	}
+	if wrong := turn.GenerateAuthKey(creds.Username, "realm", "guess"); bytes.Equal(key, wrong) {
+		t.Fatalf("auth key matches a wrong password")
+	}
+
+	other := ephemeralCredentials([]byte("other-secret"), now.Add(time.Hour))
+	if key, ok := auth(other.Username, "realm", nil); ok && bytes.Equal(key, turn.GenerateAuthKey(other.Username, "realm", other.Password)) {
+		t.Fatalf("credentials from another secret accepted")
+	}
+
+	expired := ephemeralCredentials(secret, now.Add(-time.Second))
+	if _, ok := auth(expired.Username, "realm", nil); ok {
+		t.Fatalf("expired credentials accepted")
+	}
+
+	for _, username := range []string{"familycall", "soon:abc", ""} {
+		if _, ok := auth(username, "realm", nil); ok {
+			t.Fatalf("malformed username %q accepted", username)
+		}
+	}
+}
+
+func TestEphemeralCredentialsClockSkew(t *testing.T) {
+	secret := []byte("shared-secret")
+	now := time.Unix(1_700_000_000, 0)
+	auth := ephemeralAuthHandler(secret, 30*time.Second, func() time.Time { return now })
+
+	atSkew := ephemeralCredentials(secret, now.Add(-30*time.Second))
+	if _, ok := auth(atSkew.Username, "realm", nil); !ok {
+		t.Fatalf("credentials expired by exactly the skew rejected")
+	}
+	beyond := ephemeralCredentials(secret, now.Add(-31*time.Second))
+	if _, ok := auth(beyond.Username, "realm", nil); ok {
+		t.Fatalf("credentials expired beyond the skew accepted")
+	}
+}
+
+func TestGenerateEphemeralCredentialsAreUnique(t *testing.T) {
+	ts := &TURNServer{secret: []byte("shared-secret")}
+	a := ts.GenerateEphemeralCredentials(time.Hour)
+	b := ts.GenerateEphemeralCredentials(time.Hour)
+	if a.Username == b.Username || a.Password == b.Password {
+		t.Fatalf("expected distinct credentials, got %+v and %+v", a, b)
+	}
+}
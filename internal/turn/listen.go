@@ -0,0 +1,38 @@
+package turn
+
+import (
+	"fmt"
+	"net"
+)
+
+// resolveListenIP turns Config.ListenAddress into the IPv4 address the TURN
+// listeners bind to: empty means all interfaces, otherwise an IPv4 address
+// or the name of an interface whose first IPv4 address is used.
+func resolveListenIP(spec string) (net.IP, error) {
+	if spec == "" {
+		return net.IPv4zero, nil
+	}
+	if ip := net.ParseIP(spec); ip != nil {
+		if ip4 := ip.To4(); ip4 != nil {
+			return ip4, nil
+		}
+		return nil, fmt.Errorf("TURN listen address %s is not IPv4", spec)
+	}
+
+	iface, err := net.InterfaceByName(spec)
+	if err != nil {
+		return nil, fmt.Errorf("TURN listen interface %q: %w", spec, err)
+	}
+	addrs, err := iface.Addrs()
+	if err != nil {
+		return nil, fmt.Errorf("TURN listen interface %q: %w", spec, err)
+	}
+	for _, addr := range addrs {
+		if ipNet, ok := addr.(*net.IPNet); ok {
+			if ip4 := ipNet.IP.To4(); ip4 != nil {
+				return ip4, nil
+			}
+		}
+	}
+	return nil, fmt.Errorf("TURN listen interface %q has no IPv4 address", spec)
+}
@@ -0,0 +1,107 @@
+package turn
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+const publicIPCacheFile = "public-ip.json"
+
+type publicIPCache struct {
+	IP         string    `json:"ip"`
+	DetectedAt time.Time `json:"detected_at"`
+}
+
+// resolvePublicIP returns the relay IP and where it came from ("config",
+// "cache" or "detected").
+func resolvePublicIP(cfg Config, logger *slog.Logger) (net.IP, string) {
+	return resolvePublicIPWithCache(cfg, filepath.Join(getKeysDirectory(), publicIPCacheFile), logger)
+}
+
+func resolvePublicIPWithCache(cfg Config, cachePath string, logger *slog.Logger) (net.IP, string) {
+	if cfg.PublicIP != nil {
+		return cfg.PublicIP, "config"
+	}
+	if cfg.PublicIPCacheTTL <= 0 {
+		return lookupPublicIP(logger, cfg.PublicIPTimeout, "tcp4"), "detected"
+	}
+
+	cachedIP := loadCachedPublicIP(cachePath, cfg.PublicIPCacheTTL, time.Now(), logger)
+
+	if cfg.TrustPublicIPCache && cachedIP != nil {
+		// Re-validate in the background. The running relay keeps the cached
+		// address; a changed IP only takes effect on the next start.
+		go func() {
+			ip := lookupPublicIP(logger, cfg.PublicIPTimeout, "tcp4")
+			if ip == nil {
+				return
+			}
+			if !ip.Equal(cachedIP) {
+				logger.Warn(fmt.Sprintf("Public IP changed from cached %s to %s, restart to apply", cachedIP, ip))
+			}
+			savePublicIPCache(cachePath, ip, time.Now(), logger)
+		}()
+		return cachedIP, "cache"
+	}
+
+	ip := lookupPublicIP(logger, cfg.PublicIPTimeout, "tcp4")
+	if ip == nil {
+		if cachedIP != nil {
+			return cachedIP, "cache"
+		}
+		return nil, ""
+	}
+	savePublicIPCache(cachePath, ip, time.Now(), logger)
+	return ip, "detected"
+}
+
+// resolvePublicIPv6 returns the IPv6 relay address and where it came from, or
+// nil when the host has no usable IPv6 address.
+func resolvePublicIPv6(cfg Config, logger *slog.Logger) (net.IP, string) {
+	if cfg.PublicIPv6 != nil {
+		return cfg.PublicIPv6, "config"
+	}
+	if ip := lookupPublicIP(logger, cfg.PublicIPTimeout, "tcp6"); ip != nil {
+		return ip, "detected"
+	}
+	if ip := getLocalIP(logger, "udp6"); ip != nil && ip.IsGlobalUnicast() {
+		return ip, "local"
+	}
+	return nil, ""
+}
+
+func loadCachedPublicIP(path string, ttl time.Duration, now time.Time, logger *slog.Logger) net.IP {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil
+	}
+
+	var cache publicIPCache
+	if err := json.Unmarshal(data, &cache); err != nil {
+		logger.Warn("Ignoring malformed public IP cache", "path", path, "error", err)
+		return nil
+	}
+	if now.Sub(cache.DetectedAt) > ttl {
+		return nil
+	}
+	return net.ParseIP(cache.IP)
+}
+
+func savePublicIPCache(path string, ip net.IP, now time.Time, logger *slog.Logger) {
+	data, err := json.Marshal(publicIPCache{IP: ip.String(), DetectedAt: now})
+	if err != nil {
+		return
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		logger.Warn("Failed to create public IP cache directory", "error", err)
+		return
+	}
+	if err := os.WriteFile(path, data, 0600); err != nil {
+		logger.Warn("Failed to write public IP cache", "error", err)
+	}
+}
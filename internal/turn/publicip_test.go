@@ -0,0 +1,159 @@
+package turn
+
+import (
+	"log/slog"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// stubLookup makes lookupPublicIP return ip (nil simulates a failed lookup)
+// and reports each call on the returned channel.
+func stubLookup(t *testing.T, ip net.IP) <-chan struct{} {
+	t.Helper()
+	called := make(chan struct{}, 4)
+	orig := lookupPublicIP
+	lookupPublicIP = func(*slog.Logger, time.Duration, string) net.IP {
+		called <- struct{}{}
+		return ip
+	}
+	t.Cleanup(func() { lookupPublicIP = orig })
+	return called
+}
+
+func writeCache(t *testing.T, path, ip string, detectedAt time.Time) {
+	t.Helper()
+	savePublicIPCache(path, net.ParseIP(ip), detectedAt, testLogger())
+	if _, err := os.Stat(path); err != nil {
+		t.Fatalf("cache not written: %v", err)
+	}
+}
+
+func TestResolvePublicIPSources(t *testing.T) {
+	cached := "198.51.100.7"
+	detected := "203.0.113.9"
+
+	tests := []struct {
+		name       string
+		cfg        Config
+		cacheAge   time.Duration // zero means no cache file
+		lookup     string        // empty simulates a failed lookup
+		wantIP     string
+		wantSource string
+		wantCache  string // cache contents afterwards, empty for no file
+	}{
+		{
+			name:       "configured",
+			cfg:        Config{PublicIP: net.ParseIP("192.0.2.1"), PublicIPCacheTTL: time.Hour},
+			cacheAge:   time.Minute,
+			lookup:     detected,
+			wantIP:     "192.0.2.1",
+			wantSource: "config",
+			wantCache:  cached,
+		},
+		{
+			name:       "cache disabled",
+			lookup:     detected,
+			wantIP:     detected,
+			wantSource: "detected",
+		},
+		{
+			name:       "fresh detection refreshes cache",
+			cfg:        Config{PublicIPCacheTTL: time.Hour},
+			cacheAge:   time.Minute,
+			lookup:     detected,
+			wantIP:     detected,
+			wantSource: "detected",
+			wantCache:  detected,
+		},
+		{
+			name:       "cache used when detection fails",
+			cfg:        Config{PublicIPCacheTTL: time.Hour},
+			cacheAge:   time.Minute,
+			wantIP:     cached,
+			wantSource: "cache",
+			wantCache:  cached,
+		},
+		{
+			name:      "expired cache ignored",
+			cfg:       Config{PublicIPCacheTTL: time.Hour},
+			cacheAge:  2 * time.Hour,
+			wantCache: cached,
+		},
+		{
+			name:       "first detection writes cache",
+			cfg:        Config{PublicIPCacheTTL: time.Hour},
+			lookup:     detected,
+			wantIP:     detected,
+			wantSource: "detected",
+			wantCache:  detected,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), publicIPCacheFile)
+			if tt.cacheAge > 0 {
+				writeCache(t, path, cached, time.Now().Add(-tt.cacheAge))
+			}
+			stubLookup(t, net.ParseIP(tt.lookup))
+
+			ip, source := resolvePublicIPWithCache(tt.cfg, path, testLogger())
+			if tt.wantIP == "" {
+				if ip != nil || source != "" {
+					t.Fatalf("got %v from %q, want no address", ip, source)
+				}
+			} else if !ip.Equal(net.ParseIP(tt.wantIP)) || source != tt.wantSource {
+				t.Fatalf("got %v from %q, want %s from %q", ip, source, tt.wantIP, tt.wantSource)
+			}
+
+			got := loadCachedPublicIP(path, 24*time.Hour, time.Now(), testLogger())
+			switch {
+			case tt.wantCache == "" && got != nil:
+				t.Fatalf("cache = %v, want none", got)
+			case tt.wantCache != "" && !got.Equal(net.ParseIP(tt.wantCache)):
+				t.Fatalf("cache = %v, want %s", got, tt.wantCache)
+			}
+		})
+	}
+}
+
+func TestResolvePublicIPTrustedCacheRevalidatesInBackground(t *testing.T) {
+	path := filepath.Join(t.TempDir(), publicIPCacheFile)
+	writeCache(t, path, "198.51.100.7", time.Now().Add(-time.Minute))
+	// A failed background lookup leaves the cache untouched, so nothing
+	// writes to the temp dir after the test returns.
+	called := stubLookup(t, nil)
+
+	ip, source := resolvePublicIPWithCache(Config{PublicIPCacheTTL: time.Hour, TrustPublicIPCache: true}, path, testLogger())
+	if !ip.Equal(net.ParseIP("198.51.100.7")) || source != "cache" {
+		t.Fatalf("got %v from %q, want the cached address", ip, source)
+	}
+	select {
+	case <-called:
+	case <-time.After(5 * time.Second):
+		t.Fatalf("cached address was not re-validated")
+	}
+}
+
+func TestLoadCachedPublicIPExpiry(t *testing.T) {
+	path := filepath.Join(t.TempDir(), publicIPCacheFile)
+	detectedAt := time.Unix(1_700_000_000, 0)
+	writeCache(t, path, "198.51.100.7", detectedAt)
+
+	if ip := loadCachedPublicIP(path, time.Hour, detectedAt.Add(time.Hour), testLogger()); ip == nil {
+		t.Fatalf("cache rejected at exactly its TTL")
+	}
+	if ip := loadCachedPublicIP(path, time.Hour, detectedAt.Add(time.Hour+time.Second), testLogger()); ip != nil {
+		t.Fatalf("expired cache returned %v", ip)
+	}
+
+	if err := os.WriteFile(path, []byte("{not json"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if ip := loadCachedPublicIP(path, time.Hour, detectedAt, testLogger()); ip != nil {
+		t.Fatalf("malformed cache returned %v", ip)
+	}
+}
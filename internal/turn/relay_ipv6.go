@@ -0,0 +1,38 @@
+package turn
+
+import (
+	"errors"
+	"fmt"
+	"net"
+)
+
+// ipv6RelayGenerator allocates relay sockets on [::]. pion/turn always asks
+// for "udp4" and RelayAddressGeneratorStatic can't format IPv6 listen
+// addresses, so this generator ignores the requested network.
+type ipv6RelayGenerator struct {
+	relayIP net.IP
+}
+
+func (g *ipv6RelayGenerator) Validate() error {
+	if g.relayIP == nil || g.relayIP.To4() != nil {
+		return fmt.Errorf("IPv6 relay address required, got %v", g.relayIP)
+	}
+	return nil
+}
+
+func (g *ipv6RelayGenerator) AllocatePacketConn(_ string, requestedPort int) (net.PacketConn, net.Addr, error) {
+	conn, err := net.ListenPacket("udp6", net.JoinHostPort("::", fmt.Sprint(requestedPort)))
+	if err != nil {
+		return nil, nil, err
+	}
+	local, ok := conn.LocalAddr().(*net.UDPAddr)
+	if !ok {
+		conn.Close()
+		return nil, nil, fmt.Errorf("unexpected relay address %v", conn.LocalAddr())
+	}
+	return conn, &net.UDPAddr{IP: g.relayIP, Port: local.Port}, nil
+}
+
+func (g *ipv6RelayGenerator) AllocateConn(string, int) (net.Conn, net.Addr, error) {
+	return nil, nil, errors.New("TCP relay allocations are not supported")
+}
@@ -0,0 +1,66 @@
+package turn
+
+import (
+	"net"
+	"testing"
+)
+
+func TestParseIPFamily(t *testing.T) {
+	cases := []struct {
+		in   string
+		ipv6 bool
+		want string // empty = rejected
+	}{
+		{"203.0.113.10", false, "203.0.113.10"},
+		{" 203.0.113.10\n", false, "203.0.113.10"},
+		{"203.0.113.10", true, ""},
+		{"::ffff:203.0.113.10", false, "203.0.113.10"},
+		{"::ffff:203.0.113.10", true, ""},
+		{"2001:db8::10", true, "2001:db8::10"},
+		{"2001:db8::10", false, ""},
+		{"[2001:db8::10]", true, ""},
+		{"not-an-ip", false, ""},
+		{"not-an-ip", true, ""},
+	}
+	for _, tc := range cases {
+		got := parseIPFamily(tc.in, tc.ipv6)
+		if tc.want == "" {
+			if got != nil {
+				t.Errorf("parseIPFamily(%q, ipv6=%v) = %v, want nil", tc.in, tc.ipv6, got)
+			}
+			continue
+		}
+		if got == nil || got.String() != tc.want {
+			t.Errorf("parseIPFamily(%q, ipv6=%v) = %v, want %s", tc.in, tc.ipv6, got, tc.want)
+		}
+	}
+}
+
+func TestIPv6RelayGenerator(t *testing.T) {
+	if err := (&ipv6RelayGenerator{relayIP: net.ParseIP("203.0.113.1")}).Validate(); err == nil {
+		t.Fatalf("expected IPv4 relay address to be rejected")
+	}
+
+	probe, err := net.ListenPacket("udp6", "[::1]:0")
+	if err != nil {
+		t.Skipf("IPv6 unavailable: %v", err)
+	}
+	probe.Close()
+
+	gen := &ipv6RelayGenerator{relayIP: net.ParseIP("2001:db8::1")}
+	if err := gen.Validate(); err != nil {
+		t.Fatalf("Validate: %v", err)
+	}
+	// pion/turn always requests udp4; the generator must still bind IPv6.
+	conn, addr, err := gen.AllocatePacketConn("udp4", 0)
+	if err != nil {
+		t.Fatalf("AllocatePacketConn: %v", err)
+	}
+	defer conn.Close()
+
+	relay := addr.(*net.UDPAddr)
+	local := conn.LocalAddr().(*net.UDPAddr)
+	if !relay.IP.Equal(gen.relayIP) || relay.Port != local.Port || local.IP.To4() != nil {
+		t.Fatalf("relay %v on local %v, want %s on an IPv6 socket", relay, local, gen.relayIP)
+	}
+}
@@ -0,0 +1,92 @@
+package turn
+
+import (
+	"net"
+	"sync"
+	"sync/atomic"
+
+	"github.com/pion/turn/v3"
+)
+
+// Stats is a snapshot of relay usage since the server started.
+type Stats struct {
+	ActiveAllocations int64  `json:"active_allocations"`
+	PeakAllocations   int64  `json:"peak_allocations"`
+	BytesRelayed      uint64 `json:"bytes_relayed"`
+}
+
+// relayStats counts allocations and relayed bytes; every field is atomic so
+// relay goroutines update it without locking.
+type relayStats struct {
+	active atomic.Int64
+	peak   atomic.Int64
+	bytes  atomic.Uint64
+}
+
+func (s *relayStats) snapshot() Stats {
+	return Stats{
+		ActiveAllocations: s.active.Load(),
+		PeakAllocations:   s.peak.Load(),
+		BytesRelayed:      s.bytes.Load(),
+	}
+}
+
+func (s *relayStats) allocated() {
+	active := s.active.Add(1)
+	for {
+		peak := s.peak.Load()
+		if active <= peak || s.peak.CompareAndSwap(peak, active) {
+			return
+		}
+	}
+}
+
+// Stats returns relay usage counters.
+func (ts *TURNServer) Stats() Stats {
+	return ts.stats.snapshot()
+}
+
+// countingRelayGenerator wraps the relay sockets pion/turn allocates so each
+// allocation and every byte relayed through it are counted.
+type countingRelayGenerator struct {
+	turn.RelayAddressGenerator
+	stats *relayStats
+}
+
+func (g *countingRelayGenerator) AllocatePacketConn(network string, requestedPort int) (net.PacketConn, net.Addr, error) {
+	conn, addr, err := g.RelayAddressGenerator.AllocatePacketConn(network, requestedPort)
+	if err != nil {
+		return nil, nil, err
+	}
+	g.stats.allocated()
+	return &countingPacketConn{PacketConn: conn, stats: g.stats}, addr, nil
+}
+
+// countingPacketConn is an allocation's relay socket. Both directions count:
+// peer data read here goes to the client and client data is written here.
+type countingPacketConn struct {
+	net.PacketConn
+	stats     *relayStats
+	closeOnce sync.Once
+}
+
+func (c *countingPacketConn) ReadFrom(p []byte) (int, net.Addr, error) {
+	n, addr, err := c.PacketConn.ReadFrom(p)
+	if n > 0 {
+		c.stats.bytes.Add(uint64(n))
+	}
+	return n, addr, err
+}
+
+func (c *countingPacketConn) WriteTo(p []byte, addr net.Addr) (int, error) {
+	n, err := c.PacketConn.WriteTo(p, addr)
+	if n > 0 {
+		c.stats.bytes.Add(uint64(n))
+	}
+	return n, err
+}
+
+func (c *countingPacketConn) Close() error {
+	c.closeOnce.Do(func() { c.stats.active.Add(-1) })
+	return c.PacketConn.Close()
+}
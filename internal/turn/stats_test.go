@@ -0,0 +1,70 @@
+package turn
+
+import (
+	"net"
+	"sync"
+	"testing"
+
+	"github.com/pion/turn/v3"
+)
+
+// fakePacketConn echoes a fixed payload on reads and accepts every write.
+type fakePacketConn struct {
+	net.PacketConn
+	payload []byte
+}
+
+func (c *fakePacketConn) ReadFrom(p []byte) (int, net.Addr, error) {
+	return copy(p, c.payload), &net.UDPAddr{IP: net.IPv4(192, 0, 2, 1), Port: 5000}, nil
+}
+
+func (c *fakePacketConn) WriteTo(p []byte, _ net.Addr) (int, error) { return len(p), nil }
+
+func (c *fakePacketConn) Close() error { return nil }
+
+type fakeRelayGenerator struct {
+	turn.RelayAddressGenerator
+}
+
+func (fakeRelayGenerator) AllocatePacketConn(string, int) (net.PacketConn, net.Addr, error) {
+	return &fakePacketConn{payload: make([]byte, 100)}, &net.UDPAddr{IP: net.IPv4(198, 51, 100, 1), Port: 50000}, nil
+}
+
+func TestRelayStatsCountAllocationsAndBytes(t *testing.T) {
+	stats := &relayStats{}
+	gen := &countingRelayGenerator{RelayAddressGenerator: fakeRelayGenerator{}, stats: stats}
+
+	first, _, err := gen.AllocatePacketConn("udp4", 0)
+	if err != nil {
+		t.Fatalf("allocate: %v", err)
+	}
+	second, _, _ := gen.AllocatePacketConn("udp4", 0)
+
+	buf := make([]byte, 1500)
+	var wg sync.WaitGroup
+	for range 10 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, _, _ = first.ReadFrom(buf[:0:0])
+			_, _, _ = second.ReadFrom(make([]byte, 1500))
+			_, _ = first.WriteTo(make([]byte, 40), nil)
+		}()
+	}
+	wg.Wait()
+
+	got := stats.snapshot()
+	if got.BytesRelayed != 10*(100+40) {
+		t.Fatalf("bytes relayed = %d, want %d", got.BytesRelayed, 10*(100+40))
+	}
+	if got.ActiveAllocations != 2 || got.PeakAllocations != 2 {
+		t.Fatalf("unexpected allocation counts %+v", got)
+	}
+
+	first.Close()
+	first.Close() // double close must not double count
+	got = stats.snapshot()
+	if got.ActiveAllocations != 1 || got.PeakAllocations != 2 {
+		t.Fatalf("after close: unexpected allocation counts %+v", got)
+	}
+}
@@ -1,7 +1,10 @@
 package turn
 
 import (
+	"context"
 	"crypto/rand"
+	"crypto/tls"
+	"errors"
 	"fmt"
 	"io"
 	"log/slog"
@@ -10,110 +13,247 @@ import (
 	"os"
 	"path/filepath"
 	"strings"
+	"sync/atomic"
 	"time"
 
 	"github.com/pion/turn/v3"
 )
 
 type TURNServer struct {
-	server   *turn.Server
-	username string
-	password string
+	server *turn.Server
+	secret []byte // shared secret for ephemeral credentials
+	stats  *relayStats
 
+	relayIPv4 net.IP
+	relayIPv6 net.IP // nil unless dual-stack
+
+	closed atomic.Bool
 	logger *slog.Logger
 }
 
+// Config describes how the TURN server listens and detects its relay address.
+type Config struct {
+	Port  int
+	Realm string
+	// ListenAddress binds the IPv4 listeners and relay sockets to one IPv4
+	// address or interface name instead of all interfaces.
+	ListenAddress string
+	// TCPEnabled adds a TCP listener on Port for clients whose networks
+	// block UDP.
+	TCPEnabled bool
+	// TLSPort enables a TURNS (TURN over TLS) listener when non-zero, for
+	// networks that only allow TLS egress. GetCertificate supplies its
+	// certificate.
+	TLSPort        int
+	GetCertificate func(*tls.ClientHelloInfo) (*tls.Certificate, error)
+
+	// PublicIP is the relay address to advertise. When set, no lookup is made.
+	PublicIP net.IP
+	// PublicIPTimeout bounds the ipify.org lookup (0 = 5s).
+	PublicIPTimeout time.Duration
+	// IPv6 adds [::] listeners relaying from PublicIPv6, or from a detected
+	// IPv6 address when that is unset.
+	IPv6       bool
+	PublicIPv6 net.IP
+	// PublicIPCacheTTL enables caching of the detected public IP in the keys
+	// directory. Zero disables the cache.
+	PublicIPCacheTTL time.Duration
+	// TrustPublicIPCache uses a fresh cached IP on boot and re-validates it in
+	// the background. Otherwise the cache is only a fallback for failed detection.
+	TrustPublicIPCache bool
+	// AuthCacheSize bounds the cache of derived auth keys (0 disables it);
+	// entries live for AuthCacheTTL (0 = DefaultAuthCacheTTL).
+	AuthCacheSize int
+	AuthCacheTTL  time.Duration
+	// ClockSkew accepts ephemeral credentials for this long past their expiry.
+	ClockSkew time.Duration
+}
+
 type Credentials struct {
 	Username string
 	Password string
 }
 
-func Initialize(port int, realm string, logger *slog.Logger) (*TURNServer, error) {
+func Initialize(cfg Config, logger *slog.Logger) (*TURNServer, error) {
+	port := cfg.Port
+
+	listenIP, err := resolveListenIP(cfg.ListenAddress)
+	if err != nil {
+		return nil, err
+	}
+	listenAddr := net.JoinHostPort(listenIP.String(), fmt.Sprint(port))
+
 	// Create UDP listener
-	udpListener, err := net.ListenPacket("udp4", fmt.Sprintf("0.0.0.0:%d", port))
+	udpListener, err := net.ListenPacket("udp4", listenAddr)
 	if err != nil {
-		return nil, fmt.Errorf("failed to create UDP listener: %w", err)
+		return nil, fmt.Errorf("failed to bind TURN UDP listener to %s: %w", listenAddr, err)
+	}
+	packetConnConfigs := []turn.PacketConnConfig{{PacketConn: udpListener}}
+	var listenerConfigs []turn.ListenerConfig
+	closeListeners := func() {
+		for _, pc := range packetConnConfigs {
+			pc.PacketConn.Close()
+		}
+		for _, lc := range listenerConfigs {
+			lc.Listener.Close()
+		}
 	}
 
-	// Load or generate credentials
-	creds := loadOrGenerateCredentials(logger)
+	// Load or generate the shared secret for ephemeral credentials
+	secret := loadOrGenerateSecret(logger)
 
 	// Get public IP address for relay
-	publicIP := getPublicIP(logger)
-	if publicIP == nil {
+	publicIP, source := resolvePublicIP(cfg, logger)
+	switch {
+	case publicIP != nil:
+	case !listenIP.IsUnspecified():
+		// Bound to one interface: relay from it rather than whichever
+		// one the default route picks.
+		publicIP, source = listenIP, "listen-address"
+	default:
 		logger.Info(fmt.Sprintf("Warning: Could not determine public IP, using local IP detection"))
-		publicIP = getLocalIP(logger)
+		publicIP = getLocalIP(logger, "udp4")
+		source = "local"
+	}
+	logger.Info(fmt.Sprintf("TURN server will use relay address: %s", publicIP.String()), "source", source)
+
+	stats := &relayStats{}
+	relayAddressGenerator := &countingRelayGenerator{
+		RelayAddressGenerator: &turn.RelayAddressGeneratorStatic{
+			RelayAddress: publicIP,          // Use public IP for relay
+			Address:      listenIP.String(), // Relay sockets bind where the listeners do
+		},
+		stats: stats,
+	}
+	packetConnConfigs[0].RelayAddressGenerator = relayAddressGenerator
+
+	if cfg.TCPEnabled {
+		tcpListener, err := net.Listen("tcp4", listenAddr)
+		if err != nil {
+			closeListeners()
+			return nil, fmt.Errorf("failed to bind TURN TCP listener to %s: %w", listenAddr, err)
+		}
+		listenerConfigs = append(listenerConfigs, turn.ListenerConfig{
+			Listener:              tcpListener,
+			RelayAddressGenerator: relayAddressGenerator,
+		})
+	}
+
+	if cfg.TLSPort > 0 {
+		tlsListener, err := listenTLS(cfg, listenIP)
+		if err != nil {
+			closeListeners()
+			return nil, err
+		}
+		listenerConfigs = append(listenerConfigs, turn.ListenerConfig{
+			Listener:              tlsListener,
+			RelayAddressGenerator: relayAddressGenerator,
+		})
+	}
+
+	// Dual-stack: IPv6 clients reach separate [::] listeners whose
+	// allocations relay from the IPv6 address.
+	var publicIPv6 net.IP
+	if cfg.IPv6 {
+		publicIPv6, source = resolvePublicIPv6(cfg, logger)
+		if publicIPv6 == nil {
+			logger.Warn("IPv6 enabled but no IPv6 relay address found, serving IPv4 only")
+		} else {
+			logger.Info(fmt.Sprintf("TURN server will use IPv6 relay address: %s", publicIPv6.String()), "source", source)
+
+			relayAddressGeneratorV6 := &countingRelayGenerator{
+				RelayAddressGenerator: &ipv6RelayGenerator{relayIP: publicIPv6},
+				stats:                 stats,
+			}
+			udp6Listener, err := net.ListenPacket("udp6", fmt.Sprintf("[::]:%d", port))
+			if err != nil {
+				closeListeners()
+				return nil, fmt.Errorf("failed to create UDP6 listener: %w", err)
+			}
+			packetConnConfigs = append(packetConnConfigs, turn.PacketConnConfig{
+				PacketConn:            udp6Listener,
+				RelayAddressGenerator: relayAddressGeneratorV6,
+			})
+
+			if cfg.TCPEnabled {
+				tcp6Listener, err := net.Listen("tcp6", fmt.Sprintf("[::]:%d", port))
+				if err != nil {
+					closeListeners()
+					return nil, fmt.Errorf("failed to create TCP6 listener: %w", err)
+				}
+				listenerConfigs = append(listenerConfigs, turn.ListenerConfig{
+					Listener:              tcp6Listener,
+					RelayAddressGenerator: relayAddressGeneratorV6,
+				})
+			}
+		}
+	}
+
+	authHandler := ephemeralAuthHandler(secret, cfg.ClockSkew, time.Now)
+	if cfg.AuthCacheSize > 0 {
+		authHandler = cachedAuthHandler(authHandler, newAuthKeyCache(cfg.AuthCacheSize, cfg.AuthCacheTTL), time.Now)
 	}
-	logger.Info(fmt.Sprintf("TURN server will use relay address: %s", publicIP.String()))
 
 	// Create TURN server
 	s, err := turn.NewServer(turn.ServerConfig{
-		Realm:       realm,
-		AuthHandler: simpleAuthHandler(creds.Username, creds.Password),
-		PacketConnConfigs: []turn.PacketConnConfig{
-			{
-				PacketConn: udpListener,
-				RelayAddressGenerator: &turn.RelayAddressGeneratorStatic{
-					RelayAddress: publicIP,  // Use public IP for relay
-					Address:      "0.0.0.0", // Listen on all interfaces
-				},
-			},
-		},
+		Realm:             cfg.Realm,
+		AuthHandler:       authHandler,
+		PacketConnConfigs: packetConnConfigs,
+		ListenerConfigs:   listenerConfigs,
 	})
 
 	if err != nil {
+		closeListeners()
 		return nil, fmt.Errorf("failed to create TURN server: %w", err)
 	}
 
-	logger.Info(fmt.Sprintf("TURN server initialized on port %d", port))
-	logger.Info(fmt.Sprintf("TURN credentials - Username: %s, Password: %s", creds.Username, creds.Password))
-
+	logger.Info(fmt.Sprintf("TURN server initialized on %s", listenAddr), "tcp", cfg.TCPEnabled, "tls_port", cfg.TLSPort, "ipv6", publicIPv6 != nil)
 	return &TURNServer{
-		server:   s,
-		username: creds.Username,
-		password: creds.Password,
+		server:    s,
+		secret:    secret,
+		stats:     stats,
+		relayIPv4: publicIP,
+		relayIPv6: publicIPv6,
 
 		logger: logger,
 	}, nil
 }
 
-func (ts *TURNServer) GetCredentials() Credentials {
-	return Credentials{
-		Username: ts.username,
-		Password: ts.password,
-	}
+// RelayIPs returns the advertised relay addresses; ipv6 is nil unless
+// dual-stack mode is active.
+func (ts *TURNServer) RelayIPs() (ipv4, ipv6 net.IP) {
+	return ts.relayIPv4, ts.relayIPv6
 }
 
-func loadOrGenerateCredentials(logger *slog.Logger) Credentials {
-	keysDir := getKeysDirectory()
-	usernameFile := filepath.Join(keysDir, "turn-username.key")
-	passwordFile := filepath.Join(keysDir, "turn-password.key")
-
-	// Try to load existing credentials
-	if usernameData, err := os.ReadFile(usernameFile); err == nil {
-		if passwordData, err := os.ReadFile(passwordFile); err == nil {
-			return Credentials{
-				Username: string(usernameData),
-				Password: string(passwordData),
-			}
-		}
+func listenTLS(cfg Config, listenIP net.IP) (net.Listener, error) {
+	if cfg.GetCertificate == nil {
+		return nil, fmt.Errorf("TURNS listener requires a certificate")
 	}
+	addr := net.JoinHostPort(listenIP.String(), fmt.Sprint(cfg.TLSPort))
+	listener, err := net.Listen("tcp4", addr)
+	if err != nil {
+		return nil, fmt.Errorf("failed to bind TURNS listener to %s: %w", addr, err)
+	}
+	return tls.NewListener(listener, &tls.Config{
+		GetCertificate: cfg.GetCertificate,
+		MinVersion:     tls.VersionTLS12,
+	}), nil
+}
 
-	// Generate new credentials
-	username := "familycall"
-	password := generatePassword()
+func loadOrGenerateSecret(logger *slog.Logger) []byte {
+	keysDir := getKeysDirectory()
+	secretFile := filepath.Join(keysDir, "turn-secret.key")
 
-	// Save credentials
-	if err := os.MkdirAll(keysDir, 0700); err == nil {
-		os.WriteFile(usernameFile, []byte(username), 0600)
-		os.WriteFile(passwordFile, []byte(password), 0600)
-		logger.Info(fmt.Sprintf("TURN credentials saved to: %s", keysDir))
+	if data, err := os.ReadFile(secretFile); err == nil && len(data) > 0 {
+		return data
 	}
 
-	return Credentials{
-		Username: username,
-		Password: password,
+	secret := []byte(generatePassword())
+	if err := os.MkdirAll(keysDir, 0700); err == nil {
+		os.WriteFile(secretFile, secret, 0600)
+		logger.Info(fmt.Sprintf("TURN secret saved to: %s", keysDir))
 	}
+	return secret
 }
 
 func getKeysDirectory() string {
@@ -125,20 +265,20 @@ func getKeysDirectory() string {
 	return filepath.Join(execDir, "keys")
 }
 
-func (ts *TURNServer) Close() error {
-	if ts.server != nil {
-		return ts.server.Close()
+// Check reports whether the server is still listening.
+func (ts *TURNServer) Check() error {
+	if ts.closed.Load() {
+		return errors.New("TURN server closed")
 	}
 	return nil
 }
 
-func simpleAuthHandler(expectedUsername, expectedPassword string) turn.AuthHandler {
-	return func(username string, realm string, srcAddr net.Addr) ([]byte, bool) {
-		if username == expectedUsername {
-			return turn.GenerateAuthKey(username, realm, expectedPassword), true
-		}
-		return nil, false
+func (ts *TURNServer) Close() error {
+	ts.closed.Store(true)
+	if ts.server != nil {
+		return ts.server.Close()
 	}
+	return nil
 }
 
 func generatePassword() string {
@@ -147,15 +287,34 @@ func generatePassword() string {
 	return fmt.Sprintf("%x", b)
 }
 
-// getPublicIP gets the public IP address from ipify.org
-func getPublicIP(logger *slog.Logger) net.IP {
+// lookupPublicIP detects the public IP; tests replace it to stay offline.
+var lookupPublicIP = getPublicIP
+
+// ipifyURLs are single-stack ipify endpoints per dial network.
+var ipifyURLs = map[string]string{
+	"tcp4": "https://api.ipify.org",
+	"tcp6": "https://api6.ipify.org",
+}
+
+// getPublicIP gets the public IP address of the given family ("tcp4" or
+// "tcp6") from ipify.org
+func getPublicIP(logger *slog.Logger, timeout time.Duration, network string) net.IP {
+	if timeout <= 0 {
+		timeout = 5 * time.Second
+	}
+	dialer := &net.Dialer{}
 	client := &http.Client{
-		Timeout: 5 * time.Second,
+		Timeout: timeout,
+		Transport: &http.Transport{
+			DialContext: func(ctx context.Context, _, addr string) (net.Conn, error) {
+				return dialer.DialContext(ctx, network, addr)
+			},
+		},
 	}
 
-	resp, err := client.Get("https://api.ipify.org")
+	resp, err := client.Get(ipifyURLs[network])
 	if err != nil {
-		logger.Error("Failed to get public IP from ipify.org", "error", err)
+		logger.Error("Failed to get public IP from ipify.org", "network", network, "error", err)
 		return nil
 	}
 	defer resp.Body.Close()
@@ -171,12 +330,9 @@ func getPublicIP(logger *slog.Logger) net.IP {
 		return nil
 	}
 
-	ipStr := string(body)
-	ipStr = strings.TrimSpace(ipStr)
-
-	ip := net.ParseIP(ipStr)
+	ip := parseIPFamily(string(body), network == "tcp6")
 	if ip == nil {
-		logger.Info(fmt.Sprintf("Invalid IP address from ipify.org: %s", ipStr))
+		logger.Info(fmt.Sprintf("Invalid IP address from ipify.org: %s", strings.TrimSpace(string(body))), "network", network)
 		return nil
 	}
 
@@ -184,12 +340,23 @@ func getPublicIP(logger *slog.Logger) net.IP {
 	return ip
 }
 
-// getLocalIP gets the local IP address for fallback
-func getLocalIP(logger *slog.Logger) net.IP {
+// localIPProbes are public addresses used to find the outbound interface.
+var localIPProbes = map[string]string{
+	"udp4": "8.8.8.8:80",
+	"udp6": "[2001:4860:4860::8888]:80",
+}
+
+// getLocalIP gets the local IP address of the given family ("udp4" or
+// "udp6") for fallback. Without a route, IPv4 falls back to loopback and
+// IPv6 returns nil.
+func getLocalIP(logger *slog.Logger, network string) net.IP {
 	// Try to connect to a remote address to determine local IP
-	conn, err := net.Dial("udp", "8.8.8.8:80")
+	conn, err := net.Dial(network, localIPProbes[network])
 	if err != nil {
-		logger.Error("Failed to determine local IP", "error", err)
+		logger.Error("Failed to determine local IP", "network", network, "error", err)
+		if network == "udp6" {
+			return nil
+		}
 		return net.ParseIP("127.0.0.1")
 	}
 	defer conn.Close()
@@ -198,3 +365,22 @@ func getLocalIP(logger *slog.Logger) net.IP {
 	logger.Info(fmt.Sprintf("Detected local IP: %s", localAddr.IP.String()))
 	return localAddr.IP
 }
+
+// parseIPFamily parses s as an IPv4 or IPv6 address and returns nil when it
+// is malformed or of the other family. IPv4-mapped IPv6 counts as IPv4.
+func parseIPFamily(s string, ipv6 bool) net.IP {
+	ip := net.ParseIP(strings.TrimSpace(s))
+	if ip == nil {
+		return nil
+	}
+	if ip4 := ip.To4(); ip4 != nil {
+		if ipv6 {
+			return nil
+		}
+		return ip4
+	}
+	if !ipv6 {
+		return nil
+	}
+	return ip
+}
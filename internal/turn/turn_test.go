@@ -0,0 +1,271 @@
+package turn
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"fmt"
+	"io"
+	"log/slog"
+	"math/big"
+	"net"
+	"strings"
+	"testing"
+	"time"
+)
+
+func testLogger() *slog.Logger {
+	return slog.New(slog.NewTextHandler(io.Discard, nil))
+}
+
+// stubPublicIP keeps Initialize offline.
+func stubPublicIP(t *testing.T) {
+	t.Helper()
+	orig := lookupPublicIP
+	lookupPublicIP = func(*slog.Logger, time.Duration, string) net.IP { return net.ParseIP("127.0.0.1") }
+	t.Cleanup(func() { lookupPublicIP = orig })
+}
+
+// freePort returns a port that is currently free for both TCP and UDP.
+func freePort(t *testing.T) int {
+	t.Helper()
+	for range 10 {
+		l, err := net.Listen("tcp4", "127.0.0.1:0")
+		if err != nil {
+			t.Fatalf("listen: %v", err)
+		}
+		port := l.Addr().(*net.TCPAddr).Port
+		l.Close()
+
+		if pc, err := net.ListenPacket("udp4", fmt.Sprintf("0.0.0.0:%d", port)); err == nil {
+			pc.Close()
+			return port
+		}
+	}
+	t.Fatalf("no free port found")
+	return 0
+}
+
+func TestInitializeOpensUDPAndTCPListeners(t *testing.T) {
+	stubPublicIP(t)
+	port := freePort(t)
+
+	server, err := Initialize(Config{Port: port, Realm: "test", TCPEnabled: true}, testLogger())
+	if err != nil {
+		t.Fatalf("Initialize: %v", err)
+	}
+
+	if pc, err := net.ListenPacket("udp4", fmt.Sprintf("0.0.0.0:%d", port)); err == nil {
+		pc.Close()
+		t.Fatalf("expected UDP port %d to be in use", port)
+	}
+	conn, err := net.Dial("tcp4", fmt.Sprintf("127.0.0.1:%d", port))
+	if err != nil {
+		t.Fatalf("expected TCP listener on port %d: %v", port, err)
+	}
+	conn.Close()
+
+	if err := server.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+
+	pc, err := net.ListenPacket("udp4", fmt.Sprintf("0.0.0.0:%d", port))
+	if err != nil {
+		t.Fatalf("UDP port still in use after Close: %v", err)
+	}
+	pc.Close()
+	l, err := net.Listen("tcp4", fmt.Sprintf("0.0.0.0:%d", port))
+	if err != nil {
+		t.Fatalf("TCP port still in use after Close: %v", err)
+	}
+	l.Close()
+}
+
+func TestInitializeWithoutTCP(t *testing.T) {
+	stubPublicIP(t)
+	port := freePort(t)
+
+	server, err := Initialize(Config{Port: port, Realm: "test"}, testLogger())
+	if err != nil {
+		t.Fatalf("Initialize: %v", err)
+	}
+	defer server.Close()
+
+	if conn, err := net.Dial("tcp4", fmt.Sprintf("127.0.0.1:%d", port)); err == nil {
+		conn.Close()
+		t.Fatalf("expected no TCP listener when TCP is disabled")
+	}
+}
+
+func testCertificate(t *testing.T) (tls.Certificate, *x509.CertPool) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("generate key: %v", err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "localhost"},
+		DNSNames:     []string{"localhost"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("create certificate: %v", err)
+	}
+	leaf, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatalf("parse certificate: %v", err)
+	}
+
+	pool := x509.NewCertPool()
+	pool.AddCert(leaf)
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key, Leaf: leaf}, pool
+}
+
+func TestInitializeOpensTLSListener(t *testing.T) {
+	stubPublicIP(t)
+	port := freePort(t)
+	tlsPort := freePort(t)
+	cert, roots := testCertificate(t)
+
+	server, err := Initialize(Config{
+		Port:    port,
+		Realm:   "test",
+		TLSPort: tlsPort,
+		GetCertificate: func(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+			return &cert, nil
+		},
+	}, testLogger())
+	if err != nil {
+		t.Fatalf("Initialize: %v", err)
+	}
+	defer server.Close()
+
+	conn, err := tls.DialWithDialer(&net.Dialer{Timeout: 2 * time.Second}, "tcp4", fmt.Sprintf("127.0.0.1:%d", tlsPort), &tls.Config{
+		ServerName: "localhost",
+		RootCAs:    roots,
+	})
+	if err != nil {
+		t.Fatalf("TLS handshake with TURNS listener failed: %v", err)
+	}
+	defer conn.Close()
+
+	if got := conn.ConnectionState().PeerCertificates[0]; !got.Equal(cert.Leaf) {
+		t.Fatalf("TURNS listener presented an unexpected certificate")
+	}
+}
+
+func TestInitializeTLSRequiresCertificate(t *testing.T) {
+	stubPublicIP(t)
+
+	if _, err := Initialize(Config{Port: freePort(t), Realm: "test", TLSPort: freePort(t)}, testLogger()); err == nil {
+		t.Fatalf("expected an error without a certificate")
+	}
+}
+
+func TestInitializeWithConfiguredPublicIP(t *testing.T) {
+	orig := lookupPublicIP
+	lookupPublicIP = func(*slog.Logger, time.Duration, string) net.IP {
+		t.Errorf("public IP lookup must be skipped when PublicIP is configured")
+		return nil
+	}
+	t.Cleanup(func() { lookupPublicIP = orig })
+
+	cfg := Config{Port: freePort(t), Realm: "test", PublicIP: net.ParseIP("203.0.113.10")}
+	if ip, source := resolvePublicIP(cfg, testLogger()); !ip.Equal(cfg.PublicIP) || source != "config" {
+		t.Fatalf("resolvePublicIP = %v (%s), want configured IP", ip, source)
+	}
+
+	server, err := Initialize(cfg, testLogger())
+	if err != nil {
+		t.Fatalf("Initialize: %v", err)
+	}
+	server.Close()
+}
+
+func TestInitializeDualStack(t *testing.T) {
+	stubPublicIP(t)
+	if probe, err := net.ListenPacket("udp6", "[::1]:0"); err != nil {
+		t.Skipf("IPv6 unavailable: %v", err)
+	} else {
+		probe.Close()
+	}
+	port := freePort(t)
+
+	server, err := Initialize(Config{Port: port, Realm: "test", IPv6: true, PublicIPv6: net.ParseIP("2001:db8::1")}, testLogger())
+	if err != nil {
+		t.Fatalf("Initialize: %v", err)
+	}
+	defer server.Close()
+
+	if v4, v6 := server.RelayIPs(); v4 == nil || !v6.Equal(net.ParseIP("2001:db8::1")) {
+		t.Fatalf("RelayIPs = %v, %v", v4, v6)
+	}
+	if pc, err := net.ListenPacket("udp6", fmt.Sprintf("[::]:%d", port)); err == nil {
+		pc.Close()
+		t.Fatalf("expected UDP6 port %d to be in use", port)
+	}
+}
+
+func TestResolveListenIP(t *testing.T) {
+	var loopback string
+	ifaces, _ := net.Interfaces()
+	for _, iface := range ifaces {
+		if iface.Flags&net.FlagLoopback != 0 {
+			loopback = iface.Name
+		}
+	}
+	if loopback == "" {
+		t.Skip("no loopback interface")
+	}
+
+	for spec, want := range map[string]string{
+		"":          "0.0.0.0",
+		"127.0.0.1": "127.0.0.1",
+		loopback:    "127.0.0.1",
+	} {
+		ip, err := resolveListenIP(spec)
+		if err != nil || ip.String() != want {
+			t.Fatalf("resolveListenIP(%q) = %v, %v; want %s", spec, ip, err, want)
+		}
+	}
+	for _, spec := range []string{"::1", "no-such-iface0"} {
+		if _, err := resolveListenIP(spec); err == nil {
+			t.Fatalf("resolveListenIP(%q) should fail", spec)
+		}
+	}
+}
+
+func TestInitializeBindsListenAddress(t *testing.T) {
+	orig := lookupPublicIP
+	lookupPublicIP = func(*slog.Logger, time.Duration, string) net.IP { return nil }
+	t.Cleanup(func() { lookupPublicIP = orig })
+	port := freePort(t)
+
+	server, err := Initialize(Config{Port: port, Realm: "test", TCPEnabled: true, ListenAddress: "127.0.0.1"}, testLogger())
+	if err != nil {
+		t.Fatalf("Initialize: %v", err)
+	}
+	defer server.Close()
+
+	if v4, _ := server.RelayIPs(); !v4.Equal(net.ParseIP("127.0.0.1")) {
+		t.Fatalf("relay address = %v, want the listen address", v4)
+	}
+	if conn, err := net.Dial("tcp4", fmt.Sprintf("127.0.0.1:%d", port)); err != nil {
+		t.Fatalf("expected TCP listener on 127.0.0.1:%d: %v", port, err)
+	} else {
+		conn.Close()
+	}
+
+	// The port is taken now, so a second server fails with the address.
+	if _, err := Initialize(Config{Port: port, Realm: "test", ListenAddress: "127.0.0.1"}, testLogger()); err == nil || !strings.Contains(err.Error(), fmt.Sprintf("127.0.0.1:%d", port)) {
+		t.Fatalf("expected a bind error naming the address, got %v", err)
+	}
+}